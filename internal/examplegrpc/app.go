@@ -13,22 +13,27 @@ const commandDesc = `Example of simple gRPC server`
 func NewApp(basename string) *app.App {
 	// 设置应用默认参数, 并绑定对应的标志
 	opts := options.NewOptions()
+	reloader := &ConfigReloader{}
 
 	// 初始化应用实例, 解析参数、绑定标志等
 	application := app.NewApp("example gRPC",
-		basename,                         // 应用名, 该名字将在未指定配置文件名时,作为默认配置文件名
-		app.WithOptions(opts),            // 设置应用参数
-		app.WithDescription(commandDesc), // 设置应用描述
-		app.WithDefaultValidArgs(),       // 设置应用命令检测参数. 默认是应用不能带有命令
-		app.WithRunFunc(run(opts)),       // 设置应用运行方法
+		basename,                             // 应用名, 该名字将在未指定配置文件名时,作为默认配置文件名
+		app.WithOptions(opts),                // 设置应用参数
+		app.WithDescription(commandDesc),     // 设置应用描述
+		app.WithDefaultValidArgs(),           // 设置应用命令检测参数. 默认是应用不能带有命令
+		app.WithRunFunc(run(opts, reloader)), // 设置应用运行方法
+		app.WithConfigWatch(),                // 配置文件变化时重新加载
 		// app.WithNoConfig(),               // 指明应用不需要配置文件
 	)
 
+	// 配置变化时应用到运行中的服务
+	reloader.Subscribe(application)
+
 	return application
 }
 
 // 应用运行逻辑.
-func run(opts *options.Options) app.RunFunc {
+func run(opts *options.Options, reloader *ConfigReloader) app.RunFunc {
 	return func(basename string) error {
 		log.Init(opts.Log)
 		defer log.Flush()
@@ -41,6 +46,6 @@ func run(opts *options.Options) app.RunFunc {
 		//	stopCh := genericserver.SetupSignalHandler()
 		stopCh := make(chan struct{})
 
-		return Run(cfg, stopCh)
+		return Run(cfg, reloader, stopCh)
 	}
 }
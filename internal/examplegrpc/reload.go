@@ -0,0 +1,83 @@
+package examplegrpc
+
+import (
+	"sync"
+
+	"github.com/wangweihong/eazycloud/internal/examplegrpc/options"
+	"github.com/wangweihong/eazycloud/pkg/app"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
+)
+
+// reloadableKeys are config keys applied to the running server, changes of other keys such as
+// interceptors, TLS and listeners take effect after restart.
+var reloadableKeys = []string{
+	"log.level", "log.format", "log.enable-color", "log.output-paths",
+	"server.maintenance-mode", "server.maintenance-retry-after", "server.max-in-flight",
+}
+
+// ConfigReloader applies changes of reloaded config to the running server.
+type ConfigReloader struct {
+	lock   sync.RWMutex
+	server *server
+}
+
+// Subscribe subscribes config changes of application.
+func (r *ConfigReloader) Subscribe(application *app.App) {
+	// 日志级别和格式变化时替换日志输出
+	application.OnTypedConfigChange(func(oldOpts, newOpts *options.Options, e app.ConfigChangeEvent) error {
+		log.Reload(newOpts.Log)
+		return nil
+	}, "log")
+
+	application.OnTypedConfigChange(r.applyMaintenance,
+		"server.maintenance-mode", "server.maintenance-retry-after", "server.max-in-flight")
+	application.OnTypedConfigChange(warnRestartRequired)
+}
+
+func (r *ConfigReloader) setServer(s *server) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.server = s
+}
+
+func (r *ConfigReloader) getServer() *server {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.server
+}
+
+// applyMaintenance changes maintenance state configured, reason is kept.
+func (r *ConfigReloader) applyMaintenance(oldOpts, newOpts *options.Options, e app.ConfigChangeEvent) error {
+	s := r.getServer()
+	if s == nil || s.grpcServer.Maintenance == nil {
+		return nil
+	}
+
+	state := newOpts.ServerRunOptions.MaintenanceState()
+	_, err := s.grpcServer.Maintenance.Update(maintenance.StateUpdate{
+		Mode:        &state.Mode,
+		RetryAfter:  &state.RetryAfter,
+		MaxInFlight: &state.MaxInFlight,
+	})
+	return err
+}
+
+// warnRestartRequired logs changed keys not applied to the running server.
+func warnRestartRequired(oldOpts, newOpts *options.Options, e app.ConfigChangeEvent) error {
+	for _, c := range e.Changes {
+		if !matchAny(c, reloadableKeys) {
+			log.Warnf("config %s changed, restart to take effect", c.Key)
+		}
+	}
+	return nil
+}
+
+func matchAny(c app.ConfigChange, keys []string) bool {
+	for _, k := range keys {
+		if c.Match(k) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,12 +2,13 @@ package example_server
 
 import "github.com/wangweihong/eazycloud/internal/exampleserver/config"
 
-// Run runs the specified server.
-func Run(cfg *config.Config, stopCh <-chan struct{}) error {
+// Run runs the specified server, reloader applies config changes to it.
+func Run(cfg *config.Config, reloader *ConfigReloader, stopCh <-chan struct{}) error {
 	server, err := createServer(cfg)
 	if err != nil {
 		return err
 	}
+	reloader.setServer(server)
 
 	return server.PrepareRun().Run(stopCh)
 }
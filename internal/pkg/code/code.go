@@ -42,8 +42,8 @@ func (coder ErrCode) HTTPStatus() int {
 }
 
 func register(code int, httpStatus int, message map[string]string) {
-	if !sets.NewInt(200, 400, 401, 403, 404, 500).Has(httpStatus) {
-		panic("http code not in `200, 400, 401, 403, 404, 500`")
+	if !sets.NewInt(200, 400, 401, 403, 404, 409, 410, 412, 413, 500, 503).Has(httpStatus) {
+		panic("http code not in `200, 400, 401, 403, 404, 409, 410, 412, 413, 500, 503`")
 	}
 
 	coder := &ErrCode{
@@ -3,6 +3,7 @@ package app
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/wangweihong/eazycloud/pkg/errors"
 
@@ -82,6 +83,15 @@ type App struct {
 	// git: APPNAME, clone: COMMAND, URL: ARG, bare: FLAG
 	args cobra.PositionalArgs
 	cmd  *cobra.Command
+
+	// reload config when config file changes
+	configWatch bool
+	// reloadLock serializes reloading, optionsLock protects fields below
+	reloadLock  sync.Mutex
+	optionsLock sync.Mutex
+	// settings of config applied, used to diff changed keys
+	settings    map[string]interface{}
+	subscribers []configSubscriber
 }
 
 // Option defines optional parameters for initializing the application
@@ -316,6 +326,15 @@ func (a *App) runCommand(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// 监听配置文件变化, 校验通过后通知订阅者
+	if a.configWatch && !a.noConfig && a.options != nil {
+		stop, err := a.watchConfig()
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
 	// 运行应用真正的执行逻辑
 	if a.runFunc != nil {
 		return a.runFunc(a.basename)
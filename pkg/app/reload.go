@@ -0,0 +1,317 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/json"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// editors may write config file several times in one save.
+const reloadDebounce = 200 * time.Millisecond
+
+// ConfigChange is a changed config key.
+type ConfigChange struct {
+	// Key is the full key, such as `log.level`.
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+// Match reports whether the changed key is key or under it, such as `log` matches `log.level`.
+func (c ConfigChange) Match(key string) bool {
+	return matchConfigKey(key, c.Key)
+}
+
+// ConfigChangeEvent is dispatched to subscribers after config file reloaded and validated.
+// Old and New are options of the same type as passed by WithOptions, use OnTypedConfigChange
+// to receive them typed.
+type ConfigChangeEvent struct {
+	Old     CliOptions
+	New     CliOptions
+	Changes []ConfigChange
+}
+
+// Changed reports whether key or any key under it changed, such as `log` matches `log.level`.
+func (e ConfigChangeEvent) Changed(key string) bool {
+	for _, c := range e.Changes {
+		if c.Match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigChangeFunc applies changed options to running components.
+// Error is only logged, since the new options have been accepted.
+type ConfigChangeFunc func(event ConfigChangeEvent) error
+
+type configSubscriber struct {
+	keys []string
+	fn   ConfigChangeFunc
+}
+
+// WithConfigWatch reloads config file when it changes, see App.ReloadConfig.
+func WithConfigWatch() Option {
+	return func(a *App) {
+		a.configWatch = true
+	}
+}
+
+// OnConfigChange subscribes changes of keys, such as `log` or `server.middlewares`.
+// fn is called only if any key or key under it changed, empty keys subscribes all changes.
+// Subscribers are called in order of subscription.
+func (a *App) OnConfigChange(fn ConfigChangeFunc, keys ...string) {
+	a.optionsLock.Lock()
+	defer a.optionsLock.Unlock()
+	a.subscribers = append(a.subscribers, configSubscriber{keys: keys, fn: fn})
+}
+
+// OnTypedConfigChange is OnConfigChange with options of event asserted to the type passed by WithOptions.
+// fn must be `func(oldOpts, newOpts *Options, event ConfigChangeEvent) error`, otherwise it panics.
+func (a *App) OnTypedConfigChange(fn interface{}, keys ...string) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 3 || t.NumOut() != 1 || t.In(0) != t.In(1) ||
+		t.In(2) != reflect.TypeOf(ConfigChangeEvent{}) || t.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		panic(fmt.Sprintf("invalid config change func %s", t))
+	}
+	if opts := a.Options(); opts != nil && reflect.TypeOf(opts) != t.In(0) {
+		panic(fmt.Sprintf("config change func %s does not match options %T", t, opts))
+	}
+
+	a.OnConfigChange(func(e ConfigChangeEvent) error {
+		if reflect.TypeOf(e.Old) != t.In(0) || reflect.TypeOf(e.New) != t.In(0) {
+			return fmt.Errorf("unexpected options type %T", e.New)
+		}
+		out := v.Call([]reflect.Value{reflect.ValueOf(e.Old), reflect.ValueOf(e.New), reflect.ValueOf(e)})
+		err, _ := out[0].Interface().(error)
+		return err
+	}, keys...)
+}
+
+// Options returns the options currently in effect.
+func (a *App) Options() CliOptions {
+	a.optionsLock.Lock()
+	defer a.optionsLock.Unlock()
+	return a.options
+}
+
+// ReloadConfig reads config file again into a fresh copy of options, then completes and validates it.
+// Invalid config is rejected and running options are untouched, otherwise changed keys are logged
+// and dispatched to subscribers. Command line flags still take precedence over config file.
+func (a *App) ReloadConfig() error {
+	a.reloadLock.Lock()
+	defer a.reloadLock.Unlock()
+
+	file := viper.ConfigFileUsed()
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+	v.AutomaticEnv()
+	v.SetEnvPrefix(strings.Replace(strings.ToUpper(a.basename), "-", "_", -1))
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	if err := v.BindPFlags(a.cmd.Flags()); err != nil {
+		return err
+	}
+	if err := v.ReadInConfig(); err != nil {
+		log.Errorf("reload config %s fail, keep running config:%v", file, err)
+		return fmt.Errorf("failed to read configuration file(%s): %w", file, err)
+	}
+
+	fresh, err := copyOptions(a.Options())
+	if err != nil {
+		return err
+	}
+	if err := v.Unmarshal(fresh); err != nil {
+		log.Errorf("reload config %s fail, keep running config:%v", file, err)
+		return fmt.Errorf("unmarshal config to options fail:%w", err)
+	}
+	if completableOptions, ok := fresh.(CompleteableOptions); ok {
+		if err := completableOptions.Complete(); err != nil {
+			log.Errorf("reload config %s rejected, keep running config:%v", file, err)
+			return err
+		}
+	}
+	if errs := fresh.Validate(); len(errs) != 0 {
+		err := errors.NewAggregate(errs...)
+		log.Errorf("reload config %s rejected, keep running config:%v", file, err)
+		return err
+	}
+
+	a.optionsLock.Lock()
+	settings := configSettings(v)
+	changes := diffSettings(a.settings, settings)
+	event := ConfigChangeEvent{Old: a.options, New: fresh, Changes: changes}
+	subscribers := a.subscribers
+	if len(changes) > 0 {
+		a.options = fresh
+		a.settings = settings
+	}
+	a.optionsLock.Unlock()
+
+	if len(changes) == 0 {
+		log.Infof("config %s reloaded, nothing changed", file)
+		return nil
+	}
+
+	log.Infof("%v config %s reloaded, %d keys changed:", progressMessage, file, len(changes))
+	for _, c := range changes {
+		log.Infof("  %s: %v -> %v", c.Key, maskConfigValue(c.Key, c.Old), maskConfigValue(c.Key, c.New))
+	}
+
+	for _, s := range subscribers {
+		if !subscribed(s.keys, event) {
+			continue
+		}
+		if err := s.fn(event); err != nil {
+			log.Errorf("apply config change fail:%v", err)
+		}
+	}
+	return nil
+}
+
+// watchConfig reloads config when config file changes, stop stops watching.
+// Directory of file is watched since editors may replace file by rename.
+func (a *App) watchConfig() (stop func(), err error) {
+	file, err := filepath.Abs(viper.ConfigFileUsed())
+	if err != nil {
+		return nil, err
+	}
+
+	a.optionsLock.Lock()
+	a.settings = configSettings(viper.GetViper())
+	a.optionsLock.Unlock()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var timer *time.Timer
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name, _ := filepath.Abs(event.Name)
+				if name != file || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDebounce, func() { _ = a.ReloadConfig() })
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("watch config %s error:%v", file, err)
+			}
+		}
+	}()
+
+	log.Infof("%v Watching config file: `%s`", progressMessage, file)
+	return func() {
+		_ = watcher.Close()
+		<-done
+	}, nil
+}
+
+// copyOptions deep copies options through json, so fields not in config keep their values.
+func copyOptions(opts CliOptions) (CliOptions, error) {
+	t := reflect.TypeOf(opts)
+	if t.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("options must be a pointer, got %s", t)
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("copy options fail:%w", err)
+	}
+	fresh, ok := reflect.New(t.Elem()).Interface().(CliOptions)
+	if !ok {
+		return nil, fmt.Errorf("options %s is not CliOptions", t)
+	}
+	if err := json.Unmarshal(data, fresh); err != nil {
+		return nil, fmt.Errorf("copy options fail:%w", err)
+	}
+	return fresh, nil
+}
+
+func configSettings(v *viper.Viper) map[string]interface{} {
+	settings := make(map[string]interface{})
+	for _, k := range v.AllKeys() {
+		settings[k] = v.Get(k)
+	}
+	return settings
+}
+
+func diffSettings(old, new map[string]interface{}) []ConfigChange {
+	var changes []ConfigChange
+	for k, nv := range new {
+		if ov, ok := old[k]; !ok || !reflect.DeepEqual(ov, nv) {
+			changes = append(changes, ConfigChange{Key: k, Old: ov, New: nv})
+		}
+	}
+	for k, ov := range old {
+		if _, ok := new[k]; !ok {
+			changes = append(changes, ConfigChange{Key: k, Old: ov})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+func subscribed(keys []string, event ConfigChangeEvent) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	for _, k := range keys {
+		if event.Changed(k) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchConfigKey(pattern, key string) bool {
+	pattern = strings.ToLower(pattern)
+	return key == pattern || strings.HasPrefix(key, pattern+".")
+}
+
+// maskConfigValue hides values of secret keys in logs.
+func maskConfigValue(key string, value interface{}) interface{} {
+	if value == nil {
+		return value
+	}
+	k := key[strings.LastIndex(key, ".")+1:]
+	for _, s := range []string{"password", "secret", "token", "key", "cert"} {
+		if strings.Contains(k, s) {
+			return "******"
+		}
+	}
+	return value
+}
@@ -0,0 +1,99 @@
+package app_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/app"
+	cliflag "github.com/wangweihong/eazycloud/pkg/cli/flag"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+type reloadOptions struct {
+	Log *log.Options `json:"log" mapstructure:"log"`
+}
+
+func (o *reloadOptions) Flags() (fss cliflag.NamedFlagSets) {
+	o.Log.AddFlags(fss.FlagSet("logs"))
+	return fss
+}
+
+func (o *reloadOptions) Validate() []error {
+	return o.Log.Validate()
+}
+
+func TestApp_ReloadConfig(t *testing.T) {
+	Convey("配置热加载", t, func() {
+		file := filepath.Join(t.TempDir(), "reload-test.yaml")
+		write := func(content string) {
+			So(ioutil.WriteFile(file, []byte(content), 0o600), ShouldBeNil)
+		}
+		write("log:\n  level: info\n  format: console\n")
+
+		opts := &reloadOptions{Log: log.NewOptions()}
+		events := make(chan app.ConfigChangeEvent, 10)
+		levels := make(chan string, 10)
+		var application *app.App
+		application = app.NewApp("reload test", "reload-test",
+			app.WithOptions(opts),
+			app.WithSilence(),
+			app.WithNoVersion(),
+			app.WithConfigWatch(),
+			app.WithRunFunc(func(basename string) error {
+				So(opts.Log.Level, ShouldEqual, "info")
+
+				// 非法配置被拒绝, 运行配置保持不变
+				write("log:\n  level: unknown\n  format: console\n")
+				So(application.ReloadConfig(), ShouldNotBeNil)
+				So(application.Options(), ShouldEqual, opts)
+
+				// 未订阅的键变化不通知
+				write("log:\n  level: info\n  format: json\n")
+				So(application.ReloadConfig(), ShouldBeNil)
+				So(application.Options().(*reloadOptions).Log.Format, ShouldEqual, "json")
+				So(opts.Log.Format, ShouldEqual, "console")
+
+				// 监听到文件变化后自动重新加载
+				write("log:\n  level: debug\n  format: json\n")
+				select {
+				case e := <-events:
+					So(e.Changed("log"), ShouldBeTrue)
+					So(e.Changes[0].Match("log"), ShouldBeTrue)
+					So(e.Changes[0].Match("lo"), ShouldBeFalse)
+					So(e.Changes, ShouldHaveLength, 1)
+					So(e.Changes[0], ShouldResemble, app.ConfigChange{Key: "log.level", Old: "info", New: "debug"})
+					So(e.Old.(*reloadOptions).Log.Level, ShouldEqual, "info")
+					So(e.New.(*reloadOptions).Log.Level, ShouldEqual, "debug")
+				case <-time.After(5 * time.Second):
+					So("config change not dispatched", ShouldBeEmpty)
+				}
+				select {
+				case level := <-levels:
+					So(level, ShouldEqual, "debug")
+				case <-time.After(5 * time.Second):
+					So("typed config change not dispatched", ShouldBeEmpty)
+				}
+				return nil
+			}),
+		)
+		application.OnConfigChange(func(e app.ConfigChangeEvent) error {
+			events <- e
+			return nil
+		}, "log.level")
+		application.OnTypedConfigChange(func(oldOpts, newOpts *reloadOptions, e app.ConfigChangeEvent) error {
+			levels <- newOpts.Log.Level
+			return nil
+		}, "log.level")
+		// 函数签名与选项类型不匹配
+		So(func() {
+			application.OnTypedConfigChange(func(oldOpts, newOpts *log.Options, e app.ConfigChangeEvent) error { return nil })
+		}, ShouldPanic)
+
+		application.Command().SetArgs([]string{"--config", file})
+		So(application.Command().Execute(), ShouldBeNil)
+	})
+}
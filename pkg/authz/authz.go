@@ -0,0 +1,159 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// KeySubject is the key of Subject stored in gin.Context.
+const KeySubject = "authz.subject"
+
+type subjectKeyCtx struct{}
+
+// Subject is the identity of caller.
+type Subject struct {
+	// Name is empty for unauthenticated caller.
+	Name   string   `json:"name"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// groups returns groups including implicit GroupAuthenticated.
+func (s *Subject) groups() []string {
+	if s.Name == "" {
+		return s.Groups
+	}
+	return append(append([]string{}, s.Groups...), GroupAuthenticated)
+}
+
+// WithSubject returns a copy of ctx with subject.
+func WithSubject(ctx context.Context, subject Subject) context.Context {
+	return context.WithValue(ctx, subjectKeyCtx{}, subject)
+}
+
+// SubjectFromContext returns subject stored by WithSubject.
+func SubjectFromContext(ctx context.Context) (Subject, bool) {
+	s, ok := ctx.Value(subjectKeyCtx{}).(Subject)
+	return s, ok
+}
+
+// Attributes describes a request to authorize.
+type Attributes struct {
+	Subject  Subject `json:"subject"`
+	Verb     string  `json:"verb"`
+	Route    string  `json:"route"`
+	Resource string  `json:"resource,omitempty"`
+}
+
+// Decision is the result of authorization.
+type Decision struct {
+	Allowed bool `json:"allowed"`
+	// DryRun is true if request denied is let through since authorizer is in dry-run mode.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Role is the role allows request.
+	Role   string `json:"role,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Authorizer authorizes requests with a RBAC policy which can be replaced at runtime.
+type Authorizer struct {
+	policy atomic.Value // *Policy
+	dryRun int32
+
+	mu   sync.Mutex
+	file string
+	stop func()
+}
+
+// NewAuthorizer creates an authorizer with policy.
+func NewAuthorizer(policy *Policy) (*Authorizer, error) {
+	a := &Authorizer{}
+	if err := a.SetPolicy(policy); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewFileAuthorizer creates an authorizer with policy loaded from yaml file, call Watch to
+// reload policy when file changes.
+func NewFileAuthorizer(file string) (*Authorizer, error) {
+	policy, err := LoadPolicyFile(file)
+	if err != nil {
+		return nil, err
+	}
+	a, err := NewAuthorizer(policy)
+	if err != nil {
+		return nil, err
+	}
+	a.file = file
+	return a, nil
+}
+
+// SetPolicy replaces the policy.
+func (a *Authorizer) SetPolicy(policy *Policy) error {
+	if policy == nil {
+		return fmt.Errorf("policy is nil")
+	}
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	a.policy.Store(policy)
+	return nil
+}
+
+// Policy returns the current policy.
+func (a *Authorizer) Policy() *Policy {
+	return a.policy.Load().(*Policy)
+}
+
+// SetDryRun sets dry-run mode, in which denied requests are only audited but let through.
+func (a *Authorizer) SetDryRun(dryRun bool) {
+	var v int32
+	if dryRun {
+		v = 1
+	}
+	atomic.StoreInt32(&a.dryRun, v)
+}
+
+// DryRun returns whether authorizer is in dry-run mode.
+func (a *Authorizer) DryRun() bool {
+	return atomic.LoadInt32(&a.dryRun) == 1
+}
+
+// Authorize decides whether request is allowed.
+// In dry-run mode, denied decision has DryRun set, caller should let request through.
+func (a *Authorizer) Authorize(attrs Attributes) Decision {
+	policy := a.Policy()
+
+	for _, b := range policy.Bindings {
+		if !b.matches(&attrs.Subject) {
+			continue
+		}
+		for _, role := range policy.Roles {
+			if role.Name != b.Role {
+				continue
+			}
+			for _, rule := range role.Rules {
+				if rule.matches(&attrs) {
+					return Decision{
+						Allowed: true,
+						Role:    role.Name,
+						Reason:  fmt.Sprintf("allowed by role `%s`", role.Name),
+					}
+				}
+			}
+		}
+	}
+
+	subject := attrs.Subject.Name
+	if subject == "" {
+		subject = SubjectAnonymous
+	}
+	reason := fmt.Sprintf("subject `%s` can't %s %s", subject, strings.ToLower(attrs.Verb), attrs.Route)
+	if attrs.Resource != "" {
+		reason += fmt.Sprintf(" of resource `%s`", attrs.Resource)
+	}
+	return Decision{Allowed: false, DryRun: a.DryRun(), Reason: reason}
+}
@@ -0,0 +1,118 @@
+package authz_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/authz"
+)
+
+const policyData = `
+roles:
+- name: viewer
+  rules:
+  - verbs: [get]
+    resources: [widgets]
+- name: admin
+  rules:
+  - verbs: ["*"]
+    routes: [/v1/*]
+  - verbs: [call]
+    routes: [/widget.WidgetService/*]
+bindings:
+- role: viewer
+  groups: [system:authenticated]
+- role: admin
+  subjects: [alice]
+  groups: [ops]
+`
+
+func TestAuthorizer(t *testing.T) {
+	Convey("RBAC鉴权", t, func() {
+		policy, err := authz.ParsePolicy([]byte(policyData))
+		So(err, ShouldBeNil)
+		a, err := authz.NewAuthorizer(policy)
+		So(err, ShouldBeNil)
+
+		bob := authz.Subject{Name: "bob"}
+		alice := authz.Subject{Name: "alice"}
+
+		Convey("按资源和路由匹配", func() {
+			d := a.Authorize(authz.Attributes{Subject: bob, Verb: "get", Route: "/v1/widgets/:id", Resource: "widgets"})
+			So(d.Allowed, ShouldBeTrue)
+			So(d.Role, ShouldEqual, "viewer")
+
+			So(a.Authorize(authz.Attributes{Subject: bob, Verb: "delete", Route: "/v1/widgets/:id", Resource: "widgets"}).Allowed, ShouldBeFalse)
+			So(a.Authorize(authz.Attributes{Subject: alice, Verb: "delete", Route: "/v1/widgets/:id", Resource: "widgets"}).Allowed, ShouldBeTrue)
+			So(a.Authorize(authz.Attributes{Subject: authz.Subject{Name: "carol", Groups: []string{"ops"}}, Verb: "call",
+				Route: "/widget.WidgetService/Get", Resource: "widget.WidgetService"}).Allowed, ShouldBeTrue)
+			So(a.Authorize(authz.Attributes{Subject: bob, Verb: "call", Route: "/widget.WidgetService/Get"}).Allowed, ShouldBeFalse)
+		})
+
+		Convey("匿名用户不属于system:authenticated", func() {
+			d := a.Authorize(authz.Attributes{Verb: "get", Route: "/v1/widgets", Resource: "widgets"})
+			So(d.Allowed, ShouldBeFalse)
+			So(d.Reason, ShouldContainSubstring, authz.SubjectAnonymous)
+		})
+
+		Convey("dry-run", func() {
+			a.SetDryRun(true)
+			d := a.Authorize(authz.Attributes{Subject: bob, Verb: "delete", Route: "/v1/widgets/:id"})
+			So(d.Allowed, ShouldBeFalse)
+			So(d.DryRun, ShouldBeTrue)
+		})
+
+		Convey("非法策略", func() {
+			_, err := authz.ParsePolicy([]byte("bindings:\n- role: none\n  subjects: [bob]\n"))
+			So(err, ShouldNotBeNil)
+			_, err = authz.ParsePolicy([]byte("roles:\n- name: r\n  rules:\n  - verbs: [get]\n"))
+			So(err, ShouldNotBeNil)
+			_, err = authz.ParsePolicy([]byte("role: []\n"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestAuthorizer_Watch(t *testing.T) {
+	Convey("策略文件热加载", t, func() {
+		dir, err := ioutil.TempDir("", "authz")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "policy.yaml")
+		So(ioutil.WriteFile(file, []byte(policyData), 0o600), ShouldBeNil)
+
+		a, err := authz.NewFileAuthorizer(file)
+		So(err, ShouldBeNil)
+		So(a.Watch(), ShouldBeNil)
+		defer a.Stop()
+
+		attrs := authz.Attributes{Subject: authz.Subject{Name: "bob"}, Verb: "delete", Route: "/v1/widgets/:id"}
+		So(a.Authorize(attrs).Allowed, ShouldBeFalse)
+
+		// 非法策略不生效
+		So(ioutil.WriteFile(file, []byte("roles: ["), 0o600), ShouldBeNil)
+		time.Sleep(200 * time.Millisecond)
+		So(a.Policy().Roles, ShouldHaveLength, 2)
+
+		// 通过重命名替换文件
+		tmp := filepath.Join(dir, "policy.yaml.tmp")
+		So(ioutil.WriteFile(tmp, []byte(policyData+"- role: admin\n  subjects: [bob]\n"), 0o600), ShouldBeNil)
+		So(os.Rename(tmp, file), ShouldBeNil)
+		So(waitFor(func() bool { return a.Authorize(attrs).Allowed }), ShouldBeTrue)
+	})
+}
+
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 50; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
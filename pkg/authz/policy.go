@@ -0,0 +1,160 @@
+package authz
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// All matches any verb, route, resource, subject or group.
+	All = "*"
+
+	// VerbCall is the verb of gRPC method.
+	VerbCall = "call"
+
+	// SubjectAnonymous is the name of unauthenticated subject.
+	SubjectAnonymous = "system:anonymous"
+	// GroupAuthenticated is the group all authenticated subjects belong to.
+	GroupAuthenticated = "system:authenticated"
+)
+
+// Policy is the RBAC policy, a subject is allowed if any role bound to it has a matched rule.
+//
+//	roles:
+//	- name: viewer
+//	  rules:
+//	  - verbs: [get]
+//	    resources: [widgets]
+//	  - verbs: [call]
+//	    routes: [/widget.WidgetService/*]
+//	bindings:
+//	- role: viewer
+//	  subjects: [alice]
+//	  groups: [system:authenticated]
+type Policy struct {
+	Roles    []Role    `json:"roles"    yaml:"roles"`
+	Bindings []Binding `json:"bindings" yaml:"bindings"`
+}
+
+// Role is a named set of rules.
+type Role struct {
+	Name  string `json:"name"  yaml:"name"`
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule allows verbs on routes or resources.
+// Verbs are lowercase HTTP methods, or VerbCall for gRPC method.
+// Routes are HTTP route templates like `/v1/widgets/:id` or gRPC full methods, pattern ending with
+// `/*` matches all routes with the prefix.
+// Resources are resource names, which is the last static segment of HTTP route template,
+// or gRPC service name.
+type Rule struct {
+	Verbs     []string `json:"verbs"     yaml:"verbs"`
+	Routes    []string `json:"routes"    yaml:"routes"`
+	Resources []string `json:"resources" yaml:"resources"`
+}
+
+// Binding grants role to subjects and groups.
+type Binding struct {
+	Role     string   `json:"role"     yaml:"role"`
+	Subjects []string `json:"subjects" yaml:"subjects"`
+	Groups   []string `json:"groups"   yaml:"groups"`
+}
+
+// LoadPolicyFile loads policy from yaml file.
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parses policy from yaml data.
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks roles are unique and bindings refer to existing roles.
+func (p *Policy) Validate() error {
+	roles := make(map[string]bool, len(p.Roles))
+	for i, r := range p.Roles {
+		if r.Name == "" {
+			return fmt.Errorf("roles[%d]: name is empty", i)
+		}
+		if roles[r.Name] {
+			return fmt.Errorf("roles[%d]: role `%s` is repeated", i, r.Name)
+		}
+		roles[r.Name] = true
+
+		for j, rule := range r.Rules {
+			if len(rule.Verbs) == 0 {
+				return fmt.Errorf("role `%s` rules[%d]: verbs is empty", r.Name, j)
+			}
+			if len(rule.Routes) == 0 && len(rule.Resources) == 0 {
+				return fmt.Errorf("role `%s` rules[%d]: routes and resources are both empty", r.Name, j)
+			}
+		}
+	}
+
+	for i, b := range p.Bindings {
+		if !roles[b.Role] {
+			return fmt.Errorf("bindings[%d]: role `%s` not found", i, b.Role)
+		}
+		if len(b.Subjects) == 0 && len(b.Groups) == 0 {
+			return fmt.Errorf("bindings[%d]: subjects and groups are both empty", i)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) matches(attrs *Attributes) bool {
+	if !matchAny(r.Verbs, attrs.Verb, strings.EqualFold) {
+		return false
+	}
+	return matchAny(r.Routes, attrs.Route, matchRoute) ||
+		(attrs.Resource != "" && matchAny(r.Resources, attrs.Resource, func(p, v string) bool { return p == v }))
+}
+
+func (b *Binding) matches(subject *Subject) bool {
+	name := subject.Name
+	if name == "" {
+		name = SubjectAnonymous
+	}
+	if matchAny(b.Subjects, name, func(p, v string) bool { return p == v }) {
+		return true
+	}
+	for _, g := range subject.groups() {
+		if matchAny(b.Groups, g, func(p, v string) bool { return p == v }) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, p := range patterns {
+		if p == All || match(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRoute matches route exactly or by prefix with pattern ending with `/*`.
+func matchRoute(pattern, route string) bool {
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(route, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == route
+}
@@ -0,0 +1,89 @@
+package authz
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// Reload reloads policy from file, previous policy is kept if new one is invalid.
+func (a *Authorizer) Reload() error {
+	if a.file == "" {
+		return fmt.Errorf("authorizer is not created from file")
+	}
+	policy, err := LoadPolicyFile(a.file)
+	if err != nil {
+		return err
+	}
+	return a.SetPolicy(policy)
+}
+
+// Watch reloads policy when file changes until Stop called.
+// Directory of file is watched since editors may replace file by rename.
+func (a *Authorizer) Watch() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == "" {
+		return fmt.Errorf("authorizer is not created from file")
+	}
+	if a.stop != nil {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	file := filepath.Clean(a.file)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	a.stop = func() {
+		_ = watcher.Close()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != file || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := a.Reload(); err != nil {
+					log.Errorf("reload authz policy %s fail, keep previous one:%v", file, err)
+					continue
+				}
+				log.Infof("authz policy %s reloaded", file)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("watch authz policy %s error:%v", file, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops watching policy file.
+func (a *Authorizer) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stop != nil {
+		a.stop()
+		a.stop = nil
+	}
+}
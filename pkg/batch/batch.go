@@ -0,0 +1,159 @@
+package batch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// Mode decides how batch executor handles item failure.
+type Mode int
+
+const (
+	// BestEffort executes all items no matter whether some items fail.
+	BestEffort Mode = iota
+	// FailFast stops executing remaining items after the first failure,
+	// remaining items fail with code.ErrOperationCanceled.
+	FailFast
+)
+
+// Item is an element of batch.
+type Item struct {
+	ID    string
+	Value interface{}
+}
+
+// Result is the execute result of item.
+type Result struct {
+	ID   string
+	Data interface{}
+	Err  error
+}
+
+// Func executes a single item.
+type Func func(ctx context.Context, item Item) (data interface{}, err error)
+
+type options struct {
+	concurrency int
+	mode        Mode
+	timeout     time.Duration
+}
+
+// Option configures Execute.
+type Option func(*options)
+
+// WithConcurrency set max number of items executed concurrently, default is 1.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.concurrency = n
+		}
+	}
+}
+
+// WithMode set batch mode, default is BestEffort.
+func WithMode(mode Mode) Option {
+	return func(o *options) {
+		o.mode = mode
+	}
+}
+
+// WithItemTimeout set timeout of executing each item. Zero means no timeout.
+func WithItemTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// Execute runs fn over items with bounded concurrency, results are in the same order as items.
+// Item exceeds timeout fails even if fn doesn't respect ctx, in which case fn keeps running in background.
+func Execute(ctx context.Context, items []Item, fn Func, opts ...Option) []Result {
+	o := &options{concurrency: 1, mode: BestEffort}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]Result, len(items))
+	sem := make(chan struct{}, o.concurrency)
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		results[i].ID = item.ID
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i].Err = errors.WrapF(code.ErrOperationCanceled, "item %s is not executed:%v", item.ID, ctx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, item Item) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			data, err := executeItem(ctx, item, fn, o.timeout)
+			results[i].Data = data
+			results[i].Err = err
+			if err != nil {
+				log.F(ctx).Warnf("batch item %s fail:%v", item.ID, err)
+				if o.mode == FailFast {
+					cancel()
+				}
+			}
+		}(i, item)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func executeItem(ctx context.Context, item Item, fn Func, timeout time.Duration) (data interface{}, err error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		data interface{}
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: errors.WrapF(code.ErrUnknown, "item %s panic:%v", item.ID, r)}
+			}
+		}()
+		data, err := fn(ctx, item)
+		done <- result{data: data, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, errors.WrapF(code.ErrOperationCanceled, "item %s is interrupted:%v", item.ID, ctx.Err())
+	}
+}
+
+// Aggregate returns an aggregate of failed items' errors, nil if all items succeed.
+func Aggregate(results []Result) error {
+	errs := make([]error, 0, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	return errors.NewAggregate(errs...)
+}
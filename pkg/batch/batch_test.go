@@ -0,0 +1,85 @@
+package batch_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/batch"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli/interceptorcli/callstatus"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+)
+
+func newItems(n int) []batch.Item {
+	items := make([]batch.Item, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, batch.Item{ID: fmt.Sprint(i), Value: i})
+	}
+	return items
+}
+
+func TestExecute(t *testing.T) {
+	Convey("批量执行", t, func() {
+		failOdd := func(ctx context.Context, item batch.Item) (interface{}, error) {
+			if item.Value.(int)%2 == 1 {
+				return nil, errors.Wrap(code.ErrValidation, "odd")
+			}
+			return item.Value.(int) * 10, nil
+		}
+
+		Convey("尽力执行", func() {
+			results := batch.Execute(context.Background(), newItems(4), failOdd, batch.WithConcurrency(2))
+			So(len(results), ShouldEqual, 4)
+			So(results[0].Data, ShouldEqual, 0)
+			So(results[2].Data, ShouldEqual, 20)
+			So(errors.IsCode(results[1].Err, code.ErrValidation), ShouldBeTrue)
+			So(batch.Aggregate(results), ShouldNotBeNil)
+		})
+
+		Convey("快速失败", func() {
+			var executed int32
+			results := batch.Execute(context.Background(), newItems(10), func(ctx context.Context, item batch.Item) (interface{}, error) {
+				atomic.AddInt32(&executed, 1)
+				return failOdd(ctx, item)
+			}, batch.WithMode(batch.FailFast))
+			So(atomic.LoadInt32(&executed), ShouldEqual, 2)
+			So(errors.IsCode(results[9].Err, code.ErrOperationCanceled), ShouldBeTrue)
+		})
+
+		Convey("单项超时", func() {
+			results := batch.Execute(context.Background(), newItems(1), func(ctx context.Context, item batch.Item) (interface{}, error) {
+				time.Sleep(time.Second)
+				return nil, nil
+			}, batch.WithItemTimeout(10*time.Millisecond))
+			So(errors.IsCode(results[0].Err, code.ErrOperationCanceled), ShouldBeTrue)
+		})
+
+		Convey("批量响应解析", func() {
+			results := batch.Execute(context.Background(), newItems(2), failOdd)
+
+			gin.SetMode(gin.ReleaseMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/", nil)
+			ginx.WriteBatchResponse(c, results)
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			items, err := callstatus.DecodeBatchResponse(w.Body.Bytes())
+			So(err, ShouldBeNil)
+			So(len(items), ShouldEqual, 2)
+			So(items[0].Err, ShouldBeNil)
+			So(string(items[0].Data), ShouldEqual, "0")
+			So(errors.IsCode(items[1].Err, code.ErrValidation), ShouldBeTrue)
+			So(len(callstatus.BatchErrors(items)), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// TTLStore is a Store whose items expire after ttl since last added or updated.
+type TTLStore interface {
+	Indexer
+
+	// DeleteExpired removes all expired items.
+	DeleteExpired()
+	// RunJanitor removes expired items every interval in background until stop is called.
+	RunJanitor(interval time.Duration) (stop func())
+}
+
+// ttlStore is a Store whose items expire after ttl since last added or updated.
+// Expired items are removed when accessed or listed, and all of them are purged at most once per ttl
+// when items are added, so that store is bounded without janitor.
+type ttlStore struct {
+	cache
+	ttl time.Duration
+
+	lock      sync.Mutex
+	expires   map[string]time.Time // 对象过期时间
+	lastPurge time.Time
+}
+
+var _ TTLStore = &ttlStore{}
+
+// NewTTLStore returns a Store whose items expire after ttl since last added or updated.
+func NewTTLStore(keyFunc KeyFunc, ttl time.Duration) TTLStore {
+	return &ttlStore{
+		cache: cache{
+			cacheStorage: NewThreadSafeStore(Indexers{}, Indices{}),
+			keyFunc:      keyFunc,
+		},
+		ttl:       ttl,
+		expires:   make(map[string]time.Time),
+		lastPurge: time.Now(),
+	}
+}
+
+// Add inserts an item into the store and refresh its expiration.
+func (c *ttlStore) Add(obj interface{}) error {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return KeyError{obj, err}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.purgeLocked(false)
+	c.cacheStorage.Add(key, obj)
+	c.expires[key] = time.Now().Add(c.ttl)
+	return nil
+}
+
+// Update sets an item in the store to its updated state and refresh its expiration.
+func (c *ttlStore) Update(obj interface{}) error {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return KeyError{obj, err}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expireLocked(key)
+	if err := c.cacheStorage.Update(key, obj); err != nil {
+		return err
+	}
+	c.expires[key] = time.Now().Add(c.ttl)
+	return nil
+}
+
+// Delete removes an item from the store.
+func (c *ttlStore) Delete(obj interface{}) error {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return KeyError{obj, err}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cacheStorage.Delete(key)
+	delete(c.expires, key)
+	return nil
+}
+
+// List returns a list of all the unexpired items.
+func (c *ttlStore) List() []interface{} {
+	c.DeleteExpired()
+	return c.cacheStorage.List()
+}
+
+// ListKeys returns a list of all the keys of unexpired items.
+func (c *ttlStore) ListKeys() []string {
+	c.DeleteExpired()
+	return c.cacheStorage.ListKeys()
+}
+
+// Get returns the requested item, or sets exists=false if item is not exist or expired.
+func (c *ttlStore) Get(obj interface{}) (item interface{}, exists bool, err error) {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return nil, false, KeyError{obj, err}
+	}
+	return c.GetByKey(key)
+}
+
+// GetByKey returns the requested item, or sets exists=false if item is not exist or expired.
+func (c *ttlStore) GetByKey(key string) (item interface{}, exists bool, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.expireLocked(key) {
+		return nil, false, nil
+	}
+	item, exists = c.cacheStorage.Get(key)
+	return item, exists, nil
+}
+
+// Replace will delete the contents of the store, using instead the given list.
+// All items are expired after ttl since now.
+func (c *ttlStore) Replace(list []interface{}, resourceVersion string) error {
+	items := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		key, err := c.keyFunc(item)
+		if err != nil {
+			return KeyError{item, err}
+		}
+		items[key] = item
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cacheStorage.Replace(items, resourceVersion)
+	expire := time.Now().Add(c.ttl)
+	c.expires = make(map[string]time.Time, len(items))
+	for key := range items {
+		c.expires[key] = expire
+	}
+	return nil
+}
+
+// Index returns unexpired items that match the given object on the index function.
+func (c *ttlStore) Index(indexName string, obj interface{}) ([]interface{}, error) {
+	c.DeleteExpired()
+	return c.cacheStorage.Index(indexName, obj)
+}
+
+// IndexKeys returns keys of unexpired items that match the given index value.
+func (c *ttlStore) IndexKeys(indexName, indexKey string) ([]string, error) {
+	c.DeleteExpired()
+	return c.cacheStorage.IndexKeys(indexName, indexKey)
+}
+
+// ListIndexFuncValues returns index values of unexpired items.
+func (c *ttlStore) ListIndexFuncValues(indexName string) []string {
+	c.DeleteExpired()
+	return c.cacheStorage.ListIndexFuncValues(indexName)
+}
+
+// ByIndex returns unexpired items whose index values contain indexKey.
+func (c *ttlStore) ByIndex(indexName, indexKey string) ([]interface{}, error) {
+	c.DeleteExpired()
+	return c.cacheStorage.ByIndex(indexName, indexKey)
+}
+
+// DeleteExpired removes all expired items.
+func (c *ttlStore) DeleteExpired() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.purgeLocked(true)
+}
+
+// RunJanitor removes expired items every interval in background until stop is called.
+func (c *ttlStore) RunJanitor(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.DeleteExpired()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// purgeLocked removes all expired items, only if ttl has passed since last purge unless force.
+func (c *ttlStore) purgeLocked(force bool) {
+	now := time.Now()
+	if !force && now.Sub(c.lastPurge) < c.ttl {
+		return
+	}
+	c.lastPurge = now
+	for key := range c.expires {
+		c.expireLocked(key)
+	}
+}
+
+// expireLocked removes item if it is expired, return true if removed.
+func (c *ttlStore) expireLocked(key string) bool {
+	expire, ok := c.expires[key]
+	if !ok || time.Now().Before(expire) {
+		return false
+	}
+	c.cacheStorage.Delete(key)
+	delete(c.expires, key)
+	return true
+}
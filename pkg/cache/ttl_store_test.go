@@ -0,0 +1,84 @@
+package cache_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/cache"
+)
+
+type item struct {
+	Key   string
+	Value int
+}
+
+func itemKeyFunc(obj interface{}) (string, error) {
+	return obj.(*item).Key, nil
+}
+
+func TestTTLStore(t *testing.T) {
+	Convey("TTL缓存", t, func() {
+		store := cache.NewTTLStore(itemKeyFunc, 50*time.Millisecond)
+		So(store.Add(&item{Key: "a", Value: 1}), ShouldBeNil)
+		So(store.Add(&item{Key: "b", Value: 2}), ShouldBeNil)
+
+		obj, exists, err := store.GetByKey("a")
+		So(err, ShouldBeNil)
+		So(exists, ShouldBeTrue)
+		So(obj.(*item).Value, ShouldEqual, 1)
+		So(len(store.List()), ShouldEqual, 2)
+
+		Convey("过期后对象不存在", func() {
+			time.Sleep(30 * time.Millisecond)
+			// 更新对象会刷新过期时间
+			So(store.Update(&item{Key: "b", Value: 3}), ShouldBeNil)
+			time.Sleep(30 * time.Millisecond)
+
+			_, exists, err := store.GetByKey("a")
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+			So(store.ListKeys(), ShouldResemble, []string{"b"})
+
+			So(store.Update(&item{Key: "a", Value: 1}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("索引不返回过期对象", t, func() {
+		store := cache.NewTTLStore(itemKeyFunc, 50*time.Millisecond)
+		So(store.AddIndexers(cache.Indexers{"value": func(obj interface{}) ([]string, error) {
+			return []string{"all"}, nil
+		}}), ShouldBeNil)
+		So(store.Add(&item{Key: "a", Value: 1}), ShouldBeNil)
+		items, err := store.ByIndex("value", "all")
+		So(err, ShouldBeNil)
+		So(items, ShouldHaveLength, 1)
+
+		time.Sleep(60 * time.Millisecond)
+		items, err = store.ByIndex("value", "all")
+		So(err, ShouldBeNil)
+		So(items, ShouldBeEmpty)
+		keys, err := store.IndexKeys("value", "all")
+		So(err, ShouldBeNil)
+		So(keys, ShouldBeEmpty)
+	})
+
+	Convey("定期清理过期对象", t, func() {
+		store := cache.NewTTLStore(itemKeyFunc, 20*time.Millisecond)
+		// index function is called when item is removed from storage
+		var removed int32
+		So(store.AddIndexers(cache.Indexers{"value": func(obj interface{}) ([]string, error) {
+			atomic.AddInt32(&removed, 1)
+			return nil, nil
+		}}), ShouldBeNil)
+		stop := store.RunJanitor(10 * time.Millisecond)
+		defer stop()
+
+		So(store.Add(&item{Key: "a", Value: 1}), ShouldBeNil)
+		So(atomic.LoadInt32(&removed), ShouldEqual, 1)
+		time.Sleep(60 * time.Millisecond)
+		So(atomic.LoadInt32(&removed), ShouldEqual, 2)
+	})
+}
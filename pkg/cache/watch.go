@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+)
+
+// EventType is the type of change.
+type EventType string
+
+const (
+	Added    EventType = "ADDED"
+	Modified EventType = "MODIFIED"
+	Deleted  EventType = "DELETED"
+)
+
+// Event is a change of object in store.
+type Event struct {
+	Type EventType
+	// Object is the object after change, or the last state of deleted object.
+	// It is shared with store, must be treated as read-only.
+	Object interface{}
+	// ResourceVersion is the version of this change, increased monotonically.
+	ResourceVersion uint64
+}
+
+// ErrResourceVersionTooOld is returned by Watch when events after the resource version
+// have been evicted from history, caller should list again and watch from the latest version.
+var ErrResourceVersionTooOld = errors.New("resource version is too old")
+
+// Watcher receives events of store.
+type Watcher interface {
+	// ResultChan returns the channel of events. Channel is closed when watcher stopped
+	// or it is too slow to receive events, caller should watch again from the last version received.
+	ResultChan() <-chan Event
+	// Stop stops watching.
+	Stop()
+}
+
+// WatchableIndexer is an Indexer which publishes changes to watchers.
+type WatchableIndexer interface {
+	Indexer
+	// ResourceVersion returns the version of latest change.
+	ResourceVersion() uint64
+	// Watch returns a watcher receiving changes after resourceVersion.
+	// Zero resourceVersion means watching from now on.
+	Watch(resourceVersion uint64) (Watcher, error)
+}
+
+// WatchOptions configures WatchableIndexer.
+type WatchOptions struct {
+	// HistorySize is the number of recent events kept to resume watch, default is 100.
+	HistorySize int
+	// ChanSize is buffer size of each watcher, default is 100.
+	ChanSize int
+	// SetResourceVersion is called with version of change before object stored,
+	// so object can carry its resource version. It is not called for deleted object,
+	// which may be read concurrently.
+	SetResourceVersion func(obj interface{}, version uint64)
+}
+
+// 支持监听变化的缓存, 每次变化都会生成递增的版本号并通知所有监听者.
+type watchableCache struct {
+	*cache
+	opts WatchOptions
+
+	// lock serializes changes, so that events are ordered by version.
+	lock     sync.Mutex
+	version  uint64
+	history  []Event
+	watchers map[*watcher]struct{}
+}
+
+var _ WatchableIndexer = &watchableCache{}
+
+// NewWatchableIndexer returns an Indexer which publishes add/update/delete events to watchers.
+func NewWatchableIndexer(keyFunc KeyFunc, indexers Indexers, opts WatchOptions) WatchableIndexer {
+	if opts.HistorySize <= 0 {
+		opts.HistorySize = 100
+	}
+	if opts.ChanSize <= 0 {
+		opts.ChanSize = 100
+	}
+	return &watchableCache{
+		cache: &cache{
+			cacheStorage: NewThreadSafeStore(indexers, Indices{}),
+			keyFunc:      keyFunc,
+		},
+		opts:     opts,
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+// Add inserts an item into the cache, Modified event is published if item has existed.
+func (c *watchableCache) Add(obj interface{}) error {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return KeyError{obj, err}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	eventType := Added
+	if _, exists := c.cacheStorage.Get(key); exists {
+		eventType = Modified
+	}
+	version := c.nextVersionLocked(obj)
+	c.cacheStorage.Add(key, obj)
+	c.publishLocked(Event{Type: eventType, Object: obj, ResourceVersion: version})
+	return nil
+}
+
+// Update sets an item in the cache to its updated state.
+func (c *watchableCache) Update(obj interface{}) error {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return KeyError{obj, err}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, exists := c.cacheStorage.Get(key); !exists {
+		return c.cacheStorage.Update(key, obj)
+	}
+	version := c.nextVersionLocked(obj)
+	if err := c.cacheStorage.Update(key, obj); err != nil {
+		return err
+	}
+	c.publishLocked(Event{Type: Modified, Object: obj, ResourceVersion: version})
+	return nil
+}
+
+// Delete removes an item from the cache.
+func (c *watchableCache) Delete(obj interface{}) error {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return KeyError{obj, err}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	old, exists := c.cacheStorage.Get(key)
+	if !exists {
+		return nil
+	}
+	c.cacheStorage.Delete(key)
+	version := c.nextVersionLocked(nil)
+	c.publishLocked(Event{Type: Deleted, Object: old, ResourceVersion: version})
+	return nil
+}
+
+// Replace will delete the contents of the cache, using instead the given list.
+// Events are published for the difference between old and new contents.
+func (c *watchableCache) Replace(list []interface{}, resourceVersion string) error {
+	items := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		key, err := c.keyFunc(item)
+		if err != nil {
+			return KeyError{item, err}
+		}
+		items[key] = item
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	events := make([]Event, 0, len(items))
+	for _, key := range c.cacheStorage.ListKeys() {
+		if _, ok := items[key]; !ok {
+			old, _ := c.cacheStorage.Get(key)
+			events = append(events, Event{Type: Deleted, Object: old, ResourceVersion: c.nextVersionLocked(nil)})
+		}
+	}
+	for key, item := range items {
+		eventType := Added
+		if _, exists := c.cacheStorage.Get(key); exists {
+			eventType = Modified
+		}
+		events = append(events, Event{Type: eventType, Object: item, ResourceVersion: c.nextVersionLocked(item)})
+	}
+
+	c.cacheStorage.Replace(items, resourceVersion)
+	for _, e := range events {
+		c.publishLocked(e)
+	}
+	return nil
+}
+
+// ResourceVersion returns the version of latest change.
+func (c *watchableCache) ResourceVersion() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.version
+}
+
+// Watch returns a watcher receiving changes after resourceVersion.
+func (c *watchableCache) Watch(resourceVersion uint64) (Watcher, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var replay []Event
+	if resourceVersion != 0 && resourceVersion < c.version {
+		// history must contain the event right after resourceVersion
+		if len(c.history) == 0 || c.history[0].ResourceVersion > resourceVersion+1 {
+			return nil, ErrResourceVersionTooOld
+		}
+		for _, e := range c.history {
+			if e.ResourceVersion > resourceVersion {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	w := &watcher{
+		c:      c,
+		result: make(chan Event, len(replay)+c.opts.ChanSize),
+	}
+	for _, e := range replay {
+		w.result <- e
+	}
+	c.watchers[w] = struct{}{}
+	return w, nil
+}
+
+func (c *watchableCache) nextVersionLocked(obj interface{}) uint64 {
+	c.version++
+	if obj != nil && c.opts.SetResourceVersion != nil {
+		c.opts.SetResourceVersion(obj, c.version)
+	}
+	return c.version
+}
+
+func (c *watchableCache) publishLocked(e Event) {
+	c.history = append(c.history, e)
+	if len(c.history) > c.opts.HistorySize {
+		c.history = c.history[len(c.history)-c.opts.HistorySize:]
+	}
+
+	for w := range c.watchers {
+		select {
+		case w.result <- e:
+		default:
+			// 监听者处理过慢, 关闭监听, 由监听者从最后收到的版本重新监听
+			c.stopLocked(w)
+		}
+	}
+}
+
+func (c *watchableCache) stopLocked(w *watcher) {
+	if _, ok := c.watchers[w]; ok {
+		delete(c.watchers, w)
+		close(w.result)
+	}
+}
+
+type watcher struct {
+	c      *watchableCache
+	result chan Event
+}
+
+func (w *watcher) ResultChan() <-chan Event {
+	return w.result
+}
+
+func (w *watcher) Stop() {
+	w.c.lock.Lock()
+	defer w.c.lock.Unlock()
+	w.c.stopLocked(w)
+}
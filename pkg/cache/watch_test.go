@@ -0,0 +1,47 @@
+package cache_test
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/cache"
+)
+
+func TestWatchableIndexer(t *testing.T) {
+	Convey("监听缓存变化", t, func() {
+		store := cache.NewWatchableIndexer(itemKeyFunc, cache.Indexers{}, cache.WatchOptions{HistorySize: 2})
+
+		w, err := store.Watch(0)
+		So(err, ShouldBeNil)
+		defer w.Stop()
+
+		So(store.Add(&item{Key: "a", Value: 1}), ShouldBeNil)
+		So(store.Update(&item{Key: "a", Value: 2}), ShouldBeNil)
+		So(store.Delete(&item{Key: "a"}), ShouldBeNil)
+		So(store.ResourceVersion(), ShouldEqual, 3)
+
+		var types []cache.EventType
+		for i := 0; i < 3; i++ {
+			e := <-w.ResultChan()
+			So(e.ResourceVersion, ShouldEqual, i+1)
+			types = append(types, e.Type)
+		}
+		So(types, ShouldResemble, []cache.EventType{cache.Added, cache.Modified, cache.Deleted})
+
+		Convey("从历史版本恢复监听", func() {
+			w2, err := store.Watch(1)
+			So(err, ShouldBeNil)
+			defer w2.Stop()
+			e := <-w2.ResultChan()
+			So(e.ResourceVersion, ShouldEqual, 2)
+			So(e.Object.(*item).Value, ShouldEqual, 2)
+		})
+
+		Convey("版本过旧", func() {
+			So(store.Add(&item{Key: "b"}), ShouldBeNil)
+			_, err := store.Watch(1)
+			So(err, ShouldEqual, cache.ErrResourceVersionTooOld)
+		})
+	})
+}
@@ -0,0 +1,316 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+const (
+	DefaultFailureRatio = 0.5
+	DefaultMinRequests  = 10
+	DefaultInterval     = 60 * time.Second
+	DefaultOpenDuration = 30 * time.Second
+	DefaultProbes       = 1
+)
+
+// State is state of circuit breaker.
+type State int
+
+const (
+	// StateClosed allows all requests and counts failures.
+	StateClosed State = iota
+	// StateHalfOpen allows only Probes requests to test whether target recovered.
+	StateHalfOpen
+	// StateOpen rejects all requests until OpenDuration passed.
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Result is result of a request allowed by breaker.
+type Result int
+
+const (
+	Success Result = iota
+	Failure
+	// Ignored is not counted, such as request canceled by caller.
+	Ignored
+)
+
+var (
+	stateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "circuit_breaker",
+		Name:      "state",
+		Help:      "State of circuit breaker, 0 closed, 1 half-open, 2 open.",
+	}, []string{"name"})
+	transitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "circuit_breaker",
+		Name:      "transitions_total",
+		Help:      "Number of circuit breaker state transitions.",
+	}, []string{"name", "from", "to"})
+	rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "circuit_breaker",
+		Name:      "rejected_total",
+		Help:      "Number of requests rejected by circuit breaker.",
+	}, []string{"name"})
+	metricsOnce sync.Once
+)
+
+// Settings configures circuit breaker, zero fields use defaults.
+type Settings struct {
+	// FailureRatio opens circuit when ratio of failed requests reaches it, between 0 and 1.
+	FailureRatio float64
+	// MinRequests is the minimum requests in Interval before circuit can open.
+	MinRequests int
+	// Interval is the period to clear counts in closed state.
+	Interval time.Duration
+	// OpenDuration is how long circuit keeps open before half-open.
+	OpenDuration time.Duration
+	// Probes is the number of requests allowed in half-open state, circuit closes if all of them succeed.
+	Probes int
+	// OnStateChange is called after state changed if set.
+	OnStateChange func(name string, from, to State)
+}
+
+func (s Settings) complete() Settings {
+	if s.FailureRatio <= 0 || s.FailureRatio > 1 {
+		s.FailureRatio = DefaultFailureRatio
+	}
+	if s.MinRequests <= 0 {
+		s.MinRequests = DefaultMinRequests
+	}
+	if s.Interval <= 0 {
+		s.Interval = DefaultInterval
+	}
+	if s.OpenDuration <= 0 {
+		s.OpenDuration = DefaultOpenDuration
+	}
+	if s.Probes <= 0 {
+		s.Probes = DefaultProbes
+	}
+	return s
+}
+
+// Breaker is a circuit breaker of a target.
+type Breaker struct {
+	name     string
+	settings Settings
+
+	lock       sync.Mutex
+	state      State
+	generation uint64
+	expiry     time.Time
+	requests   int
+	failures   int
+	// in-flight and succeeded probes in half-open state
+	probing   int
+	succeeded int
+}
+
+// NewBreaker creates a closed circuit breaker, name is used in logs and metrics.
+func NewBreaker(name string, settings Settings) *Breaker {
+	metricsOnce.Do(func() {
+		registerCollector(stateGauge)
+		registerCollector(transitions)
+		registerCollector(rejected)
+	})
+
+	b := &Breaker{name: name, settings: settings.complete()}
+	b.expiry = time.Now().Add(b.settings.Interval)
+	stateGauge.WithLabelValues(name).Set(float64(StateClosed))
+	return b
+}
+
+// Name returns name of breaker.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns current state.
+func (b *Breaker) State() State {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refresh(time.Now())
+	return b.state
+}
+
+// Allow checks whether a request can pass. If allowed, done must be called with the result of request,
+// otherwise error with code `code.ErrCircuitOpen` is returned.
+func (b *Breaker) Allow() (done func(result Result), err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refresh(time.Now())
+	switch b.state {
+	case StateOpen:
+		rejected.WithLabelValues(b.name).Inc()
+		return nil, errors.WrapF(code.ErrCircuitOpen, "circuit breaker %s is open", b.name)
+	case StateHalfOpen:
+		if b.probing+b.succeeded >= b.settings.Probes {
+			rejected.WithLabelValues(b.name).Inc()
+			return nil, errors.WrapF(code.ErrCircuitOpen, "circuit breaker %s is half-open, waiting for probes", b.name)
+		}
+		b.probing++
+	}
+
+	generation := b.generation
+	var once sync.Once
+	return func(result Result) {
+		once.Do(func() { b.done(generation, result) })
+	}, nil
+}
+
+func (b *Breaker) done(generation uint64, result Result) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	b.refresh(now)
+	// result of request allowed before state changed is dropped
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case StateClosed:
+		if result == Ignored {
+			return
+		}
+		b.requests++
+		if result == Failure {
+			b.failures++
+		}
+		if b.requests >= b.settings.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.settings.FailureRatio {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		b.probing--
+		switch result {
+		case Ignored:
+			return
+		case Failure:
+			b.setState(StateOpen, now)
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.settings.Probes {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+// refresh clears counts of expired interval, and turns open into half-open after OpenDuration.
+func (b *Breaker) refresh(now time.Time) {
+	if now.Before(b.expiry) {
+		return
+	}
+	switch b.state {
+	case StateClosed:
+		b.newGeneration(now)
+	case StateOpen:
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	b.newGeneration(now)
+
+	stateGauge.WithLabelValues(b.name).Set(float64(state))
+	transitions.WithLabelValues(b.name, from.String(), state.String()).Inc()
+	if state == StateOpen {
+		log.Warnf("circuit breaker %s: %s -> %s, reject requests for %v", b.name, from, state, b.settings.OpenDuration)
+	} else {
+		log.Infof("circuit breaker %s: %s -> %s", b.name, from, state)
+	}
+	if b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(b.name, from, state)
+	}
+}
+
+func (b *Breaker) newGeneration(now time.Time) {
+	b.generation++
+	b.requests, b.failures, b.probing, b.succeeded = 0, 0, 0, 0
+	switch b.state {
+	case StateClosed:
+		b.expiry = now.Add(b.settings.Interval)
+	case StateOpen:
+		b.expiry = now.Add(b.settings.OpenDuration)
+	default:
+		b.expiry = time.Time{}
+	}
+}
+
+// Group holds breakers of the same settings by name, such as target address or route.
+type Group struct {
+	settings Settings
+	lock     sync.RWMutex
+	breakers map[string]*Breaker
+}
+
+// NewGroup creates a Group, breakers are created on first use.
+func NewGroup(settings Settings) *Group {
+	return &Group{settings: settings, breakers: make(map[string]*Breaker)}
+}
+
+// Get returns breaker of name, creates it if not exist.
+func (g *Group) Get(name string) *Breaker {
+	g.lock.RLock()
+	b, ok := g.breakers[name]
+	g.lock.RUnlock()
+	if ok {
+		return b
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if b, ok := g.breakers[name]; ok {
+		return b
+	}
+	b = NewBreaker(name, g.settings)
+	g.breakers[name] = b
+	return b
+}
+
+// States returns states of all breakers in group.
+func (g *Group) States() map[string]State {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	states := make(map[string]State, len(g.breakers))
+	for name, b := range g.breakers {
+		states[name] = b.State()
+	}
+	return states
+}
+
+func registerCollector(c prometheus.Collector) {
+	if err := prometheus.Register(c); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			log.Warnf("register circuit breaker metrics fail:%v", err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package circuitbreaker_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/circuitbreaker"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+)
+
+func TestBreaker(t *testing.T) {
+	Convey("熔断器状态转换", t, func() {
+		var changes []string
+		b := circuitbreaker.NewBreaker("test", circuitbreaker.Settings{
+			FailureRatio: 0.5,
+			MinRequests:  4,
+			OpenDuration: 50 * time.Millisecond,
+			Probes:       2,
+			OnStateChange: func(name string, from, to circuitbreaker.State) {
+				changes = append(changes, from.String()+"->"+to.String())
+			},
+		})
+		So(b.State(), ShouldEqual, circuitbreaker.StateClosed)
+
+		request := func(success bool) error {
+			done, err := b.Allow()
+			if err != nil {
+				return err
+			}
+			if success {
+				done(circuitbreaker.Success)
+			} else {
+				done(circuitbreaker.Failure)
+			}
+			return nil
+		}
+
+		Convey("请求数未达到下限不熔断", func() {
+			So(request(false), ShouldBeNil)
+			So(request(false), ShouldBeNil)
+			So(request(false), ShouldBeNil)
+			So(b.State(), ShouldEqual, circuitbreaker.StateClosed)
+
+			done, err := b.Allow()
+			So(err, ShouldBeNil)
+			done(circuitbreaker.Ignored)
+			So(b.State(), ShouldEqual, circuitbreaker.StateClosed)
+		})
+
+		Convey("失败率达到阈值熔断, 探测成功后恢复", func() {
+			So(request(true), ShouldBeNil)
+			So(request(false), ShouldBeNil)
+			So(request(true), ShouldBeNil)
+			So(request(false), ShouldBeNil)
+			So(b.State(), ShouldEqual, circuitbreaker.StateOpen)
+
+			err := request(true)
+			So(err, ShouldNotBeNil)
+			So(errors.IsCode(err, code.ErrCircuitOpen), ShouldBeTrue)
+
+			time.Sleep(60 * time.Millisecond)
+			So(b.State(), ShouldEqual, circuitbreaker.StateHalfOpen)
+
+			done1, err := b.Allow()
+			So(err, ShouldBeNil)
+			done2, err := b.Allow()
+			So(err, ShouldBeNil)
+			_, err = b.Allow()
+			So(errors.IsCode(err, code.ErrCircuitOpen), ShouldBeTrue)
+
+			done1(circuitbreaker.Success)
+			So(b.State(), ShouldEqual, circuitbreaker.StateHalfOpen)
+			done2(circuitbreaker.Success)
+			So(b.State(), ShouldEqual, circuitbreaker.StateClosed)
+			So(changes, ShouldResemble, []string{"closed->open", "open->half-open", "half-open->closed"})
+		})
+
+		Convey("探测失败重新熔断", func() {
+			for i := 0; i < 4; i++ {
+				So(request(false), ShouldBeNil)
+			}
+			time.Sleep(60 * time.Millisecond)
+			So(request(false), ShouldBeNil)
+			So(b.State(), ShouldEqual, circuitbreaker.StateOpen)
+		})
+	})
+}
+
+func TestGroup(t *testing.T) {
+	Convey("按名称获取熔断器", t, func() {
+		g := circuitbreaker.NewGroup(circuitbreaker.Settings{MinRequests: 1})
+		So(g.Get("a"), ShouldEqual, g.Get("a"))
+		So(g.Get("a"), ShouldNotEqual, g.Get("b"))
+
+		done, err := g.Get("a").Allow()
+		So(err, ShouldBeNil)
+		done(circuitbreaker.Failure)
+		So(g.States(), ShouldResemble, map[string]circuitbreaker.State{
+			"a": circuitbreaker.StateOpen,
+			"b": circuitbreaker.StateClosed,
+		})
+	})
+}
+
+func TestClassify(t *testing.T) {
+	Convey("调用结果分类", t, func() {
+		ctx := context.Background()
+		So(circuitbreaker.Classify(ctx, nil, false), ShouldEqual, circuitbreaker.Success)
+		So(circuitbreaker.Classify(ctx, nil, true), ShouldEqual, circuitbreaker.Failure)
+		So(circuitbreaker.Classify(ctx, errors.Wrap(code.ErrValidation, "bad"), false), ShouldEqual, circuitbreaker.Success)
+		So(circuitbreaker.Classify(ctx, &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, false), ShouldEqual, circuitbreaker.Failure)
+		So(circuitbreaker.Classify(ctx, io.ErrUnexpectedEOF, false), ShouldEqual, circuitbreaker.Failure)
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		So(circuitbreaker.Classify(canceled, context.Canceled, false), ShouldEqual, circuitbreaker.Ignored)
+	})
+}
@@ -0,0 +1,33 @@
+package circuitbreaker
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"net"
+)
+
+// Classify returns result of a finished call. Calls canceled by caller are ignored, transport errors
+// and server errors are failures, others such as business errors and client errors are successes.
+// serverError is reported by protocol, such as http status >= 500 or gRPC code Unavailable.
+func Classify(ctx context.Context, err error, serverError bool) Result {
+	switch {
+	case err != nil && stderrors.Is(ctx.Err(), context.Canceled):
+		return Ignored
+	case serverError || IsTransportError(err):
+		return Failure
+	default:
+		return Success
+	}
+}
+
+// IsTransportError reports whether err is a transport error, such as connection refused, reset,
+// timeout or unexpected EOF. Errors converted by `errors.UpdateStack` lose their type and are not.
+func IsTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return stderrors.As(err, &netErr) || stderrors.Is(err, context.DeadlineExceeded) ||
+		stderrors.Is(err, io.EOF) || stderrors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -134,7 +134,77 @@ const (
 )
 
 // common: Http  server error.
-const ()
+const (
+	// @HTTP 400
+	// @MessageCN  不支持的API版本
+	// @MessageEN  API version is not supported.
+	ErrAPIVersionUnsupported int = iota + 100401
+
+	// @HTTP 410
+	// @MessageCN  API已下线
+	// @MessageEN  API has been sunset.
+	ErrAPISunset
+
+	// @HTTP 404
+	// @MessageCN  操作不存在
+	// @MessageEN  Operation not found.
+	ErrOperationNotFound
+
+	// @HTTP 503
+	// @MessageCN  操作队列已满
+	// @MessageEN  Operation queue is full.
+	ErrOperationQueueFull
+
+	// @HTTP 400
+	// @MessageCN  操作已取消
+	// @MessageEN  Operation has been canceled.
+	ErrOperationCanceled
+
+	// @HTTP 400
+	// @MessageCN  操作已结束
+	// @MessageEN  Operation has already finished.
+	ErrOperationFinished
+
+	// @HTTP 404
+	// @MessageCN  资源不存在
+	// @MessageEN  Resource not found.
+	ErrResourceNotFound
+
+	// @HTTP 409
+	// @MessageCN  资源已存在
+	// @MessageEN  Resource already exists.
+	ErrResourceAlreadyExist
+
+	// @HTTP 409
+	// @MessageCN  资源版本冲突
+	// @MessageEN  Resource version conflict.
+	ErrResourceConflict
+
+	// @HTTP 410
+	// @MessageCN  资源版本过旧
+	// @MessageEN  Resource version is too old.
+	ErrResourceVersionTooOld
+
+	// @HTTP 412
+	// @MessageCN  前置条件不满足
+	// @MessageEN  Precondition failed.
+	ErrPreconditionFailed
+
+	// @HTTP 413
+	// @MessageCN  请求体过大
+	// @MessageEN  Request entity too large.
+	ErrRequestEntityTooLarge
+
+	// @HTTP 503
+	// @MessageCN  服务维护中
+	// @MessageEN  Service is under maintenance.
+	ErrServiceInMaintenance
+
+	// @HTTP 503
+	// @MessageCN  服务过载
+	// @MessageEN  Service is overloaded.
+	ErrServiceOverloaded
+)
 
 // common: Http  client error.
 const (
@@ -152,6 +222,11 @@ const (
 	// @MessageCN  生成HTTP客户端失败
 	// @MessageEN  Generate HTTP client error.
 	ErrHTTPClientGenerateError
+
+	// @HTTP 503
+	// @MessageCN  熔断器已打开
+	// @MessageEN  Circuit breaker is open.
+	ErrCircuitOpen
 )
 
 // common: gRPC  server error.
@@ -27,9 +27,24 @@ func init() {
 	register(ErrInvalidYaml, 500, map[string]string{"MessageCN": "数据非有效YAML结构", "MessageEN": "Data is not valid Yaml."})
 	register(ErrEncodingYaml, 500, map[string]string{"MessageCN": "YAML数据编码失败", "MessageEN": "Yaml data could not be encoded."})
 	register(ErrDecodingYaml, 500, map[string]string{"MessageCN": "YAML数据编码失败", "MessageEN": "Yaml data could not be decoded."})
+	register(ErrAPIVersionUnsupported, 400, map[string]string{"MessageCN": "不支持的API版本", "MessageEN": "API version is not supported."})
+	register(ErrAPISunset, 410, map[string]string{"MessageCN": "API已下线", "MessageEN": "API has been sunset."})
+	register(ErrOperationNotFound, 404, map[string]string{"MessageCN": "操作不存在", "MessageEN": "Operation not found."})
+	register(ErrOperationQueueFull, 503, map[string]string{"MessageCN": "操作队列已满", "MessageEN": "Operation queue is full."})
+	register(ErrOperationCanceled, 400, map[string]string{"MessageCN": "操作已取消", "MessageEN": "Operation has been canceled."})
+	register(ErrOperationFinished, 400, map[string]string{"MessageCN": "操作已结束", "MessageEN": "Operation has already finished."})
+	register(ErrResourceNotFound, 404, map[string]string{"MessageCN": "资源不存在", "MessageEN": "Resource not found."})
+	register(ErrResourceAlreadyExist, 409, map[string]string{"MessageCN": "资源已存在", "MessageEN": "Resource already exists."})
+	register(ErrResourceConflict, 409, map[string]string{"MessageCN": "资源版本冲突", "MessageEN": "Resource version conflict."})
+	register(ErrResourceVersionTooOld, 410, map[string]string{"MessageCN": "资源版本过旧", "MessageEN": "Resource version is too old."})
+	register(ErrPreconditionFailed, 412, map[string]string{"MessageCN": "前置条件不满足", "MessageEN": "Precondition failed."})
+	register(ErrRequestEntityTooLarge, 413, map[string]string{"MessageCN": "请求体过大", "MessageEN": "Request entity too large."})
+	register(ErrServiceInMaintenance, 503, map[string]string{"MessageCN": "服务维护中", "MessageEN": "Service is under maintenance."})
+	register(ErrServiceOverloaded, 503, map[string]string{"MessageCN": "服务过载", "MessageEN": "Service is overloaded."})
 	register(ErrHTTPError, 500, map[string]string{"MessageCN": "HTTP请求失败", "MessageEN": "HTTP request error."})
 	register(ErrHTTPResponseDataParseError, 500, map[string]string{"MessageCN": "解析HTTP服务返回数据失败", "MessageEN": "Decode data from http response error."})
 	register(ErrHTTPClientGenerateError, 500, map[string]string{"MessageCN": "生成HTTP客户端失败", "MessageEN": "Generate HTTP client error."})
+	register(ErrCircuitOpen, 503, map[string]string{"MessageCN": "熔断器已打开", "MessageEN": "Circuit breaker is open."})
 	register(ErrGRPCClientGenerateError, 500, map[string]string{"MessageCN": "生成gRPC客户端失败", "MessageEN": "Generate gRPC client error."})
 	register(ErrGRPCClientCertificateError, 500, map[string]string{"MessageCN": "gRPC客户端证书错误", "MessageEN": "Validate gRPC client certificate error."})
 	register(ErrGRPCClientDialError, 500, map[string]string{"MessageCN": "gRPC客户端连接失败", "MessageEN": "Dial to gRPC server error."})
@@ -126,9 +126,9 @@ func registerPre(coder Coder) {
 		panic(fmt.Sprintf("coder `%v` has message map  key `%v` value is empty", coder.Code(), MessageLangCNKey))
 	}
 
-	found := sets.NewInt(200, 400, 401, 403, 404, 500).Has(coder.HTTPStatus())
+	found := sets.NewInt(200, 400, 401, 403, 404, 409, 410, 412, 413, 500, 503).Has(coder.HTTPStatus())
 	if !found {
-		panic("http code not in `200, 400, 401, 403, 404, 500`")
+		panic("http code not in `200, 400, 401, 403, 404, 409, 410, 412, 413, 500, 503`")
 	}
 }
 
@@ -0,0 +1,8 @@
+//go:build faultinject
+// +build faultinject
+
+package faultinject
+
+// BuildEnabled reports whether binary is built with `faultinject` tag, which enables fault
+// injection regardless of config.
+const BuildEnabled = true
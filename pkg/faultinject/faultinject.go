@@ -0,0 +1,201 @@
+package faultinject
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangweihong/eazycloud/pkg/errors"
+)
+
+// Rule injects fault into requests it matches. A request matches if all conditions set match,
+// and only Percentage of matched requests are injected.
+type Rule struct {
+	Name string `json:"name"`
+	// Routes are HTTP request paths or gRPC full methods, pattern ending with `/*` matches all routes
+	// with the prefix. Empty matches all routes.
+	Routes []string `json:"routes,omitempty"`
+	// Methods are HTTP methods, empty matches all methods.
+	Methods []string `json:"methods,omitempty"`
+	// Headers must all be matched, keys of gRPC metadata are in lowercase.
+	Headers map[string]string `json:"headers,omitempty"`
+	// RequestIDs are request ids to inject.
+	RequestIDs []string `json:"requestIDs,omitempty"`
+	// Percentage of matched requests to inject, between 0 and 100. Zero means all.
+	Percentage float64 `json:"percentage,omitempty"`
+
+	// Delay is latency added before handling request, such as `200ms`.
+	Delay string `json:"delay,omitempty"`
+	// AbortCode aborts request with the `errors` code.
+	AbortCode int `json:"abortCode,omitempty"`
+	// Reset resets connection without response.
+	Reset bool `json:"reset,omitempty"`
+	// Panic panics in handler chain.
+	Panic bool `json:"panic,omitempty"`
+}
+
+// Validate checks validation of Rule.
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if r.Percentage < 0 || r.Percentage > 100 {
+		return fmt.Errorf("rule `%s`: percentage must be between 0 and 100", r.Name)
+	}
+	if r.Delay != "" {
+		if d, err := time.ParseDuration(r.Delay); err != nil || d < 0 {
+			return fmt.Errorf("rule `%s`: invalid delay `%s`", r.Name, r.Delay)
+		}
+	}
+	if r.AbortCode != 0 && errors.ParseCoder(errors.Wrap(r.AbortCode, "")).Code() != r.AbortCode {
+		return fmt.Errorf("rule `%s`: abort code %d is not registered", r.Name, r.AbortCode)
+	}
+	if r.Delay == "" && r.AbortCode == 0 && !r.Reset && !r.Panic {
+		return fmt.Errorf("rule `%s`: no fault to inject", r.Name)
+	}
+	return nil
+}
+
+// Request describes a request to match rules.
+type Request struct {
+	Route     string
+	Method    string
+	RequestID string
+	// Header returns value of header key.
+	Header func(key string) string
+}
+
+// Fault is the fault to inject into request.
+type Fault struct {
+	Rule      string
+	Delay     time.Duration
+	AbortCode int
+	Reset     bool
+	Panic     bool
+}
+
+// Sleep waits for Delay, it returns ctx error if ctx done before.
+func (f *Fault) Sleep(ctx context.Context) error {
+	if f.Delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(f.Delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Error returns error of AbortCode, nil if not aborted.
+func (f *Fault) Error() error {
+	if f.AbortCode == 0 {
+		return nil
+	}
+	return errors.WrapF(f.AbortCode, "fault injected by rule `%s`", f.Rule)
+}
+
+// Injector matches requests against rules which can be replaced at runtime.
+type Injector struct {
+	lock  sync.RWMutex
+	rules []Rule
+
+	randLock sync.Mutex
+	rand     *rand.Rand
+}
+
+// NewInjector creates an injector without rules.
+func NewInjector() *Injector {
+	return &Injector{rand: rand.New(rand.NewSource(time.Now().UnixNano()))} // nolint: gosec
+}
+
+// SetRules replaces all rules, rule names must be unique.
+func (i *Injector) SetRules(rules []Rule) error {
+	names := make(map[string]bool, len(rules))
+	for idx := range rules {
+		if err := rules[idx].Validate(); err != nil {
+			return err
+		}
+		if names[rules[idx].Name] {
+			return fmt.Errorf("rule `%s` is repeated", rules[idx].Name)
+		}
+		names[rules[idx].Name] = true
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.rules = append([]Rule{}, rules...)
+	return nil
+}
+
+// Rules returns current rules.
+func (i *Injector) Rules() []Rule {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return append([]Rule{}, i.rules...)
+}
+
+// Match returns fault of the first rule matching and sampling req, nil if no fault to inject.
+func (i *Injector) Match(req Request) *Fault {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	for idx := range i.rules {
+		r := &i.rules[idx]
+		if !r.matches(&req) {
+			continue
+		}
+		if r.Percentage > 0 && r.Percentage < 100 && i.float()*100 >= r.Percentage {
+			continue
+		}
+		// validated already
+		delay, _ := time.ParseDuration(r.Delay)
+		return &Fault{Rule: r.Name, Delay: delay, AbortCode: r.AbortCode, Reset: r.Reset, Panic: r.Panic}
+	}
+	return nil
+}
+
+func (i *Injector) float() float64 {
+	i.randLock.Lock()
+	defer i.randLock.Unlock()
+	return i.rand.Float64()
+}
+
+func (r *Rule) matches(req *Request) bool {
+	if len(r.Routes) > 0 && !matchAny(r.Routes, req.Route, matchRoute) {
+		return false
+	}
+	if len(r.Methods) > 0 && !matchAny(r.Methods, req.Method, strings.EqualFold) {
+		return false
+	}
+	if len(r.RequestIDs) > 0 && !matchAny(r.RequestIDs, req.RequestID, func(p, v string) bool { return p == v }) {
+		return false
+	}
+	for k, v := range r.Headers {
+		if req.Header == nil || req.Header(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, p := range patterns {
+		if match(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRoute(pattern, route string) bool {
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(route, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == route
+}
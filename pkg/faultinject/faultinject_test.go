@@ -0,0 +1,77 @@
+package faultinject_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/faultinject"
+)
+
+func TestInjector(t *testing.T) {
+	Convey("故障注入规则", t, func() {
+		inj := faultinject.NewInjector()
+		So(inj.Match(faultinject.Request{Route: "/v1/widgets"}), ShouldBeNil)
+
+		Convey("非法规则", func() {
+			So(inj.SetRules([]faultinject.Rule{{Name: "noop"}}), ShouldNotBeNil)
+			So(inj.SetRules([]faultinject.Rule{{Name: "bad", Delay: "1x"}}), ShouldNotBeNil)
+			So(inj.SetRules([]faultinject.Rule{{Name: "bad", AbortCode: 99999999}}), ShouldNotBeNil)
+			So(inj.SetRules([]faultinject.Rule{{Name: "bad", Reset: true, Percentage: 101}}), ShouldNotBeNil)
+			So(inj.SetRules([]faultinject.Rule{{Name: "dup", Reset: true}, {Name: "dup", Panic: true}}), ShouldNotBeNil)
+		})
+
+		Convey("按路由,方法,请求头和请求ID匹配", func() {
+			So(inj.SetRules([]faultinject.Rule{
+				{Name: "by-id", RequestIDs: []string{"req-1"}, Reset: true},
+				{
+					Name:      "abort",
+					Routes:    []string{"/v1/*"},
+					Methods:   []string{"post"},
+					Headers:   map[string]string{"X-Fault": "on"},
+					AbortCode: code.ErrServiceOverloaded,
+				},
+			}), ShouldBeNil)
+
+			header := http.Header{"X-Fault": []string{"on"}}
+			f := inj.Match(faultinject.Request{Route: "/v1/widgets", Method: http.MethodPost, Header: header.Get})
+			So(f, ShouldNotBeNil)
+			So(f.Rule, ShouldEqual, "abort")
+			So(errors.IsCode(f.Error(), code.ErrServiceOverloaded), ShouldBeTrue)
+
+			So(inj.Match(faultinject.Request{Route: "/v1/widgets", Method: http.MethodGet, Header: header.Get}), ShouldBeNil)
+			So(inj.Match(faultinject.Request{Route: "/v2/widgets", Method: http.MethodPost, Header: header.Get}), ShouldBeNil)
+			So(inj.Match(faultinject.Request{Route: "/v1/widgets", Method: http.MethodPost}), ShouldBeNil)
+
+			f = inj.Match(faultinject.Request{Route: "/any", RequestID: "req-1"})
+			So(f, ShouldNotBeNil)
+			So(f.Reset, ShouldBeTrue)
+		})
+
+		Convey("按百分比采样", func() {
+			So(inj.SetRules([]faultinject.Rule{{Name: "half", Panic: true, Percentage: 50}}), ShouldBeNil)
+			hits := 0
+			for i := 0; i < 1000; i++ {
+				if inj.Match(faultinject.Request{Route: "/v1/widgets"}) != nil {
+					hits++
+				}
+			}
+			So(hits, ShouldBeBetween, 350, 650)
+		})
+
+		Convey("延迟可被取消", func() {
+			So(inj.SetRules([]faultinject.Rule{{Name: "slow", Delay: "1h"}}), ShouldBeNil)
+			f := inj.Match(faultinject.Request{})
+			So(f.Delay, ShouldEqual, time.Hour)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			So(f.Sleep(ctx) == context.DeadlineExceeded, ShouldBeTrue)
+		})
+	})
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/wangweihong/eazycloud/pkg/errors"
 	"github.com/wangweihong/eazycloud/pkg/log"
 	"github.com/wangweihong/eazycloud/pkg/tls/grpctls"
+	"github.com/wangweihong/eazycloud/pkg/token"
 )
 
 // type CallerHandler func(ctx context.Context, conn *grpc.ClientConn) (interface{}, error).
@@ -41,6 +42,10 @@ type Client struct {
 	// 拦截器列表
 	interceptors        []string
 	interceptorSkippers []skipper.SkipperFunc
+	// 访问令牌
+	tokenSource token.TokenSource
+	// 允许通过非TLS连接发送令牌
+	tokenInsecure bool
 }
 
 func NewClient(addr string, options ...Option) (*Client, error) {
@@ -81,6 +86,10 @@ func (c *Client) validate() error {
 		}
 	}
 
+	if c.tokenSource != nil && !c.tlsEnabled && !c.tokenInsecure {
+		return fmt.Errorf("must enable tls or allow insecure token transport when tokenSource set")
+	}
+
 	if c.mtlsEnabled {
 		if c.clientKeyData == "" || c.clientCertData == "" {
 			return fmt.Errorf("must provide clientKeyPEMData and clientCertPEMData when enable mTls")
@@ -156,6 +165,9 @@ func (c *Client) getClientConn(ctx context.Context, addr string, copt ...grpc.Ca
 		log.F(ctx).Debugf("install unary client interceptors: %s", m)
 		chainInterceptors = append(chainInterceptors, mw)
 	}
+	if c.tokenSource != nil {
+		chainInterceptors = append(chainInterceptors, tokenUnaryClientInterceptor(c.tokenSource, !c.tokenInsecure))
+	}
 
 	var opt []grpc.DialOption
 	opt = append(opt,
@@ -2,6 +2,9 @@ package grpccli_test
 
 import (
 	"context"
+	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,16 +15,25 @@ import (
 	"github.com/wangweihong/eazycloud/pkg/skipper"
 
 	"github.com/wangweihong/eazycloud/pkg/grpccli/interceptorcli/callstatus"
+	circuitbreakercli "github.com/wangweihong/eazycloud/pkg/grpccli/interceptorcli/circuitbreaker"
 
 	"github.com/wangweihong/eazycloud/pkg/grpcproto/apis/debug"
 
+	"github.com/wangweihong/eazycloud/pkg/circuitbreaker"
+	"github.com/wangweihong/eazycloud/pkg/code"
 	"github.com/wangweihong/eazycloud/pkg/errors"
 	"github.com/wangweihong/eazycloud/pkg/grpcsvr/interceptor"
 	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/token"
 	"github.com/wangweihong/eazycloud/pkg/tracectx"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/wangweihong/eazycloud/pkg/grpcproto/apis/version"
 )
@@ -237,3 +249,106 @@ func TestClient_Interceptors(t *testing.T) {
 		})
 	})
 }
+
+func TestCircuitBreakerInterceptor(t *testing.T) {
+	Convey("熔断拦截器", t, func() {
+		cc, err := grpc.Dial("127.0.0.1:1", grpc.WithInsecure())
+		So(err, ShouldBeNil)
+		defer cc.Close()
+
+		group := circuitbreaker.NewGroup(circuitbreaker.Settings{MinRequests: 2, OpenDuration: time.Minute})
+		interceptor := circuitbreakercli.UnaryClientInterceptor(group, true)
+		calls := 0
+		invoke := func(method string, invokeErr error) error {
+			return interceptor(context.Background(), method, nil, nil, cc,
+				func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+					calls++
+					return invokeErr
+				})
+		}
+
+		Convey("业务错误不计为失败", func() {
+			for i := 0; i < 3; i++ {
+				So(invoke("/svc/A", errors.Wrap(code.ErrValidation, "bad")), ShouldNotBeNil)
+			}
+			So(calls, ShouldEqual, 3)
+		})
+
+		Convey("服务不可用时按方法熔断", func() {
+			unavailable := status.Error(codes.Unavailable, "down")
+			So(invoke("/svc/A", unavailable), ShouldNotBeNil)
+			So(invoke("/svc/A", errors.UpdateStack(unavailable)), ShouldNotBeNil)
+			err := invoke("/svc/A", nil)
+			So(errors.IsCode(err, code.ErrCircuitOpen), ShouldBeTrue)
+			So(calls, ShouldEqual, 2)
+
+			So(invoke("/svc/B", nil), ShouldBeNil)
+			So(calls, ShouldEqual, 3)
+		})
+	})
+}
+
+func TestClient_TokenSource(t *testing.T) {
+	Convey("访问令牌", t, func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		var lock sync.Mutex
+		var received []string
+		s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			auth := strings.Join(md.Get("authorization"), ",")
+			lock.Lock()
+			received = append(received, auth)
+			lock.Unlock()
+			if auth != "Bearer new" {
+				return nil, status.Error(codes.Unauthenticated, "token expired")
+			}
+			return handler(ctx, req)
+		}))
+		healthpb.RegisterHealthServer(s, health.NewServer())
+		go func() {
+			_ = s.Serve(lis)
+		}()
+		defer s.Stop()
+
+		check := func(c *grpccli.Client) error {
+			return c.Call(context.Background(), func(ctx context.Context, conn *grpc.ClientConn) error {
+				_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+				return err
+			})
+		}
+
+		Convey("令牌被拒绝后使用新令牌重试", func() {
+			tokens := []string{"old", "new"}
+			source := token.NewCachedTokenSource(token.TokenSourceFunc(func(ctx context.Context) (*token.Token, error) {
+				t := &token.Token{AccessToken: tokens[0], Expiry: time.Now().Add(time.Hour)}
+				tokens = tokens[1:]
+				return t, nil
+			}), 0)
+			c, err := grpccli.NewClient(lis.Addr().String(), grpccli.WithTokenSource(source), grpccli.WithInsecureTokenTransport())
+			So(err, ShouldBeNil)
+			defer c.Close()
+
+			So(check(c), ShouldBeNil)
+			So(check(c), ShouldBeNil)
+			So(received, ShouldResemble, []string{"Bearer old", "Bearer new", "Bearer new"})
+		})
+
+		Convey("静态令牌不重试", func() {
+			c, err := grpccli.NewClient(lis.Addr().String(), grpccli.WithTokenSource(token.StaticTokenSource("old")),
+				grpccli.WithInsecureTokenTransport())
+			So(err, ShouldBeNil)
+			defer c.Close()
+
+			err = check(c)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Unauthenticated")
+			So(received, ShouldResemble, []string{"Bearer old"})
+		})
+
+		Convey("默认不通过非TLS连接发送令牌", func() {
+			_, err := grpccli.NewClient(lis.Addr().String(), grpccli.WithTokenSource(token.StaticTokenSource("old")))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,92 @@
+package circuitbreaker
+
+import (
+	"context"
+	"regexp"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/wangweihong/eazycloud/pkg/circuitbreaker"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// DefaultGroup is used by the interceptor registered in interceptorcli.
+var DefaultGroup = circuitbreaker.NewGroup(circuitbreaker.Settings{})
+
+// FailureCodes are gRPC codes counted as failures.
+var FailureCodes = []codes.Code{
+	codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown,
+}
+
+// errors converted by `errors.UpdateStack` keep only message of status.
+var statusCodeRegexp = regexp.MustCompile(`rpc error: code = (\w+)`)
+
+// UnaryClientInterceptor returns a new unary client interceptor for circuit breaking.
+// Breakers are keyed by target, or by target and method if perMethod is true. Requests are rejected with
+// `code.ErrCircuitOpen` error when circuit is open. Only errors of FailureCodes and transport errors are
+// counted as failures, business errors in CallStatus are not, see circuitbreaker.Classify.
+func UnaryClientInterceptor(group *circuitbreaker.Group, perMethod bool, skipperFunc ...skipper.SkipperFunc) grpc.UnaryClientInterceptor {
+	name := "circuitbreaker"
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(method, skipperFunc...) {
+			log.F(ctx).Debugf("skip interceptor %s for %s", name, method)
+
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		key := cc.Target()
+		if perMethod {
+			key += method
+		}
+		done, err := group.Get(key).Allow()
+		if err != nil {
+			log.F(ctx).Warnf("%s rejected:%v", method, err)
+			return err
+		}
+
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(circuitbreaker.Classify(ctx, err, isFailure(err)))
+		return errors.UpdateStack(err)
+	}
+}
+
+// isFailure reports whether err is a server error of FailureCodes.
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	c, ok := statusCode(err)
+	if !ok {
+		return false
+	}
+	for _, fc := range FailureCodes {
+		if c == fc {
+			return true
+		}
+	}
+	return false
+}
+
+func statusCode(err error) (codes.Code, bool) {
+	if s, ok := status.FromError(err); ok {
+		return s.Code(), true
+	}
+	m := statusCodeRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return codes.OK, false
+	}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c.String() == m[1] {
+			return c, true
+		}
+	}
+	return codes.OK, false
+}
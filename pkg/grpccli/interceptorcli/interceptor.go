@@ -4,14 +4,16 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/wangweihong/eazycloud/pkg/grpccli/interceptorcli/callstatus"
+	"github.com/wangweihong/eazycloud/pkg/grpccli/interceptorcli/circuitbreaker"
 	"github.com/wangweihong/eazycloud/pkg/grpccli/interceptorcli/logging"
 
 	"github.com/wangweihong/eazycloud/pkg/skipper"
 )
 
 const (
-	InterceptorNameLogger     = "logger"
-	InterceptorNameCallStatus = "callstatus"
+	InterceptorNameLogger         = "logger"
+	InterceptorNameCallStatus     = "callstatus"
+	InterceptorNameCircuitBreaker = "circuitbreaker"
 )
 
 var (
@@ -21,8 +23,9 @@ var (
 
 func defaultUnaryClientInterceptorList(skipperFunc ...skipper.SkipperFunc) map[string]grpc.UnaryClientInterceptor {
 	return map[string]grpc.UnaryClientInterceptor{
-		InterceptorNameLogger:     logging.UnaryClientInterceptor(skipperFunc...),
-		InterceptorNameCallStatus: callstatus.UnaryClientInterceptor(skipperFunc...),
+		InterceptorNameLogger:         logging.UnaryClientInterceptor(skipperFunc...),
+		InterceptorNameCallStatus:     callstatus.UnaryClientInterceptor(skipperFunc...),
+		InterceptorNameCircuitBreaker: circuitbreaker.UnaryClientInterceptor(circuitbreaker.DefaultGroup, false, skipperFunc...),
 	}
 }
 
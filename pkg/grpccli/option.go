@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/wangweihong/eazycloud/pkg/skipper"
+	"github.com/wangweihong/eazycloud/pkg/token"
 
 	"google.golang.org/grpc"
 )
@@ -76,3 +77,19 @@ func WithDialOption(opt ...grpc.DialOption) Option {
 		c.dialOpts = opt
 	}
 }
+
+// WithTokenSource 每次调用以per-RPC credentials设置source的访问令牌.
+// 调用因令牌过期被拒绝(Unauthenticated)时, source实现token.Invalidator则令牌失效后重试一次.
+// 令牌默认仅允许通过TLS连接发送, 见WithInsecureTokenTransport.
+func WithTokenSource(source token.TokenSource) Option {
+	return func(c *Client) {
+		c.tokenSource = source
+	}
+}
+
+// WithInsecureTokenTransport 允许通过非TLS连接发送访问令牌, 仅用于测试或可信网络.
+func WithInsecureTokenTransport() Option {
+	return func(c *Client) {
+		c.tokenInsecure = true
+	}
+}
@@ -0,0 +1,64 @@
+package grpccli
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/token"
+)
+
+type tokenCredentials struct {
+	source     token.TokenSource
+	requireTLS bool
+}
+
+// TokenCredentials returns per-RPC credentials setting `authorization` metadata with token of source,
+// requireTLS refuses to send token over insecure connection.
+func TokenCredentials(source token.TokenSource, requireTLS bool) credentials.PerRPCCredentials {
+	return &tokenCredentials{source: source, requireTLS: requireTLS}
+}
+
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	t, err := c.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": t.AuthorizationHeader()}, nil
+}
+
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// tokenUnaryClientInterceptor sets token of source as per-RPC credentials of each call, requireTLS refuses to
+// send token over insecure connection. Call rejected with Unauthenticated is retried once with new token
+// if source is token.Invalidator.
+func tokenUnaryClientInterceptor(source token.TokenSource, requireTLS bool) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		invalidator, retryable := source.(token.Invalidator)
+		for attempt := 1; ; attempt++ {
+			t, err := source.Token(ctx)
+			if err != nil {
+				log.F(ctx).Errorf("get token err:%s", err.Error())
+				return errors.WrapError(code.ErrTokenInvalid, err)
+			}
+
+			used := token.TokenSourceFunc(func(ctx context.Context) (*token.Token, error) { return t, nil })
+			callOpts := append(opts[:len(opts):len(opts)], grpc.PerRPCCredentials(TokenCredentials(used, requireTLS)))
+			err = invoker(ctx, method, req, reply, cc, callOpts...)
+			if attempt == 1 && retryable && status.Code(err) == codes.Unauthenticated {
+				log.F(ctx).Warnf("token rejected by %s, retry with new token", method)
+				invalidator.Invalidate(t)
+				continue
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package watchservice
+
+import (
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/grpcproto/apis/callstatus"
+	"github.com/wangweihong/eazycloud/pkg/grpcproto/apis/watch"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/resource"
+	"github.com/wangweihong/eazycloud/pkg/json"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+type watchService struct {
+	lock   sync.RWMutex
+	stores map[string]*resource.Store
+}
+
+var defaultWatchService = &watchService{stores: make(map[string]*resource.Store)}
+
+// AddStore makes changes of store watchable by resource name.
+func AddStore(store *resource.Store) {
+	defaultWatchService.lock.Lock()
+	defer defaultWatchService.lock.Unlock()
+	defaultWatchService.stores[store.Resource().Name] = store
+}
+
+// Watch streams changes of resource. Error such as resource version too old is sent
+// as an event with call status, then stream is closed.
+func (s *watchService) Watch(req *watch.WatchRequest, stream watch.WatchService_WatchServer) error {
+	ctx := stream.Context()
+
+	s.lock.RLock()
+	store, ok := s.stores[req.GetResource()]
+	s.lock.RUnlock()
+	if !ok {
+		err := errors.WrapF(code.ErrResourceNotFound, "resource %s is not watchable", req.GetResource())
+		return stream.Send(&watch.WatchEvent{CallStatus: callstatus.FromError(err)})
+	}
+
+	ch, err := store.Watch(ctx, req.GetResourceVersion(), req.GetSelector())
+	if err != nil {
+		return stream.Send(&watch.WatchEvent{CallStatus: callstatus.FromError(err)})
+	}
+
+	for e := range ch {
+		data, err := json.Marshal(e.Object)
+		if err != nil {
+			log.F(ctx).Errorf("marshal %s object fail:%v", req.GetResource(), err)
+			return stream.Send(&watch.WatchEvent{
+				CallStatus: callstatus.FromError(errors.WrapError(code.ErrEncodingJSON, err)),
+			})
+		}
+		if err := stream.Send(&watch.WatchEvent{
+			CallStatus:      callstatus.FromError(nil),
+			Type:            string(e.Type),
+			ResourceVersion: e.ResourceVersion,
+			Object:          data,
+		}); err != nil {
+			log.F(ctx).Warnf("send %s watch event fail:%v", req.GetResource(), err)
+			return err
+		}
+	}
+	return nil
+}
+
+func RegisterWatchService(s *grpc.Server) {
+	watch.RegisterWatchServiceServer(s, defaultWatchService)
+}
@@ -0,0 +1,69 @@
+package grpcsvr_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/wangweihong/eazycloud/pkg/grpcproto/apis/version"
+	"github.com/wangweihong/eazycloud/pkg/grpcsvr"
+	"github.com/wangweihong/eazycloud/pkg/grpcsvr/grpcoptions"
+)
+
+func TestGRPCServer_Authorize(t *testing.T) {
+	Convey("通过选项启用调用鉴权", t, func() {
+		dir, err := ioutil.TempDir("", "authz")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "policy.yaml")
+		policy := `
+roles:
+- name: caller
+  rules:
+  - verbs: [call]
+    resources: [version.VersionService]
+bindings:
+- role: caller
+  subjects: [alice]
+`
+		So(ioutil.WriteFile(file, []byte(policy), 0o600), ShouldBeNil)
+
+		opts := grpcoptions.NewServerRunOptions()
+		opts.AuthzPolicyFile = file
+		So(opts.Validate(), ShouldBeEmpty)
+		conf := grpcsvr.NewConfig()
+		So(opts.ApplyTo(conf), ShouldBeNil)
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+		So(s.Authorizer, ShouldNotBeNil)
+
+		lis := bufconn.Listen(1 << 20)
+		go func() {
+			_ = s.Serve(lis)
+		}()
+		defer s.Close()
+
+		conn, err := grpc.Dial("bufnet",
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+			grpc.WithInsecure(),
+		)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		client := version.NewVersionServiceClient(conn)
+
+		_, err = client.Version(context.Background(), &version.VersionRequest{})
+		So(err, ShouldNotBeNil)
+
+		// authorizer is shared, changes apply to the server
+		s.Authorizer.SetDryRun(true)
+		_, err = client.Version(context.Background(), &version.VersionRequest{})
+		So(err, ShouldBeNil)
+	})
+}
@@ -9,7 +9,15 @@ import (
 
 	"github.com/wangweihong/eazycloud/pkg/tls"
 
+	"github.com/wangweihong/eazycloud/pkg/authz"
+	"github.com/wangweihong/eazycloud/pkg/faultinject"
+	"github.com/wangweihong/eazycloud/pkg/grpcproto/service/watchservice"
 	"github.com/wangweihong/eazycloud/pkg/grpcsvr/interceptor"
+	authzinterceptor "github.com/wangweihong/eazycloud/pkg/grpcsvr/interceptor/authz"
+	faultinjectinterceptor "github.com/wangweihong/eazycloud/pkg/grpcsvr/interceptor/faultinject"
+	maintenanceinterceptor "github.com/wangweihong/eazycloud/pkg/grpcsvr/interceptor/maintenance"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/resource"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
 
 	"github.com/wangweihong/eazycloud/pkg/log"
 	//"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc".
@@ -26,9 +34,38 @@ type GRPCConfig struct {
 	Version            bool
 	Reflect            bool
 	Debug              bool
+	Watch              bool
 	UnaryInterceptors  []string
 	StreamInterceptors []string
 	RuntimeDebug       *debug.RuntimeDebugInfo
+	// Maintenance rejects calls in maintenance or overloaded if not nil, it can be shared with http server.
+	// It's created from MaintenanceConfig if nil.
+	Maintenance       *maintenance.Switch
+	MaintenanceConfig *MaintenanceInfo
+	// Authorizer authorizes unary and stream calls after interceptors above if not nil,
+	// it can be shared with http server. It's created from AuthzPolicyFile if nil.
+	Authorizer *authz.Authorizer
+	// AuthzPolicyFile is the yaml policy file, reloaded when changed. Empty disables authorization.
+	AuthzPolicyFile string
+	// AuthzDryRun only logs denied calls without rejecting them.
+	AuthzDryRun bool
+	// FaultInjector injects faults into calls after interceptors above if not nil, only for resilience testing.
+	FaultInjector *faultinject.Injector
+	// WatchStores are watchable through watch service if Watch is enabled.
+	WatchStores []*resource.Store
+}
+
+// MaintenanceInfo configures maintenance mode and load shedding.
+type MaintenanceInfo struct {
+	// Enable creates maintenance switch, mode can be changed at runtime only if enabled.
+	Enable bool
+	// Mode is the initial mode, `off`, `readonly` or `full`.
+	Mode       string
+	RetryAfter int
+	// MaxInFlight sheds calls when in-flight calls reach it, zero means no limit.
+	MaxInFlight int64
+	// AllowRoutes are full methods always served, pattern ending with `/*` matches all methods with the prefix.
+	AllowRoutes []string
 }
 
 // NewConfig returns a Config struct with the default values.
@@ -47,6 +84,13 @@ func NewConfig() *GRPCConfig {
 			Enable:    false,
 			OutputDir: "",
 		},
+		MaintenanceConfig: &MaintenanceInfo{
+			Enable:      false,
+			Mode:        string(maintenance.ModeOff),
+			RetryAfter:  maintenance.DefaultRetryAfter,
+			MaxInFlight: 0,
+			AllowRoutes: maintenance.DefaultAllowedRoutes,
+		},
 	}
 }
 
@@ -85,7 +129,55 @@ func (c *CompletedGRPCConfig) New() (*GRPCServer, error) {
 		opts = append(opts, grpc.Creds(creds))
 	}
 
+	maintenanceSwitch := c.Maintenance
+	if maintenanceSwitch == nil && c.MaintenanceConfig != nil && c.MaintenanceConfig.Enable {
+		var err error
+		maintenanceSwitch, err = maintenance.NewSwitch(maintenance.State{
+			Mode:        maintenance.Mode(c.MaintenanceConfig.Mode),
+			RetryAfter:  c.MaintenanceConfig.RetryAfter,
+			MaxInFlight: c.MaintenanceConfig.MaxInFlight,
+		}, c.MaintenanceConfig.AllowRoutes...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	authorizer := c.Authorizer
+	ownAuthorizer := false
+	if authorizer == nil && c.AuthzPolicyFile != "" {
+		var err error
+		if authorizer, err = authz.NewFileAuthorizer(c.AuthzPolicyFile); err != nil {
+			return nil, err
+		}
+		authorizer.SetDryRun(c.AuthzDryRun)
+		if err := authorizer.Watch(); err != nil {
+			return nil, err
+		}
+		ownAuthorizer = true
+	}
+
 	opts = installInterceptors(c.UnaryInterceptors, opts)
+	if maintenanceSwitch != nil {
+		log.Infof("install maintenance interceptors, mode:%s", maintenanceSwitch.State().Mode)
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(maintenanceinterceptor.UnaryServerInterceptor(maintenanceSwitch)),
+			grpc.ChainStreamInterceptor(maintenanceinterceptor.StreamServerInterceptor(maintenanceSwitch)),
+		)
+	}
+	if authorizer != nil {
+		log.Info("install authz interceptors")
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(authzinterceptor.UnaryServerInterceptor(authorizer)),
+			grpc.ChainStreamInterceptor(authzinterceptor.StreamServerInterceptor(authorizer)),
+		)
+	}
+	if c.FaultInjector != nil {
+		log.Warn("install fault injection interceptors, never enable it in production")
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(faultinjectinterceptor.UnaryServerInterceptor(c.FaultInjector)),
+			grpc.ChainStreamInterceptor(faultinjectinterceptor.StreamServerInterceptor(c.FaultInjector)),
+		)
+	}
 	// opts = append(opts, grpc.ChainStreamInterceptor(streamUnaryInterceptor...))
 
 	gRPCServer := &GRPCServer{
@@ -95,9 +187,17 @@ func (c *CompletedGRPCConfig) New() (*GRPCServer, error) {
 		Version:            c.Version,
 		Reflect:            c.Reflect,
 		Debug:              c.Debug,
+		Watch:              c.Watch,
 		UnaryInterceptors:  c.UnaryInterceptors,
 		StreamInterceptors: c.StreamInterceptors,
 		runtimeDebug:       c.RuntimeDebug,
+		Maintenance:        maintenanceSwitch,
+		Authorizer:         authorizer,
+		ownAuthorizer:      ownAuthorizer,
+	}
+
+	for _, store := range c.WatchStores {
+		watchservice.AddStore(store)
 	}
 
 	initGenericGRPCServer(gRPCServer)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/wangweihong/eazycloud/pkg/authz"
 	"github.com/wangweihong/eazycloud/pkg/debug"
 
 	"github.com/wangweihong/eazycloud/pkg/util/maputil"
@@ -12,6 +13,8 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/wangweihong/eazycloud/pkg/grpcsvr/interceptor"
+	maintenanceinterceptor "github.com/wangweihong/eazycloud/pkg/grpcsvr/interceptor/maintenance"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
 	"github.com/wangweihong/eazycloud/pkg/sets"
 
 	"github.com/wangweihong/eazycloud/pkg/grpcsvr"
@@ -23,11 +26,21 @@ type ServerRunOptions struct {
 	Version            bool     `json:"version"             mapstructure:"version"`             // 开启版本服务
 	Reflect            bool     `json:"reflect"             mapstructure:"reflect"`             // 是否开启gRPC反射服务。开启反射服务后, grpcurl工具才能获取gRPC服务接口
 	Debug              bool     `json:"debug"               mapstructure:"debug"`               // 是否开启调试服务
+	Watch              bool     `json:"watch"               mapstructure:"watch"`               // 是否开启资源监听服务
 	UnaryInterceptors  []string `json:"unary-interceptors"  mapstructure:"unary-interceptors"`  // 启动拦截器列表
 	StreamInterceptors []string `json:"stream-interceptors" mapstructure:"stream-interceptors"` // 启动拦截器列表
 
 	RuntimeDebug    bool   `json:"runtime-debug"     mapstructure:"runtime-debug"`     // 开启运行时调试
 	RuntimeDebugDir string `json:"runtime-debug-dir" mapstructure:"runtime-debug-dir"` // 调试输出目录
+
+	Maintenance            bool     `json:"maintenance"              mapstructure:"maintenance"`              // 开启维护模式开关
+	MaintenanceMode        string   `json:"maintenance-mode"         mapstructure:"maintenance-mode"`         // 初始维护模式
+	MaintenanceRetryAfter  int      `json:"maintenance-retry-after"  mapstructure:"maintenance-retry-after"`  // 客户端重试等待秒数
+	MaintenanceAllowRoutes []string `json:"maintenance-allow-routes" mapstructure:"maintenance-allow-routes"` // 维护期间放行的方法
+	MaxInFlight            int64    `json:"max-in-flight"            mapstructure:"max-in-flight"`            // 并发调用上限
+
+	AuthzPolicyFile string `json:"authz-policy-file" mapstructure:"authz-policy-file"` // RBAC策略文件
+	AuthzDryRun     bool   `json:"authz-dry-run"     mapstructure:"authz-dry-run"`     // 仅审计不拒绝
 }
 
 // NewServerRunOptions creates a new ServerRunOptions object with default parameters.
@@ -35,14 +48,22 @@ func NewServerRunOptions() *ServerRunOptions {
 	defaults := grpcsvr.NewConfig()
 
 	return &ServerRunOptions{
-		MaxMsgSize:         4 * 1024 * 1024,
-		Version:            defaults.Version,
-		Reflect:            defaults.Reflect,
-		Debug:              defaults.Debug,
-		UnaryInterceptors:  defaults.UnaryInterceptors,
-		StreamInterceptors: defaults.StreamInterceptors,
-		RuntimeDebug:       defaults.RuntimeDebug.Enable,
-		RuntimeDebugDir:    defaults.RuntimeDebug.OutputDir,
+		MaxMsgSize:             4 * 1024 * 1024,
+		Version:                defaults.Version,
+		Reflect:                defaults.Reflect,
+		Debug:                  defaults.Debug,
+		Watch:                  defaults.Watch,
+		UnaryInterceptors:      defaults.UnaryInterceptors,
+		StreamInterceptors:     defaults.StreamInterceptors,
+		RuntimeDebug:           defaults.RuntimeDebug.Enable,
+		RuntimeDebugDir:        defaults.RuntimeDebug.OutputDir,
+		Maintenance:            defaults.MaintenanceConfig.Enable,
+		MaintenanceMode:        defaults.MaintenanceConfig.Mode,
+		MaintenanceRetryAfter:  defaults.MaintenanceConfig.RetryAfter,
+		MaintenanceAllowRoutes: defaults.MaintenanceConfig.AllowRoutes,
+		MaxInFlight:            defaults.MaintenanceConfig.MaxInFlight,
+		AuthzPolicyFile:        defaults.AuthzPolicyFile,
+		AuthzDryRun:            defaults.AuthzDryRun,
 	}
 }
 
@@ -52,15 +73,34 @@ func (s *ServerRunOptions) ApplyTo(c *grpcsvr.GRPCConfig) error {
 	c.Version = s.Version
 	c.Reflect = s.Reflect
 	c.Debug = s.Debug
+	c.Watch = s.Watch
 	c.UnaryInterceptors = s.UnaryInterceptors
 	c.StreamInterceptors = s.StreamInterceptors
 	c.RuntimeDebug = &debug.RuntimeDebugInfo{
 		Enable:    s.RuntimeDebug,
 		OutputDir: s.RuntimeDebugDir,
 	}
+	c.MaintenanceConfig = &grpcsvr.MaintenanceInfo{
+		Enable:      s.Maintenance,
+		Mode:        s.MaintenanceMode,
+		RetryAfter:  s.MaintenanceRetryAfter,
+		MaxInFlight: s.MaxInFlight,
+		AllowRoutes: s.MaintenanceAllowRoutes,
+	}
+	c.AuthzPolicyFile = s.AuthzPolicyFile
+	c.AuthzDryRun = s.AuthzDryRun
 	return nil
 }
 
+// MaintenanceState returns maintenance state configured, it's applied to running switch when config reloaded.
+func (s *ServerRunOptions) MaintenanceState() maintenance.State {
+	return maintenance.State{
+		Mode:        maintenance.Mode(s.MaintenanceMode),
+		RetryAfter:  s.MaintenanceRetryAfter,
+		MaxInFlight: s.MaxInFlight,
+	}
+}
+
 // Validate checks validation of ServerRunOptions.
 func (s *ServerRunOptions) Validate() []error {
 	errors := []error{}
@@ -81,6 +121,18 @@ func (s *ServerRunOptions) Validate() []error {
 			errors = append(errors, fmt.Errorf("set `RuntimeDebugDir` when enable runtime debug"))
 		}
 	}
+
+	if s.Maintenance {
+		if err := s.MaintenanceState().Validate(); err != nil {
+			errors = append(errors, fmt.Errorf("server.maintenance: %w", err))
+		}
+	}
+
+	if s.AuthzPolicyFile != "" {
+		if _, err := authz.LoadPolicyFile(s.AuthzPolicyFile); err != nil {
+			errors = append(errors, fmt.Errorf("server.authz-policy-file: %w", err))
+		}
+	}
 	return errors
 }
 
@@ -98,6 +150,9 @@ func (s *ServerRunOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&s.Debug, "server.debug", s.Debug, ""+
 		"Install debug service.")
 
+	fs.BoolVar(&s.Watch, "server.watch", s.Watch, ""+
+		"Install watch service, which streams changes of resource stores registered to server.")
+
 	fs.StringSliceVar(
 		&s.UnaryInterceptors,
 		"server.unary-interceptors",
@@ -115,4 +170,25 @@ func (s *ServerRunOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.StringVar(&s.RuntimeDebugDir, "server.runtime-debug-dir", s.RuntimeDebugDir, ""+
 		"Directory runtime debug data saved")
+
+	fs.BoolVar(&s.Maintenance, "server.maintenance", s.Maintenance, ""+
+		"Enable maintenance switch, mode can be changed by config reload at runtime.")
+
+	fs.StringVar(&s.MaintenanceMode, "server.maintenance-mode", s.MaintenanceMode, ""+
+		"Initial maintenance mode. Supported mode: "+strings.Join(maintenance.Modes, ",")+
+		". readonly rejects all calls except methods prefixed with "+strings.Join(maintenanceinterceptor.ReadMethodPrefixes, ",")+".")
+
+	fs.IntVar(&s.MaintenanceRetryAfter, "server.maintenance-retry-after", s.MaintenanceRetryAfter, ""+
+		"Seconds client should wait before retry when call rejected in maintenance or overloaded.")
+
+	fs.StringSliceVar(&s.MaintenanceAllowRoutes, "server.maintenance-allow-routes", s.MaintenanceAllowRoutes, ""+
+		"Methods always served in maintenance, comma separated. Pattern ending with /* matches all methods with the prefix.")
+
+	fs.Int64Var(&s.MaxInFlight, "server.max-in-flight", s.MaxInFlight, ""+
+		"Maximum number of in-flight calls when maintenance switch enabled, more calls are rejected. Zero means no limit.")
+
+	fs.StringVar(&s.AuthzPolicyFile, "server.authz-policy-file", s.AuthzPolicyFile,
+		"RBAC policy file in yaml, reloaded when changed. Enables authorization of calls if set.")
+	fs.BoolVar(&s.AuthzDryRun, "server.authz-dry-run", s.AuthzDryRun,
+		"Only log calls denied by authorization without rejecting them.")
 }
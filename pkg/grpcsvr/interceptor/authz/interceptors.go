@@ -0,0 +1,90 @@
+package authz
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+
+	"github.com/wangweihong/eazycloud/pkg/authz"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// UnaryServerInterceptor returns a new unary server interceptor rejecting call not allowed by authorizer.
+func UnaryServerInterceptor(a *authz.Authorizer, skipperFunc ...skipper.SkipperFunc) grpc.UnaryServerInterceptor {
+	name := "authz"
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(info.FullMethod, skipperFunc...) {
+			log.F(ctx).Debugf("skip interceptor %s for %s", name, info.FullMethod)
+
+			resp, err := handler(ctx, req)
+			return resp, errors.UpdateStack(err)
+		}
+
+		if err := authorize(ctx, a, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		resp, err := handler(ctx, req)
+		return resp, errors.UpdateStack(err)
+	}
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor rejecting call not allowed by authorizer.
+func StreamServerInterceptor(a *authz.Authorizer, skipperFunc ...skipper.SkipperFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		if !skipper.Skip(info.FullMethod, skipperFunc...) {
+			if err := authorize(stream.Context(), a, info.FullMethod); err != nil {
+				return err
+			}
+		}
+		return handler(srv, stream)
+	}
+}
+
+// Attributes describes gRPC call for authorization.
+// Subject is read from context set by authz.WithSubject, then username set by authentication.
+// Verb is authz.VerbCall, route is full method like `/pkg.Service/Method`, and resource is service name.
+func Attributes(ctx context.Context, fullMethod string) authz.Attributes {
+	subject, ok := authz.SubjectFromContext(ctx)
+	if !ok {
+		if username, ok := ctx.Value(log.KeyUsername).(string); ok {
+			subject.Name = username
+		}
+	}
+
+	service := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(service, "/"); i >= 0 {
+		service = service[:i]
+	}
+	return authz.Attributes{
+		Subject:  subject,
+		Verb:     authz.VerbCall,
+		Route:    fullMethod,
+		Resource: service,
+	}
+}
+
+func authorize(ctx context.Context, a *authz.Authorizer, fullMethod string) error {
+	attrs := Attributes(ctx, fullMethod)
+	decision := a.Authorize(attrs)
+	if decision.Allowed {
+		return nil
+	}
+
+	log.F(ctx).Warn("authorization denied",
+		log.String("subject", attrs.Subject.Name),
+		log.String("reason", decision.Reason),
+		log.Bool("dryRun", decision.DryRun))
+	if decision.DryRun {
+		return nil
+	}
+	return errors.Wrap(code.ErrPermissionDenied, decision.Reason)
+}
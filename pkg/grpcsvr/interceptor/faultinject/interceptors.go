@@ -0,0 +1,94 @@
+package faultinject
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/faultinject"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+	"github.com/wangweihong/eazycloud/pkg/tracectx"
+)
+
+// UnaryServerInterceptor returns a new unary server interceptor injecting fault into calls matching rules of injector.
+func UnaryServerInterceptor(injector *faultinject.Injector, skipperFunc ...skipper.SkipperFunc) grpc.UnaryServerInterceptor {
+	name := "faultinject"
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(info.FullMethod, skipperFunc...) {
+			log.F(ctx).Debugf("skip interceptor %s for %s", name, info.FullMethod)
+
+			resp, err := handler(ctx, req)
+			return resp, errors.UpdateStack(err)
+		}
+
+		if err := inject(ctx, injector, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		resp, err := handler(ctx, req)
+		return resp, errors.UpdateStack(err)
+	}
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor injecting fault into calls matching rules of injector.
+func StreamServerInterceptor(injector *faultinject.Injector, skipperFunc ...skipper.SkipperFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		if !skipper.Skip(info.FullMethod, skipperFunc...) {
+			if err := inject(stream.Context(), injector, info.FullMethod); err != nil {
+				return err
+			}
+		}
+		return handler(srv, stream)
+	}
+}
+
+// inject applies fault to call, connection can't be reset by interceptor, so reset is
+// simulated by Unavailable status as client sees when connection broken.
+func inject(ctx context.Context, injector *faultinject.Injector, fullMethod string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID := tracectx.FromTraceIDContext(ctx)
+	if requestID == "" {
+		if v := md.Get("x-request-id"); len(v) > 0 {
+			requestID = v[0]
+		}
+	}
+
+	fault := injector.Match(faultinject.Request{
+		Route:     fullMethod,
+		RequestID: requestID,
+		Header: func(key string) string {
+			if v := md.Get(strings.ToLower(key)); len(v) > 0 {
+				return v[0]
+			}
+			return ""
+		},
+	})
+	if fault == nil {
+		return nil
+	}
+
+	log.F(ctx).Warnf("inject fault of rule `%s` into %s", fault.Rule, fullMethod)
+	if err := fault.Sleep(ctx); err != nil {
+		return status.FromContextError(err).Err()
+	}
+
+	switch {
+	case fault.Panic:
+		panic(fmt.Sprintf("fault injected by rule `%s`", fault.Rule))
+	case fault.Reset:
+		return status.Errorf(codes.Unavailable, "connection reset by fault rule `%s`", fault.Rule)
+	default:
+		return fault.Error()
+	}
+}
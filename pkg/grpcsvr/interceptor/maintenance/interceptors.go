@@ -0,0 +1,80 @@
+package maintenance
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// HeaderRetryAfter is the metadata key of seconds client should wait before retry.
+const HeaderRetryAfter = "retry-after"
+
+// ReadMethodPrefixes are prefixes of method name treated as read, which are served in read-only mode.
+var ReadMethodPrefixes = []string{"Get", "List", "Watch", "Describe", "Check", "Version"}
+
+// UnaryServerInterceptor returns a new unary server interceptor rejecting calls according to maintenance switch.
+func UnaryServerInterceptor(sw *maintenance.Switch, skipperFunc ...skipper.SkipperFunc) grpc.UnaryServerInterceptor {
+	name := "maintenance"
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(info.FullMethod, skipperFunc...) {
+			log.F(ctx).Debugf("skip interceptor %s for %s", name, info.FullMethod)
+
+			resp, err := handler(ctx, req)
+			return resp, errors.UpdateStack(err)
+		}
+
+		done, err := sw.Admit(info.FullMethod, IsReadMethod(info.FullMethod))
+		if err != nil {
+			if retryAfter := sw.State().RetryAfter; retryAfter > 0 {
+				_ = grpc.SetHeader(ctx, metadata.Pairs(HeaderRetryAfter, strconv.Itoa(retryAfter)))
+			}
+			return nil, err
+		}
+		defer done()
+
+		resp, err := handler(ctx, req)
+		return resp, errors.UpdateStack(err)
+	}
+}
+
+// StreamServerInterceptor returns a new streaming server interceptor rejecting calls according to maintenance switch.
+func StreamServerInterceptor(sw *maintenance.Switch, skipperFunc ...skipper.SkipperFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		if skipper.Skip(info.FullMethod, skipperFunc...) {
+			return handler(srv, stream)
+		}
+
+		done, err := sw.Admit(info.FullMethod, IsReadMethod(info.FullMethod))
+		if err != nil {
+			if retryAfter := sw.State().RetryAfter; retryAfter > 0 {
+				_ = stream.SetHeader(metadata.Pairs(HeaderRetryAfter, strconv.Itoa(retryAfter)))
+			}
+			return err
+		}
+		defer done()
+		return handler(srv, stream)
+	}
+}
+
+// IsReadMethod reports whether name of full method `/pkg.Service/Method` has prefix in ReadMethodPrefixes.
+func IsReadMethod(fullMethod string) bool {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, p := range ReadMethodPrefixes {
+		if strings.HasPrefix(method, p) {
+			return true
+		}
+	}
+	return false
+}
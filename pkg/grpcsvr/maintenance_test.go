@@ -0,0 +1,59 @@
+package grpcsvr_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/wangweihong/eazycloud/pkg/grpcproto/apis/debug"
+	"github.com/wangweihong/eazycloud/pkg/grpcproto/apis/version"
+	"github.com/wangweihong/eazycloud/pkg/grpcsvr"
+	"github.com/wangweihong/eazycloud/pkg/grpcsvr/grpcoptions"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
+)
+
+func TestGRPCServer_Maintenance(t *testing.T) {
+	Convey("通过选项启用维护模式", t, func() {
+		opts := grpcoptions.NewServerRunOptions()
+		opts.Debug = true
+		opts.Maintenance = true
+		opts.MaintenanceMode = string(maintenance.ModeFull)
+		So(opts.Validate(), ShouldBeEmpty)
+		conf := grpcsvr.NewConfig()
+		So(opts.ApplyTo(conf), ShouldBeNil)
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+		So(s.Maintenance, ShouldNotBeNil)
+
+		lis := bufconn.Listen(1 << 20)
+		go func() {
+			_ = s.Serve(lis)
+		}()
+		defer s.Stop()
+
+		conn, err := grpc.Dial("bufnet",
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+			grpc.WithInsecure(),
+		)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		sleep := func() error {
+			_, err := debug.NewDebugServiceClient(conn).
+				Sleep(context.Background(), &debug.SleepRequest{Duration: durationpb.New(0)})
+			return err
+		}
+		So(sleep(), ShouldNotBeNil)
+		// 白名单中的版本服务仍可访问
+		_, err = version.NewVersionServiceClient(conn).Version(context.Background(), &version.VersionRequest{})
+		So(err, ShouldBeNil)
+
+		So(s.Maintenance.SetMode(maintenance.ModeOff, ""), ShouldBeNil)
+		So(sleep(), ShouldBeNil)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/wangweihong/eazycloud/pkg/authz"
 	"github.com/wangweihong/eazycloud/pkg/debug"
 
 	"github.com/wangweihong/eazycloud/pkg/grpcsvr/interceptor"
@@ -13,10 +14,12 @@ import (
 
 	"github.com/wangweihong/eazycloud/pkg/grpcproto/service/debugservice"
 	"github.com/wangweihong/eazycloud/pkg/grpcproto/service/versionservice"
+	"github.com/wangweihong/eazycloud/pkg/grpcproto/service/watchservice"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
 
 	"google.golang.org/grpc"
 )
@@ -29,11 +32,18 @@ type GRPCServer struct {
 	Version bool
 	Reflect bool
 	Debug   bool
+	Watch   bool
 	// install interceptors
 	UnaryInterceptors  []string
 	StreamInterceptors []string
 
 	runtimeDebug *debug.RuntimeDebugInfo
+	// Maintenance switch of calls, nil if not configured
+	Maintenance *maintenance.Switch
+	// Authorizer of calls, nil if not configured. It can be shared with http server.
+	Authorizer *authz.Authorizer
+	// ownAuthorizer is true if Authorizer is created from policy file, which is stopped when closed
+	ownAuthorizer bool
 }
 
 func (s *GRPCServer) Run() {
@@ -88,6 +98,9 @@ func (s *GRPCServer) Run() {
 
 func (s *GRPCServer) Close() {
 	s.GracefulStop()
+	if s.ownAuthorizer {
+		s.Authorizer.Stop()
+	}
 	if s.Address != "" {
 		log.Infof("gRPC server on tcp://%s stopped", s.Address)
 	}
@@ -119,11 +132,16 @@ func (s *GRPCServer) InstallAPIs() {
 		debugservice.RegisterDebugServer(s.Server)
 	}
 
+	if s.Watch {
+		watchservice.RegisterWatchService(s.Server)
+	}
+
 	log.Info(
 		"gRPC run with service",
 		log.Bool("reflect", s.Reflect),
 		log.Bool("version", s.Version),
 		log.Bool("debug", s.Debug),
+		log.Bool("watch", s.Watch),
 	)
 }
 
@@ -0,0 +1,87 @@
+package grpcsvr_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/grpcproto/apis/watch"
+	"github.com/wangweihong/eazycloud/pkg/grpcsvr"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/resource"
+	"github.com/wangweihong/eazycloud/pkg/json"
+)
+
+type watchedUser struct {
+	resource.ObjectMeta
+	Name string `json:"name"`
+}
+
+func TestGRPCServer_Watch(t *testing.T) {
+	Convey("监听资源变更", t, func() {
+		store, err := resource.NewStore(&resource.Resource{
+			Name: "watched-users",
+			New:  func() resource.Object { return &watchedUser{} },
+			KeyFunc: func(obj interface{}) (string, error) {
+				return obj.(*watchedUser).Name, nil
+			},
+		})
+		So(err, ShouldBeNil)
+
+		conf := grpcsvr.NewConfig()
+		conf.MaxMsgSize = 4 * 1024 * 1024
+		conf.Watch = true
+		conf.WatchStores = []*resource.Store{store}
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+
+		lis := bufconn.Listen(1 << 20)
+		go func() {
+			_ = s.Serve(lis)
+		}()
+		defer s.Stop()
+
+		conn, err := grpc.Dial("bufnet",
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+			grpc.WithInsecure(),
+		)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client := watch.NewWatchServiceClient(conn)
+
+		Convey("推送变更事件", func() {
+			stream, err := client.Watch(ctx, &watch.WatchRequest{Resource: "watched-users"})
+			So(err, ShouldBeNil)
+
+			// wait for watch established before changing store
+			time.Sleep(100 * time.Millisecond)
+			_, err = store.Create(ctx, &watchedUser{Name: "u1"})
+			So(err, ShouldBeNil)
+
+			event, err := stream.Recv()
+			So(err, ShouldBeNil)
+			So(event.GetType(), ShouldEqual, "ADDED")
+			So(event.GetResourceVersion(), ShouldNotBeEmpty)
+			var user watchedUser
+			So(json.Unmarshal(event.GetObject(), &user), ShouldBeNil)
+			So(user.Name, ShouldEqual, "u1")
+		})
+
+		Convey("资源不可监听", func() {
+			stream, err := client.Watch(ctx, &watch.WatchRequest{Resource: "none"})
+			So(err, ShouldBeNil)
+
+			event, err := stream.Recv()
+			So(err, ShouldBeNil)
+			So(event.GetCallStatus().GetCode(), ShouldEqual, int64(code.ErrResourceNotFound))
+		})
+	})
+}
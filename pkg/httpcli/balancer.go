@@ -0,0 +1,32 @@
+package httpcli
+
+import (
+	"context"
+)
+
+// PickInfo is the request to pick endpoint for.
+type PickInfo struct {
+	Method string
+	RawURL string
+	// Key is set by BalanceKeyCallOption, used by consistent hash.
+	Key string
+}
+
+// DoneInfo is the result of request to picked endpoint.
+type DoneInfo struct {
+	Err error
+	// Sent is false if request fails before sending, such as failing to encode body.
+	Sent bool
+	// StatusCode is 0 if no response received.
+	StatusCode int
+}
+
+// Balancer picks endpoint address for each request, such as balancer.Balancer.
+type Balancer interface {
+	// Pick returns address of endpoint such as `http://127.0.0.1:8080`, done must be called after request finished.
+	Pick(ctx context.Context, info PickInfo) (addr string, done func(DoneInfo), err error)
+}
+
+// EndpointHook is called with address of endpoint before request sent to it, such as the one picked by Balancer.
+// Request fails with err if it returns error, otherwise done is called after request finished.
+type EndpointHook func(ctx context.Context, addr string) (done func(DoneInfo), err error)
@@ -0,0 +1,452 @@
+package balancer
+
+import (
+	"context"
+	stderrors "errors"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// Policy is how to pick endpoint.
+type Policy string
+
+const (
+	// RoundRobin picks available endpoints in turn.
+	RoundRobin Policy = "round_robin"
+	// LeastPending picks the available endpoint with the least in-flight requests.
+	LeastPending Policy = "least_pending"
+	// ConsistentHash picks endpoint by key set by httpcli.BalanceKeyCallOption, so requests of the same key go to
+	// the same endpoint while it is available. Requests without key are picked by round robin.
+	ConsistentHash Policy = "consistent_hash"
+)
+
+const (
+	DefaultRefreshInterval    = 30 * time.Second
+	DefaultMaxFails           = 3
+	DefaultEjectDuration      = 30 * time.Second
+	DefaultHealthCheckPath    = "/healthz"
+	DefaultHealthCheckTimeout = 2 * time.Second
+
+	// virtual nodes of each endpoint in hash ring
+	ringReplicas = 100
+	// changes reported by Watcher are resolved after it
+	watchDebounce = 200 * time.Millisecond
+)
+
+// Config configures Balancer, zero fields use defaults.
+type Config struct {
+	// Policy defaults to RoundRobin.
+	Policy Policy
+	// RefreshInterval is the interval to resolve endpoints again.
+	RefreshInterval time.Duration
+	// MaxFails is the consecutive failures to eject endpoint, failures are transport errors and 5xx responses.
+	MaxFails int
+	// EjectDuration is how long ejected endpoint is not picked.
+	EjectDuration time.Duration
+	// HealthCheckInterval enables active health check of each endpoint if positive.
+	HealthCheckInterval time.Duration
+	// HealthCheckPath is requested by GET, endpoint is healthy if status is 2xx.
+	HealthCheckPath    string
+	HealthCheckTimeout time.Duration
+	// HealthClient sends health check requests, such as client with the same TLS config. Defaults to http.Client.
+	HealthClient *http.Client
+}
+
+func (c Config) complete() Config {
+	if c.Policy == "" {
+		c.Policy = RoundRobin
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	if c.MaxFails <= 0 {
+		c.MaxFails = DefaultMaxFails
+	}
+	if c.EjectDuration <= 0 {
+		c.EjectDuration = DefaultEjectDuration
+	}
+	if c.HealthCheckPath == "" {
+		c.HealthCheckPath = DefaultHealthCheckPath
+	}
+	if c.HealthCheckTimeout <= 0 {
+		c.HealthCheckTimeout = DefaultHealthCheckTimeout
+	}
+	if c.HealthClient == nil {
+		c.HealthClient = &http.Client{}
+	}
+	return c
+}
+
+// EndpointStatus is the status of endpoint.
+type EndpointStatus struct {
+	Addr    string
+	Pending int64
+	Ejected bool
+	Healthy bool
+}
+
+type endpoint struct {
+	addr    string
+	pending int64
+
+	lock         sync.Mutex
+	fails        int
+	ejectedUntil time.Time
+	unhealthy    bool
+}
+
+func (e *endpoint) available(now time.Time) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return !e.unhealthy && !now.Before(e.ejectedUntil)
+}
+
+type ringNode struct {
+	hash     uint32
+	endpoint *endpoint
+}
+
+// Balancer is a httpcli.Balancer picking endpoints resolved by Resolver.
+// Failing endpoints are ejected for a while, and unhealthy endpoints are skipped if health check enabled.
+// If no endpoint is available, all endpoints are picked.
+type Balancer struct {
+	resolver Resolver
+	config   Config
+
+	lock      sync.RWMutex
+	endpoints []*endpoint
+	ring      []ringNode
+	next      uint64
+
+	refreshLock sync.Mutex
+	stop        chan struct{}
+	stopOnce    sync.Once
+	wg          sync.WaitGroup
+}
+
+var _ httpcli.Balancer = &Balancer{}
+
+// New resolves endpoints and creates a Balancer, it fails if no endpoint resolved.
+// Balancer must be closed after use.
+func New(resolver Resolver, config Config) (*Balancer, error) {
+	b := &Balancer{
+		resolver: resolver,
+		config:   config.complete(),
+		stop:     make(chan struct{}),
+	}
+	if err := b.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+
+	b.wg.Add(1)
+	go b.refreshLoop()
+	if w, ok := resolver.(Watcher); ok {
+		b.wg.Add(1)
+		go b.watch(w)
+	}
+	if b.config.HealthCheckInterval > 0 {
+		b.wg.Add(1)
+		go b.healthCheckLoop()
+	}
+	return b, nil
+}
+
+// Close stops resolving and health checking.
+func (b *Balancer) Close() {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+	b.wg.Wait()
+}
+
+// Endpoints returns status of endpoints.
+func (b *Balancer) Endpoints() []EndpointStatus {
+	b.lock.RLock()
+	endpoints := b.endpoints
+	b.lock.RUnlock()
+
+	now := time.Now()
+	status := make([]EndpointStatus, 0, len(endpoints))
+	for _, e := range endpoints {
+		e.lock.Lock()
+		status = append(status, EndpointStatus{
+			Addr:    e.addr,
+			Pending: atomic.LoadInt64(&e.pending),
+			Ejected: now.Before(e.ejectedUntil),
+			Healthy: !e.unhealthy,
+		})
+		e.lock.Unlock()
+	}
+	return status
+}
+
+// Refresh resolves endpoints again, endpoints are kept if resolving fails or resolves nothing.
+func (b *Balancer) Refresh(ctx context.Context) error {
+	b.refreshLock.Lock()
+	defer b.refreshLock.Unlock()
+
+	addrs, err := b.resolver.Resolve(ctx)
+	if err != nil {
+		log.Warnf("resolve endpoints fail, keep %d endpoints:%v", len(b.endpoints), err)
+		return errors.WrapError(code.ErrHTTPClientGenerateError, err)
+	}
+	if len(addrs) == 0 {
+		log.Warnf("no endpoint resolved, keep %d endpoints", len(b.endpoints))
+		return errors.Wrap(code.ErrHTTPClientGenerateError, "no endpoint resolved")
+	}
+
+	b.lock.RLock()
+	old := make(map[string]*endpoint, len(b.endpoints))
+	for _, e := range b.endpoints {
+		old[e.addr] = e
+	}
+	b.lock.RUnlock()
+
+	endpoints := make([]*endpoint, 0, len(addrs))
+	seen := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		// keep state of existing endpoints
+		e, ok := old[addr]
+		if !ok {
+			e = &endpoint{addr: addr}
+			log.Infof("endpoint %s added", addr)
+		}
+		endpoints = append(endpoints, e)
+	}
+	for addr := range old {
+		if !seen[addr] {
+			log.Infof("endpoint %s removed", addr)
+		}
+	}
+
+	var ring []ringNode
+	if b.config.Policy == ConsistentHash {
+		ring = buildRing(endpoints)
+	}
+
+	b.lock.Lock()
+	b.endpoints = endpoints
+	b.ring = ring
+	b.lock.Unlock()
+	return nil
+}
+
+// Pick picks an available endpoint.
+func (b *Balancer) Pick(ctx context.Context, info httpcli.PickInfo) (string, func(httpcli.DoneInfo), error) {
+	b.lock.RLock()
+	endpoints, ring := b.endpoints, b.ring
+	b.lock.RUnlock()
+	if len(endpoints) == 0 {
+		return "", nil, errors.Wrap(code.ErrHTTPError, "no endpoint to pick")
+	}
+
+	now := time.Now()
+	available := make([]*endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		if e.available(now) {
+			available = append(available, e)
+		}
+	}
+	if len(available) == 0 {
+		log.F(ctx).Warnf("all %d endpoints are unavailable, pick from all of them", len(endpoints))
+		available = endpoints
+	}
+
+	var picked *endpoint
+	switch {
+	case b.config.Policy == ConsistentHash && info.Key != "":
+		picked = pickFromRing(ring, info.Key, available)
+	case b.config.Policy == LeastPending:
+		start := int(atomic.AddUint64(&b.next, 1) % uint64(len(available)))
+		for i := 0; i < len(available); i++ {
+			e := available[(start+i)%len(available)]
+			if picked == nil || atomic.LoadInt64(&e.pending) < atomic.LoadInt64(&picked.pending) {
+				picked = e
+			}
+		}
+	}
+	if picked == nil {
+		picked = available[atomic.AddUint64(&b.next, 1)%uint64(len(available))]
+	}
+
+	atomic.AddInt64(&picked.pending, 1)
+	var once sync.Once
+	return picked.addr, func(di httpcli.DoneInfo) {
+		once.Do(func() {
+			atomic.AddInt64(&picked.pending, -1)
+			b.report(picked, di)
+		})
+	}, nil
+}
+
+// report ejects endpoint after MaxFails consecutive failures.
+func (b *Balancer) report(e *endpoint, di httpcli.DoneInfo) {
+	if !di.Sent || stderrors.Is(di.Err, context.Canceled) {
+		return
+	}
+	failed := (di.StatusCode == 0 && di.Err != nil) || di.StatusCode >= http.StatusInternalServerError
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if !failed {
+		e.fails = 0
+		return
+	}
+	e.fails++
+	if e.fails >= b.config.MaxFails {
+		e.fails = 0
+		e.ejectedUntil = time.Now().Add(b.config.EjectDuration)
+		log.Warnf("endpoint %s ejected for %v after %d consecutive failures, last status:%d, err:%v",
+			e.addr, b.config.EjectDuration, b.config.MaxFails, di.StatusCode, di.Err)
+	}
+}
+
+func (b *Balancer) refreshLoop() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			_ = b.Refresh(context.Background())
+		}
+	}
+}
+
+func (b *Balancer) watch(w Watcher) {
+	defer b.wg.Done()
+
+	var lock sync.Mutex
+	var timer *time.Timer
+	err := w.Watch(b.stop, func() {
+		lock.Lock()
+		defer lock.Unlock()
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(watchDebounce, func() { _ = b.Refresh(context.Background()) })
+	})
+	if err != nil {
+		log.Warnf("watch endpoints fail, resolve every %v:%v", b.config.RefreshInterval, err)
+	}
+	lock.Lock()
+	if timer != nil {
+		timer.Stop()
+	}
+	lock.Unlock()
+}
+
+func (b *Balancer) healthCheckLoop() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		b.healthCheck()
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Balancer) healthCheck() {
+	b.lock.RLock()
+	endpoints := b.endpoints
+	b.lock.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, e := range endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			err := b.probe(e.addr)
+
+			e.lock.Lock()
+			defer e.lock.Unlock()
+			switch {
+			case err != nil && !e.unhealthy:
+				e.unhealthy = true
+				log.Warnf("endpoint %s is unhealthy:%v", e.addr, err)
+			case err == nil && e.unhealthy:
+				e.unhealthy = false
+				log.Infof("endpoint %s is healthy again", e.addr)
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (b *Balancer) probe(addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.HealthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+b.config.HealthCheckPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.config.HealthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.WrapF(code.ErrHTTPError, "health check status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func buildRing(endpoints []*endpoint) []ringNode {
+	ring := make([]ringNode, 0, len(endpoints)*ringReplicas)
+	for _, e := range endpoints {
+		for i := 0; i < ringReplicas; i++ {
+			ring = append(ring, ringNode{hash: hashKey(e.addr + "#" + strconv.Itoa(i)), endpoint: e})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+// pickFromRing picks the first available endpoint clockwise from hash of key.
+func pickFromRing(ring []ringNode, key string, available []*endpoint) *endpoint {
+	if len(ring) == 0 {
+		return nil
+	}
+	set := make(map[*endpoint]bool, len(available))
+	for _, e := range available {
+		set[e] = true
+	}
+	h := hashKey(key)
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	for i := 0; i < len(ring); i++ {
+		node := ring[(start+i)%len(ring)]
+		if set[node.endpoint] {
+			return node.endpoint
+		}
+	}
+	return nil
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
@@ -0,0 +1,169 @@
+package balancer_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/httpcli/balancer"
+)
+
+type backend struct {
+	*httptest.Server
+	requests int64
+	status   int64
+	healthz  int64
+}
+
+func newBackend() *backend {
+	b := &backend{status: http.StatusOK, healthz: http.StatusOK}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(int(atomic.LoadInt64(&b.healthz)))
+			return
+		}
+		atomic.AddInt64(&b.requests, 1)
+		w.WriteHeader(int(atomic.LoadInt64(&b.status)))
+	}))
+	return b
+}
+
+func invoke(c *httpcli.Client, opts ...httpcli.CallOption) *httpcli.RawResponse {
+	opts = append(opts, httpcli.ResponseNotParseCallOption())
+	resp, err := c.Invoke(context.Background(), http.MethodGet, "/items", nil, nil, opts...)
+	So(err, ShouldBeNil)
+	return resp
+}
+
+func TestBalancer(t *testing.T) {
+	Convey("客户端负载均衡", t, func() {
+		b1, b2, b3 := newBackend(), newBackend(), newBackend()
+		defer b1.Close()
+		defer b2.Close()
+		defer b3.Close()
+		resolver := balancer.StaticResolver(b1.URL, b2.URL, b3.URL)
+
+		Convey("轮询并返回实际使用的地址", func() {
+			lb, err := balancer.New(resolver, balancer.Config{})
+			So(err, ShouldBeNil)
+			defer lb.Close()
+			c, err := httpcli.NewClient("items-service", httpcli.WithBalancer(lb))
+			So(err, ShouldBeNil)
+
+			addrs := make(map[string]int)
+			for i := 0; i < 6; i++ {
+				resp := invoke(c)
+				addrs[resp.ReqAddr]++
+			}
+			So(addrs, ShouldResemble, map[string]int{b1.URL: 2, b2.URL: 2, b3.URL: 2})
+		})
+
+		Convey("连续失败的地址被剔除", func() {
+			atomic.StoreInt64(&b2.status, http.StatusServiceUnavailable)
+			lb, err := balancer.New(resolver, balancer.Config{MaxFails: 2, EjectDuration: time.Minute})
+			So(err, ShouldBeNil)
+			defer lb.Close()
+			c, err := httpcli.NewClient("items-service", httpcli.WithBalancer(lb))
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 12; i++ {
+				invoke(c)
+			}
+			So(atomic.LoadInt64(&b2.requests), ShouldEqual, 2)
+			for _, s := range lb.Endpoints() {
+				So(s.Ejected, ShouldEqual, s.Addr == b2.URL)
+			}
+		})
+
+		Convey("主动健康检查跳过不健康的地址", func() {
+			atomic.StoreInt64(&b3.healthz, http.StatusServiceUnavailable)
+			lb, err := balancer.New(resolver, balancer.Config{HealthCheckInterval: 20 * time.Millisecond})
+			So(err, ShouldBeNil)
+			defer lb.Close()
+			time.Sleep(100 * time.Millisecond)
+
+			c, err := httpcli.NewClient("items-service", httpcli.WithBalancer(lb))
+			So(err, ShouldBeNil)
+			for i := 0; i < 6; i++ {
+				So(invoke(c).ReqAddr, ShouldNotEqual, b3.URL)
+			}
+
+			atomic.StoreInt64(&b3.healthz, http.StatusOK)
+			time.Sleep(100 * time.Millisecond)
+			for i := 0; i < 6; i++ {
+				invoke(c)
+			}
+			So(atomic.LoadInt64(&b3.requests), ShouldEqual, 2)
+		})
+
+		Convey("一致性哈希", func() {
+			lb, err := balancer.New(resolver, balancer.Config{Policy: balancer.ConsistentHash})
+			So(err, ShouldBeNil)
+			defer lb.Close()
+			c, err := httpcli.NewClient("items-service", httpcli.WithBalancer(lb))
+			So(err, ShouldBeNil)
+
+			addr := invoke(c, httpcli.BalanceKeyCallOption("user-1")).ReqAddr
+			for i := 0; i < 5; i++ {
+				So(invoke(c, httpcli.BalanceKeyCallOption("user-1")).ReqAddr, ShouldEqual, addr)
+			}
+		})
+
+		Convey("最少请求数", func() {
+			lb, err := balancer.New(resolver, balancer.Config{Policy: balancer.LeastPending})
+			So(err, ShouldBeNil)
+			defer lb.Close()
+
+			addr1, done1, err := lb.Pick(context.Background(), httpcli.PickInfo{})
+			So(err, ShouldBeNil)
+			addr2, done2, err := lb.Pick(context.Background(), httpcli.PickInfo{})
+			So(err, ShouldBeNil)
+			addr3, done3, err := lb.Pick(context.Background(), httpcli.PickInfo{})
+			So(err, ShouldBeNil)
+			So(map[string]bool{addr1: true, addr2: true, addr3: true}, ShouldHaveLength, 3)
+
+			done1(httpcli.DoneInfo{Sent: true, StatusCode: http.StatusOK})
+			addr, done, err := lb.Pick(context.Background(), httpcli.PickInfo{})
+			So(err, ShouldBeNil)
+			So(addr, ShouldEqual, addr1)
+			done(httpcli.DoneInfo{})
+			done2(httpcli.DoneInfo{})
+			done3(httpcli.DoneInfo{})
+		})
+
+		Convey("从文件解析地址并监听变化", func() {
+			dir, err := ioutil.TempDir("", "balancer")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "endpoints")
+			So(ioutil.WriteFile(file, []byte("# items\n"+b1.URL+"\n\n"), 0o600), ShouldBeNil)
+
+			lb, err := balancer.New(balancer.FileResolver(file), balancer.Config{})
+			So(err, ShouldBeNil)
+			defer lb.Close()
+			So(lb.Endpoints(), ShouldHaveLength, 1)
+
+			// wait for watcher to start
+			time.Sleep(100 * time.Millisecond)
+			So(ioutil.WriteFile(file, []byte(b1.URL+"\n"+b2.URL+"\n"), 0o600), ShouldBeNil)
+			for i := 0; i < 20 && len(lb.Endpoints()) != 2; i++ {
+				time.Sleep(100 * time.Millisecond)
+			}
+			So(lb.Endpoints(), ShouldHaveLength, 2)
+		})
+
+		Convey("没有可用地址", func() {
+			_, err := balancer.New(balancer.StaticResolver(), balancer.Config{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
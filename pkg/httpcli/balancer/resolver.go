@@ -0,0 +1,141 @@
+package balancer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// Resolver resolves addresses of endpoints, such as `http://127.0.0.1:8080`.
+// Balancer resolves again every RefreshInterval.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// Watcher is implemented by Resolver which can tell when addresses changed, Balancer resolves again
+// once changed is called. Watch blocks until stop closed.
+type Watcher interface {
+	Watch(stop <-chan struct{}, changed func()) error
+}
+
+// ResolverFunc is a function Resolver.
+type ResolverFunc func(ctx context.Context) ([]string, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// StaticResolver resolves the fixed addresses.
+func StaticResolver(addrs ...string) Resolver {
+	return ResolverFunc(func(ctx context.Context) ([]string, error) {
+		return addrs, nil
+	})
+}
+
+// DNSResolver resolves A/AAAA records of host into `scheme://ip:port`.
+func DNSResolver(scheme, host string, port int) Resolver {
+	return ResolverFunc(func(ctx context.Context) ([]string, error) {
+		ips, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		addrs := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			addrs = append(addrs, scheme+"://"+net.JoinHostPort(ip, strconv.Itoa(port)))
+		}
+		return addrs, nil
+	})
+}
+
+// DNSSRVResolver resolves SRV records of `_service._proto.name` into `scheme://target:port`.
+func DNSSRVResolver(scheme, service, proto, name string) Resolver {
+	return ResolverFunc(func(ctx context.Context) ([]string, error) {
+		_, srvs, err := net.DefaultResolver.LookupSRV(ctx, service, proto, name)
+		if err != nil {
+			return nil, err
+		}
+		addrs := make([]string, 0, len(srvs))
+		for _, srv := range srvs {
+			target := strings.TrimSuffix(srv.Target, ".")
+			addrs = append(addrs, scheme+"://"+net.JoinHostPort(target, strconv.Itoa(int(srv.Port))))
+		}
+		return addrs, nil
+	})
+}
+
+// FileResolver resolves addresses from file, one address per line, empty lines and lines starting with `#`
+// are ignored. File is watched, so changes are picked up without restart.
+func FileResolver(path string) Resolver {
+	return &fileResolver{path: path}
+}
+
+type fileResolver struct {
+	path string
+}
+
+func (r *fileResolver) Resolve(ctx context.Context) ([]string, error) {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var addrs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addrs = append(addrs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read endpoints file %s fail:%w", r.path, err)
+	}
+	return addrs, nil
+}
+
+// Watch watches directory of file since editors may replace file by rename.
+func (r *fileResolver) Watch(stop <-chan struct{}, changed func()) error {
+	file, err := filepath.Abs(r.path)
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			name, _ := filepath.Abs(event.Name)
+			if name == file && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				changed()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Warnf("watch endpoints file %s error:%v", file, err)
+		}
+	}
+}
@@ -10,8 +10,19 @@ type callInfo struct {
 	header             map[string]string
 	query              map[string]interface{}
 	responseNotParse   bool
-	httpRequestProcess func(req *http.Request) (*http.Request, error)
+	httpRequestProcess []ProcessRequestFunc
 	urlSetter          func() (string, error)
+	requestBodyLength  *int64
+	requestProgress    ProgressFunc
+	streamResponse     bool
+	responseProgress   ProgressFunc
+	requestEncoder     RequestEncoder
+	codec              Codec
+	// codec of client, used if codec not set
+	clientCodec Codec
+	balanceKey  string
+	// called with address of endpoint request sent to
+	endpointHooks []EndpointHook
 }
 
 type CallOption func(*callInfo)
@@ -30,6 +41,19 @@ func HeaderCallOption(header map[string]string) CallOption {
 	}
 }
 
+// OneHeaderCallOption 设置某个请求的单个头部, 不影响其他头部.
+func OneHeaderCallOption(key, value string) CallOption {
+	return func(c *callInfo) {
+		if key == "" {
+			return
+		}
+		if c.header == nil {
+			c.header = make(map[string]string)
+		}
+		c.header[key] = value
+	}
+}
+
 // QueryCallOption 设置某个连接查询参数.
 func QueryCallOption(query map[string]interface{}) CallOption {
 	return func(c *callInfo) {
@@ -65,9 +89,10 @@ func ResponseNotParseCallOption() CallOption {
 type ProcessRequestFunc func(req *http.Request) (*http.Request, error)
 
 // HttpRequestProcessOption 在http请求发起调用前，对http请求进行处理. 如根据url/请求头进行加密,并写入httpReq.
+// 多次设置时按设置顺序依次处理.
 func HttpRequestProcessOption(fun ProcessRequestFunc) CallOption {
 	return func(c *callInfo) {
-		c.httpRequestProcess = fun
+		c.httpRequestProcess = append(c.httpRequestProcess, fun)
 	}
 }
 
@@ -79,3 +104,80 @@ func URLOption(epf URLSetter) CallOption {
 		c.urlSetter = epf
 	}
 }
+
+// ProgressFunc reports progress of request or response body, total is -1 if length is unknown.
+type ProgressFunc func(transferred, total int64)
+
+// RequestBodyLengthCallOption 设置io.Reader请求体的长度, 未设置且无法从Reader得到长度时使用分块传输.
+func RequestBodyLengthCallOption(length int64) CallOption {
+	return func(c *callInfo) {
+		c.requestBodyLength = &length
+	}
+}
+
+// RequestProgressCallOption 上传io.Reader请求体时回调进度.
+func RequestProgressCallOption(fn ProgressFunc) CallOption {
+	return func(c *callInfo) {
+		c.requestProgress = fn
+	}
+}
+
+// StreamResponseCallOption 不读取响应体, 通过RawResponse.Stream返回, 调用者读取完毕后必须关闭.
+// 超时时间对整个读取过程生效.
+func StreamResponseCallOption() CallOption {
+	return func(c *callInfo) {
+		c.streamResponse = true
+	}
+}
+
+// ResponseProgressCallOption 读取响应体时回调进度.
+func ResponseProgressCallOption(fn ProgressFunc) CallOption {
+	return func(c *callInfo) {
+		c.responseProgress = fn
+	}
+}
+
+// RequestEncoderCallOption 设置请求体的编码方式, 优先于CodecCallOption. json.RawMessage和EncodedBody总是原样发送.
+func RequestEncoderCallOption(enc RequestEncoder) CallOption {
+	return func(c *callInfo) {
+		c.requestEncoder = enc
+	}
+}
+
+// FormCallOption 将结构体或map请求体编码为application/x-www-form-urlencoded表单.
+func FormCallOption() CallOption {
+	return RequestEncoderCallOption(FormEncoder)
+}
+
+// MultipartCallOption 将MultipartForm,结构体或map请求体编码为multipart/form-data表单.
+func MultipartCallOption() CallOption {
+	return RequestEncoderCallOption(MultipartEncoder)
+}
+
+// CodecCallOption 设置请求体编码和响应体解码的编解码器, 优先于客户端编解码器, 且不按响应的Content-Type选择解码器.
+func CodecCallOption(codec Codec) CallOption {
+	return func(c *callInfo) {
+		c.codec = codec
+	}
+}
+
+// clientCodecCallOption 设置客户端编解码器, 响应按Content-Type解码失败时使用.
+func clientCodecCallOption(codec Codec) CallOption {
+	return func(c *callInfo) {
+		c.clientCodec = codec
+	}
+}
+
+// BalanceKeyCallOption 设置负载均衡的键, 一致性哈希策略下相同的键选择相同的服务端.
+func BalanceKeyCallOption(key string) CallOption {
+	return func(c *callInfo) {
+		c.balanceKey = key
+	}
+}
+
+// EndpointCallOption 设置请求发送到服务端地址前调用的钩子, 如负载均衡选出的地址, 可多次设置.
+func EndpointCallOption(hook EndpointHook) CallOption {
+	return func(c *callInfo) {
+		c.endpointHooks = append(c.endpointHooks, hook)
+	}
+}
@@ -0,0 +1,199 @@
+package httpcli
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	MIMEYAML     = "application/yaml"
+	MIMEXML      = "application/xml"
+	MIMEProtobuf = "application/x-protobuf"
+)
+
+// Names of built-in codecs.
+const (
+	CodecJSON  = "json"
+	CodecYAML  = "yaml"
+	CodecXML   = "xml"
+	CodecProto = "proto"
+	CodecRaw   = "raw"
+)
+
+// Codec marshals request argument and unmarshals response body.
+type Codec interface {
+	// Name is the name registered, such as `json`.
+	Name() string
+	// ContentType is Content-Type of marshaled body.
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSONCodec  Codec = &codec{name: CodecJSON, contentType: MIMEJSON, marshal: json.Marshal, unmarshal: json.Unmarshal}
+	YAMLCodec  Codec = &codec{name: CodecYAML, contentType: MIMEYAML, marshal: yaml.Marshal, unmarshal: yaml.Unmarshal}
+	XMLCodec   Codec = &codec{name: CodecXML, contentType: MIMEXML, marshal: xml.Marshal, unmarshal: xml.Unmarshal}
+	ProtoCodec Codec = &codec{name: CodecProto, contentType: MIMEProtobuf, marshal: marshalProto, unmarshal: unmarshalProto}
+	// RawCodec sends []byte, string or json.RawMessage as it is, and unmarshals body into *[]byte, *string or io.Writer.
+	RawCodec Codec = &codec{name: CodecRaw, contentType: MIMEOctetStream, marshal: marshalRaw, unmarshal: unmarshalRaw}
+)
+
+var (
+	codecLock sync.RWMutex
+	// codecs by name
+	codecs = make(map[string]Codec)
+	// codecs by media type
+	mediaCodecs = make(map[string]Codec)
+)
+
+func init() {
+	RegisterCodec(JSONCodec)
+	RegisterCodec(YAMLCodec, "application/x-yaml", "text/yaml", "text/x-yaml")
+	RegisterCodec(XMLCodec, "text/xml")
+	RegisterCodec(ProtoCodec, "application/protobuf")
+	RegisterCodec(RawCodec)
+}
+
+// RegisterCodec registers codec by its name and content type, and decodes responses of mediaTypes with it.
+// Codec registered later replaces the former one with the same name or media type.
+func RegisterCodec(c Codec, mediaTypes ...string) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+
+	codecs[c.Name()] = c
+	for _, t := range append([]string{c.ContentType()}, mediaTypes...) {
+		if mt, _, err := mime.ParseMediaType(t); err == nil {
+			mediaCodecs[mt] = c
+		}
+	}
+}
+
+// GetCodec returns codec registered by name, nil if not exist.
+func GetCodec(name string) Codec {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	return codecs[name]
+}
+
+// CodecForContentType returns codec to decode body of contentType, nil if not exist.
+// Structured syntax suffix such as `application/problem+json` is supported.
+func CodecForContentType(contentType string) Codec {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	if c, ok := mediaCodecs[mt]; ok {
+		return c
+	}
+	if i := strings.LastIndex(mt, "+"); i >= 0 {
+		return codecs[mt[i+1:]]
+	}
+	return nil
+}
+
+// DecodeResponse decodes body of response into reply. Codec set by CodecCallOption in opts is always used,
+// otherwise codec of response Content-Type if registered, then codec of client, which defaults to JSONCodec.
+func DecodeResponse(resp *RawResponse, reply interface{}, opts ...CallOption) error {
+	ci := &callInfo{}
+	for _, o := range opts {
+		o(ci)
+	}
+	return decodeResponse(resp, reply, ci)
+}
+
+func decodeResponse(resp *RawResponse, reply interface{}, ci *callInfo) error {
+	if reply == nil {
+		return nil
+	}
+	c := ci.activeCodec()
+	// codec set explicitly in call wins over negotiation
+	if ci.codec == nil && resp.Header != nil {
+		if rc := CodecForContentType(resp.Header.Get("Content-Type")); rc != nil {
+			c = rc
+		}
+	}
+	if err := c.Unmarshal(resp.Body, reply); err != nil {
+		return fmt.Errorf("%s decode body fail:%w", c.Name(), err)
+	}
+	return nil
+}
+
+func (c *callInfo) activeCodec() Codec {
+	if c.codec != nil {
+		return c.codec
+	}
+	if c.clientCodec != nil {
+		return c.clientCodec
+	}
+	return JSONCodec
+}
+
+type codec struct {
+	name        string
+	contentType string
+	marshal     func(v interface{}) ([]byte, error)
+	unmarshal   func(data []byte, v interface{}) error
+}
+
+func (c *codec) Name() string                               { return c.name }
+func (c *codec) ContentType() string                        { return c.contentType }
+func (c *codec) Marshal(v interface{}) ([]byte, error)      { return c.marshal(v) }
+func (c *codec) Unmarshal(data []byte, v interface{}) error { return c.unmarshal(data, v) }
+
+func marshalProto(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func unmarshalProto(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func marshalRaw(v interface{}) ([]byte, error) {
+	switch d := v.(type) {
+	case []byte:
+		return d, nil
+	case json.RawMessage:
+		return d, nil
+	case string:
+		return []byte(d), nil
+	default:
+		return nil, fmt.Errorf("raw codec can't marshal %T", v)
+	}
+}
+
+func unmarshalRaw(data []byte, v interface{}) error {
+	switch d := v.(type) {
+	case *[]byte:
+		*d = append((*d)[:0], data...)
+	case *json.RawMessage:
+		*d = append((*d)[:0], data...)
+	case *string:
+		*d = string(data)
+	case io.Writer:
+		_, err := d.Write(data)
+		return err
+	default:
+		return fmt.Errorf("raw codec can't unmarshal into %T", v)
+	}
+	return nil
+}
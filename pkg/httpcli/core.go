@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -35,8 +35,14 @@ type Client struct {
 	clientCertData string
 	// 通用调用参数
 	callOpts []CallOption
+	// 编解码器
+	codec Codec
 	// 拦截器列表
 	chainInterceptors []Interceptor
+	// 负载均衡器
+	balancer Balancer
+	// 传输层包装
+	transportWrappers []TransportWrapper
 }
 
 func NewClient(addr string, options ...Option) (*Client, error) {
@@ -59,7 +65,7 @@ func (c *Client) GetAddr() string {
 }
 
 func (c *Client) validate() error {
-	if c.addr == "" {
+	if c.addr == "" && c.balancer == nil {
 		return fmt.Errorf("client addr is empty")
 	}
 
@@ -122,8 +128,13 @@ func (c *Client) GetConn(ctx context.Context) (*http.Client, error) {
 		tr.TLSClientConfig = creds
 	}
 
+	var rt http.RoundTripper = tr
+	for i := len(c.transportWrappers) - 1; i >= 0; i-- {
+		rt = c.transportWrappers[i](rt)
+	}
+
 	conn := http.Client{
-		Transport: tr,
+		Transport: rt,
 	}
 	c.conn = &conn
 	return c.conn, nil
@@ -145,6 +156,9 @@ func (c *Client) Invoke(
 	opts ...CallOption,
 ) (*RawResponse, error) {
 	opts = combine(c.callOpts, opts)
+	if c.codec != nil {
+		opts = combine([]CallOption{clientCodecCallOption(c.codec)}, opts)
+	}
 	file, line, fn := callerutil.CallerDepth(2)
 	callerMsg := fmt.Sprintf("%s:%s:%d", file, fn, line)
 
@@ -158,6 +172,10 @@ func (c *Client) Invoke(
 			c,
 			getChainUnaryInvoker(c.chainInterceptors, 0, invoke),
 			opts...)
+		// interceptors may reject streamed response, such as unexpected status code, close it for caller
+		if err != nil && rawResp != nil && rawResp.Stream != nil {
+			_ = rawResp.Stream.Close()
+		}
 
 		log.F(ctx).
 			Debug("Interceptor Invoked called.", log.String("caller", callerMsg), log.Err(err), log.Every("arg", arg), log.Every("reply", reply))
@@ -203,8 +221,11 @@ func getChainUnaryInvoker(interceptors []Interceptor, curr int, finalInvoker Inv
 }
 
 type RawResponse struct {
-	Header     http.Header
-	Body       []byte
+	Header http.Header
+	Body   []byte
+	// Stream is the response body not read if StreamResponseCallOption set, caller must close it
+	// if call succeeds, it has been closed if call fails.
+	Stream     io.ReadCloser
 	Cookies    []*http.Cookie
 	StatusCode int
 	Status     string
@@ -215,7 +236,6 @@ type RawResponse struct {
 
 type Invoker func(ctx context.Context, method string, rawURL string, arg, reply interface{}, cc *Client, opt ...CallOption) (*RawResponse, error)
 
-//nolint: funlen,gocognit
 func invoke(
 	ctx context.Context,
 	method string,
@@ -234,37 +254,76 @@ func invoke(
 		o(ci)
 	}
 
-	reqURL := cc.addr + rawURL
-	if ci.urlSetter != nil {
-		var err error
-		originURL := reqURL
-		reqURL, err = ci.urlSetter()
-		if err != nil {
-			log.F(ctx).Errorf("http Do urlSetter err:%s", err.Error())
-			return nil, err
+	if cc.balancer == nil || ci.urlSetter != nil {
+		rawResp, info := invokeEndpoint(ctx, cc.addr, method, rawURL, arg, reply, cc, ci)
+		return rawResp, info.Err
+	}
+
+	addr, done, err := cc.balancer.Pick(ctx, PickInfo{Method: method, RawURL: rawURL, Key: ci.balanceKey})
+	if err != nil {
+		log.F(ctx).Errorf("pick endpoint err:%s", err.Error())
+		return nil, err
+	}
+	log.F(ctx).Debugf("pick endpoint %s", addr)
+
+	rawResp, info := invokeEndpoint(ctx, addr, method, rawURL, arg, reply, cc, ci)
+	done(info)
+	return rawResp, info.Err
+}
+
+// invokeEndpoint calls endpoint hooks around sending request to addr.
+func invokeEndpoint(
+	ctx context.Context,
+	addr string,
+	method string,
+	rawURL string,
+	arg, reply interface{},
+	cc *Client,
+	ci *callInfo,
+) (*RawResponse, DoneInfo) {
+	dones := make([]func(DoneInfo), 0, len(ci.endpointHooks))
+	finish := func(info DoneInfo) {
+		for i := len(dones) - 1; i >= 0; i-- {
+			dones[i](info)
 		}
-		log.F(ctx).Debugf("urlSetter change req url from %v to %v", originURL, reqURL)
 	}
-	if ci.query != nil {
-		values := url.Values{}
-		for k, v := range ci.query {
-			var value string
-			switch v.(type) {
-			case string:
-				value = fmt.Sprintf("%s", v)
-			case int, int32, int64:
-				value = fmt.Sprintf("%d", v)
-			case float64, float32:
-				value = fmt.Sprintf("%v", v)
-			default:
-				value = fmt.Sprintf("%v", v)
-			}
-			values.Set(k, value)
+	for _, hook := range ci.endpointHooks {
+		done, err := hook(ctx, addr)
+		if err != nil {
+			info := DoneInfo{Err: err}
+			finish(info)
+			return nil, info
 		}
-		if len(ci.query) > 0 {
-			reqURL = fmt.Sprintf("%s?%s", reqURL, values.Encode())
+		if done != nil {
+			dones = append(dones, done)
 		}
 	}
+
+	rawResp, sent, err := doInvoke(ctx, addr, method, rawURL, arg, reply, cc, ci)
+	info := DoneInfo{Err: err, Sent: sent}
+	if rawResp != nil {
+		info.StatusCode = rawResp.StatusCode
+	}
+	finish(info)
+	return rawResp, info
+}
+
+// doInvoke sends request to addr, sent reports whether request has been sent to addr.
+//
+//nolint:funlen,gocognit
+func doInvoke(
+	ctx context.Context,
+	addr string,
+	method string,
+	rawURL string,
+	arg, reply interface{},
+	cc *Client,
+	ci *callInfo,
+) (*RawResponse, bool, error) {
+	reqURL, err := buildURL(ctx, addr, rawURL, ci)
+	if err != nil {
+		return nil, false, err
+	}
 	// refer to https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
 	var timeout time.Duration
 	var cancel context.CancelFunc
@@ -284,70 +343,92 @@ func invoke(
 	} else {
 		ctx, cancel = context.WithCancel(ctx)
 	}
-	defer cancel()
+	// streamed response body is read after invoke returned, cancel when it is closed
+	streaming := false
+	defer func() {
+		if !streaming {
+			cancel()
+		}
+	}()
 
 	httpReq, err := http.NewRequestWithContext(ctx, method, reqURL, nil)
 	if err != nil {
 		log.F(ctx).Errorf("http.NewRequest error:%s", err.Error())
-		return nil, err
+		return nil, false, err
 	}
 
 	for k, v := range ci.header {
 		httpReq.Header.Add(k, v)
 	}
 
-	if arg != nil {
-		var body []byte
-		// 不对数据做任何处理
-		// 如一些内含格式的字符串
-		if str, ok := arg.(json.RawMessage); ok {
-			body = str
-		} else {
-			body, err = json.Marshal(arg)
-			if err != nil {
-				log.F(ctx).Errorf("marshal data err:%s", err.Error())
-				return nil, err
-			}
+	var reqBody *bodyReader
+	if r, ok := arg.(io.Reader); ok {
+		// 流式上传, 不对数据做任何处理
+		length := readerLength(r)
+		if ci.requestBodyLength != nil {
+			length = *ci.requestBodyLength
 		}
+		log.F(ctx).Debugf("stream body data, length:%s", lengthString(length))
 
-		if httpReq.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
-			log.F(ctx).Debug("urlencoded body data")
-
-			bf := bytes.NewBuffer(body)
-			httpReq.Body = ioutil.NopCloser(bf)
-			httpReq.ContentLength = int64(len(body))
-		} else {
-			log.F(ctx).Debug("json body data")
+		reqBody = newBodyReader(r, length, ci.requestProgress)
+		httpReq.Body = reqBody
+		httpReq.ContentLength = length
+		if length == 0 {
+			httpReq.Body = http.NoBody
+		}
+		if httpReq.Header.Get("Content-Type") == "" {
+			httpReq.Header.Set("Content-Type", "application/octet-stream")
+		}
+	} else if arg != nil {
+		body, contentType, err := encodeBody(arg, ci)
+		if err != nil {
+			log.F(ctx).Errorf("encode data err:%s", err.Error())
+			return nil, false, err
+		}
+		log.F(ctx).Debugf("%s body data", contentType)
 
-			httpReq.Header.Add("Content-Type", "application/json")
-			httpReq.Body = ioutil.NopCloser(bytes.NewReader(body))
-			httpReq.ContentLength = int64(len(body))
+		// 调用者在头部指定的类型优先
+		if httpReq.Header.Get("Content-Type") == "" && contentType != "" {
+			httpReq.Header.Set("Content-Type", contentType)
+		}
+		httpReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+		httpReq.ContentLength = int64(len(body))
+		httpReq.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
 		}
 	}
 
 	// 某些情况下, 需要根据http请求的URL/头部等进行签名等处理
-	if ci.httpRequestProcess != nil {
-		httpReq, err = ci.httpRequestProcess(httpReq)
+	for _, process := range ci.httpRequestProcess {
+		httpReq, err = process(httpReq)
 		if err != nil {
 			log.F(ctx).Errorf("httpRequestProcess err:%s", err.Error())
-			return nil, err
+			return nil, false, err
 		}
 	}
 
 	conn, err := cc.GetConn(ctx)
 	if err != nil {
 		log.F(ctx).Errorf("get client conn err:%s", err.Error())
-		return nil, err
+		return nil, false, err
 	}
 
 	log.F(ctx).Debug("Before Do", log.Any("headers", httpReq.Header), log.String("requrl", httpReq.URL.String()))
 	httpResp, err := conn.Do(httpReq)
 	if err != nil {
-		log.F(ctx).Errorf("http Do err:%s", err.Error())
-		return nil, err
+		if reqBody != nil && !reqBody.complete() {
+			log.F(ctx).Errorf("http Do err:%s, %d/%s bytes of body sent", err.Error(), reqBody.read, lengthString(reqBody.total))
+		} else {
+			log.F(ctx).Errorf("http Do err:%s", err.Error())
+		}
+		return nil, true, err
 	}
 
-	defer httpResp.Body.Close()
+	defer func() {
+		if !streaming {
+			httpResp.Body.Close()
+		}
+	}()
 
 	rawResp := RawResponse{}
 	rawResp.Header = httpResp.Header
@@ -355,15 +436,22 @@ func invoke(
 	rawResp.StatusCode = httpResp.StatusCode
 	rawResp.Status = httpResp.Status
 	rawResp.ReqURL = reqURL
-	rawResp.ReqAddr = cc.addr
+	rawResp.ReqAddr = addr
 	rawResp.ReqHeader = httpReq.Header
 
 	log.F(ctx).Debug("After Do", log.Every("resp", rawResp))
 
-	bodyData, err := ioutil.ReadAll(httpResp.Body)
+	if ci.streamResponse {
+		streaming = true
+		rawResp.Stream = newResponseStream(ctx, httpResp.Body, httpResp.ContentLength, ci.responseProgress, cancel)
+		return &rawResp, true, nil
+	}
+
+	respBody := newBodyReader(httpResp.Body, httpResp.ContentLength, ci.responseProgress)
+	bodyData, err := ioutil.ReadAll(respBody)
 	if err != nil {
-		log.F(ctx).Errorf("http read body err:%s", err.Error())
-		return &rawResp, err
+		log.F(ctx).Errorf("http read body err:%s, %d/%s bytes read", err.Error(), respBody.read, lengthString(respBody.total))
+		return &rawResp, true, err
 	}
 
 	rawResp.Body = bodyData
@@ -372,11 +460,60 @@ func invoke(
 	// 由于无法覆盖服务器返回的状态码和返回请求体数据逻辑,因此提供选项允许调用者不在当前调用中进行数据解码
 	// 调用者可以自定义拦截器来根据具体场景解构状态码并解析数据。 示例见NoSuccessStatusCodeInterceptor
 	if !ci.responseNotParse && reply != nil {
-		if err := json.Unmarshal(bodyData, reply); err != nil {
+		if err := decodeResponse(&rawResp, reply, ci); err != nil {
 			log.F(ctx).Errorf("http decode  body err:%s", err.Error())
-			return &rawResp, err
+			return &rawResp, true, err
 		}
 		log.F(ctx).Debug("After Parse", log.Every("reply", reply))
 	}
-	return &rawResp, nil
+	return &rawResp, true, nil
+}
+
+// RequestURL returns the url requested with opts, such as the key of response cache in interceptor.
+// opts passed to interceptor have contained call options of client.
+func RequestURL(ctx context.Context, cc *Client, rawURL string, opts ...CallOption) (string, error) {
+	ci := &callInfo{}
+	for _, o := range opts {
+		o(ci)
+	}
+	return requestURL(ctx, cc, rawURL, ci)
+}
+
+func requestURL(ctx context.Context, cc *Client, rawURL string, ci *callInfo) (string, error) {
+	return buildURL(ctx, cc.addr, rawURL, ci)
+}
+
+func buildURL(ctx context.Context, addr string, rawURL string, ci *callInfo) (string, error) {
+	reqURL := addr + rawURL
+	if ci.urlSetter != nil {
+		var err error
+		originURL := reqURL
+		reqURL, err = ci.urlSetter()
+		if err != nil {
+			log.F(ctx).Errorf("http Do urlSetter err:%s", err.Error())
+			return "", err
+		}
+		log.F(ctx).Debugf("urlSetter change req url from %v to %v", originURL, reqURL)
+	}
+	if ci.query != nil {
+		values := url.Values{}
+		for k, v := range ci.query {
+			var value string
+			switch v.(type) {
+			case string:
+				value = fmt.Sprintf("%s", v)
+			case int, int32, int64:
+				value = fmt.Sprintf("%d", v)
+			case float64, float32:
+				value = fmt.Sprintf("%v", v)
+			default:
+				value = fmt.Sprintf("%v", v)
+			}
+			values.Set(k, value)
+		}
+		if len(ci.query) > 0 {
+			reqURL = fmt.Sprintf("%s?%s", reqURL, values.Encode())
+		}
+	}
+	return reqURL, nil
 }
@@ -2,13 +2,38 @@ package httpcli_test
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/wangweihong/eazycloud/pkg/circuitbreaker"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli/balancer"
+	"github.com/wangweihong/eazycloud/pkg/httpcli/interceptorcli/callstatus"
+	circuitbreakercli "github.com/wangweihong/eazycloud/pkg/httpcli/interceptorcli/circuitbreaker"
+	"github.com/wangweihong/eazycloud/pkg/httpcli/interceptorcli/conditional"
+	"github.com/wangweihong/eazycloud/pkg/httpcli/interceptorcli/retry"
+	tokencli "github.com/wangweihong/eazycloud/pkg/httpcli/interceptorcli/token"
 	"github.com/wangweihong/eazycloud/pkg/httpsvr"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/genericmiddleware"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/resource"
 
 	"github.com/wangweihong/eazycloud/pkg/httpcli"
 	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/token"
 	"github.com/wangweihong/eazycloud/pkg/version"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -118,3 +143,767 @@ func TestClient_Interceptor(t *testing.T) {
 		})
 	})
 }
+
+type etagUser struct {
+	resource.ObjectMeta
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestConditionalRequestInterceptor(t *testing.T) {
+	Convey("条件请求", t, func() {
+		gin.SetMode(gin.ReleaseMode)
+		store, err := resource.NewStore(&resource.Resource{
+			Name: "users",
+			New:  func() resource.Object { return &etagUser{} },
+			KeyFunc: func(obj interface{}) (string, error) {
+				return obj.(*etagUser).Name, nil
+			},
+		})
+		So(err, ShouldBeNil)
+		_, err = store.Create(context.Background(), &etagUser{Name: "u1"})
+		So(err, ShouldBeNil)
+
+		var statuses []int
+		e := gin.New()
+		e.Use(func(c *gin.Context) {
+			c.Next()
+			statuses = append(statuses, c.Writer.Status())
+		})
+		e.Use(genericmiddleware.ETag(false))
+		e.GET("/hello", func(c *gin.Context) {
+			ginx.WriteResponse(c, nil, "hello")
+		})
+		resource.Install(e, store)
+		srv := httptest.NewServer(e)
+		defer srv.Close()
+
+		vc := conditional.NewValidatorCache(time.Minute)
+		c, err := httpcli.NewClient(srv.URL,
+			httpcli.WithIntercepts(conditional.ConditionalRequestInterceptor(vc)))
+		So(err, ShouldBeNil)
+		ctx := context.Background()
+
+		Convey("ETag中间件", func() {
+			for i := 0; i < 2; i++ {
+				var reply ginx.Response
+				resp, err := c.Invoke(ctx, http.MethodGet, "/hello", nil, &reply)
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+				So(reply.Data, ShouldEqual, "hello")
+			}
+			So(statuses, ShouldResemble, []int{http.StatusOK, http.StatusNotModified})
+		})
+
+		Convey("资源版本ETag", func() {
+			var reply struct {
+				Data etagUser `json:"data"`
+			}
+			_, err := c.Invoke(ctx, http.MethodGet, "/users/u1", nil, &reply)
+			So(err, ShouldBeNil)
+			_, err = c.Invoke(ctx, http.MethodGet, "/users/u1", nil, &reply)
+			So(err, ShouldBeNil)
+			So(reply.Data.Name, ShouldEqual, "u1")
+			So(statuses, ShouldResemble, []int{http.StatusOK, http.StatusNotModified})
+			So(vc.ETag(srv.URL+"/users/u1"), ShouldEqual, `"`+reply.Data.ResourceVersion+`"`)
+
+			// 他人修改后, 带If-Match的更新失败
+			_, err = store.Patch(ctx, "u1", []byte(`{"age":1}`))
+			So(err, ShouldBeNil)
+			resp, err := c.Invoke(ctx, http.MethodPatch, "/users/u1", map[string]int{"age": 2}, nil)
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusPreconditionFailed)
+			So(vc.ETag(srv.URL+"/users/u1"), ShouldBeEmpty)
+
+			_, err = c.Invoke(ctx, http.MethodGet, "/users/u1", nil, &reply)
+			So(err, ShouldBeNil)
+			So(reply.Data.Age, ShouldEqual, 1)
+			resp, err = c.Invoke(ctx, http.MethodPatch, "/users/u1", map[string]int{"age": 2}, nil)
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			obj, err := store.Get("u1")
+			So(err, ShouldBeNil)
+			So(obj.(*etagUser).Age, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	Convey("重试拦截器", t, func() {
+		var lock sync.Mutex
+		var bodies []string
+		failures := 2
+		retryAfter := ""
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			if len(bodies) <= failures {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"name":"a"}`))
+		}))
+		defer srv.Close()
+
+		c, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(retry.RetryInterceptor(retry.Policy{
+			MaxAttempts:    3,
+			InitialBackoff: 10 * time.Millisecond,
+			Deadline:       time.Second,
+		})))
+		So(err, ShouldBeNil)
+
+		Convey("幂等请求失败后重试, 每次发送相同的请求体", func() {
+			var reply map[string]string
+			resp, err := c.Invoke(context.Background(), http.MethodPut, "/users/a", map[string]string{"name": "a"}, &reply)
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			So(reply["name"], ShouldEqual, "a")
+			So(bodies, ShouldResemble, []string{`{"name":"a"}`, `{"name":"a"}`, `{"name":"a"}`})
+		})
+
+		Convey("超过最大尝试次数返回最后的响应", func() {
+			failures = 3
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/users/a", nil, nil, httpcli.ResponseNotParseCallOption())
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+			So(bodies, ShouldHaveLength, 3)
+		})
+
+		Convey("非幂等请求不重试", func() {
+			resp, err := c.Invoke(context.Background(), http.MethodPost, "/users", nil, nil, httpcli.ResponseNotParseCallOption())
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+			So(bodies, ShouldHaveLength, 1)
+		})
+
+		Convey("Retry-After超过期限时不再重试", func() {
+			retryAfter = "10"
+			start := time.Now()
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/users/a", nil, nil, httpcli.ResponseNotParseCallOption())
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+			So(bodies, ShouldHaveLength, 1)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+
+		Convey("Retry-After不超过最大退避时间", func() {
+			retryAfter = "3600"
+			c, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(retry.RetryInterceptor(retry.Policy{
+				MaxAttempts:    3,
+				InitialBackoff: 10 * time.Millisecond,
+				MaxBackoff:     20 * time.Millisecond,
+			})))
+			So(err, ShouldBeNil)
+			start := time.Now()
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/users/a", nil, nil,
+				httpcli.StreamResponseCallOption())
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			_ = resp.Stream.Close()
+			So(bodies, ShouldHaveLength, 3)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+
+		Convey("网络错误重试", func() {
+			addr := srv.URL
+			srv.Close()
+			c, err := httpcli.NewClient(addr, httpcli.WithIntercepts(retry.RetryInterceptor(retry.Policy{
+				MaxAttempts:    2,
+				InitialBackoff: 10 * time.Millisecond,
+				Classifiers:    []retry.Classifier{retry.NetworkErrorClassifier()},
+			})))
+			So(err, ShouldBeNil)
+			attempts := 0
+			_, err = c.Invoke(context.Background(), http.MethodGet, "/users/a", nil, nil,
+				httpcli.HttpRequestProcessOption(func(req *http.Request) (*http.Request, error) {
+					attempts++
+					return req, nil
+				}))
+			So(err, ShouldNotBeNil)
+			So(attempts, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestCircuitBreakerInterceptor(t *testing.T) {
+	Convey("熔断拦截器", t, func() {
+		var lock sync.Mutex
+		requests := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			requests++
+			if r.URL.Path == "/down" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			if r.URL.Path == "/notfound" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		defer srv.Close()
+
+		group := circuitbreaker.NewGroup(circuitbreaker.Settings{MinRequests: 2, OpenDuration: time.Minute})
+
+		Convey("目标地址失败后熔断, 直接返回错误", func() {
+			c, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(
+				circuitbreakercli.CircuitBreakerInterceptor(group, false)))
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 2; i++ {
+				resp, err := c.Invoke(context.Background(), http.MethodGet, "/down", nil, nil, httpcli.ResponseNotParseCallOption())
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusBadGateway)
+			}
+			_, err = c.Invoke(context.Background(), http.MethodGet, "/up", nil, nil)
+			So(errors.IsCode(err, code.ErrCircuitOpen), ShouldBeTrue)
+			So(requests, ShouldEqual, 2)
+			So(group.States()[c.GetAddr()], ShouldEqual, circuitbreaker.StateOpen)
+		})
+
+		Convey("客户端错误和解码错误不计为失败", func() {
+			c, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(
+				circuitbreakercli.CircuitBreakerInterceptor(group, false)))
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 2; i++ {
+				resp, err := c.Invoke(context.Background(), http.MethodGet, "/notfound", nil, nil, httpcli.ResponseNotParseCallOption())
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+				var reply []string
+				_, err = c.Invoke(context.Background(), http.MethodGet, "/up", nil, &reply)
+				So(err, ShouldNotBeNil)
+			}
+			So(requests, ShouldEqual, 4)
+			So(group.States()[c.GetAddr()], ShouldEqual, circuitbreaker.StateClosed)
+		})
+
+		Convey("传输错误计为失败", func() {
+			down := httptest.NewServer(http.NotFoundHandler())
+			down.Close()
+			c, err := httpcli.NewClient(down.URL, httpcli.WithIntercepts(
+				circuitbreakercli.CircuitBreakerInterceptor(group, false)))
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 2; i++ {
+				_, err = c.Invoke(context.Background(), http.MethodGet, "/up", nil, nil)
+				So(err, ShouldNotBeNil)
+			}
+			So(group.States()[c.GetAddr()], ShouldEqual, circuitbreaker.StateOpen)
+		})
+
+		Convey("使用负载均衡时按选出的服务端熔断", func() {
+			bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+			defer bad.Close()
+			lb, err := balancer.New(balancer.StaticResolver(bad.URL, srv.URL), balancer.Config{MaxFails: 100})
+			So(err, ShouldBeNil)
+			defer lb.Close()
+			c, err := httpcli.NewClient("users", httpcli.WithBalancer(lb), httpcli.WithIntercepts(
+				circuitbreakercli.CircuitBreakerInterceptor(group, false)))
+			So(err, ShouldBeNil)
+
+			var opened, succeeded int
+			for i := 0; i < 8; i++ {
+				resp, err := c.Invoke(context.Background(), http.MethodGet, "/up", nil, nil, httpcli.ResponseNotParseCallOption())
+				switch {
+				case errors.IsCode(err, code.ErrCircuitOpen):
+					opened++
+				case err == nil && resp.StatusCode == http.StatusOK:
+					succeeded++
+				}
+			}
+			So(group.States()[bad.URL], ShouldEqual, circuitbreaker.StateOpen)
+			So(group.States()[srv.URL], ShouldEqual, circuitbreaker.StateClosed)
+			So(group.States(), ShouldNotContainKey, "users")
+			So(opened, ShouldBeGreaterThan, 0)
+			So(succeeded, ShouldEqual, 4)
+		})
+
+		Convey("按路由熔断不影响其他路由", func() {
+			c, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(
+				circuitbreakercli.CircuitBreakerInterceptor(group, true)))
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 3; i++ {
+				_, _ = c.Invoke(context.Background(), http.MethodGet, "/down?i=1", nil, nil, httpcli.ResponseNotParseCallOption())
+			}
+			So(requests, ShouldEqual, 2)
+			_, err = c.Invoke(context.Background(), http.MethodGet, "/up", nil, nil)
+			So(err, ShouldBeNil)
+			So(requests, ShouldEqual, 3)
+		})
+	})
+}
+
+func TestClient_Stream(t *testing.T) {
+	Convey("流式请求体和响应体", t, func() {
+		data := strings.Repeat("0123456789", 10000)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("X-Content-Length", strconv.FormatInt(r.ContentLength, 10))
+			w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+			w.Header().Set("X-Transfer-Encoding", strings.Join(r.TransferEncoding, ","))
+			if len(body) > 0 {
+				_, _ = w.Write(body)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			_, _ = w.Write([]byte(data))
+		}))
+		defer srv.Close()
+
+		c, err := httpcli.NewClient(srv.URL)
+		So(err, ShouldBeNil)
+
+		Convey("已知长度的请求体", func() {
+			var lock sync.Mutex
+			var sent, length int64
+			resp, err := c.Invoke(context.Background(), http.MethodPut, "/upload", strings.NewReader(data), nil,
+				httpcli.ResponseNotParseCallOption(),
+				httpcli.RequestProgressCallOption(func(transferred, total int64) {
+					lock.Lock()
+					defer lock.Unlock()
+					sent, length = transferred, total
+				}))
+			So(err, ShouldBeNil)
+			lock.Lock()
+			So(sent, ShouldEqual, len(data))
+			So(length, ShouldEqual, len(data))
+			lock.Unlock()
+			So(string(resp.Body), ShouldEqual, data)
+			So(resp.Header.Get("X-Content-Length"), ShouldEqual, strconv.Itoa(len(data)))
+			So(resp.Header.Get("X-Content-Type"), ShouldEqual, "application/octet-stream")
+		})
+
+		Convey("未知长度的请求体分块传输", func() {
+			pr, pw := io.Pipe()
+			go func() {
+				_, _ = pw.Write([]byte(data))
+				_ = pw.Close()
+			}()
+			resp, err := c.Invoke(context.Background(), http.MethodPut, "/upload", pr, nil,
+				httpcli.ResponseNotParseCallOption(),
+				httpcli.OneHeaderCallOption("Content-Type", "text/plain"))
+			So(err, ShouldBeNil)
+			So(string(resp.Body), ShouldEqual, data)
+			So(resp.Header.Get("X-Transfer-Encoding"), ShouldEqual, "chunked")
+			So(resp.Header.Get("X-Content-Type"), ShouldEqual, "text/plain")
+		})
+
+		Convey("流式读取响应体", func() {
+			var read, length int64
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/download", nil, nil,
+				httpcli.StreamResponseCallOption(),
+				httpcli.TimeoutCallOption(5*time.Second),
+				httpcli.ResponseProgressCallOption(func(transferred, total int64) {
+					read, length = transferred, total
+				}))
+			So(err, ShouldBeNil)
+			So(resp.Body, ShouldBeNil)
+			So(resp.Stream, ShouldNotBeNil)
+
+			buf := make([]byte, 100)
+			_, err = io.ReadFull(resp.Stream, buf)
+			So(err, ShouldBeNil)
+			So(string(buf), ShouldEqual, data[:100])
+
+			rest, err := ioutil.ReadAll(resp.Stream)
+			So(err, ShouldBeNil)
+			So(string(rest), ShouldEqual, data[100:])
+			So(resp.Stream.Close(), ShouldBeNil)
+			So(read, ShouldEqual, len(data))
+			So(length, ShouldEqual, len(data))
+		})
+
+		Convey("提前关闭响应流", func() {
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/download", nil, nil,
+				httpcli.StreamResponseCallOption())
+			So(err, ShouldBeNil)
+			buf := make([]byte, 10)
+			_, err = io.ReadFull(resp.Stream, buf)
+			So(err, ShouldBeNil)
+			So(resp.Stream.Close(), ShouldBeNil)
+			_, err = resp.Stream.Read(buf)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("拦截器返回错误时关闭响应流", func() {
+			c, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(
+				func(ctx context.Context, method string, rawURL string, arg, reply interface{}, cc *httpcli.Client, invoker httpcli.Invoker, opts ...httpcli.CallOption) (*httpcli.RawResponse, error) {
+					resp, err := invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+					if err == nil {
+						err = errors.Wrap(code.ErrHTTPError, "rejected")
+					}
+					return resp, err
+				}))
+			So(err, ShouldBeNil)
+
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/download", nil, nil,
+				httpcli.StreamResponseCallOption())
+			So(err, ShouldNotBeNil)
+			So(resp.Stream, ShouldNotBeNil)
+			_, err = resp.Stream.Read(make([]byte, 10))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestClient_Form(t *testing.T) {
+	Convey("表单编码", t, func() {
+		type Page struct {
+			Offset int `form:"offset"`
+		}
+		type Query struct {
+			Page
+			Name    string   `form:"name"`
+			Tags    []string `form:"tag"`
+			Enabled *bool    `form:"enabled"`
+			Empty   string   `form:"empty,omitempty"`
+			Ignored string   `form:"-"`
+		}
+
+		var lock sync.Mutex
+		var forms []map[string][]string
+		var files map[string]string
+		failures := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			forms = append(forms, r.PostForm)
+			if r.MultipartForm != nil {
+				files = make(map[string]string)
+				for name, fhs := range r.MultipartForm.File {
+					f, _ := fhs[0].Open()
+					data, _ := ioutil.ReadAll(f)
+					_ = f.Close()
+					files[name] = fhs[0].Filename + ":" + fhs[0].Header.Get("Content-Type") + ":" + string(data)
+				}
+			}
+			if len(forms) <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		defer srv.Close()
+
+		c, err := httpcli.NewClient(srv.URL)
+		So(err, ShouldBeNil)
+
+		Convey("按form标签编码结构体", func() {
+			values, err := httpcli.EncodeForm(&Query{Page: Page{Offset: 10}, Name: "a", Tags: []string{"x", "y"}, Ignored: "i"})
+			So(err, ShouldBeNil)
+			So(values.Encode(), ShouldEqual, "name=a&offset=10&tag=x&tag=y")
+
+			_, err = c.Invoke(context.Background(), http.MethodPost, "/form", Query{Name: "a b", Tags: []string{"x"}}, nil,
+				httpcli.FormCallOption())
+			So(err, ShouldBeNil)
+			So(forms[0], ShouldResemble, map[string][]string{"offset": {"0"}, "name": {"a b"}, "tag": {"x"}})
+		})
+
+		Convey("multipart表单上传文件", func() {
+			dir, err := ioutil.TempDir("", "httpcli")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "b.txt")
+			So(ioutil.WriteFile(path, []byte("from path"), 0o600), ShouldBeNil)
+
+			_, err = c.Invoke(context.Background(), http.MethodPost, "/upload", &httpcli.MultipartForm{
+				Fields: map[string]string{"name": "a"},
+				Files: []httpcli.FormFile{
+					{FieldName: "a", FileName: "a.txt", ContentType: "text/plain", Reader: strings.NewReader("from reader")},
+					{FieldName: "b", Path: path},
+				},
+			}, nil, httpcli.MultipartCallOption())
+			So(err, ShouldBeNil)
+			So(forms[0], ShouldResemble, map[string][]string{"name": {"a"}})
+			So(files, ShouldResemble, map[string]string{
+				"a": "a.txt:text/plain:from reader",
+				"b": "b.txt:application/octet-stream:from path",
+			})
+		})
+
+		Convey("重试时发送相同的表单", func() {
+			failures = 1
+			rc, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(retry.RetryInterceptor(retry.Policy{
+				InitialBackoff: 10 * time.Millisecond,
+				Methods:        []string{http.MethodPost},
+			})))
+			So(err, ShouldBeNil)
+			_, err = rc.Invoke(context.Background(), http.MethodPost, "/form", map[string]interface{}{"name": "a", "n": 1}, nil,
+				httpcli.FormCallOption())
+			So(err, ShouldBeNil)
+			So(forms, ShouldHaveLength, 2)
+			So(forms[1], ShouldResemble, forms[0])
+			So(forms[1], ShouldResemble, map[string][]string{"name": {"a"}, "n": {"1"}})
+		})
+	})
+}
+
+func TestClient_Codec(t *testing.T) {
+	Convey("编解码器", t, func() {
+		type Item struct {
+			Name  string `json:"name" yaml:"name" xml:"name"`
+			Count int    `json:"count" yaml:"count" xml:"count"`
+		}
+
+		var reqContentType, reqBody string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			reqContentType, reqBody = r.Header.Get("Content-Type"), string(body)
+			switch r.URL.Path {
+			case "/xml":
+				w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+				_, _ = w.Write([]byte(`<Item><name>x</name><count>2</count></Item>`))
+			case "/problem":
+				w.Header().Set("Content-Type", "application/problem+json")
+				_, _ = w.Write([]byte(`{"name":"p","count":3}`))
+			case "/plain":
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write(body)
+			default:
+				w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+				_, _ = w.Write(body)
+			}
+		}))
+		defer srv.Close()
+
+		Convey("客户端编解码器", func() {
+			c, err := httpcli.NewClient(srv.URL, httpcli.WithCodec(httpcli.YAMLCodec))
+			So(err, ShouldBeNil)
+
+			var reply Item
+			_, err = c.Invoke(context.Background(), http.MethodPost, "/echo", Item{Name: "a", Count: 1}, &reply)
+			So(err, ShouldBeNil)
+			So(reqContentType, ShouldEqual, httpcli.MIMEYAML)
+			So(reqBody, ShouldEqual, "name: a\ncount: 1\n")
+			So(reply, ShouldResemble, Item{Name: "a", Count: 1})
+
+			Convey("请求编解码器优先", func() {
+				_, err = c.Invoke(context.Background(), http.MethodPost, "/plain", "raw data", &reqBody,
+					httpcli.CodecCallOption(httpcli.RawCodec))
+				So(err, ShouldBeNil)
+				So(reqContentType, ShouldEqual, httpcli.MIMEOctetStream)
+				So(reqBody, ShouldEqual, "raw data")
+
+				// 不按响应Content-Type选择解码器
+				var raw string
+				_, err = c.Invoke(context.Background(), http.MethodGet, "/xml", nil, &raw,
+					httpcli.CodecCallOption(httpcli.RawCodec))
+				So(err, ShouldBeNil)
+				So(raw, ShouldEqual, `<Item><name>x</name><count>2</count></Item>`)
+			})
+		})
+
+		Convey("按响应Content-Type解码", func() {
+			c, err := httpcli.NewClient(srv.URL)
+			So(err, ShouldBeNil)
+
+			var reply Item
+			_, err = c.Invoke(context.Background(), http.MethodGet, "/xml", nil, &reply)
+			So(err, ShouldBeNil)
+			So(reply, ShouldResemble, Item{Name: "x", Count: 2})
+
+			_, err = c.Invoke(context.Background(), http.MethodGet, "/problem", nil, &reply)
+			So(err, ShouldBeNil)
+			So(reply, ShouldResemble, Item{Name: "p", Count: 3})
+
+			resp, err := c.Invoke(context.Background(), http.MethodPost, "/plain", Item{Name: "j"}, nil,
+				httpcli.ResponseNotParseCallOption())
+			So(err, ShouldBeNil)
+			So(httpcli.DecodeResponse(resp, &reply), ShouldBeNil)
+			So(reply, ShouldResemble, Item{Name: "j"})
+		})
+
+		Convey("注册的编解码器", func() {
+			So(httpcli.GetCodec(httpcli.CodecJSON), ShouldEqual, httpcli.JSONCodec)
+			So(httpcli.CodecForContentType("text/yaml"), ShouldEqual, httpcli.YAMLCodec)
+			So(httpcli.CodecForContentType("text/html"), ShouldBeNil)
+
+			data, err := httpcli.ProtoCodec.Marshal(wrapperspb.String("a"))
+			So(err, ShouldBeNil)
+			var m wrapperspb.StringValue
+			So(httpcli.ProtoCodec.Unmarshal(data, &m), ShouldBeNil)
+			So(m.GetValue(), ShouldEqual, "a")
+			_, err = httpcli.ProtoCodec.Marshal(Item{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCallStatusInterceptor(t *testing.T) {
+	Convey("响应信封拦截器", t, func() {
+		gin.SetMode(gin.TestMode)
+		engine := gin.New()
+		engine.GET("/items/a", func(c *gin.Context) {
+			ginx.WriteResponse(c, nil, map[string]string{"name": "a"})
+		})
+		engine.GET("/items/b", func(c *gin.Context) {
+			ginx.WriteResponse(c, errors.Wrap(code.ErrValidation, "invalid name"), nil)
+		})
+		engine.GET("/plain", func(c *gin.Context) {
+			c.String(http.StatusBadGateway, "bad gateway")
+		})
+		srv := httptest.NewServer(engine)
+		defer srv.Close()
+
+		c, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(callstatus.CallStatusInterceptor()))
+		So(err, ShouldBeNil)
+
+		Convey("成功时仅解析data", func() {
+			var reply map[string]string
+			_, err := c.Invoke(context.Background(), http.MethodGet, "/items/a", nil, &reply)
+			So(err, ShouldBeNil)
+			So(reply, ShouldResemble, map[string]string{"name": "a"})
+		})
+
+		Convey("失败时返回带有远端调用栈的错误", func() {
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/items/b", nil, nil)
+			So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+			So(errors.IsCode(err, code.ErrValidation), ShouldBeTrue)
+			e := errors.FromError(err)
+			So(e.Description(), ShouldEqual, "invalid name")
+			So(e.Stack(), ShouldHaveLength, 2)
+			So(e.Detail(), ShouldNotBeEmpty)
+		})
+
+		Convey("非信封响应", func() {
+			_, err := c.Invoke(context.Background(), http.MethodGet, "/plain", nil, nil)
+			So(errors.IsCode(err, code.ErrHTTPError), ShouldBeTrue)
+		})
+	})
+}
+
+func TestTokenInterceptor(t *testing.T) {
+	Convey("访问令牌拦截器", t, func() {
+		var lock sync.Mutex
+		issued := 0
+		tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, secret, _ := r.BasicAuth()
+			if id != "client" || secret != "secret" || r.PostFormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+				return
+			}
+			lock.Lock()
+			issued++
+			n := issued
+			lock.Unlock()
+			// slow down so that concurrent calls share one refreshing
+			time.Sleep(50 * time.Millisecond)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"token-` + strconv.Itoa(n) + `","token_type":"bearer","expires_in":3600}`))
+		}))
+		defer tokenSrv.Close()
+
+		// token-1 is expired after the first round
+		expired := map[string]bool{}
+		apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			auth := r.Header.Get("Authorization")
+			if expired[auth] {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"status":{"code":` + strconv.Itoa(code.ErrExpired) + `}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"auth":"` + auth + `"}`))
+		}))
+		defer apiSrv.Close()
+
+		source, err := token.ClientCredentialsTokenSource(token.ClientCredentialsConfig{
+			ClientID:     "client",
+			ClientSecret: "secret",
+			TokenURL:     tokenSrv.URL,
+		})
+		So(err, ShouldBeNil)
+		c, err := httpcli.NewClient(apiSrv.URL, httpcli.WithIntercepts(tokencli.TokenInterceptor(source)))
+		So(err, ShouldBeNil)
+
+		var wg sync.WaitGroup
+		replies := make([]map[string]string, 10)
+		errs := make([]error, 10)
+		for i := range replies {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = c.Invoke(context.Background(), http.MethodGet, "/items", nil, &replies[i])
+			}(i)
+		}
+		wg.Wait()
+		for i := range replies {
+			So(errs[i], ShouldBeNil)
+			So(replies[i]["auth"], ShouldEqual, "Bearer token-1")
+		}
+		So(issued, ShouldEqual, 1)
+
+		lock.Lock()
+		expired["Bearer token-1"] = true
+		lock.Unlock()
+		var reply map[string]string
+		_, err = c.Invoke(context.Background(), http.MethodGet, "/items", nil, &reply)
+		So(err, ShouldBeNil)
+		So(reply["auth"], ShouldEqual, "Bearer token-2")
+		So(issued, ShouldEqual, 2)
+
+		Convey("流式响应重试前关闭被拒绝的响应流", func() {
+			closed := make(chan struct{}, 1)
+			streamSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") == "Bearer token-2" {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					w.WriteHeader(http.StatusUnauthorized)
+					w.(http.Flusher).Flush()
+					select {
+					case <-r.Context().Done():
+						closed <- struct{}{}
+					case <-time.After(10 * time.Second):
+					}
+					return
+				}
+				_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+			}))
+			defer streamSrv.Close()
+
+			c, err := httpcli.NewClient(streamSrv.URL, httpcli.WithIntercepts(tokencli.TokenInterceptor(source)))
+			So(err, ShouldBeNil)
+			resp, err := c.Invoke(context.Background(), http.MethodGet, "/items", nil, nil, httpcli.StreamResponseCallOption())
+			So(err, ShouldBeNil)
+			data, err := ioutil.ReadAll(resp.Stream)
+			_ = resp.Stream.Close()
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "Bearer token-3")
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				So("rejected stream not closed", ShouldBeEmpty)
+			}
+		})
+
+		Convey("令牌获取失败", func() {
+			source, err := token.ClientCredentialsTokenSource(token.ClientCredentialsConfig{
+				ClientID:     "client",
+				ClientSecret: "wrong",
+				TokenURL:     tokenSrv.URL,
+			})
+			So(err, ShouldBeNil)
+			c, err := httpcli.NewClient(apiSrv.URL, httpcli.WithIntercepts(tokencli.TokenInterceptor(source)))
+			So(err, ShouldBeNil)
+			_, err = c.Invoke(context.Background(), http.MethodGet, "/items", nil, nil)
+			So(errors.IsCode(err, code.ErrTokenInvalid), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,350 @@
+package httpcli
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MIMEJSON          = "application/json"
+	MIMEPOSTForm      = "application/x-www-form-urlencoded"
+	MIMEMultipartForm = "multipart/form-data"
+	MIMEOctetStream   = "application/octet-stream"
+)
+
+// RequestEncoder encodes request argument into body.
+type RequestEncoder interface {
+	// Encode returns body and its Content-Type.
+	Encode(arg interface{}) (body []byte, contentType string, err error)
+}
+
+// RequestEncoderFunc is a function RequestEncoder.
+type RequestEncoderFunc func(arg interface{}) ([]byte, string, error)
+
+func (f RequestEncoderFunc) Encode(arg interface{}) ([]byte, string, error) {
+	return f(arg)
+}
+
+var (
+	// JSONEncoder encodes argument into json.
+	JSONEncoder = CodecEncoder(JSONCodec)
+	// FormEncoder encodes struct or map argument into urlencoded form, see EncodeForm.
+	FormEncoder RequestEncoder = RequestEncoderFunc(func(arg interface{}) ([]byte, string, error) {
+		values, err := EncodeForm(arg)
+		if err != nil {
+			return nil, "", err
+		}
+		return []byte(values.Encode()), MIMEPOSTForm, nil
+	})
+	// MultipartEncoder encodes MultipartForm, or struct or map argument into multipart form.
+	MultipartEncoder RequestEncoder = RequestEncoderFunc(encodeMultipart)
+)
+
+// EncodedBody is request body already encoded, it is sent as it is.
+type EncodedBody struct {
+	ContentType string
+	Data        []byte
+}
+
+// EncodeRequestBody encodes arg with encoder in opts, so the same body can be sent several times,
+// such as retries in interceptor. Readers are read into memory.
+func EncodeRequestBody(arg interface{}, opts ...CallOption) (*EncodedBody, error) {
+	ci := &callInfo{}
+	for _, o := range opts {
+		o(ci)
+	}
+	if r, ok := arg.(io.Reader); ok {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return &EncodedBody{ContentType: MIMEOctetStream, Data: data}, nil
+	}
+	data, contentType, err := encodeBody(arg, ci)
+	if err != nil {
+		return nil, err
+	}
+	return &EncodedBody{ContentType: contentType, Data: data}, nil
+}
+
+func encodeBody(arg interface{}, ci *callInfo) ([]byte, string, error) {
+	switch v := arg.(type) {
+	case *EncodedBody:
+		return v.Data, v.ContentType, nil
+	case json.RawMessage:
+		// 不对数据做任何处理, 如一些内含格式的字符串
+		return v, MIMEJSON, nil
+	}
+	if ci.requestEncoder != nil {
+		return ci.requestEncoder.Encode(arg)
+	}
+	return CodecEncoder(ci.activeCodec()).Encode(arg)
+}
+
+// CodecEncoder encodes request argument with codec.
+func CodecEncoder(codec Codec) RequestEncoder {
+	return RequestEncoderFunc(func(arg interface{}) ([]byte, string, error) {
+		body, err := codec.Marshal(arg)
+		return body, codec.ContentType(), err
+	})
+}
+
+// FormFile is a file part of multipart form, content is read from Reader, or file of Path if Reader is nil.
+type FormFile struct {
+	FieldName string
+	// FileName defaults to base name of Path.
+	FileName string
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+	Reader      io.Reader
+	Path        string
+}
+
+// MultipartForm is argument of multipart form, Fields is struct or map encoded by EncodeForm.
+type MultipartForm struct {
+	Fields interface{}
+	Files  []FormFile
+}
+
+func encodeMultipart(arg interface{}) ([]byte, string, error) {
+	form, ok := arg.(*MultipartForm)
+	if !ok {
+		if f, isForm := arg.(MultipartForm); isForm {
+			form = &f
+		} else {
+			form = &MultipartForm{Fields: arg}
+		}
+	}
+
+	values, err := EncodeForm(form.Fields)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range values[k] {
+			if err := w.WriteField(k, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	for i := range form.Files {
+		if err := writeFormFile(w, &form.Files[i]); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+func writeFormFile(w *multipart.Writer, f *FormFile) error {
+	if f.FieldName == "" {
+		return fmt.Errorf("field name of form file is empty")
+	}
+	r := f.Reader
+	if r == nil {
+		if f.Path == "" {
+			return fmt.Errorf("form file %s has neither reader nor path", f.FieldName)
+		}
+		file, err := os.Open(f.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	fileName := f.FileName
+	if fileName == "" && f.Path != "" {
+		fileName = filepath.Base(f.Path)
+	}
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = MIMEOctetStream
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		escapeQuotes(f.FieldName), escapeQuotes(fileName)))
+	h.Set("Content-Type", contentType)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, r)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// EncodeForm encodes struct or map into form values.
+// Struct fields are named by `form` tag or field name, tag `-` skips the field and option `omitempty` skips zero value.
+// Embedded structs are flattened, slices are encoded as multiple values, nil pointers are skipped.
+func EncodeForm(arg interface{}) (url.Values, error) {
+	values := url.Values{}
+	if arg == nil {
+		return values, nil
+	}
+	switch v := arg.(type) {
+	case url.Values:
+		return v, nil
+	case map[string][]string:
+		return url.Values(v), nil
+	case map[string]string:
+		for k, s := range v {
+			values.Set(k, s)
+		}
+		return values, nil
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(arg))
+	switch rv.Kind() {
+	case reflect.Struct:
+		if err := encodeFormStruct(values, rv); err != nil {
+			return nil, err
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("form: map key must be string, got %s", rv.Type().Key())
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := encodeFormValue(values, iter.Key().String(), iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+	case reflect.Invalid:
+	default:
+		return nil, fmt.Errorf("form: unsupported type %s", rv.Type())
+	}
+	return values, nil
+}
+
+func encodeFormStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+		tag := field.Tag.Get("form")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		if field.Anonymous && name == "" {
+			ev := reflect.Indirect(fv)
+			if ev.Kind() == reflect.Struct {
+				if err := encodeFormStruct(values, ev); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+		if err := encodeFormValue(values, name, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeFormValue(values url.Values, name string, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < v.Len(); i++ {
+			s, err := formString(v.Index(i))
+			if err != nil {
+				return fmt.Errorf("form: field %s: %w", name, err)
+			}
+			values.Add(name, s)
+		}
+		return nil
+	}
+	s, err := formString(v)
+	if err != nil {
+		return fmt.Errorf("form: field %s: %w", name, err)
+	}
+	values.Add(name, s)
+	return nil
+}
+
+func formString(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if v.CanInterface() {
+		switch i := v.Interface().(type) {
+		case time.Time:
+			return i.Format(time.RFC3339), nil
+		case time.Duration:
+			return i.String(), nil
+		case encoding.TextMarshaler:
+			b, err := i.MarshalText()
+			return string(b), err
+		case fmt.Stringer:
+			return i.String(), nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
@@ -0,0 +1,68 @@
+package callstatus
+
+import (
+	"encoding/json"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+)
+
+// BatchItemResult is the result of an item in batch response.
+type BatchItemResult struct {
+	ID string
+	// Err is nil if item succeeded.
+	Err error
+	// Data is the raw data of item, decode it into the expected type.
+	Data json.RawMessage
+}
+
+// DecodeBatchResponse decodes batch response body written by server into per-item results.
+// Error is returned only if body is not a valid batch response.
+func DecodeBatchResponse(body []byte) ([]BatchItemResult, error) {
+	var resp struct {
+		Status *ginx.CallStatus `json:"status"`
+		Data   *struct {
+			Items []struct {
+				ID     string           `json:"id"`
+				Status *ginx.CallStatus `json:"status"`
+				Data   json.RawMessage  `json:"data,omitempty"`
+			} `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, errors.WrapError(code.ErrHTTPResponseDataParseError, err)
+	}
+
+	if resp.Status == nil || resp.Status.Code != int64(code.ErrOperationBatchExecute) {
+		// request fail as a whole
+		if err := ginx.ToError(resp.Status); err != nil {
+			return nil, err
+		}
+		return nil, errors.Wrap(code.ErrHTTPResponseDataParseError, "response is not a batch response")
+	}
+	if resp.Data == nil {
+		return nil, errors.Wrap(code.ErrHTTPResponseDataParseError, "batch response has no data")
+	}
+
+	results := make([]BatchItemResult, 0, len(resp.Data.Items))
+	for _, item := range resp.Data.Items {
+		results = append(results, BatchItemResult{
+			ID:   item.ID,
+			Err:  ginx.ToError(item.Status),
+			Data: item.Data,
+		})
+	}
+	return results, nil
+}
+
+// BatchErrors returns errors of failed items keyed by item id.
+func BatchErrors(results []BatchItemResult) map[string]error {
+	errs := make(map[string]error)
+	for _, r := range results {
+		if r.Err != nil {
+			errs[r.ID] = r.Err
+		}
+	}
+	return errs
+}
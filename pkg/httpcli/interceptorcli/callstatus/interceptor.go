@@ -0,0 +1,69 @@
+package callstatus
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/json"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// envelope is ginx.Response with data not decoded.
+type envelope struct {
+	Status *ginx.CallStatus `json:"status"`
+	Data   json.RawMessage  `json:"data,omitempty"`
+}
+
+// 响应信封拦截器
+// 解析服务端ginx.Response格式的响应, 非成功的状态转换为带有远端调用栈的错误, 仅将Data解析到reply.
+// 响应不是ginx.Response时, 非2xx状态码返回code.ErrHTTPError错误, 否则返回code.ErrHTTPResponseDataParseError错误.
+func CallStatusInterceptor(skipperFunc ...skipper.SkipperFunc) httpcli.Interceptor {
+	name := "CallStatusInterceptor"
+	return func(ctx context.Context, method string, rawURL string, arg, reply interface{}, cc *httpcli.Client, invoker httpcli.Invoker, opts ...httpcli.CallOption) (*httpcli.RawResponse, error) {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(rawURL, skipperFunc...) {
+			log.F(ctx).Debugf("skip interceptor %s for %s", name, rawURL)
+
+			return invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+		}
+
+		// tell `invoker` do not parse response data, only `data` field is decoded into reply
+		opts = append(opts, httpcli.ResponseNotParseCallOption())
+
+		rawResp, err := invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+		if err != nil {
+			return rawResp, errors.UpdateStack(err)
+		}
+
+		var resp envelope
+		if err := json.Unmarshal(rawResp.Body, &resp); err != nil || resp.Status == nil {
+			if rawResp.StatusCode < http.StatusOK || rawResp.StatusCode >= http.StatusMultipleChoices {
+				log.F(ctx).Errorf("response status %d is not success", rawResp.StatusCode)
+				return rawResp, errors.WrapF(code.ErrHTTPError, "response status %d is not success", rawResp.StatusCode)
+			}
+			log.F(ctx).Errorf("`status` field not exist in response")
+			return rawResp, errors.Wrap(code.ErrHTTPResponseDataParseError, "`status` field not exist in response")
+		}
+
+		// keep stack of remote services, so that the call chain can be traced
+		if err := ginx.ToError(resp.Status); err != nil {
+			log.F(ctx).Error(err.Error())
+			return rawResp, err
+		}
+
+		if reply != nil && len(resp.Data) > 0 && string(resp.Data) != "null" {
+			if err := json.Unmarshal(resp.Data, reply); err != nil {
+				log.F(ctx).Errorf("decode data err:%s", err.Error())
+				return rawResp, errors.WrapError(code.ErrHTTPResponseDataParseError, err)
+			}
+		}
+		return rawResp, nil
+	}
+}
@@ -0,0 +1,61 @@
+package circuitbreaker
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wangweihong/eazycloud/pkg/circuitbreaker"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// 熔断拦截器
+// 按实际请求的服务端地址(使用负载均衡时为选出的地址)熔断, perRoute为true时按地址+请求方法+路径熔断. 熔断期间直接返回code.ErrCircuitOpen错误.
+// 仅传输错误(连接失败、超时等)或响应状态码>=500计为失败, 业务错误、4xx及解码失败不计入, 调用方取消的请求不计入.
+// 传输错误被其他拦截器包装后无法识别, 应放在拦截器链的内层.
+func CircuitBreakerInterceptor(group *circuitbreaker.Group, perRoute bool, skipperFunc ...skipper.SkipperFunc) httpcli.Interceptor {
+	name := "CircuitBreakerInterceptor"
+	return func(ctx context.Context, method string, rawURL string, arg, reply interface{}, cc *httpcli.Client, invoker httpcli.Invoker, opts ...httpcli.CallOption) (*httpcli.RawResponse, error) {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(rawURL, skipperFunc...) {
+			log.F(ctx).Debugf("skip interceptor %s for %s", name, rawURL)
+
+			return invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+		}
+
+		// endpoint is known only after picked by balancer
+		hook := func(ctx context.Context, addr string) (func(httpcli.DoneInfo), error) {
+			key := addr
+			if perRoute {
+				key += " " + method + " " + routePath(rawURL)
+			}
+			done, err := group.Get(key).Allow()
+			if err != nil {
+				log.F(ctx).Warnf("%s %s to %s rejected:%v", method, rawURL, addr, err)
+				return nil, err
+			}
+			return func(di httpcli.DoneInfo) {
+				done(circuitbreaker.Classify(ctx, di.Err, di.StatusCode >= http.StatusInternalServerError))
+			}, nil
+		}
+
+		resp, err := invoker(ctx, method, rawURL, arg, reply, cc, append(opts, httpcli.EndpointCallOption(hook))...)
+		return resp, errors.UpdateStack(err)
+	}
+}
+
+func routePath(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Path
+	}
+	if i := strings.IndexByte(rawURL, '?'); i >= 0 {
+		return rawURL[:i]
+	}
+	return rawURL
+}
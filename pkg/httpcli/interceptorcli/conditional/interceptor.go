@@ -0,0 +1,164 @@
+package conditional
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wangweihong/eazycloud/pkg/cache"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+const (
+	headerETag            = "ETag"
+	headerLastModified    = "Last-Modified"
+	headerIfMatch         = "If-Match"
+	headerIfNoneMatch     = "If-None-Match"
+	headerIfModifiedSince = "If-Modified-Since"
+	defaultValidatorTTL   = 10 * time.Minute
+)
+
+// validator is the cached validators and body of a GET response.
+type validator struct {
+	url          string
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// ValidatorCache caches validators of GET responses by request url.
+type ValidatorCache struct {
+	store cache.Store
+}
+
+// NewValidatorCache returns a cache whose entries expire after ttl, default is 10 minutes.
+func NewValidatorCache(ttl time.Duration) *ValidatorCache {
+	if ttl <= 0 {
+		ttl = defaultValidatorTTL
+	}
+	return &ValidatorCache{
+		store: cache.NewTTLStore(func(obj interface{}) (string, error) {
+			return obj.(*validator).url, nil
+		}, ttl),
+	}
+}
+
+// ETag returns the cached etag of url.
+func (v *ValidatorCache) ETag(url string) string {
+	if e := v.get(url); e != nil {
+		return e.etag
+	}
+	return ""
+}
+
+// Invalidate removes cached validators of url.
+func (v *ValidatorCache) Invalidate(url string) {
+	_ = v.store.Delete(&validator{url: url})
+}
+
+func (v *ValidatorCache) get(url string) *validator {
+	obj, exists, _ := v.store.GetByKey(url)
+	if !exists {
+		return nil
+	}
+	return obj.(*validator)
+}
+
+// 条件请求拦截器
+// GET请求缓存响应的ETag/Last-Modified, 再次请求时带上If-None-Match/If-Modified-Since, 服务端返回304时使用缓存的响应体.
+// PUT/PATCH/DELETE请求如果有缓存的强ETag, 带上If-Match避免覆盖他人的修改, 请求完成后清除缓存.
+// 注意: 拦截器会自行解析响应数据到reply.
+func ConditionalRequestInterceptor(vc *ValidatorCache, skipperFunc ...skipper.SkipperFunc) httpcli.Interceptor {
+	name := "ConditionalRequestInterceptor"
+	return func(ctx context.Context, method string, rawURL string, arg, reply interface{}, cc *httpcli.Client, invoker httpcli.Invoker, opts ...httpcli.CallOption) (*httpcli.RawResponse, error) {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(rawURL, skipperFunc...) {
+			log.F(ctx).Debugf("skip interceptor %s for %s", name, rawURL)
+
+			return invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+		}
+
+		reqURL, err := httpcli.RequestURL(ctx, cc, rawURL, opts...)
+		if err != nil {
+			return nil, errors.UpdateStack(err)
+		}
+
+		switch method {
+		case http.MethodGet:
+			return conditionalGet(ctx, vc, reqURL, rawURL, reply, cc, invoker, opts...)
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if e := vc.get(reqURL); e != nil && e.etag != "" && !strings.HasPrefix(e.etag, "W/") {
+				log.F(ctx).Debugf("send If-Match %s for %s", e.etag, reqURL)
+				opts = append(opts, httpcli.OneHeaderCallOption(headerIfMatch, e.etag))
+			}
+			rawResp, err := invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+			if err != nil {
+				return rawResp, errors.UpdateStack(err)
+			}
+			// resource changed, or cached one is stale if precondition failed
+			vc.Invalidate(reqURL)
+			return rawResp, nil
+		default:
+			return invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+		}
+	}
+}
+
+func conditionalGet(
+	ctx context.Context,
+	vc *ValidatorCache,
+	reqURL, rawURL string,
+	reply interface{},
+	cc *httpcli.Client,
+	invoker httpcli.Invoker,
+	opts ...httpcli.CallOption,
+) (*httpcli.RawResponse, error) {
+	cached := vc.get(reqURL)
+	if cached != nil {
+		if cached.etag != "" {
+			opts = append(opts, httpcli.OneHeaderCallOption(headerIfNoneMatch, cached.etag))
+		}
+		if cached.lastModified != "" {
+			opts = append(opts, httpcli.OneHeaderCallOption(headerIfModifiedSince, cached.lastModified))
+		}
+	}
+	// tell `invoker` do not parse response data, body of 304 is empty
+	opts = append(opts, httpcli.ResponseNotParseCallOption())
+
+	rawResp, err := invoker(ctx, http.MethodGet, rawURL, nil, reply, cc, opts...)
+	if err != nil {
+		return rawResp, errors.UpdateStack(err)
+	}
+
+	switch {
+	case rawResp.StatusCode == http.StatusNotModified && cached != nil:
+		log.F(ctx).Debugf("%s not modified, use cached response", reqURL)
+		rawResp.StatusCode = http.StatusOK
+		rawResp.Status = "200 OK"
+		rawResp.Body = append([]byte(nil), cached.body...)
+	case rawResp.StatusCode == http.StatusOK &&
+		(rawResp.Header.Get(headerETag) != "" || rawResp.Header.Get(headerLastModified) != ""):
+		_ = vc.store.Add(&validator{
+			url:          reqURL,
+			etag:         rawResp.Header.Get(headerETag),
+			lastModified: rawResp.Header.Get(headerLastModified),
+			body:         rawResp.Body,
+		})
+	default:
+		vc.Invalidate(reqURL)
+	}
+
+	if reply != nil && len(rawResp.Body) > 0 {
+		if err := httpcli.DecodeResponse(rawResp, reply, opts...); err != nil {
+			log.F(ctx).Errorf("decode  err:%s", err.Error())
+			return rawResp, err
+		}
+	}
+	return rawResp, nil
+}
@@ -0,0 +1,307 @@
+package retry
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/json"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+	DefaultMultiplier     = 2.0
+	DefaultJitter         = 0.2
+)
+
+// IdempotentMethods are methods retried by default.
+var IdempotentMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace,
+}
+
+// RetryableStatusCodes are status codes retried by default.
+var RetryableStatusCodes = []int{
+	http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+}
+
+// Classifier reports whether result of an attempt should be retried.
+type Classifier func(resp *httpcli.RawResponse, err error) bool
+
+// StatusCodeClassifier retries responses with status codes.
+func StatusCodeClassifier(codes ...int) Classifier {
+	return func(resp *httpcli.RawResponse, err error) bool {
+		if resp == nil {
+			return false
+		}
+		for _, c := range codes {
+			if resp.StatusCode == c {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// NetworkErrorClassifier retries network errors such as connection refused, reset and timeout
+// of a single attempt. Canceled context is not retried.
+// Errors converted by `errors.UpdateStack` in inner interceptors are classified by message.
+func NetworkErrorClassifier() Classifier {
+	return func(resp *httpcli.RawResponse, err error) bool {
+		if err == nil || stderrors.Is(err, context.Canceled) {
+			return false
+		}
+		if stderrors.Is(err, io.EOF) || stderrors.Is(err, io.ErrUnexpectedEOF) ||
+			stderrors.Is(err, syscall.ECONNREFUSED) || stderrors.Is(err, syscall.ECONNRESET) {
+			return true
+		}
+		var netErr net.Error
+		if stderrors.As(err, &netErr) {
+			return true
+		}
+
+		msg := err.Error()
+		if strings.Contains(msg, context.Canceled.Error()) {
+			return false
+		}
+		for _, s := range networkErrorMessages {
+			if strings.Contains(msg, s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var networkErrorMessages = []string{
+	"connection refused", "connection reset", "broken pipe", "EOF", "i/o timeout",
+	"deadline exceeded", "no such host", "Client.Timeout",
+}
+
+// CodeClassifier retries errors with `errors` codes, and responses whose `status.code` is one of codes.
+func CodeClassifier(codes ...int) Classifier {
+	return func(resp *httpcli.RawResponse, err error) bool {
+		for _, c := range codes {
+			if err != nil && errors.IsCode(err, c) {
+				return true
+			}
+		}
+		if resp == nil || len(resp.Body) == 0 {
+			return false
+		}
+		var body struct {
+			Status *struct {
+				Code int `json:"code"`
+			} `json:"status"`
+		}
+		if json.Unmarshal(resp.Body, &body) != nil || body.Status == nil {
+			return false
+		}
+		for _, c := range codes {
+			if body.Status.Code == c {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// DefaultClassifiers retries network errors and RetryableStatusCodes.
+func DefaultClassifiers() []Classifier {
+	return []Classifier{NetworkErrorClassifier(), StatusCodeClassifier(RetryableStatusCodes...)}
+}
+
+// Policy configures retry, zero fields use defaults.
+type Policy struct {
+	// MaxAttempts includes the first attempt.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes backoff by the fraction, between 0 and 1.
+	Jitter float64
+	// Deadline limits all attempts and backoff, zero means only limited by ctx.
+	Deadline time.Duration
+	// Methods are methods to retry, defaults to IdempotentMethods.
+	Methods []string
+	// Classifiers retry an attempt if any of them reports true, defaults to DefaultClassifiers.
+	Classifiers []Classifier
+}
+
+func (p Policy) complete() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultMultiplier
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		p.Jitter = DefaultJitter
+	}
+	if len(p.Methods) == 0 {
+		p.Methods = IdempotentMethods
+	}
+	if len(p.Classifiers) == 0 {
+		p.Classifiers = DefaultClassifiers()
+	}
+	return p
+}
+
+// 重试拦截器
+// 按指数退避加随机抖动重试失败的请求, 默认仅重试幂等方法的网络错误和429/502/503/504响应.
+// 响应带有Retry-After时等待其指定的时间(不超过MaxBackoff), 超过剩余期限则不再重试. 请求体只按调用的编码方式编码一次, 每次尝试发送相同的数据.
+// 应放在拦截器链的前面, 使后续的拦截器在每次尝试时都执行.
+func RetryInterceptor(policy Policy, skipperFunc ...skipper.SkipperFunc) httpcli.Interceptor {
+	name := "RetryInterceptor"
+	policy = policy.complete()
+	methods := make(map[string]bool, len(policy.Methods))
+	for _, m := range policy.Methods {
+		methods[m] = true
+	}
+	var randLock sync.Mutex
+	random := rand.New(rand.NewSource(time.Now().UnixNano())) // nolint: gosec
+
+	return func(ctx context.Context, method string, rawURL string, arg, reply interface{}, cc *httpcli.Client, invoker httpcli.Invoker, opts ...httpcli.CallOption) (*httpcli.RawResponse, error) {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(rawURL, skipperFunc...) || !methods[method] || policy.MaxAttempts == 1 {
+			resp, err := invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+			return resp, errors.UpdateStack(err)
+		}
+
+		arg, err := replayable(arg, opts)
+		if err != nil {
+			return nil, errors.UpdateStack(err)
+		}
+
+		if policy.Deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, policy.Deadline)
+			defer cancel()
+		}
+
+		var resp *httpcli.RawResponse
+		for attempt := 1; ; attempt++ {
+			log.F(ctx).Debugf("attempt %d/%d: %s %s", attempt, policy.MaxAttempts, method, rawURL)
+			resp, err = invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+			if !retryable(policy.Classifiers, resp, err) {
+				if attempt > 1 {
+					log.F(ctx).Infof("attempt %d/%d: %s %s finished, status:%d, err:%v",
+						attempt, policy.MaxAttempts, method, rawURL, statusCode(resp), err)
+				}
+				return resp, errors.UpdateStack(err)
+			}
+			if attempt >= policy.MaxAttempts {
+				log.F(ctx).Warnf("attempt %d/%d: %s %s failed, give up, status:%d, err:%v",
+					attempt, policy.MaxAttempts, method, rawURL, statusCode(resp), err)
+				return resp, errors.UpdateStack(err)
+			}
+
+			delay := retryAfter(resp)
+			if delay > policy.MaxBackoff {
+				delay = policy.MaxBackoff
+			}
+			if delay <= 0 {
+				randLock.Lock()
+				delay = policy.backoff(attempt, random.Float64())
+				randLock.Unlock()
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				log.F(ctx).Warnf("attempt %d/%d: %s %s failed, no time to retry after %v, status:%d, err:%v",
+					attempt, policy.MaxAttempts, method, rawURL, delay, statusCode(resp), err)
+				return resp, errors.UpdateStack(err)
+			}
+			log.F(ctx).Warnf("attempt %d/%d: %s %s failed, retry after %v, status:%d, err:%v",
+				attempt, policy.MaxAttempts, method, rawURL, delay, statusCode(resp), err)
+			// response of failed attempt is discarded
+			if resp != nil && resp.Stream != nil {
+				_ = resp.Stream.Close()
+				resp.Stream = nil
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return resp, errors.UpdateStack(err)
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// backoff returns delay before next attempt, r is a random number in [0, 1).
+func (p Policy) backoff(attempt int, r float64) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d *= 1 + p.Jitter*(2*r-1)
+	return time.Duration(d)
+}
+
+func retryable(classifiers []Classifier, resp *httpcli.RawResponse, err error) bool {
+	for _, c := range classifiers {
+		if c(resp, err) {
+			return true
+		}
+	}
+	return false
+}
+
+// replayable encodes arg once with encoder of call, so every attempt sends the same body.
+// Reader is read into memory since it can't be read again.
+func replayable(arg interface{}, opts []httpcli.CallOption) (interface{}, error) {
+	switch arg.(type) {
+	case nil, json.RawMessage, *httpcli.EncodedBody:
+		return arg, nil
+	default:
+		return httpcli.EncodeRequestBody(arg, opts...)
+	}
+}
+
+// retryAfter parses Retry-After header in seconds or http date.
+func retryAfter(resp *httpcli.RawResponse) time.Duration {
+	if resp == nil || resp.Header == nil {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func statusCode(resp *httpcli.RawResponse) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
@@ -0,0 +1,82 @@
+package signature
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/signature"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// 请求签名拦截器
+// 在请求发出前按signature.CanonicalRequest格式签名, 签名写入请求头. signedHeaders为空时签名signature.DefaultSignedHeaders.
+// 无法预先读取的请求体(如流式上传)不签名, 摘要为signature.UnsignedPayload.
+func SignatureInterceptor(signer signature.Signer, signedHeaders []string, skipperFunc ...skipper.SkipperFunc) httpcli.Interceptor {
+	name := "SignatureInterceptor"
+	return func(ctx context.Context, method string, rawURL string, arg, reply interface{}, cc *httpcli.Client, invoker httpcli.Invoker, opts ...httpcli.CallOption) (*httpcli.RawResponse, error) {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(rawURL, skipperFunc...) {
+			log.F(ctx).Debugf("skip interceptor %s for %s", name, rawURL)
+
+			return invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+		}
+
+		// sign after other request processing, signed headers must not be changed later
+		opts = append(opts, httpcli.HttpRequestProcessOption(func(req *http.Request) (*http.Request, error) {
+			digest, err := bodyDigest(req)
+			if err != nil {
+				log.F(ctx).Errorf("read request body err:%s", err.Error())
+				return nil, errors.WrapError(code.ErrHTTPClientGenerateError, err)
+			}
+			if err := signature.Sign(req, signer, signedHeaders, digest); err != nil {
+				log.F(ctx).Errorf("sign request err:%s", err.Error())
+				return nil, errors.WrapError(code.ErrHTTPClientGenerateError, err)
+			}
+			return req, nil
+		}))
+
+		rawResp, err := invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+		if err != nil {
+			return rawResp, errors.UpdateStack(err)
+		}
+		return rawResp, nil
+	}
+}
+
+// HMAC-SHA256请求签名拦截器.
+func HMACSignatureInterceptor(keyID string, secret []byte, skipperFunc ...skipper.SkipperFunc) httpcli.Interceptor {
+	return SignatureInterceptor(signature.NewHMACSigner(keyID, secret), nil, skipperFunc...)
+}
+
+// Ed25519请求签名拦截器.
+func Ed25519SignatureInterceptor(keyID string, key ed25519.PrivateKey, skipperFunc ...skipper.SkipperFunc) httpcli.Interceptor {
+	return SignatureInterceptor(signature.NewEd25519Signer(keyID, key), nil, skipperFunc...)
+}
+
+// bodyDigest reads body by GetBody, so that body is not consumed.
+func bodyDigest(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return signature.BodyDigest(nil), nil
+	}
+	if req.GetBody == nil {
+		return signature.UnsignedPayload, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return signature.BodyDigest(data), nil
+}
@@ -5,7 +5,6 @@ import (
 	"net/http"
 
 	"github.com/wangweihong/eazycloud/pkg/code"
-	"github.com/wangweihong/eazycloud/pkg/json"
 
 	"github.com/wangweihong/eazycloud/pkg/errors"
 	"github.com/wangweihong/eazycloud/pkg/httpcli"
@@ -40,7 +39,7 @@ func NoSuccessStatusCodeInterceptor(skipperFunc ...skipper.SkipperFunc) httpcli.
 		}
 
 		if reply != nil {
-			if err := json.Unmarshal(rawResp.Body, reply); err != nil {
+			if err := httpcli.DecodeResponse(rawResp, reply, opts...); err != nil {
 				log.F(ctx).Errorf("decode  err:%s", err.Error())
 				return rawResp, err
 			}
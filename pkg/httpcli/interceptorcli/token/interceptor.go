@@ -0,0 +1,85 @@
+package token
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/json"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+	"github.com/wangweihong/eazycloud/pkg/token"
+)
+
+// 访问令牌拦截器
+// 从source获取令牌并设置`Authorization`请求头. 响应为401且表明令牌过期或无效时, 令牌失效后使用新令牌重试一次.
+// source需实现token.Invalidator才会重试, 流式请求体不重试.
+func TokenInterceptor(source token.TokenSource, skipperFunc ...skipper.SkipperFunc) httpcli.Interceptor {
+	name := "TokenInterceptor"
+	return func(ctx context.Context, method string, rawURL string, arg, reply interface{}, cc *httpcli.Client, invoker httpcli.Invoker, opts ...httpcli.CallOption) (*httpcli.RawResponse, error) {
+		log.F(ctx).Debugf("Interceptor %s Enter", name)
+		defer log.F(ctx).Debugf("Interceptor %s Finish", name)
+
+		if skipper.Skip(rawURL, skipperFunc...) {
+			log.F(ctx).Debugf("skip interceptor %s for %s", name, rawURL)
+
+			return invoker(ctx, method, rawURL, arg, reply, cc, opts...)
+		}
+
+		invalidator, retryable := source.(token.Invalidator)
+		if _, ok := arg.(io.Reader); ok {
+			retryable = false
+		}
+
+		for attempt := 1; ; attempt++ {
+			t, err := source.Token(ctx)
+			if err != nil {
+				log.F(ctx).Errorf("get token err:%s", err.Error())
+				return nil, errors.WrapError(code.ErrTokenInvalid, err)
+			}
+
+			callOpts := append(opts[:len(opts):len(opts)], httpcli.HttpRequestProcessOption(func(req *http.Request) (*http.Request, error) {
+				req.Header.Set("Authorization", t.AuthorizationHeader())
+				return req, nil
+			}))
+			rawResp, err := invoker(ctx, method, rawURL, arg, reply, cc, callOpts...)
+			if attempt == 1 && retryable && tokenRejected(rawResp) {
+				log.F(ctx).Warnf("token rejected by %s, retry with new token", rawURL)
+				invalidator.Invalidate(t)
+				if rawResp.Stream != nil {
+					_ = rawResp.Stream.Close()
+				}
+				continue
+			}
+			if err != nil {
+				return rawResp, errors.UpdateStack(err)
+			}
+			return rawResp, nil
+		}
+	}
+}
+
+// tokenRejected returns true if response is 401 and indicates token is expired or invalid,
+// by `WWW-Authenticate` header or `status.code` of response envelope.
+func tokenRejected(rawResp *httpcli.RawResponse) bool {
+	if rawResp == nil || rawResp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	if strings.Contains(rawResp.Header.Get("WWW-Authenticate"), "invalid_token") {
+		return true
+	}
+
+	var body struct {
+		Status *struct {
+			Code int `json:"code"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(rawResp.Body, &body); err != nil || body.Status == nil {
+		return false
+	}
+	return body.Status.Code == code.ErrExpired || body.Status.Code == code.ErrTokenInvalid
+}
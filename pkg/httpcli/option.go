@@ -70,3 +70,27 @@ func WithTransport(tp *http.Transport) Option {
 		c.transport = tp
 	}
 }
+
+// TransportWrapper 包装客户端的http传输层.
+type TransportWrapper func(next http.RoundTripper) http.RoundTripper
+
+// WithTransportWrapper 包装客户端的http传输层, 如记录/回放请求. 先设置的包装在外层.
+func WithTransportWrapper(wrappers ...TransportWrapper) Option {
+	return func(c *Client) {
+		c.transportWrappers = append(c.transportWrappers, wrappers...)
+	}
+}
+
+// WithCodec 设置客户端的编解码器, 可被CodecCallOption覆盖. 响应的Content-Type有注册的编解码器时, 优先使用该编解码器解码.
+func WithCodec(codec Codec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithBalancer 设置负载均衡器, 每个请求由负载均衡器选择服务端地址, 此时addr仅作为客户端名称.
+func WithBalancer(b Balancer) Option {
+	return func(c *Client) {
+		c.balancer = b
+	}
+}
@@ -0,0 +1,140 @@
+package recorder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/wangweihong/eazycloud/pkg/json"
+)
+
+// CassetteVersion is the version of cassette format.
+const CassetteVersion = 1
+
+// Redacted replaces value of redacted headers.
+const Redacted = "REDACTED"
+
+// DefaultRedactHeaders are headers redacted when recording, such as credentials.
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Signature",
+}
+
+// Body is request or response body, base64 encoded if not valid utf8.
+type Body struct {
+	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+	Data     string `json:"data,omitempty"     yaml:"data,omitempty"`
+}
+
+// NewBody encodes data into Body.
+func NewBody(data []byte) Body {
+	if utf8.Valid(data) {
+		return Body{Data: string(data)}
+	}
+	return Body{Encoding: "base64", Data: base64.StdEncoding.EncodeToString(data)}
+}
+
+// Bytes decodes Body.
+func (b Body) Bytes() ([]byte, error) {
+	if b.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(b.Data)
+	}
+	return []byte(b.Data), nil
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string      `json:"method"           yaml:"method"`
+	URL    string      `json:"url"              yaml:"url"`
+	Header http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body   Body        `json:"body"             yaml:"body"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode int         `json:"statusCode"       yaml:"statusCode"`
+	Header     http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body       Body        `json:"body"             yaml:"body"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"  yaml:"request"`
+	Response Response `json:"response" yaml:"response"`
+}
+
+// Cassette is the file of recorded interactions.
+type Cassette struct {
+	Version      int            `json:"version"      yaml:"version"`
+	Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+}
+
+// LoadCassette reads cassette from file, format is decided by extension, yaml for `.yaml` and `.yml`, otherwise json.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{}
+	if isYAML(path) {
+		err = yaml.Unmarshal(data, c)
+	} else {
+		err = json.Unmarshal(data, c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode cassette %s fail:%w", path, err)
+	}
+	if c.Version != CassetteVersion {
+		return nil, fmt.Errorf("cassette %s version %d is not supported", path, c.Version)
+	}
+	return c, nil
+}
+
+// Save writes cassette into file, parent directory is created if not exist.
+func (c *Cassette) Save(path string) error {
+	c.Version = CassetteVersion
+	var data []byte
+	var err error
+	if isYAML(path) {
+		data, err = yaml.Marshal(c)
+	} else {
+		data, err = json.MarshalIndent(c, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0o600)
+}
+
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// redact returns copy of header with values of names replaced by Redacted.
+func redact(header http.Header, names []string) http.Header {
+	if header == nil {
+		return nil
+	}
+	h := header.Clone()
+	for _, name := range names {
+		if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+			h.Set(name, Redacted)
+		}
+	}
+	return h
+}
@@ -0,0 +1,68 @@
+package recorder
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"reflect"
+
+	"github.com/wangweihong/eazycloud/pkg/json"
+)
+
+// Matcher tells whether live request with body matches the recorded one.
+type Matcher func(r *http.Request, body []byte, recorded *Request) bool
+
+// DefaultMatchers match method and url.
+var DefaultMatchers = []Matcher{MatchMethod, MatchURL}
+
+// MatchMethod matches method.
+func MatchMethod(r *http.Request, body []byte, recorded *Request) bool {
+	return r.Method == recorded.Method
+}
+
+// MatchURL matches scheme, host, path and query, order of query parameters is ignored.
+func MatchURL(r *http.Request, body []byte, recorded *Request) bool {
+	u, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+	return r.URL.Scheme == u.Scheme && r.URL.Host == u.Host && r.URL.Path == u.Path &&
+		reflect.DeepEqual(r.URL.Query(), u.Query())
+}
+
+// MatchPath matches path and query only, so that recording can be replayed against another address.
+func MatchPath(r *http.Request, body []byte, recorded *Request) bool {
+	u, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+	return r.URL.Path == u.Path && reflect.DeepEqual(r.URL.Query(), u.Query())
+}
+
+// MatchHeaders returns Matcher matching values of headers.
+func MatchHeaders(names ...string) Matcher {
+	return func(r *http.Request, body []byte, recorded *Request) bool {
+		for _, name := range names {
+			if !reflect.DeepEqual(r.Header.Values(name), recorded.Header.Values(name)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchBody matches body, json bodies are compared semantically.
+func MatchBody(r *http.Request, body []byte, recorded *Request) bool {
+	data, err := recorded.Body.Bytes()
+	if err != nil {
+		return false
+	}
+	if bytes.Equal(body, data) {
+		return true
+	}
+	var live, rec interface{}
+	if json.Unmarshal(body, &live) != nil || json.Unmarshal(data, &rec) != nil {
+		return false
+	}
+	return reflect.DeepEqual(live, rec)
+}
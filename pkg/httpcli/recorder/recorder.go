@@ -0,0 +1,233 @@
+package recorder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// Mode is the mode of Recorder.
+type Mode string
+
+const (
+	// ModeReplay replays recorded interactions, request not matched fails.
+	ModeReplay Mode = "replay"
+	// ModeRecord sends requests and records interactions, cassette is overwritten once saved.
+	ModeRecord Mode = "record"
+	// ModeReplayOrRecord replays if cassette exists, otherwise records.
+	ModeReplayOrRecord Mode = "replay-or-record"
+)
+
+// Config is config of Recorder.
+type Config struct {
+	// Path is the cassette file.
+	Path string
+	// Mode is ModeReplayOrRecord if not set.
+	Mode Mode
+	// Matchers match request with recorded interactions, all of them must match. DefaultMatchers if not set.
+	Matchers []Matcher
+	// RedactHeaders are redacted when recording, DefaultRedactHeaders if not set.
+	RedactHeaders []string
+}
+
+// Recorder records or replays interactions of httpcli.Client, plugged in by httpcli.WithTransportWrapper.
+// Each recorded interaction is replayed once in order, so that repeated requests are replayed deterministically.
+type Recorder struct {
+	config Config
+	mode   Mode
+
+	lock     sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// New creates Recorder, cassette is loaded in replay mode.
+func New(config Config) (*Recorder, error) {
+	if config.Path == "" {
+		return nil, errors.Wrap(code.ErrValidation, "cassette path must be set")
+	}
+	if config.Mode == "" {
+		config.Mode = ModeReplayOrRecord
+	}
+	if len(config.Matchers) == 0 {
+		config.Matchers = DefaultMatchers
+	}
+	if config.RedactHeaders == nil {
+		config.RedactHeaders = DefaultRedactHeaders
+	}
+
+	r := &Recorder{config: config, mode: config.Mode, cassette: &Cassette{Version: CassetteVersion}}
+	switch config.Mode {
+	case ModeRecord:
+	case ModeReplayOrRecord:
+		if _, err := os.Stat(config.Path); os.IsNotExist(err) {
+			r.mode = ModeRecord
+			break
+		}
+		r.mode = ModeReplay
+		fallthrough
+	case ModeReplay:
+		cassette, err := LoadCassette(config.Path)
+		if err != nil {
+			return nil, errors.WrapError(code.ErrValidation, err)
+		}
+		r.cassette = cassette
+		r.used = make([]bool, len(cassette.Interactions))
+	default:
+		return nil, errors.WrapF(code.ErrValidation, "unknown recorder mode %s", config.Mode)
+	}
+	log.Debugf("recorder of cassette %s is in %s mode", config.Path, r.mode)
+	return r, nil
+}
+
+// Mode returns the actual mode, ModeRecord or ModeReplay.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Wrapper returns httpcli.TransportWrapper, which can be passed to httpcli.WithTransportWrapper.
+func (r *Recorder) Wrapper() httpcli.TransportWrapper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &transport{recorder: r, next: next}
+	}
+}
+
+// Save writes recorded interactions into cassette, nothing is done in replay mode.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.cassette.Save(r.config.Path)
+}
+
+// Unused returns interactions not replayed, which can be used to check all of them are requested.
+func (r *Recorder) Unused() []*Interaction {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var unused []*Interaction
+	for i, used := range r.used {
+		if !used {
+			unused = append(unused, r.cassette.Interactions[i])
+		}
+	}
+	return unused
+}
+
+type transport struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.recorder.mode == ModeReplay {
+		return t.recorder.replay(req, body)
+	}
+	return t.recorder.record(t.next, req, body)
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !r.match(req, body, &interaction.Request) {
+			continue
+		}
+		r.used[i] = true
+		return newResponse(req, &interaction.Response)
+	}
+	return nil, errors.WrapF(code.ErrHTTPError, "no interaction recorded in %s matches %s %s",
+		r.config.Path, req.Method, req.URL.String())
+}
+
+func (r *Recorder) match(req *http.Request, body []byte, recorded *Request) bool {
+	for _, m := range r.config.Matchers {
+		if !m(req, body, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Recorder) record(next http.RoundTripper, req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		// failed request is not recorded, it can't be replayed as response
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redact(req.Header, r.config.RedactHeaders),
+			Body:   NewBody(body),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     redact(resp.Header, r.config.RedactHeaders),
+			Body:       NewBody(respBody),
+		},
+	}
+	r.lock.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.lock.Unlock()
+	return resp, nil
+}
+
+// readBody reads request body and restores it.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func newResponse(req *http.Request, recorded *Response) (*http.Response, error) {
+	body, err := recorded.Body.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("decode recorded body fail:%w", err)
+	}
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,163 @@
+package recorder_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/httpcli/recorder"
+)
+
+func TestRecorder(t *testing.T) {
+	Convey("记录和回放", t, func() {
+		var count int64
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt64(&count, 1)
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "session=secret")
+			_, _ = fmt.Fprintf(w, `{"count":%d,"path":"%s","body":%q}`, n, r.URL.Path, body)
+		}))
+		defer srv.Close()
+
+		dir, err := ioutil.TempDir("", "recorder")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		type reply struct {
+			Count int    `json:"count"`
+			Path  string `json:"path"`
+			Body  string `json:"body"`
+		}
+		call := func(r *recorder.Recorder, path string, arg interface{}) (*reply, error) {
+			c, err := httpcli.NewClient(srv.URL, httpcli.WithTransportWrapper(r.Wrapper()))
+			So(err, ShouldBeNil)
+			var resp reply
+			_, err = c.Invoke(context.Background(), http.MethodPost, path, arg, &resp,
+				httpcli.OneHeaderCallOption("Authorization", "Bearer secret"))
+			return &resp, err
+		}
+
+		for _, ext := range []string{".yaml", ".json"} {
+			path := filepath.Join(dir, "cassettes", "users"+ext)
+
+			r, err := recorder.New(recorder.Config{Path: path})
+			So(err, ShouldBeNil)
+			So(r.Mode(), ShouldEqual, recorder.ModeRecord)
+			for i := 0; i < 2; i++ {
+				resp, err := call(r, "/users", map[string]string{"name": "a"})
+				So(err, ShouldBeNil)
+				So(resp.Path, ShouldEqual, "/users")
+			}
+			So(r.Save(), ShouldBeNil)
+
+			data, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldContainSubstring, recorder.Redacted)
+			So(string(data), ShouldNotContainSubstring, "secret")
+
+			// replay doesn't send request
+			before := atomic.LoadInt64(&count)
+			r, err = recorder.New(recorder.Config{Path: path, Matchers: []recorder.Matcher{recorder.MatchMethod, recorder.MatchURL, recorder.MatchBody}})
+			So(err, ShouldBeNil)
+			So(r.Mode(), ShouldEqual, recorder.ModeReplay)
+			So(r.Unused(), ShouldHaveLength, 2)
+
+			first, err := call(r, "/users", map[string]string{"name": "a"})
+			So(err, ShouldBeNil)
+			second, err := call(r, "/users", map[string]string{"name": "a"})
+			So(err, ShouldBeNil)
+			So(second.Count, ShouldEqual, first.Count+1)
+			So(first.Body, ShouldEqual, `{"name":"a"}`)
+			So(r.Unused(), ShouldBeEmpty)
+			So(atomic.LoadInt64(&count), ShouldEqual, before)
+
+			_, err = call(r, "/users", map[string]string{"name": "a"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no interaction recorded")
+		}
+
+		Convey("请求不匹配", func() {
+			path := filepath.Join(dir, "users.yaml")
+			r, err := recorder.New(recorder.Config{Path: path, Mode: recorder.ModeRecord})
+			So(err, ShouldBeNil)
+			_, err = call(r, "/users", map[string]string{"name": "a"})
+			So(err, ShouldBeNil)
+			So(r.Save(), ShouldBeNil)
+
+			r, err = recorder.New(recorder.Config{Path: path, Mode: recorder.ModeReplay,
+				Matchers: []recorder.Matcher{recorder.MatchMethod, recorder.MatchPath, recorder.MatchBody}})
+			So(err, ShouldBeNil)
+			_, err = call(r, "/users", map[string]string{"name": "b"})
+			So(err, ShouldNotBeNil)
+			_, err = call(r, "/groups", map[string]string{"name": "a"})
+			So(err, ShouldNotBeNil)
+			_, err = call(r, "/users", map[string]string{"name": "a"})
+			So(err, ShouldBeNil)
+
+			_, err = recorder.New(recorder.Config{Path: filepath.Join(dir, "none.yaml"), Mode: recorder.ModeReplay})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestStub(t *testing.T) {
+	Convey("请求桩", t, func() {
+		stub := recorder.NewStub()
+		stub.On(http.MethodGet, "/users/1").Reply(http.StatusOK, map[string]string{"name": "a"}).Times(1)
+		stub.On(http.MethodGet, "/users/1").Reply(http.StatusNotFound, `{"name":""}`)
+		stub.On(http.MethodPost, "/users").MatchHeader("X-Tenant", "t1").MatchBody(map[string]string{"name": "b"}).ReplyFunc(
+			func(req *http.Request, body []byte) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusCreated,
+					Header:     http.Header{},
+					Body:       ioutil.NopCloser(http.NoBody),
+					Request:    req,
+				}, nil
+			})
+		stub.On(http.MethodDelete, "").ReplyError(fmt.Errorf("connection reset"))
+
+		c, err := httpcli.NewClient("http://users.local", httpcli.WithTransportWrapper(stub.Wrapper()))
+		So(err, ShouldBeNil)
+
+		var reply map[string]string
+		resp, err := c.Invoke(context.Background(), http.MethodGet, "/users/1", nil, &reply)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(reply["name"], ShouldEqual, "a")
+
+		resp, err = c.Invoke(context.Background(), http.MethodGet, "/users/1", nil, nil)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+
+		resp, err = c.Invoke(context.Background(), http.MethodPost, "/users", map[string]string{"name": "b"}, nil,
+			httpcli.OneHeaderCallOption("X-Tenant", "t1"))
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+
+		_, err = c.Invoke(context.Background(), http.MethodPost, "/users", map[string]string{"name": "b"}, nil,
+			httpcli.OneHeaderCallOption("X-Tenant", "t2"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "no stub matches")
+
+		_, err = c.Invoke(context.Background(), http.MethodDelete, "/users/"+strconv.Itoa(1), nil, nil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "connection reset")
+
+		requests := stub.Requests()
+		So(requests, ShouldHaveLength, 5)
+		So(requests[2].URL, ShouldEqual, "http://users.local/users")
+		data, _ := requests[2].Body.Bytes()
+		So(string(data), ShouldEqual, `{"name":"b"}`)
+	})
+}
@@ -0,0 +1,202 @@
+package recorder
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/json"
+)
+
+// ResponderFunc builds response of request with body.
+type ResponderFunc func(req *http.Request, body []byte) (*http.Response, error)
+
+// Route is a stubbed request and its response.
+type Route struct {
+	method    string
+	path      string
+	matchers  []Matcher
+	expected  Request
+	response  Response
+	err       error
+	responder ResponderFunc
+	times     int
+	calls     int
+}
+
+// MatchHeader matches request whose header key is value.
+func (r *Route) MatchHeader(key, value string) *Route {
+	if r.expected.Header == nil {
+		r.expected.Header = http.Header{}
+	}
+	r.expected.Header.Add(key, value)
+	r.matchers = append(r.matchers, MatchHeaders(key))
+	return r
+}
+
+// MatchBody matches request with body, body other than []byte and string is encoded as json,
+// json bodies are compared semantically.
+func (r *Route) MatchBody(body interface{}) *Route {
+	data, err := encodeBody(body)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.expected.Body = NewBody(data)
+	r.matchers = append(r.matchers, MatchBody)
+	return r
+}
+
+// MatchFunc matches request by f.
+func (r *Route) MatchFunc(f func(req *http.Request, body []byte) bool) *Route {
+	r.matchers = append(r.matchers, func(req *http.Request, body []byte, recorded *Request) bool {
+		return f(req, body)
+	})
+	return r
+}
+
+// Reply replies with status and body, body other than []byte and string is encoded as json.
+func (r *Route) Reply(status int, body interface{}) *Route {
+	r.response.StatusCode = status
+	data, err := encodeBody(body)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.response.Body = NewBody(data)
+	switch body.(type) {
+	case nil, []byte, string:
+	default:
+		r.ReplyHeader("Content-Type", "application/json")
+	}
+	return r
+}
+
+// ReplyHeader sets header of response.
+func (r *Route) ReplyHeader(key, value string) *Route {
+	if r.response.Header == nil {
+		r.response.Header = http.Header{}
+	}
+	r.response.Header.Set(key, value)
+	return r
+}
+
+// ReplyError fails request with err, such as network error.
+func (r *Route) ReplyError(err error) *Route {
+	r.err = err
+	return r
+}
+
+// ReplyFunc replies with response built by f.
+func (r *Route) ReplyFunc(f ResponderFunc) *Route {
+	r.responder = f
+	return r
+}
+
+// Times limits how many times the route is matched, zero means no limit.
+func (r *Route) Times(n int) *Route {
+	r.times = n
+	return r
+}
+
+func (r *Route) match(req *http.Request, body []byte) bool {
+	if r.times > 0 && r.calls >= r.times {
+		return false
+	}
+	if r.method != "" && r.method != req.Method {
+		return false
+	}
+	if r.path != "" && r.path != req.URL.Path {
+		return false
+	}
+	for _, m := range r.matchers {
+		if !m(req, body, &r.expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stub is a programmable transport for unit tests, plugged in by httpcli.WithTransportWrapper.
+// Request is replied by the first matched route in order of registration, request not matched fails.
+type Stub struct {
+	lock     sync.Mutex
+	routes   []*Route
+	requests []*Request
+}
+
+// NewStub creates Stub without routes.
+func NewStub() *Stub {
+	return &Stub{}
+}
+
+// On registers route of method and path, empty method or path matches all.
+// Route replies 200 without body if not set.
+func (s *Stub) On(method, path string) *Route {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := &Route{method: method, path: path, response: Response{StatusCode: http.StatusOK}}
+	s.routes = append(s.routes, r)
+	return r
+}
+
+// Wrapper returns httpcli.TransportWrapper, requests are never sent to next transport.
+func (s *Stub) Wrapper() httpcli.TransportWrapper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return s
+	}
+}
+
+// Requests returns received requests, for assertions.
+func (s *Stub) Requests() []*Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// RoundTrip replies request with matched route.
+func (s *Stub) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	s.requests = append(s.requests, &Request{Method: req.Method, URL: req.URL.String(), Header: req.Header.Clone(), Body: NewBody(body)})
+	var route *Route
+	for _, r := range s.routes {
+		if r.match(req, body) {
+			r.calls++
+			route = r
+			break
+		}
+	}
+	s.lock.Unlock()
+
+	switch {
+	case route == nil:
+		return nil, errors.WrapF(code.ErrHTTPError, "no stub matches %s %s", req.Method, req.URL.String())
+	case route.err != nil:
+		return nil, route.err
+	case route.responder != nil:
+		return route.responder(req, body)
+	default:
+		return newResponse(req, &route.response)
+	}
+}
+
+func encodeBody(body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	default:
+		return json.Marshal(b)
+	}
+}
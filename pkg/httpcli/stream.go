@@ -0,0 +1,113 @@
+package httpcli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// bodyReader counts bytes read from body and reports progress.
+type bodyReader struct {
+	r        io.Reader
+	total    int64
+	read     int64
+	eof      bool
+	progress ProgressFunc
+}
+
+func newBodyReader(r io.Reader, total int64, progress ProgressFunc) *bodyReader {
+	return &bodyReader{r: r, total: total, progress: progress}
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if n > 0 {
+		b.read += int64(n)
+		if b.progress != nil {
+			b.progress(b.read, b.total)
+		}
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// Close closes underlying reader if it is a closer, as http.NewRequest does.
+func (b *bodyReader) Close() error {
+	if c, ok := b.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// complete reports whether body has been read to the end.
+func (b *bodyReader) complete() bool {
+	return b.eof || (b.total >= 0 && b.read >= b.total)
+}
+
+// responseStream is the streamed response body, request context is canceled when it is closed.
+type responseStream struct {
+	*bodyReader
+	ctx    context.Context
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func newResponseStream(ctx context.Context, body io.ReadCloser, total int64, progress ProgressFunc, cancel context.CancelFunc) *responseStream {
+	return &responseStream{
+		bodyReader: newBodyReader(body, total, progress),
+		ctx:        ctx,
+		body:       body,
+		cancel:     cancel,
+	}
+}
+
+func (s *responseStream) Read(p []byte) (int, error) {
+	n, err := s.bodyReader.Read(p)
+	if err != nil && err != io.EOF {
+		log.F(s.ctx).Errorf("read response stream err after %d/%s bytes:%s", s.read, lengthString(s.total), err.Error())
+	}
+	return n, err
+}
+
+func (s *responseStream) Close() error {
+	var err error
+	s.once.Do(func() {
+		err = s.body.Close()
+		s.cancel()
+		if s.complete() {
+			log.F(s.ctx).Debugf("response stream finished, %d bytes read", s.read)
+		} else {
+			log.F(s.ctx).Warnf("response stream closed before end, %d/%s bytes read", s.read, lengthString(s.total))
+		}
+	})
+	return err
+}
+
+// readerLength returns length of common in-memory readers, -1 if unknown.
+func readerLength(r io.Reader) int64 {
+	switch v := r.(type) {
+	case *bytes.Buffer:
+		return int64(v.Len())
+	case *bytes.Reader:
+		return int64(v.Len())
+	case *strings.Reader:
+		return int64(v.Len())
+	default:
+		return -1
+	}
+}
+
+func lengthString(length int64) string {
+	if length < 0 {
+		return "unknown"
+	}
+	return strconv.FormatInt(length, 10)
+}
@@ -0,0 +1,65 @@
+package httpsvr
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/authz"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/genericmiddleware"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// AuthzPath is the path of authorization decision test api.
+const AuthzPath = "/debug/authz"
+
+// authzQuery is the query of AuthzPath.
+type authzQuery struct {
+	Subject  string   `form:"subject"`
+	Groups   []string `form:"group"`
+	Verb     string   `form:"verb"     binding:"required"`
+	Route    string   `form:"route"    binding:"required"`
+	Resource string   `form:"resource"`
+}
+
+// Authorizer returns authorizer created from or shared by Config.Authorization, nil if not configured.
+func (s *GenericHTTPServer) Authorizer() *authz.Authorizer {
+	return s.authorizer
+}
+
+// Authorize returns middleware authorizing request with Authorizer, it should be installed after
+// authentication of route group. It passes all requests if authorizer is not configured.
+func (s *GenericHTTPServer) Authorize(skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	if s.authorizer == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return genericmiddleware.Authorize(s.authorizer, skippers...)
+}
+
+// installAuthzAPI installs api to test decision of authorizer, such as
+// `/debug/authz?subject=alice&group=dev&verb=get&route=/v1/widgets/:id`.
+// Resource is derived from HTTP route if not specified. It exposes policy, so it's an admin api.
+func (s *GenericHTTPServer) installAuthzAPI() {
+	s.GET(AuthzPath, s.adminGuard, func(c *gin.Context) {
+		var q authzQuery
+		if err := ginx.ParseQuery(c, &q); err != nil {
+			ginx.WriteResponse(c, err, nil)
+			return
+		}
+		if q.Resource == "" && q.Verb != authz.VerbCall {
+			q.Resource = genericmiddleware.RouteResource(q.Route)
+		}
+
+		attrs := authz.Attributes{
+			Subject:  authz.Subject{Name: q.Subject, Groups: q.Groups},
+			Verb:     q.Verb,
+			Route:    q.Route,
+			Resource: q.Resource,
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"attributes": attrs,
+			"decision":   s.authorizer.Authorize(attrs),
+		})
+	})
+}
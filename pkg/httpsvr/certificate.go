@@ -0,0 +1,25 @@
+package httpsvr
+
+import (
+	cryptotls "crypto/tls"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/tls"
+)
+
+// ReloadCertificate replaces certificate of secure server, new TLS handshakes use it at once
+// while established connections keep the old one. Invalid certificate is rejected.
+func (s *GenericHTTPServer) ReloadCertificate(certKey tls.CertData) error {
+	cert, err := cryptotls.X509KeyPair([]byte(certKey.Cert), []byte(certKey.Key))
+	if err != nil {
+		return err
+	}
+	s.certificate.Store(&cert)
+	log.Info("secure server certificate loaded")
+	return nil
+}
+
+func (s *GenericHTTPServer) getCertificate(*cryptotls.ClientHelloInfo) (*cryptotls.Certificate, error) {
+	cert, _ := s.certificate.Load().(*cryptotls.Certificate)
+	return cert, nil
+}
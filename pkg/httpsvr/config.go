@@ -5,11 +5,17 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/wangweihong/eazycloud/pkg/authz"
 	"github.com/wangweihong/eazycloud/pkg/debug"
+	"github.com/wangweihong/eazycloud/pkg/faultinject"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
 
 	"github.com/wangweihong/eazycloud/pkg/tls"
 
 	"github.com/wangweihong/eazycloud/pkg/httpsvr/genericmiddleware"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
+	"github.com/wangweihong/eazycloud/pkg/util/netutil"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,12 +28,31 @@ type Config struct {
 	Jwt             *JwtInfo
 	Mode            string
 	Middlewares     []string
-	Healthz         bool
-	Version         bool
+	// MaxRequestBodySize is the default limit of request body, routes can override it by BodyLimit, zero means no limit.
+	MaxRequestBodySize int64
+	Compression        *CompressionInfo
+	Healthz            bool
+	Version            bool
+	// Routes installs route introspection api, which exposes all routes and middlewares.
+	Routes bool
+	// AdminToken allows remote client to call admin apis under `/debug/` with bearer token,
+	// admin apis are only accessible from loopback address without it.
+	AdminToken string
+
+	// TrustedProxies are CIDRs or IPs of proxies whose forwarding headers and PROXY protocol
+	// header are trusted, empty means client connects directly.
+	TrustedProxies []string
+	// ProxyProtocol enables PROXY protocol v1/v2 on listeners, only for connections from TrustedProxies.
+	ProxyProtocol bool
 
 	EnableMetrics bool
 	Profiling     *FeatureProfilingInfo
 	RuntimeDebug  *debug.RuntimeDebugInfo
+	Authorization *AuthorizationInfo
+	Maintenance   *MaintenanceInfo
+	// FaultInjection is only for resilience testing.
+	FaultInjection *FaultInjectionInfo
+	Mirror         *MirrorInfo
 }
 
 // SecureServingInfo holds configuration of the TLS server.
@@ -60,6 +85,59 @@ type JwtInfo struct {
 	MaxRefresh time.Duration
 }
 
+// CompressionInfo configures response compression.
+type CompressionInfo struct {
+	Enable bool
+	// Level is the compression level, -1 uses the default level of each encoding.
+	Level int
+	// MinSize is the minimum size of response body to compress.
+	MinSize int
+	// ContentTypes are media types allowed to compress, entries ending with `/` match all subtypes.
+	ContentTypes []string
+}
+
+// AuthorizationInfo configures RBAC authorization.
+type AuthorizationInfo struct {
+	// PolicyFile is the yaml policy file, reloaded when changed. Empty disables authorization.
+	PolicyFile string
+	// DryRun only logs denied requests without rejecting them.
+	DryRun bool
+	// Authorizer is shared with other servers such as gRPC server, PolicyFile and DryRun are
+	// ignored if set. Server doesn't stop watching policy of shared authorizer when closed.
+	Authorizer *authz.Authorizer
+}
+
+// FaultInjectionInfo configures fault injection.
+type FaultInjectionInfo struct {
+	// Enable installs fault injection middleware and admin api, always enabled if built with `faultinject` tag.
+	Enable bool
+}
+
+// MirrorInfo configures mirroring requests to shadow backend.
+type MirrorInfo struct {
+	// Address of shadow backend, such as `http://127.0.0.1:8081`. Empty disables mirroring.
+	Address string
+	// Percentage of requests to mirror, between 0 and 100.
+	Percentage float64
+	Timeout    time.Duration
+}
+
+// MaintenanceInfo configures maintenance mode and load shedding.
+type MaintenanceInfo struct {
+	// Enable installs maintenance middleware and admin api, mode can be changed at runtime only if enabled.
+	Enable bool
+	// Mode is the initial mode, `off`, `readonly` or `full`.
+	Mode       string
+	Reason     string
+	RetryAfter int
+	// MaxInFlight sheds request when in-flight requests reach it, zero means no limit.
+	MaxInFlight int64
+	// AllowRoutes are always served, pattern ending with `/*` matches all routes with the prefix.
+	AllowRoutes []string
+	// Signal enters maintenance mode on SIGTTOU and leaves on SIGTTIN.
+	Signal bool
+}
+
 type FeatureProfilingInfo struct {
 	// enable profiling
 	EnableProfiling bool
@@ -74,11 +152,21 @@ func NewConfig() *Config {
 	return &Config{
 		Version: true,
 		Healthz: true,
+		Routes:  false,
 		Mode:    gin.ReleaseMode,
 		Middlewares: []string{
 			genericmiddleware.MWNameRequestID,
 			genericmiddleware.MWNameContext,
 		},
+		MaxRequestBodySize: 0,
+		TrustedProxies:     nil,
+		ProxyProtocol:      false,
+		Compression: &CompressionInfo{
+			Enable:       false,
+			Level:        genericmiddleware.DefaultCompressionLevel,
+			MinSize:      genericmiddleware.DefaultCompressMinSize,
+			ContentTypes: genericmiddleware.DefaultCompressContentTypes,
+		},
 		EnableMetrics: true,
 		Jwt: &JwtInfo{
 			Realm:      "jwt",
@@ -94,6 +182,26 @@ func NewConfig() *Config {
 			Enable:    false,
 			OutputDir: "",
 		},
+		Authorization: &AuthorizationInfo{
+			PolicyFile: "",
+			DryRun:     false,
+		},
+		Maintenance: &MaintenanceInfo{
+			Enable:      false,
+			Mode:        string(maintenance.ModeOff),
+			RetryAfter:  maintenance.DefaultRetryAfter,
+			MaxInFlight: 0,
+			AllowRoutes: maintenance.DefaultAllowedRoutes,
+			Signal:      false,
+		},
+		FaultInjection: &FaultInjectionInfo{
+			Enable: false,
+		},
+		Mirror: &MirrorInfo{
+			Address:    "",
+			Percentage: 0,
+			Timeout:    genericmiddleware.DefaultMirrorTimeout,
+		},
 		InsecureServing: &InsecureServingInfo{},
 		SecureServing:   &SecureServingInfo{},
 	}
@@ -114,21 +222,96 @@ func (c *Config) Complete() CompletedConfig {
 func (c CompletedConfig) New() (*GenericHTTPServer, error) {
 	gin.SetMode(c.Mode)
 
+	trustedProxies, err := netutil.NewTrustedProxies(c.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	var authorizer *authz.Authorizer
+	ownAuthorizer := false
+	if c.Authorization != nil && c.Authorization.Authorizer != nil {
+		authorizer = c.Authorization.Authorizer
+	} else if c.Authorization != nil && c.Authorization.PolicyFile != "" {
+		ownAuthorizer = true
+		if authorizer, err = authz.NewFileAuthorizer(c.Authorization.PolicyFile); err != nil {
+			return nil, err
+		}
+		authorizer.SetDryRun(c.Authorization.DryRun)
+		if err := authorizer.Watch(); err != nil {
+			return nil, err
+		}
+	}
+
+	var maintenanceSwitch *maintenance.Switch
+	if c.Maintenance != nil && c.Maintenance.Enable {
+		maintenanceSwitch, err = maintenance.NewSwitch(maintenance.State{
+			Mode:        maintenance.Mode(c.Maintenance.Mode),
+			Reason:      c.Maintenance.Reason,
+			RetryAfter:  c.Maintenance.RetryAfter,
+			MaxInFlight: c.Maintenance.MaxInFlight,
+		}, append([]string{MaintenancePath}, c.Maintenance.AllowRoutes...)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var faultInjector *faultinject.Injector
+	if faultinject.BuildEnabled || (c.FaultInjection != nil && c.FaultInjection.Enable) {
+		faultInjector = faultinject.NewInjector()
+	}
+
+	var mirror *genericmiddleware.MirrorConfig
+	if c.Mirror != nil && c.Mirror.Address != "" {
+		// shadow backend is usually a test deployment with self-signed certificate
+		client, err := httpcli.NewClient(c.Mirror.Address, httpcli.WithInsecure())
+		if err != nil {
+			return nil, err
+		}
+		mirror = &genericmiddleware.MirrorConfig{
+			Client:     client,
+			Percentage: c.Mirror.Percentage,
+			Timeout:    c.Mirror.Timeout,
+		}
+	}
+
 	s := &GenericHTTPServer{
 		SecureServingInfo:   c.SecureServing,
 		InsecureServingInfo: c.InsecureServing,
 		healthz:             c.Healthz,
 		version:             c.Version,
+		routes:              c.Routes,
+		adminGuard:          genericmiddleware.AdminGuard(c.AdminToken, trustedProxies),
+		routeMetas:          newRouteMetaStore(),
+		apiVersions:         newAPIVersioning(),
+		deprecationUsage:    newDeprecationUsage(),
 		enableMetrics:       c.EnableMetrics,
 		profiling:           c.Profiling,
 		middlewares:         c.Middlewares,
+		maxRequestBodySize:  c.MaxRequestBodySize,
+		compression:         c.Compression,
+		trustedProxies:      trustedProxies,
+		proxyProtocol:       c.ProxyProtocol,
+		authorizer:          authorizer,
+		ownAuthorizer:       ownAuthorizer,
+		maintenance:         maintenanceSwitch,
+		faultInjector:       faultInjector,
+		mirror:              mirror,
 		Engine:              gin.New(),
 		runtimeDebug:        c.RuntimeDebug,
+		streamTracker:       ginx.NewStreamTracker(),
 	}
 
 	// 初始化http server配置
 	// 1. 安装通用的中间件
 	// 2. 安装通用的路由, 如版本,健康,pprof等
+	if maintenanceSwitch != nil && c.Maintenance.Signal {
+		s.stopMaintenanceSignal = maintenanceSwitch.HandleSignals(maintenance.ModeReadOnly)
+	}
+
+	// gin.Context.ClientIP trusts all proxies by default
+	if err := s.Engine.SetTrustedProxies(c.TrustedProxies); err != nil {
+		return nil, err
+	}
 	initGenericHTTPServer(s)
 
 	return s, nil
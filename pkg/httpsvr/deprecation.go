@@ -0,0 +1,132 @@
+package httpsvr
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/genericmiddleware"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+const (
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+	HeaderLink        = "Link"
+)
+
+// Deprecation describes how a deprecated route is going to be removed.
+type Deprecation struct {
+	// Sunset is the time after which route will be removed.
+	Sunset *time.Time
+	// Link refer to the document of migration, such as the new api.
+	Link string
+	// RejectAfterSunset reject request with ErrAPISunset after sunset time.
+	RejectAfterSunset bool
+}
+
+// maxDeprecationClients limits clients counted per deprecated route,
+// calls of clients beyond it are counted as otherDeprecationClients.
+const (
+	maxDeprecationClients   = 1000
+	otherDeprecationClients = "other"
+)
+
+// deprecationUsage counts calls of deprecated routes per client.
+type deprecationUsage struct {
+	lock   sync.Mutex
+	counts map[string]map[string]int64
+}
+
+func newDeprecationUsage() *deprecationUsage {
+	return &deprecationUsage{counts: make(map[string]map[string]int64)}
+}
+
+func (d *deprecationUsage) inc(route, client string) int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	clients, ok := d.counts[route]
+	if !ok {
+		clients = make(map[string]int64)
+		d.counts[route] = clients
+	}
+	if _, exist := clients[client]; !exist && len(clients) >= maxDeprecationClients {
+		client = otherDeprecationClients
+	}
+	clients[client]++
+	return clients[client]
+}
+
+func (d *deprecationUsage) snapshot() map[string]map[string]int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := make(map[string]map[string]int64, len(d.counts))
+	for route, clients := range d.counts {
+		out[route] = make(map[string]int64, len(clients))
+		for client, count := range clients {
+			out[route][client] = count
+		}
+	}
+	return out
+}
+
+// Deprecate marks route `method path` as deprecated.
+// path must be the full path which route registered with, such as `/v1/users/:id`.
+// Deprecation headers are emitted by DeprecationMiddleware, which is installed globally.
+func (s *GenericHTTPServer) Deprecate(method, path string, d Deprecation) {
+	s.routeMetas.update(method, path, func(meta *RouteMeta) {
+		meta.Deprecated = true
+		meta.Sunset = d.Sunset
+		meta.Link = d.Link
+		meta.RejectAfterSunset = d.RejectAfterSunset
+	})
+}
+
+// DeprecationUsage returns call counts of deprecated routes, keyed by `METHOD path` and client.
+// At most 1000 clients are counted per route, calls of other clients are counted as `other`.
+func (s *GenericHTTPServer) DeprecationUsage() map[string]map[string]int64 {
+	return s.deprecationUsage.snapshot()
+}
+
+// DeprecationMiddleware emits `Deprecation`,`Sunset`,`Link` headers for deprecated routes
+// and rejects request after sunset if required.
+func (s *GenericHTTPServer) DeprecationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		meta, ok := s.routeMetas.get(c.Request.Method, c.FullPath())
+		if !ok || !meta.Deprecated {
+			c.Next()
+			return
+		}
+
+		c.Header(HeaderDeprecation, "true")
+		if meta.Sunset != nil {
+			c.Header(HeaderSunset, meta.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if meta.Link != "" {
+			c.Header(HeaderLink, fmt.Sprintf("<%s>; rel=\"deprecation\"", meta.Link))
+		}
+
+		route := routeKey(c.Request.Method, c.FullPath())
+		client := genericmiddleware.ClientIP(c)
+		count := s.deprecationUsage.inc(route, client)
+		log.F(c).Warn("deprecated api called",
+			log.String("route", route),
+			log.String("client", client),
+			log.Int64("count", count))
+
+		if meta.RejectAfterSunset && meta.Sunset != nil && time.Now().After(*meta.Sunset) {
+			ginx.WriteResponse(c, errors.WrapF(code.ErrAPISunset, "%s has been sunset at %v", route, meta.Sunset), nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package httpsvr
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/faultinject"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// FaultInjectionPath is the path of fault injection admin api.
+const FaultInjectionPath = "/debug/faults"
+
+// FaultInjector returns fault injector, nil if not enabled.
+// It can be passed to grpc server to share fault rules.
+func (s *GenericHTTPServer) FaultInjector() *faultinject.Injector {
+	return s.faultInjector
+}
+
+// installFaultInjectionAPI installs admin api to get, replace and clear fault rules.
+// PUT replaces all rules, such as `[{"name":"slow","routes":["/v1/*"],"delay":"1s","percentage":10}]`.
+func (s *GenericHTTPServer) installFaultInjectionAPI() {
+	get := func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.faultInjector.Rules())
+	}
+
+	s.GET(FaultInjectionPath, s.adminGuard, get)
+	s.PUT(FaultInjectionPath, s.adminGuard, func(c *gin.Context) {
+		var rules []faultinject.Rule
+		if err := ginx.ParseJSON(c, &rules); err != nil {
+			ginx.WriteResponse(c, err, nil)
+			return
+		}
+		if err := s.faultInjector.SetRules(rules); err != nil {
+			ginx.WriteResponse(c, errors.WrapError(code.ErrValidation, err), nil)
+			return
+		}
+		log.F(c).Warnf("fault rules replaced, %d rules", len(rules))
+		get(c)
+	})
+	s.DELETE(FaultInjectionPath, s.adminGuard, func(c *gin.Context) {
+		_ = s.faultInjector.SetRules(nil)
+		log.F(c).Info("fault rules cleared")
+		get(c)
+	})
+}
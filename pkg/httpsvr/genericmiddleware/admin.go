@@ -0,0 +1,57 @@
+package genericmiddleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/util/netutil"
+)
+
+// AdminGuard protects admin apis such as `/debug/routes`, `/debug/maintenance`.
+// Request from loopback address is allowed, request from others must carry `Authorization: Bearer <token>`.
+// If token is empty, admin apis are only accessible from loopback address.
+// Request forwarded by a proxy on the same host is from loopback only if the proxy is trusted and
+// the client it forwards for is loopback too, otherwise every remote client would look like loopback.
+func AdminGuard(token string, trusted *netutil.TrustedProxies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if fromLoopback(c.Request, trusted) {
+			c.Next()
+			return
+		}
+
+		auth := c.GetHeader("Authorization")
+		if token != "" && strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1 {
+			c.Next()
+			return
+		}
+
+		log.F(c).Warn("admin api access denied", log.String("client", ClientIP(c)), log.String("path", c.Request.URL.Path))
+		ginx.WriteResponse(c, errors.Wrap(code.ErrPermissionDenied, "admin api is only accessible from loopback or with admin token"), nil)
+		c.Abort()
+	}
+}
+
+func fromLoopback(r *http.Request, trusted *netutil.TrustedProxies) bool {
+	remote := netutil.ParseIP(r.RemoteAddr)
+	if remote == nil || !remote.IsLoopback() {
+		return false
+	}
+	if r.Header.Get(netutil.HeaderForwarded) == "" && r.Header.Get(netutil.HeaderXForwardedFor) == "" &&
+		r.Header.Get(netutil.HeaderXRealIP) == "" {
+		return true
+	}
+	if !trusted.Contains(remote) {
+		return false
+	}
+	ip := net.ParseIP(trusted.ClientIP(r))
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,82 @@
+package genericmiddleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/authz"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// Authorize rejects request not allowed by authorizer with ErrPermissionDenied.
+// It should be installed after authentication, see AuthzAttributes for how request is described.
+// In dry-run mode, denied request is only logged.
+func Authorize(a *authz.Authorizer, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) {
+			c.Next()
+			return
+		}
+
+		attrs := AuthzAttributes(c)
+		decision := a.Authorize(attrs)
+		if !decision.Allowed {
+			log.F(c).Warn("authorization denied",
+				log.String("subject", attrs.Subject.Name),
+				log.String("reason", decision.Reason),
+				log.Bool("dryRun", decision.DryRun))
+
+			if !decision.DryRun {
+				ginx.WriteResponse(c, errors.Wrap(code.ErrPermissionDenied, decision.Reason), nil)
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// AuthzAttributes describes request for authorization.
+// Subject is read from authz.KeySubject of gin.Context, then request context, then username set by
+// authentication. Verb is lowercase HTTP method, route is route template, and resource is the last
+// static segment of route template, such as `widgets` of `/v1/widgets/:id`.
+func AuthzAttributes(c *gin.Context) authz.Attributes {
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	return authz.Attributes{
+		Subject:  authzSubject(c),
+		Verb:     strings.ToLower(c.Request.Method),
+		Route:    route,
+		Resource: RouteResource(c.FullPath()),
+	}
+}
+
+func authzSubject(c *gin.Context) authz.Subject {
+	if v, ok := c.Get(authz.KeySubject); ok {
+		if s, ok := v.(authz.Subject); ok {
+			return s
+		}
+	}
+	if s, ok := authz.SubjectFromContext(c.Request.Context()); ok {
+		return s
+	}
+	return authz.Subject{Name: c.GetString(string(log.KeyUsername))}
+}
+
+// RouteResource returns the last static segment of route template as resource name.
+func RouteResource(route string) string {
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if s := segments[i]; s != "" && !strings.HasPrefix(s, ":") && !strings.HasPrefix(s, "*") {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package genericmiddleware
+
+import (
+	"io"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// DefaultMaxRequestBodySize is the default limit of request body.
+const DefaultMaxRequestBodySize int64 = 4 << 20 // 4 MB
+
+// limitedBody returns ErrRequestEntityTooLarge once more than limit bytes read,
+// or on first read if Content-Length exceeds limit.
+type limitedBody struct {
+	io.ReadCloser
+	limit         int64
+	contentLength int64
+	read          int64
+	err           error
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.read == 0 && l.contentLength > l.limit {
+		l.err = errors.WrapF(code.ErrRequestEntityTooLarge,
+			"request body size %d exceeds %d bytes", l.contentLength, l.limit)
+		return 0, l.err
+	}
+	// read one more byte to know whether body exceeds limit
+	if remaining := l.limit - l.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		n -= int(l.read - l.limit)
+		l.read = l.limit
+		l.err = errors.WrapF(code.ErrRequestEntityTooLarge, "request body exceeds %d bytes", l.limit)
+		return n, l.err
+	}
+	return n, err
+}
+
+// DefaultBodyLimit sets the default limit of request body, which is overridden by BodyLimit of route.
+// Since route is unknown when it runs, request is not rejected directly, reading body fails with
+// ErrRequestEntityTooLarge if Content-Length or body read exceeds the limit.
+func DefaultBodyLimit(limit int64, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) || c.Request.Body == nil || limit <= 0 {
+			c.Next()
+			return
+		}
+
+		c.Request.Body = &limitedBody{ReadCloser: c.Request.Body, limit: limit, contentLength: c.Request.ContentLength}
+		c.Next()
+	}
+}
+
+// BodyLimit rejects request whose body is larger than limit with ErrRequestEntityTooLarge.
+// Request with Content-Length is rejected directly, otherwise reading body fails once limit exceeded.
+// It can be used per route to override DefaultBodyLimit, such as a larger one for upload.
+func BodyLimit(limit int64, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) || c.Request.Body == nil || limit <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			ginx.WriteResponse(c, errors.WrapF(code.ErrRequestEntityTooLarge,
+				"request body size %d exceeds %d bytes", c.Request.ContentLength, limit), nil)
+			c.Abort()
+			return
+		}
+
+		lb, ok := c.Request.Body.(*limitedBody)
+		if gb, isGzip := c.Request.Body.(*gzipBody); isGzip {
+			lb, ok = gb.lb, true
+		}
+		if ok && lb.read == 0 {
+			// route limit overrides the default one
+			lb.limit = limit
+		} else {
+			c.Request.Body = &limitedBody{ReadCloser: c.Request.Body, limit: limit}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package genericmiddleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+	"github.com/wangweihong/eazycloud/pkg/util/netutil"
+)
+
+// RealIP resolves the real client ip with forwarding headers sent by trusted proxies, see
+// netutil.TrustedProxies.ClientIP. The ip is stored in gin.Context and log fields of context,
+// get it with ClientIP.
+func RealIP(trusted *netutil.TrustedProxies, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) {
+			c.Next()
+			return
+		}
+
+		ip := trusted.ClientIP(c.Request)
+		c.Set(string(log.KeyClientIP), ip)
+
+		// copy fields to avoid modifying map shared with others
+		fields := map[string]interface{}{string(log.KeyClientIP): ip}
+		if v, ok := c.Get(log.FieldKeyCtx{}.String()); ok {
+			if m, ok := v.(map[string]interface{}); ok {
+				for k, v := range m {
+					if _, exist := fields[k]; !exist {
+						fields[k] = v
+					}
+				}
+			}
+		}
+		c.Set(log.FieldKeyCtx{}.String(), fields)
+		c.Request = c.Request.WithContext(log.WithFieldPair(c.Request.Context(), string(log.KeyClientIP), ip))
+
+		c.Next()
+	}
+}
+
+// ClientIP returns client ip resolved by RealIP, or gin.Context.ClientIP if RealIP is not installed.
+func ClientIP(c *gin.Context) string {
+	if ip := c.GetString(string(log.KeyClientIP)); ip != "" {
+		return ip
+	}
+	return c.ClientIP()
+}
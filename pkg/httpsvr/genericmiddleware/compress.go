@@ -0,0 +1,253 @@
+package genericmiddleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingBrotli  = "br"
+
+	// DefaultCompressionLevel uses the default level of each encoding.
+	DefaultCompressionLevel = -1
+	DefaultCompressMinSize  = 1024
+)
+
+// DefaultCompressContentTypes are media types compressed by default, entries ending with `/` match
+// all subtypes.
+var DefaultCompressContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-yaml",
+	"image/svg+xml",
+}
+
+// CompressConfig configures Compress.
+type CompressConfig struct {
+	// Level is the compression level, 1(best speed)-9(best compression) for gzip and deflate,
+	// 0-11 for brotli. DefaultCompressionLevel uses the default level of each encoding.
+	Level int
+	// MinSize is the minimum size of response body to compress, smaller one is sent as is.
+	MinSize int
+	// ContentTypes are media types allowed to compress.
+	ContentTypes []string
+}
+
+// DefaultCompressConfig returns the default compress config.
+func DefaultCompressConfig() CompressConfig {
+	return CompressConfig{
+		Level:        DefaultCompressionLevel,
+		MinSize:      DefaultCompressMinSize,
+		ContentTypes: DefaultCompressContentTypes,
+	}
+}
+
+// encodingPreference is used when client accepts encodings with the same quality.
+var encodingPreference = []string{EncodingBrotli, EncodingGzip, EncodingDeflate}
+
+// Compress compresses response body with brotli, gzip or deflate according to Accept-Encoding.
+// Response is buffered until MinSize reached, and compressed only if its content type is allowed
+// and handler doesn't set Content-Encoding. Strong etag is weakened since body is changed.
+func Compress(conf CompressConfig, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, conf: &conf, encoding: encoding}
+		c.Writer = w
+		defer func() {
+			w.close()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// negotiateEncoding returns the supported encoding with the highest quality in Accept-Encoding.
+func negotiateEncoding(accept string) string {
+	if accept == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := mime.ParseMediaType("x/" + strings.TrimSpace(part))
+		name = strings.TrimPrefix(name, "x/")
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range encodingPreference {
+		q, ok := qualities[enc]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+type compressWriter struct {
+	gin.ResponseWriter
+	conf     *CompressConfig
+	encoding string
+
+	buf     []byte
+	decided bool
+	// encoder is nil if response is not compressed
+	encoder io.WriteCloser
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.conf.MinSize {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush compresses streaming response regardless of MinSize.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) close() {
+	if !w.decided {
+		if len(w.buf) == 0 {
+			return
+		}
+		w.decided = true
+		// smaller than MinSize
+		if _, err := w.ResponseWriter.Write(w.buf); err != nil {
+			log.Debugf("write response fail:%v", err)
+		}
+		return
+	}
+	if w.encoder != nil {
+		if err := w.encoder.Close(); err != nil {
+			log.Debugf("close %s encoder fail:%v", w.encoding, err)
+		}
+	}
+}
+
+// decide whether to compress, then writes buffered data.
+func (w *compressWriter) decide() error {
+	w.decided = true
+
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	status := w.Status()
+	if header.Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified && status >= http.StatusOK &&
+		w.allowed(header.Get("Content-Type")) {
+		w.encoder = newEncoder(w.ResponseWriter, w.encoding, w.conf.Level)
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+	}
+
+	data := w.buf
+	w.buf = nil
+	if len(data) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(data)
+	} else {
+		_, err = w.ResponseWriter.Write(data)
+	}
+	return err
+}
+
+func (w *compressWriter) allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range w.conf.ContentTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func newEncoder(w io.Writer, encoding string, level int) io.WriteCloser {
+	switch encoding {
+	case EncodingBrotli:
+		if level < brotli.BestSpeed || level > brotli.BestCompression {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(w, level)
+	case EncodingDeflate:
+		fw, err := flate.NewWriter(w, level)
+		if err != nil {
+			fw, _ = flate.NewWriter(w, flate.DefaultCompression)
+		}
+		return fw
+	default:
+		gw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			gw, _ = gzip.NewWriterLevel(w, gzip.DefaultCompression)
+		}
+		return gw
+	}
+}
@@ -11,56 +11,144 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
 	"github.com/wangweihong/eazycloud/pkg/json"
 	"github.com/wangweihong/eazycloud/pkg/log"
 )
 
 const (
-	DisableCopy                = false
-	RequestBodyKey             = "req_body"  // post请求将请求数据写到gin.Context中
-	ResponseBodyKey            = "resp_body" // 当回应结束后插入回应数据到gin.Context中
+	DisableCopy     = false
+	RequestBodyKey  = "req_body"  // post请求将请求数据写到gin.Context中
+	ResponseBodyKey = "resp_body" // 当回应结束后插入回应数据到gin.Context中
+	// 拷贝请求数据的上限, 非正数时使用DefaultMaxRequestBodySize
 	HTTPMaxContentLength int64 = 0
 )
 
 // Copy body to context bytes array.
+// Body larger than HTTPMaxContentLength is rejected with ErrRequestEntityTooLarge.
 func CopyBodyMiddleware(skippers ...skipper.SkipperFunc) gin.HandlerFunc {
-	var maxMemory int64 = 4 << 20 // 4 MB
-	//if v := HTTPMaxContentLength; v > 0 {
-	//	maxMemory = v
-	//}
+	return CopyBodyMiddlewareWithLimit(HTTPMaxContentLength, skippers...)
+}
+
+// CopyBodyMiddlewareWithLimit copies body to context bytes array, body larger than limit
+// (DefaultMaxRequestBodySize if not positive) is rejected with ErrRequestEntityTooLarge.
+// If body is limited by DefaultBodyLimit, larger body is passed through without copied instead,
+// so that BodyLimit of route can still override the limit.
+func CopyBodyMiddlewareWithLimit(limit int64, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	maxMemory := DefaultMaxRequestBodySize
+	if limit > 0 {
+		maxMemory = limit
+	}
 
 	return func(c *gin.Context) {
-		if skipper.Skip(c.Request.URL.Path, skippers...) || c.Request.Body == nil {
+		if skipper.Skip(c.Request.URL.Path, skippers...) || c.Request.Body == nil || DisableCopy {
 			c.Next()
 			return
 		}
 
-		if !DisableCopy {
-			var requestBody []byte
-			isGzip := false
-			safe := &io.LimitedReader{R: c.Request.Body, N: maxMemory}
+		// 默认限制可能被路由覆盖, 直接读取原始数据, 由limitedBody在处理请求时限制
+		lb, limited := c.Request.Body.(*limitedBody)
+		if limited && c.Request.ContentLength > maxMemory {
+			c.Next()
+			return
+		}
+		body := c.Request.Body
+		if limited {
+			body = lb.ReadCloser
+		}
 
-			if c.GetHeader("Content-Encoding") == "gzip" {
-				reader, err := gzip.NewReader(safe)
-				if err == nil {
-					isGzip = true
-					requestBody, _ = ioutil.ReadAll(reader)
+		// read one more byte to know whether body exceeds limit
+		raw, err := ioutil.ReadAll(io.LimitReader(body, maxMemory+1))
+		if err != nil {
+			abortWithError(c, errors.WrapError(code.ErrBind, err))
+			return
+		}
+		isGzip := c.GetHeader("Content-Encoding") == "gzip"
+		exceeded := int64(len(raw)) > maxMemory
+		requestBody := raw
+		if !exceeded && isGzip {
+			if reader, gzErr := gzip.NewReader(bytes.NewReader(raw)); gzErr == nil {
+				// limit decompressed size too
+				requestBody, err = ioutil.ReadAll(io.LimitReader(reader, maxMemory+1))
+				if err != nil {
+					abortWithError(c, errors.WrapError(code.ErrBind, err))
+					return
 				}
+				exceeded = int64(len(requestBody)) > maxMemory
+			} else {
+				isGzip = false
 			}
+		}
 
-			if !isGzip {
-				requestBody, _ = ioutil.ReadAll(safe)
+		if exceeded {
+			if !limited {
+				abortWithError(c, errors.WrapF(code.ErrRequestEntityTooLarge, "request body exceeds %d bytes", maxMemory))
+				return
 			}
-
-			c.Request.Body.Close()
-			bf := bytes.NewBuffer(requestBody)
-			c.Request.Body = http.MaxBytesReader(c.Writer, ioutil.NopCloser(bf), maxMemory)
-			c.Set(RequestBodyKey, requestBody)
+			// 放回已读数据, 不拷贝
+			lb.ReadCloser = &readCloser{Reader: io.MultiReader(bytes.NewReader(raw), body), Closer: body}
+			if isGzip {
+				c.Request.Body = &gzipBody{lb: lb}
+			}
+			c.Next()
+			return
 		}
+
+		body.Close()
+		bf := bytes.NewBuffer(requestBody)
+		c.Request.Body = http.MaxBytesReader(c.Writer, ioutil.NopCloser(bf), maxMemory)
+		c.Set(RequestBodyKey, requestBody)
 		c.Next()
 	}
 }
 
+func abortWithError(c *gin.Context, err error) {
+	ginx.WriteResponse(c, err, nil)
+	c.Abort()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// gzipBody decompresses body limited by DefaultBodyLimit, decompressed size is limited too.
+type gzipBody struct {
+	lb     *limitedBody
+	reader *gzip.Reader
+	read   int64
+	err    error
+}
+
+func (g *gzipBody) Read(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.reader == nil {
+		reader, err := gzip.NewReader(g.lb)
+		if err != nil {
+			g.err = err
+			return 0, err
+		}
+		g.reader = reader
+	}
+	n, err := g.reader.Read(p)
+	g.read += int64(n)
+	if g.read > g.lb.limit {
+		n -= int(g.read - g.lb.limit)
+		g.read = g.lb.limit
+		g.err = errors.WrapF(code.ErrRequestEntityTooLarge, "decompressed request body exceeds %d bytes", g.lb.limit)
+		return n, g.err
+	}
+	return n, err
+}
+
+func (g *gzipBody) Close() error {
+	return g.lb.Close()
+}
+
 func SetResponseBody(c *gin.Context, data interface{}) {
 	if !DisableCopy {
 		b, err := json.Marshal(data)
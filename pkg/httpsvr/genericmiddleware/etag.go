@@ -0,0 +1,85 @@
+package genericmiddleware
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// etagWriter buffers response body to compute etag. It passes through once flushed, such as streaming.
+type etagWriter struct {
+	gin.ResponseWriter
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (w *etagWriter) Write(data []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *etagWriter) WriteString(s string) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.buf.WriteString(s)
+}
+
+func (w *etagWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// ETag computes etag from body of successful GET/HEAD response if handler doesn't set one,
+// and replies 304 without body if client's cached copy is fresh.
+// Weak etag should be used if response body may be encoded differently, such as compressed.
+func ETag(weak bool, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) ||
+			(c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+
+		w := &etagWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.passthrough {
+			return
+		}
+		if w.Status() != http.StatusOK {
+			_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+			return
+		}
+
+		header := w.Header()
+		etag := header.Get(ginx.HeaderETag)
+		if etag == "" {
+			etag = ginx.BodyETag(w.buf.Bytes(), weak)
+			header.Set(ginx.HeaderETag, etag)
+		}
+		lastModified, _ := http.ParseTime(header.Get(ginx.HeaderLastModified))
+		if ginx.NotModified(c.Request, etag, lastModified) {
+			log.F(c).Debugf("etag %s not modified", etag)
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			w.ResponseWriter.WriteHeaderNow()
+			return
+		}
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+}
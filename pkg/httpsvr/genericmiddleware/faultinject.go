@@ -0,0 +1,67 @@
+package genericmiddleware
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/faultinject"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// FaultInject injects latency, abort, connection reset or panic into requests matching rules of injector.
+// Request is matched with its path, method, headers and request id, so it should be installed after RequestID.
+func FaultInject(injector *faultinject.Injector, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) {
+			c.Next()
+			return
+		}
+
+		fault := injector.Match(faultinject.Request{
+			Route:     c.Request.URL.Path,
+			Method:    c.Request.Method,
+			RequestID: c.GetString(XRequestIDKey),
+			Header:    c.GetHeader,
+		})
+		if fault == nil {
+			c.Next()
+			return
+		}
+
+		log.F(c).Warnf("inject fault of rule `%s` into %s %s", fault.Rule, c.Request.Method, c.Request.URL.Path)
+		if err := fault.Sleep(c.Request.Context()); err != nil {
+			c.Abort()
+			return
+		}
+
+		switch {
+		case fault.Panic:
+			panic(fmt.Sprintf("fault injected by rule `%s`", fault.Rule))
+		case fault.Reset:
+			resetConn(c)
+			c.Abort()
+		case fault.AbortCode != 0:
+			ginx.WriteResponse(c, fault.Error(), nil)
+			c.Abort()
+		default:
+			c.Next()
+		}
+	}
+}
+
+// resetConn closes connection of request, tcp connection is closed with RST.
+func resetConn(c *gin.Context) {
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		log.F(c).Warnf("hijack connection fail:%v", err)
+		return
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = conn.Close()
+}
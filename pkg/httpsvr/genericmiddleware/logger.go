@@ -44,7 +44,7 @@ func LoggerMiddleware(skippers ...skipper.SkipperFunc) gin.HandlerFunc {
 		fields["req_time_begin"] = start.Format("2006-01-02 15:04:05.000000")
 		fields["host_pid"] = os.Getpid()
 		fields["host_ip"] = netutil.GetIPAddrNotError(true)
-		fields["req_client_ip"] = c.ClientIP()
+		fields["req_client_ip"] = ClientIP(c)
 		fields["req_method"] = method
 		fields["req_url"] = c.Request.URL.String()
 		fields["req_proto"] = c.Request.Proto
@@ -87,7 +87,7 @@ func LoggerMiddleware(skippers ...skipper.SkipperFunc) gin.HandlerFunc {
 		simpleCallInfo := fmt.Sprintf(
 			"%3d - [%s] %v %s  %s",
 			c.Writer.Status(),
-			c.ClientIP(),
+			ClientIP(c),
 			Latency,
 			c.Request.Method,
 			p,
@@ -198,7 +198,7 @@ func LoggerWithConfig(conf gin.LoggerConfig) gin.HandlerFunc {
 			param.TimeStamp = time.Now()
 			param.Latency = param.TimeStamp.Sub(start)
 
-			param.ClientIP = c.ClientIP()
+			param.ClientIP = ClientIP(c)
 			param.Method = c.Request.Method
 			param.StatusCode = c.Writer.Status()
 			param.ErrorMessage = c.Errors.ByType(gin.ErrorTypePrivate).String()
@@ -0,0 +1,38 @@
+package genericmiddleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// Maintenance rejects requests according to maintenance switch with `Retry-After` header.
+// GET, HEAD and OPTIONS requests are treated as read, which are served in read-only mode.
+// Routes allowed by switch are matched with request path.
+func Maintenance(sw *maintenance.Switch, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) {
+			c.Next()
+			return
+		}
+
+		method := c.Request.Method
+		read := method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+		done, err := sw.Admit(c.Request.URL.Path, read)
+		if err != nil {
+			if retryAfter := sw.State().RetryAfter; retryAfter > 0 {
+				c.Header("Retry-After", strconv.Itoa(retryAfter))
+			}
+			ginx.WriteResponse(c, err, nil)
+			c.Abort()
+			return
+		}
+		defer done()
+		c.Next()
+	}
+}
@@ -19,6 +19,8 @@ const (
 	MWNameCORS      = "cors"
 	MWNameLogger    = "logger"
 	MWNameDump      = "dump"
+	MWNameETag      = "etag"
+	MWNameCopyBody  = "copybody"
 )
 
 // Middlewares store registered middlewares.
@@ -76,6 +78,8 @@ func defaultMiddlewareList() map[string]gin.HandlerFunc {
 		MWNameCORS:      Cors(),
 		MWNameLogger:    Logger(),
 		MWNameDump:      gindump.Dump(),
+		MWNameETag:      ETag(false),
+		MWNameCopyBody:  CopyBodyMiddleware(),
 	}
 }
 
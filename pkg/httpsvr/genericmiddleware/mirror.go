@@ -0,0 +1,324 @@
+package genericmiddleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// XMirrorKey is set in mirrored requests, so shadow backend can tell them from live requests.
+const XMirrorKey = "X-Mirror"
+
+const (
+	// DefaultMirrorTimeout is the default timeout of mirrored request.
+	DefaultMirrorTimeout = 10 * time.Second
+	// DefaultMirrorConcurrency is the default limit of in-flight mirrored requests.
+	DefaultMirrorConcurrency = 100
+
+	// primary response body larger than it is not used to compare codes.
+	mirrorMaxCaptureSize = 64 * 1024
+)
+
+// Mirror results recorded in metrics and MirrorResult.
+const (
+	MirrorResultMatch          = "match"
+	MirrorResultStatusMismatch = "status_mismatch"
+	MirrorResultCodeMismatch   = "code_mismatch"
+	MirrorResultError          = "error"
+	MirrorResultDropped        = "dropped"
+)
+
+// hop-by-hop headers are not mirrored, neither are body headers since body copied is decompressed
+// and re-encoded by client.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length", "Content-Encoding",
+}
+
+var (
+	mirrorRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "http_mirror",
+		Name:      "requests_total",
+		Help:      "Number of mirrored requests by route and compare result.",
+	}, []string{"route", "result"})
+	mirrorLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: "http_mirror",
+		Name:      "latency_seconds",
+		Help:      "Latency of mirrored requests on primary and shadow backend.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "backend"})
+	mirrorMetricsOnce sync.Once
+)
+
+// MirrorConfig configures traffic mirroring.
+type MirrorConfig struct {
+	// Client sends mirrored requests to shadow backend.
+	Client *httpcli.Client
+	// Percentage of requests to mirror, between 0 and 100.
+	Percentage float64
+	// Timeout of mirrored request, defaults to DefaultMirrorTimeout.
+	Timeout time.Duration
+	// MaxConcurrency limits in-flight mirrored requests, requests exceeding it are dropped.
+	// Defaults to DefaultMirrorConcurrency.
+	MaxConcurrency int
+	// OnResult is called with the compare result of each mirrored request if set.
+	OnResult func(MirrorResult)
+}
+
+// MirrorResult is the compare result of primary and shadow response.
+type MirrorResult struct {
+	Method string
+	Path   string
+	// Route is the route template, used as metrics label.
+	Route          string
+	Result         string
+	PrimaryStatus  int
+	ShadowStatus   int
+	PrimaryCode    int64
+	ShadowCode     int64
+	PrimaryLatency time.Duration
+	ShadowLatency  time.Duration
+	Err            error
+}
+
+// Mirror replays a percentage of requests to shadow backend asynchronously after they are served,
+// and compares http status and `status.code` of responses. Shadow response never affects client.
+// Request body is taken from CopyBodyMiddleware, which must be installed before, requests with body
+// not copied are not mirrored.
+// Compare results are recorded in `http_mirror_*` metrics and logged if mismatched.
+func Mirror(conf MirrorConfig, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	mirrorMetricsOnce.Do(func() {
+		registerCollector(mirrorRequests)
+		registerCollector(mirrorLatency)
+	})
+
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultMirrorTimeout
+	}
+	if conf.MaxConcurrency <= 0 {
+		conf.MaxConcurrency = DefaultMirrorConcurrency
+	}
+	sem := make(chan struct{}, conf.MaxConcurrency)
+
+	var randLock sync.Mutex
+	random := rand.New(rand.NewSource(time.Now().UnixNano())) // nolint: gosec
+	sample := func() bool {
+		if conf.Percentage >= 100 {
+			return true
+		}
+		randLock.Lock()
+		defer randLock.Unlock()
+		return random.Float64()*100 < conf.Percentage
+	}
+
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) || conf.Client == nil || conf.Percentage <= 0 ||
+			c.GetHeader(XMirrorKey) != "" || !sample() {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if v, ok := c.Get(RequestBodyKey); ok {
+			body, _ = v.([]byte)
+		} else if c.Request.ContentLength != 0 && c.Request.Body != nil && c.Request.Body != http.NoBody {
+			log.F(c).Debugf("request body of %s is not copied, skip mirroring", c.Request.URL.Path)
+			c.Next()
+			return
+		}
+
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		start := time.Now()
+		c.Next()
+
+		result := MirrorResult{
+			Method:         c.Request.Method,
+			Path:           c.Request.URL.Path,
+			Route:          c.FullPath(),
+			PrimaryStatus:  w.Status(),
+			PrimaryCode:    responseCode(w.body.Bytes(), w.overflow),
+			PrimaryLatency: time.Since(start),
+		}
+		rawURL := c.Request.URL.RequestURI()
+		header := mirrorHeader(c.Request.Header)
+		// gin.Context is reused after request finished
+		ctx := c.Copy()
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			result.Result = MirrorResultDropped
+			recordMirror(ctx, &conf, &result)
+			return
+		}
+
+		go func() {
+			defer func() { <-sem }()
+			defer func() {
+				if r := recover(); r != nil {
+					log.F(ctx).Errorf("mirror request panic:%v", r)
+				}
+			}()
+
+			mirrorRequest(ctx, &conf, rawURL, header, body, &result)
+			recordMirror(ctx, &conf, &result)
+		}()
+	}
+}
+
+func mirrorRequest(ctx context.Context, conf *MirrorConfig, rawURL string, header http.Header, body []byte, result *MirrorResult) {
+	var arg interface{}
+	if len(body) > 0 {
+		arg = json.RawMessage(body)
+	}
+
+	start := time.Now()
+	// mirrored request must not be canceled with live request
+	resp, err := conf.Client.Invoke(context.Background(), result.Method, rawURL, arg, nil,
+		httpcli.TimeoutCallOption(conf.Timeout),
+		httpcli.ResponseNotParseCallOption(),
+		httpcli.HttpRequestProcessOption(func(req *http.Request) (*http.Request, error) {
+			req.Header = header
+			return req, nil
+		}),
+	)
+	result.ShadowLatency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		result.Result = MirrorResultError
+		return
+	}
+
+	result.ShadowStatus = resp.StatusCode
+	result.ShadowCode = responseCode(resp.Body, len(resp.Body) > mirrorMaxCaptureSize)
+	switch {
+	case result.PrimaryStatus != result.ShadowStatus:
+		result.Result = MirrorResultStatusMismatch
+	case result.PrimaryCode != result.ShadowCode:
+		result.Result = MirrorResultCodeMismatch
+	default:
+		result.Result = MirrorResultMatch
+	}
+}
+
+func recordMirror(ctx context.Context, conf *MirrorConfig, result *MirrorResult) {
+	route := result.Route
+	if route == "" {
+		route = "unknown"
+	}
+	mirrorRequests.WithLabelValues(route, result.Result).Inc()
+	if result.Result != MirrorResultDropped {
+		mirrorLatency.WithLabelValues(route, "primary").Observe(result.PrimaryLatency.Seconds())
+	}
+	if result.Result != MirrorResultDropped && result.Result != MirrorResultError {
+		mirrorLatency.WithLabelValues(route, "shadow").Observe(result.ShadowLatency.Seconds())
+	}
+
+	switch result.Result {
+	case MirrorResultMatch:
+		log.F(ctx).Debug("mirror request matched",
+			log.String("method", result.Method),
+			log.String("path", result.Path),
+			log.Duration("primaryLatency", result.PrimaryLatency),
+			log.Duration("shadowLatency", result.ShadowLatency))
+	case MirrorResultDropped:
+		log.F(ctx).Warn("mirror request dropped, too many in-flight mirrored requests",
+			log.String("method", result.Method),
+			log.String("path", result.Path))
+	case MirrorResultError:
+		log.F(ctx).Warn("mirror request fail",
+			log.String("method", result.Method),
+			log.String("path", result.Path),
+			log.Err(result.Err))
+	default:
+		log.F(ctx).Warn("mirror response mismatched",
+			log.String("result", result.Result),
+			log.String("method", result.Method),
+			log.String("path", result.Path),
+			log.Int("primaryStatus", result.PrimaryStatus),
+			log.Int("shadowStatus", result.ShadowStatus),
+			log.Int64("primaryCode", result.PrimaryCode),
+			log.Int64("shadowCode", result.ShadowCode),
+			log.Duration("primaryLatency", result.PrimaryLatency),
+			log.Duration("shadowLatency", result.ShadowLatency))
+	}
+
+	if conf.OnResult != nil {
+		conf.OnResult(*result)
+	}
+}
+
+func registerCollector(c prometheus.Collector) {
+	if err := prometheus.Register(c); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			log.Warnf("register mirror metrics fail:%v", err)
+		}
+	}
+}
+
+// mirrorHeader copies request header without hop-by-hop and body headers.
+func mirrorHeader(h http.Header) http.Header {
+	header := h.Clone()
+	for _, k := range hopHeaders {
+		header.Del(k)
+	}
+	header.Set(XMirrorKey, "true")
+	return header
+}
+
+// responseCode returns `status.code` of ginx.Response body, 0 if body is not ginx.Response.
+func responseCode(body []byte, truncated bool) int64 {
+	if truncated || len(body) == 0 {
+		return 0
+	}
+	var resp struct {
+		Status *struct {
+			Code int64 `json:"code"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Status == nil {
+		return 0
+	}
+	return resp.Status.Code
+}
+
+// captureWriter captures response body up to mirrorMaxCaptureSize.
+type captureWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *captureWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > mirrorMaxCaptureSize {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
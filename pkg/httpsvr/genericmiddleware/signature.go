@@ -0,0 +1,52 @@
+package genericmiddleware
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/signature"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+)
+
+// VerifySignature rejects request whose signature is invalid, expired or replayed with ErrSignatureInvalid.
+// Body is read to verify its digest and restored for handlers, so it should be installed after body limit.
+func VerifySignature(v *signature.RequestVerifier, skippers ...skipper.SkipperFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skipper.Skip(c.Request.URL.Path, skippers...) {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil && c.GetHeader(signature.HeaderContentSHA256) != signature.UnsignedPayload {
+			var err error
+			body, err = ioutil.ReadAll(c.Request.Body)
+			c.Request.Body.Close()
+			if err != nil {
+				if !errors.IsCode(err, code.ErrRequestEntityTooLarge) {
+					err = errors.WrapError(code.ErrBind, err)
+				}
+				ginx.WriteResponse(c, err, nil)
+				c.Abort()
+				return
+			}
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		if err := v.Verify(c.Request, body); err != nil {
+			log.F(c).Warn("signature verification failed",
+				log.String("keyID", c.GetHeader(signature.HeaderKeyID)),
+				log.String("reason", err.Error()))
+			ginx.WriteResponse(c, err, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
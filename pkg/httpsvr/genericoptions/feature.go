@@ -3,6 +3,7 @@ package genericoptions
 import (
 	"fmt"
 
+	"github.com/wangweihong/eazycloud/pkg/authz"
 	"github.com/wangweihong/eazycloud/pkg/httpsvr"
 
 	"github.com/spf13/pflag"
@@ -16,6 +17,16 @@ type FeatureOptions struct {
 	ProfileAddress      string `json:"profile-address"      mapstructure:"profile-address"`      // prof地址,采取独立服务时需指定
 	// metrics
 	EnableMetrics bool `json:"enable-metrics"       mapstructure:"enable-metrics"` // 是否启动/metrics api
+	// compression
+	EnableCompression  bool     `json:"enable-compression"   mapstructure:"enable-compression"`   // 是否压缩响应
+	CompressionLevel   int      `json:"compression-level"    mapstructure:"compression-level"`    // 压缩级别
+	CompressionMinSize int      `json:"compression-min-size" mapstructure:"compression-min-size"` // 超过该大小才压缩
+	CompressionTypes   []string `json:"compression-types"    mapstructure:"compression-types"`    // 允许压缩的媒体类型
+	// authorization
+	AuthzPolicyFile string `json:"authz-policy-file" mapstructure:"authz-policy-file"` // RBAC策略文件
+	AuthzDryRun     bool   `json:"authz-dry-run"     mapstructure:"authz-dry-run"`     // 仅审计不拒绝
+	// fault injection
+	EnableFaultInjection bool `json:"enable-fault-injection" mapstructure:"enable-fault-injection"` // 是否启用故障注入
 }
 
 // NewFeatureOptions creates a FeatureOptions object with default parameters.
@@ -23,10 +34,17 @@ func NewFeatureOptions() *FeatureOptions {
 	defaults := httpsvr.NewConfig()
 
 	return &FeatureOptions{
-		EnableMetrics:       defaults.EnableMetrics,
-		StandAloneProfiling: defaults.Profiling.StandAloneProfiling,
-		EnableProfiling:     defaults.Profiling.EnableProfiling,
-		ProfileAddress:      defaults.Profiling.ProfileAddress,
+		EnableMetrics:        defaults.EnableMetrics,
+		StandAloneProfiling:  defaults.Profiling.StandAloneProfiling,
+		EnableProfiling:      defaults.Profiling.EnableProfiling,
+		ProfileAddress:       defaults.Profiling.ProfileAddress,
+		EnableCompression:    defaults.Compression.Enable,
+		CompressionLevel:     defaults.Compression.Level,
+		CompressionMinSize:   defaults.Compression.MinSize,
+		CompressionTypes:     defaults.Compression.ContentTypes,
+		AuthzPolicyFile:      defaults.Authorization.PolicyFile,
+		AuthzDryRun:          defaults.Authorization.DryRun,
+		EnableFaultInjection: defaults.FaultInjection.Enable,
 	}
 }
 
@@ -38,6 +56,19 @@ func (o *FeatureOptions) ApplyTo(c *httpsvr.Config) error {
 		ProfileAddress:      o.ProfileAddress,
 	}
 	c.EnableMetrics = o.EnableMetrics
+	c.Compression = &httpsvr.CompressionInfo{
+		Enable:       o.EnableCompression,
+		Level:        o.CompressionLevel,
+		MinSize:      o.CompressionMinSize,
+		ContentTypes: o.CompressionTypes,
+	}
+	c.Authorization = &httpsvr.AuthorizationInfo{
+		PolicyFile: o.AuthzPolicyFile,
+		DryRun:     o.AuthzDryRun,
+	}
+	c.FaultInjection = &httpsvr.FaultInjectionInfo{
+		Enable: o.EnableFaultInjection,
+	}
 
 	return nil
 }
@@ -53,6 +84,19 @@ func (o *FeatureOptions) Validate() []error {
 				"feature.enable-profiling and feature.standalone-profiling enable"))
 		}
 	}
+	if o.EnableCompression {
+		if o.CompressionLevel < -1 || o.CompressionLevel > 11 {
+			errs = append(errs, fmt.Errorf("feature.compression-level must be between -1 and 11"))
+		}
+		if o.CompressionMinSize < 0 {
+			errs = append(errs, fmt.Errorf("feature.compression-min-size must not be negative"))
+		}
+	}
+	if o.AuthzPolicyFile != "" {
+		if _, err := authz.LoadPolicyFile(o.AuthzPolicyFile); err != nil {
+			errs = append(errs, fmt.Errorf("feature.authz-policy-file: %w", err))
+		}
+	}
 	return errs
 }
 
@@ -73,4 +117,21 @@ func (o *FeatureOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.BoolVar(&o.EnableMetrics, "feature.enable-metrics", o.EnableMetrics,
 		"Enables metrics on the apiserver at /metrics")
+
+	fs.BoolVar(&o.EnableCompression, "feature.enable-compression", o.EnableCompression,
+		"Compress response with brotli, gzip or deflate according to Accept-Encoding.")
+	fs.IntVar(&o.CompressionLevel, "feature.compression-level", o.CompressionLevel,
+		"Compression level, 1-9 for gzip and deflate, 0-11 for brotli, -1 uses the default level.")
+	fs.IntVar(&o.CompressionMinSize, "feature.compression-min-size", o.CompressionMinSize,
+		"Minimum size in bytes of response body to compress.")
+	fs.StringSliceVar(&o.CompressionTypes, "feature.compression-types", o.CompressionTypes,
+		"Media types allowed to compress, entries ending with `/` match all subtypes.")
+
+	fs.StringVar(&o.AuthzPolicyFile, "feature.authz-policy-file", o.AuthzPolicyFile,
+		"RBAC policy file in yaml, reloaded when changed. Enables authorization and /debug/authz api if set.")
+	fs.BoolVar(&o.AuthzDryRun, "feature.authz-dry-run", o.AuthzDryRun,
+		"Only log requests denied by authorization without rejecting them.")
+
+	fs.BoolVar(&o.EnableFaultInjection, "feature.enable-fault-injection", o.EnableFaultInjection,
+		"Enable fault injection middleware and /debug/faults api for resilience testing, never enable it in production.")
 }
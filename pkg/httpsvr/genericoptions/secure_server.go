@@ -160,3 +160,23 @@ func (s *SecureServingOptions) Complete() error {
 
 	return nil
 }
+
+// LoadServerCert loads certificate from cert files or cert directory again, so that reloaded
+// options pick up changed files. Certificate data is returned as is if no file is configured.
+func (s *SecureServingOptions) LoadServerCert() (tls.CertData, error) {
+	cert := s.ServerCert
+	keyCert := cert.CertKey
+	// cert directory takes precedence as Complete does
+	if len(cert.CertDirectory) > 0 {
+		keyCert.CertFile = path.Join(cert.CertDirectory, cert.PairName+".crt")
+		keyCert.KeyFile = path.Join(cert.CertDirectory, cert.PairName+".key")
+	}
+	if len(keyCert.CertFile) == 0 {
+		return cert.CertData, nil
+	}
+
+	var data tls.CertData
+	var err error
+	data.Cert, data.Key, err = tls.LoadDataFromFile(keyCert.CertFile, keyCert.KeyFile)
+	return data, err
+}
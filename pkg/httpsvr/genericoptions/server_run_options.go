@@ -2,13 +2,17 @@ package genericoptions
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/wangweihong/eazycloud/pkg/httpsvr"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
 
 	"github.com/wangweihong/eazycloud/pkg/debug"
 
 	"github.com/wangweihong/eazycloud/pkg/util/maputil"
+	"github.com/wangweihong/eazycloud/pkg/util/netutil"
 
 	"github.com/wangweihong/eazycloud/pkg/util/sliceutil"
 
@@ -23,8 +27,25 @@ type ServerRunOptions struct {
 	Mode        string   `json:"mode"        mapstructure:"mode"`        // GIN服务模式
 	Version     bool     `json:"version"     mapstructure:"version"`     // 开启版本模式
 	Healthz     bool     `json:"healthz"     mapstructure:"healthz"`     // 开启healthz服务
+	Routes      bool     `json:"routes"      mapstructure:"routes"`      // 开启路由查看服务
+	AdminToken  string   `json:"admin-token" mapstructure:"admin-token"` // 远程访问管理接口的令牌
 	Middlewares []string `json:"middlewares" mapstructure:"middlewares"` // 安装的通用中间件
 
+	MaxRequestBodySize int64    `json:"max-request-body-size" mapstructure:"max-request-body-size"` // 请求体大小上限
+	TrustedProxies     []string `json:"trusted-proxies"       mapstructure:"trusted-proxies"`       // 受信任的代理CIDR
+	ProxyProtocol      bool     `json:"proxy-protocol"        mapstructure:"proxy-protocol"`        // 开启PROXY协议
+
+	Maintenance            bool     `json:"maintenance"              mapstructure:"maintenance"`              // 开启维护模式开关
+	MaintenanceMode        string   `json:"maintenance-mode"         mapstructure:"maintenance-mode"`         // 初始维护模式
+	MaintenanceRetryAfter  int      `json:"maintenance-retry-after"  mapstructure:"maintenance-retry-after"`  // 客户端重试等待秒数
+	MaintenanceAllowRoutes []string `json:"maintenance-allow-routes" mapstructure:"maintenance-allow-routes"` // 维护期间放行的路由
+	MaintenanceSignal      bool     `json:"maintenance-signal"       mapstructure:"maintenance-signal"`       // 通过信号切换维护模式
+	MaxInFlight            int64    `json:"max-in-flight"            mapstructure:"max-in-flight"`            // 并发请求上限
+
+	MirrorAddress    string        `json:"mirror-address"    mapstructure:"mirror-address"`    // 流量镜像的影子服务地址
+	MirrorPercentage float64       `json:"mirror-percentage" mapstructure:"mirror-percentage"` // 镜像请求的百分比
+	MirrorTimeout    time.Duration `json:"mirror-timeout"    mapstructure:"mirror-timeout"`    // 镜像请求超时
+
 	RuntimeDebug    bool   `json:"runtime-debug"     mapstructure:"runtime-debug"`     // 开启运行时调试
 	RuntimeDebugDir string `json:"runtime-debug-dir" mapstructure:"runtime-debug-dir"` // 调试输出目录
 }
@@ -34,12 +55,26 @@ func NewServerRunOptions() *ServerRunOptions {
 	defaults := httpsvr.NewConfig()
 
 	return &ServerRunOptions{
-		Mode:            defaults.Mode,
-		Healthz:         defaults.Healthz,
-		Middlewares:     defaults.Middlewares,
-		Version:         defaults.Version,
-		RuntimeDebug:    defaults.RuntimeDebug.Enable,
-		RuntimeDebugDir: defaults.RuntimeDebug.OutputDir,
+		Mode:                   defaults.Mode,
+		Healthz:                defaults.Healthz,
+		Routes:                 defaults.Routes,
+		AdminToken:             defaults.AdminToken,
+		Middlewares:            defaults.Middlewares,
+		MaxRequestBodySize:     defaults.MaxRequestBodySize,
+		TrustedProxies:         defaults.TrustedProxies,
+		ProxyProtocol:          defaults.ProxyProtocol,
+		Version:                defaults.Version,
+		RuntimeDebug:           defaults.RuntimeDebug.Enable,
+		RuntimeDebugDir:        defaults.RuntimeDebug.OutputDir,
+		Maintenance:            defaults.Maintenance.Enable,
+		MaintenanceMode:        defaults.Maintenance.Mode,
+		MaintenanceRetryAfter:  defaults.Maintenance.RetryAfter,
+		MaintenanceAllowRoutes: defaults.Maintenance.AllowRoutes,
+		MaintenanceSignal:      defaults.Maintenance.Signal,
+		MaxInFlight:            defaults.Maintenance.MaxInFlight,
+		MirrorAddress:          defaults.Mirror.Address,
+		MirrorPercentage:       defaults.Mirror.Percentage,
+		MirrorTimeout:          defaults.Mirror.Timeout,
 	}
 }
 
@@ -47,7 +82,25 @@ func NewServerRunOptions() *ServerRunOptions {
 func (s *ServerRunOptions) ApplyTo(c *httpsvr.Config) error {
 	c.Mode = s.Mode
 	c.Healthz = s.Healthz
+	c.Routes = s.Routes
+	c.AdminToken = s.AdminToken
 	c.Middlewares = s.Middlewares
+	c.MaxRequestBodySize = s.MaxRequestBodySize
+	c.TrustedProxies = s.TrustedProxies
+	c.ProxyProtocol = s.ProxyProtocol
+	c.Maintenance = &httpsvr.MaintenanceInfo{
+		Enable:      s.Maintenance,
+		Mode:        s.MaintenanceMode,
+		RetryAfter:  s.MaintenanceRetryAfter,
+		MaxInFlight: s.MaxInFlight,
+		AllowRoutes: s.MaintenanceAllowRoutes,
+		Signal:      s.MaintenanceSignal,
+	}
+	c.Mirror = &httpsvr.MirrorInfo{
+		Address:    s.MirrorAddress,
+		Percentage: s.MirrorPercentage,
+		Timeout:    s.MirrorTimeout,
+	}
 	c.Version = s.Version
 	c.RuntimeDebug = &debug.RuntimeDebugInfo{
 		Enable:    s.RuntimeDebug,
@@ -57,6 +110,15 @@ func (s *ServerRunOptions) ApplyTo(c *httpsvr.Config) error {
 	return nil
 }
 
+// MaintenanceState returns maintenance state configured, it's applied to running switch when config reloaded.
+func (s *ServerRunOptions) MaintenanceState() maintenance.State {
+	return maintenance.State{
+		Mode:        maintenance.Mode(s.MaintenanceMode),
+		RetryAfter:  s.MaintenanceRetryAfter,
+		MaxInFlight: s.MaxInFlight,
+	}
+}
+
 // Validate checks validation of ServerRunOptions.
 func (s *ServerRunOptions) Validate() []error {
 	errors := []error{}
@@ -76,6 +138,33 @@ func (s *ServerRunOptions) Validate() []error {
 		errors = append(errors, fmt.Errorf("middleware `%v` is not supported", invalidMiddleware.List()))
 	}
 
+	if s.MaxRequestBodySize < 0 {
+		errors = append(errors, fmt.Errorf("server.max-request-body-size must not be negative"))
+	}
+
+	if _, err := netutil.NewTrustedProxies(s.TrustedProxies); err != nil {
+		errors = append(errors, fmt.Errorf("server.trusted-proxies: %w", err))
+	}
+
+	if s.ProxyProtocol && len(s.TrustedProxies) == 0 {
+		errors = append(errors, fmt.Errorf("set server.trusted-proxies when enable server.proxy-protocol"))
+	}
+
+	if s.Maintenance {
+		if err := s.MaintenanceState().Validate(); err != nil {
+			errors = append(errors, fmt.Errorf("server.maintenance: %w", err))
+		}
+	}
+
+	if s.MirrorAddress != "" {
+		if u, err := url.Parse(s.MirrorAddress); err != nil || u.Scheme == "" || u.Host == "" {
+			errors = append(errors, fmt.Errorf("server.mirror-address must be an url such as `http://127.0.0.1:8081`"))
+		}
+		if s.MirrorPercentage <= 0 || s.MirrorPercentage > 100 {
+			errors = append(errors, fmt.Errorf("server.mirror-percentage must be in (0, 100]"))
+		}
+	}
+
 	if s.RuntimeDebug {
 		if s.RuntimeDebugDir == "" {
 			errors = append(errors, fmt.Errorf("set `RuntimeDebugDir` when enable runtime debug"))
@@ -98,10 +187,57 @@ func (s *ServerRunOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&s.Version, "server.version", s.Version, ""+
 		"Install /version router.")
 
+	fs.BoolVar(&s.Routes, "server.routes", s.Routes, ""+
+		"Install /debug/routes router and print route table when server start.")
+
+	fs.StringVar(&s.AdminToken, "server.admin-token", s.AdminToken, ""+
+		"Bearer token for remote clients to call admin routers under /debug/, such as /debug/routes. "+
+		"Without it, admin routers are only accessible from loopback address.")
+
 	fs.StringSliceVar(&s.Middlewares, "server.middlewares", s.Middlewares, ""+
 		"List of allowed middleware for server, comma separated. If this list is empty,no middlewares will be used."+
 		"Support middleware: "+strings.Join(genericmiddleware.MiddlewareNames, ","))
 
+	fs.Int64Var(&s.MaxRequestBodySize, "server.max-request-body-size", s.MaxRequestBodySize, ""+
+		"Maximum size in bytes of request body, larger request is rejected with 413. Zero means no limit.")
+
+	fs.StringSliceVar(&s.TrustedProxies, "server.trusted-proxies", s.TrustedProxies, ""+
+		"List of trusted proxy CIDRs or IPs, comma separated. Client ip is resolved from "+
+		"Forwarded, X-Forwarded-For and X-Real-IP headers only for requests from these proxies.")
+
+	fs.BoolVar(&s.ProxyProtocol, "server.proxy-protocol", s.ProxyProtocol, ""+
+		"Accept PROXY protocol v1/v2 header on listeners for connections from trusted proxies.")
+
+	fs.BoolVar(&s.Maintenance, "server.maintenance", s.Maintenance, ""+
+		"Enable maintenance switch and install "+httpsvr.MaintenancePath+" router to change mode at runtime.")
+
+	fs.StringVar(&s.MaintenanceMode, "server.maintenance-mode", s.MaintenanceMode, ""+
+		"Initial maintenance mode. Supported mode: "+strings.Join(maintenance.Modes, ",")+
+		". readonly rejects all requests except GET, HEAD and OPTIONS.")
+
+	fs.IntVar(&s.MaintenanceRetryAfter, "server.maintenance-retry-after", s.MaintenanceRetryAfter, ""+
+		"Seconds set into Retry-After header when request rejected in maintenance or overloaded.")
+
+	fs.StringSliceVar(&s.MaintenanceAllowRoutes, "server.maintenance-allow-routes", s.MaintenanceAllowRoutes, ""+
+		"Routes always served in maintenance, comma separated. Pattern ending with /* matches all routes with the prefix.")
+
+	fs.BoolVar(&s.MaintenanceSignal, "server.maintenance-signal", s.MaintenanceSignal, ""+
+		"Enter readonly maintenance mode on SIGTTOU and leave on SIGTTIN.")
+
+	fs.Int64Var(&s.MaxInFlight, "server.max-in-flight", s.MaxInFlight, ""+
+		"Maximum number of in-flight requests when maintenance switch enabled, more requests are rejected with 503. "+
+		"Zero means no limit.")
+
+	fs.StringVar(&s.MirrorAddress, "server.mirror-address", s.MirrorAddress, ""+
+		"Address of shadow backend such as http://127.0.0.1:8081, a percentage of requests are mirrored to it "+
+		"asynchronously and responses are compared. Empty disables mirroring.")
+
+	fs.Float64Var(&s.MirrorPercentage, "server.mirror-percentage", s.MirrorPercentage, ""+
+		"Percentage of requests to mirror, between 0 and 100.")
+
+	fs.DurationVar(&s.MirrorTimeout, "server.mirror-timeout", s.MirrorTimeout, ""+
+		"Timeout of mirrored requests.")
+
 	fs.BoolVar(&s.RuntimeDebug, "server.runtime-debug", s.RuntimeDebug, ""+
 		"Enable debugging during runtime.")
 
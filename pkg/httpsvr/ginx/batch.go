@@ -0,0 +1,69 @@
+package ginx
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/batch"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// BatchSummary summarizes results of batch operation.
+type BatchSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// BatchItem is the result of an item in batch operation.
+type BatchItem struct {
+	ID     string      `json:"id"`
+	Status *CallStatus `json:"status"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// BatchResult is the data of batch operation response.
+type BatchResult struct {
+	Summary BatchSummary `json:"summary"`
+	Items   []BatchItem  `json:"items"`
+}
+
+// NewBatchResult converts batch results into BatchResult.
+func NewBatchResult(results []batch.Result) *BatchResult {
+	br := &BatchResult{
+		Summary: BatchSummary{Total: len(results)},
+		Items:   make([]BatchItem, 0, len(results)),
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			br.Summary.Failed++
+		} else {
+			br.Summary.Succeeded++
+		}
+		br.Items = append(br.Items, BatchItem{
+			ID:     r.ID,
+			Status: FromError(r.Err),
+			Data:   r.Data,
+		})
+	}
+	return br
+}
+
+// WriteBatchResponse write batch results into http response body with code.ErrOperationBatchExecute,
+// caller should check status of each item to confirm batch results.
+func WriteBatchResponse(c *gin.Context, results []batch.Result) {
+	br := NewBatchResult(results)
+	if br.Summary.Failed > 0 {
+		log.F(c).Warnf("batch execute %d items, %d failed", br.Summary.Total, br.Summary.Failed)
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Status: FromError(errors.Wrap(code.ErrOperationBatchExecute,
+			fmt.Sprintf("total:%d, succeeded:%d, failed:%d", br.Summary.Total, br.Summary.Succeeded, br.Summary.Failed))),
+		Data: br,
+	})
+}
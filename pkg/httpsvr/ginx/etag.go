@@ -0,0 +1,139 @@
+package ginx
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+)
+
+const (
+	HeaderETag              = "ETag"
+	HeaderLastModified      = "Last-Modified"
+	HeaderIfMatch           = "If-Match"
+	HeaderIfNoneMatch       = "If-None-Match"
+	HeaderIfModifiedSince   = "If-Modified-Since"
+	HeaderIfUnmodifiedSince = "If-Unmodified-Since"
+)
+
+// BodyETag computes etag from response body.
+func BodyETag(body []byte, weak bool) string {
+	sum := sha1.Sum(body)
+	return formatETag(hex.EncodeToString(sum[:]), weak)
+}
+
+// VersionETag computes etag from resource version, which changes every time resource changed.
+func VersionETag(version string, weak bool) string {
+	return formatETag(version, weak)
+}
+
+// ParseETag returns the opaque value of etag and whether it is weak.
+func ParseETag(etag string) (string, bool) {
+	etag = strings.TrimSpace(etag)
+	weak := strings.HasPrefix(etag, "W/")
+	etag = strings.TrimPrefix(etag, "W/")
+	return strings.Trim(etag, `"`), weak
+}
+
+func formatETag(value string, weak bool) string {
+	if weak {
+		return `W/"` + value + `"`
+	}
+	return `"` + value + `"`
+}
+
+// etagMatch reports whether etag matches any in header list. Strong comparison
+// requires both etags to be strong, which is used by If-Match.
+func etagMatch(header, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	value, weak := ParseETag(etag)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		v, w := ParseETag(candidate)
+		if v != value {
+			continue
+		}
+		if !strong || (!weak && !w) {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModified reports whether client's cached copy identified by If-None-Match or If-Modified-Since is fresh.
+// If-Modified-Since is ignored if If-None-Match presents.
+func NotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get(HeaderIfNoneMatch); inm != "" {
+		return etagMatch(inm, etag, false)
+	}
+	if ims := r.Header.Get(HeaderIfModifiedSince); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		// http date has no sub-second precision
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// CheckIfMatch checks If-Match and If-Unmodified-Since against current etag and last modified time of resource,
+// ErrPreconditionFailed is returned if they don't match. Empty etag means resource doesn't exist.
+func CheckIfMatch(r *http.Request, etag string, lastModified time.Time) error {
+	if im := r.Header.Get(HeaderIfMatch); im != "" {
+		if !etagMatch(im, etag, true) {
+			return errors.WrapF(code.ErrPreconditionFailed, "etag %s doesn't match `%s`", etag, im)
+		}
+		return nil
+	}
+	if ius := r.Header.Get(HeaderIfUnmodifiedSince); ius != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ius)
+		if err == nil && lastModified.Truncate(time.Second).After(t) {
+			return errors.WrapF(code.ErrPreconditionFailed, "resource has been modified since %s", ius)
+		}
+	}
+	return nil
+}
+
+// CheckPreconditions evaluates conditional headers of request against current etag and last modified
+// time of resource, and sets ETag and Last-Modified headers of response.
+// For GET/HEAD, 304 is written if client's cached copy is fresh. For other methods, If-Match and
+// If-None-Match are enforced and ErrPreconditionFailed is written if they fail.
+// It returns true if response has been written, handler should return directly.
+func CheckPreconditions(c *gin.Context, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		c.Header(HeaderETag, etag)
+	}
+	if !lastModified.IsZero() {
+		c.Header(HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		if NotModified(c.Request, etag, lastModified) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+
+	err := CheckIfMatch(c.Request, etag, lastModified)
+	if err == nil {
+		if inm := c.GetHeader(HeaderIfNoneMatch); inm != "" && etagMatch(inm, etag, false) {
+			err = errors.WrapF(code.ErrPreconditionFailed, "etag %s matches `%s`", etag, inm)
+		}
+	}
+	if err != nil {
+		WriteResponse(c, err, nil)
+		c.Abort()
+		return true
+	}
+	return false
+}
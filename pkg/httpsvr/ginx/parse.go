@@ -14,7 +14,7 @@ func ParseRawData(c *gin.Context) ([]byte, error) {
 	raw, err := c.GetRawData()
 	if err != nil {
 		log.F(c).Errorf("get raw data:%v", err)
-		return nil, errors.WrapError(code.ErrBind, err)
+		return nil, bindError(err)
 	}
 
 	log.F(c).Debug("get raw data:", log.Every("req", string(raw)))
@@ -25,7 +25,7 @@ func ParseRawData(c *gin.Context) ([]byte, error) {
 func ParseJSON(c *gin.Context, obj interface{}) error {
 	if err := c.ShouldBindJSON(obj); err != nil {
 		log.F(c).Errorf("pares json data:%v", err)
-		return errors.WrapError(code.ErrBind, err)
+		return bindError(err)
 	}
 	log.F(c).Debug("parse json data:", log.Every("req", obj))
 	return nil
@@ -35,7 +35,7 @@ func ParseJSON(c *gin.Context, obj interface{}) error {
 func ParseQuery(c *gin.Context, obj interface{}) error {
 	if err := c.ShouldBindQuery(obj); err != nil {
 		log.F(c).Errorf("pares query data:%v", err)
-		return errors.WrapError(code.ErrBind, err)
+		return bindError(err)
 	}
 	log.F(c).Debug("parse query data:", log.Every("req", obj))
 
@@ -46,9 +46,17 @@ func ParseQuery(c *gin.Context, obj interface{}) error {
 func ParseForm(c *gin.Context, obj interface{}) error {
 	if err := c.ShouldBindWith(obj, binding.Form); err != nil {
 		log.F(c).Errorf("pares form data:%v", err)
-		return errors.WrapError(code.ErrBind, err)
+		return bindError(err)
 	}
 	log.F(c).Debug("parse form body:", log.Every("req", obj))
 
 	return nil
 }
+
+// bindError wraps err as ErrBind, unless body is too large.
+func bindError(err error) error {
+	if errors.IsCode(err, code.ErrRequestEntityTooLarge) {
+		return errors.UpdateStack(err)
+	}
+	return errors.WrapError(code.ErrBind, err)
+}
@@ -0,0 +1,282 @@
+package ginx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/json"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+const (
+	// HeaderLastEventID is the header sent by browser when reconnect event stream.
+	HeaderLastEventID = "Last-Event-ID"
+	// SSEEventError is the event name used when producer returns error.
+	SSEEventError = "error"
+
+	defaultSSEHeartbeat  = 15 * time.Second
+	defaultSSEBufferSize = 16
+)
+
+// SSEvent is a server-sent event.
+type SSEvent struct {
+	// ID is set as `Last-Event-ID` by client when reconnect.
+	ID string
+	// Event is the event name, empty means `message`.
+	Event string
+	// Data is written as is if it is string or []byte, otherwise encoded as json.
+	Data interface{}
+	// Retry tells client the reconnection time.
+	Retry time.Duration
+}
+
+// SSEOption configures StreamSSE.
+type SSEOption func(*sseOptions)
+
+type sseOptions struct {
+	heartbeat  time.Duration
+	bufferSize int
+	tracker    *StreamTracker
+}
+
+// WithSSEHeartbeat set interval of heartbeat comment which keeps connection alive through proxies.
+// Zero disables heartbeat.
+func WithSSEHeartbeat(interval time.Duration) SSEOption {
+	return func(o *sseOptions) {
+		o.heartbeat = interval
+	}
+}
+
+// WithSSEBufferSize set the number of events buffered before Send blocks.
+func WithSSEBufferSize(size int) SSEOption {
+	return func(o *sseOptions) {
+		if size >= 0 {
+			o.bufferSize = size
+		}
+	}
+}
+
+// WithSSETracker set the tracker stream registered to, tracker set by SetStreamTracker or DefaultStreamTracker is used by default.
+func WithSSETracker(tracker *StreamTracker) SSEOption {
+	return func(o *sseOptions) {
+		o.tracker = tracker
+	}
+}
+
+// SSEStream is used by producer to send events.
+type SSEStream struct {
+	ctx         context.Context
+	events      chan SSEvent
+	lastEventID string
+}
+
+// LastEventID returns the last event id client received, producer should resume from it.
+func (s *SSEStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Send queues an event. It blocks when buffer is full until client consumes it,
+// returns error if client disconnected or server is shutting down.
+func (s *SSEStream) Send(ev SSEvent) error {
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	default:
+	}
+
+	select {
+	case s.events <- ev:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// streamFormat describes how events are encoded into response.
+type streamFormat struct {
+	name        string
+	contentType string
+	write       func(w io.Writer, ev SSEvent) error
+	heartbeat   string
+}
+
+var (
+	sseFormat = streamFormat{
+		name:        "sse",
+		contentType: "text/event-stream",
+		write:       writeSSEvent,
+		heartbeat:   ": heartbeat\n\n",
+	}
+	jsonLinesFormat = streamFormat{
+		name:        "json",
+		contentType: "application/x-ndjson",
+		write:       writeJSONLine,
+		heartbeat:   "\n",
+	}
+)
+
+// StreamSSE writes events sent by producer into response as `text/event-stream`.
+// producer runs with a context which is canceled when client disconnected or server shutdown,
+// context carries log fields of request, such as request id.
+// Error returned by producer is sent to client as an `error` event.
+func StreamSSE(c *gin.Context, producer func(ctx context.Context, stream *SSEStream) error, opts ...SSEOption) {
+	serveStream(c, producer, sseFormat, opts...)
+}
+
+// StreamJSON is like StreamSSE, but writes data of each event as a line of json into chunked response,
+// ID and name of event are ignored. Error returned by producer is written as `{"status":{...}}`,
+// empty lines are heartbeats which should be skipped by client.
+func StreamJSON(c *gin.Context, producer func(ctx context.Context, stream *SSEStream) error, opts ...SSEOption) {
+	serveStream(c, producer, jsonLinesFormat, opts...)
+}
+
+func serveStream(
+	c *gin.Context,
+	producer func(ctx context.Context, stream *SSEStream) error,
+	format streamFormat,
+	opts ...SSEOption,
+) {
+	o := &sseOptions{
+		heartbeat:  defaultSSEHeartbeat,
+		bufferSize: defaultSSEBufferSize,
+		tracker:    streamTracker(c),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	draining, release, ok := o.tracker.track()
+	if !ok {
+		WriteResponse(c, errors.Wrap(code.ErrServiceOverloaded, "server is shutting down"), nil)
+		return
+	}
+	defer release()
+
+	ctx, cancel := streamContext(requestContext(c), draining)
+	defer cancel()
+
+	lastEventID := c.GetHeader(HeaderLastEventID)
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	stream := &SSEStream{
+		ctx:         ctx,
+		events:      make(chan SSEvent, o.bufferSize),
+		lastEventID: lastEventID,
+	}
+
+	c.Header("Content-Type", format.contentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭nginx缓存, 避免事件被延迟推送
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	log.F(ctx).Debugf("%s stream start, last event id:%v", format.name, lastEventID)
+
+	produceErr := make(chan error, 1)
+	go func() {
+		defer close(stream.events)
+		produceErr <- producer(ctx, stream)
+	}()
+
+	var heartbeat <-chan time.Time
+	if o.heartbeat > 0 {
+		ticker := time.NewTicker(o.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case ev, ok := <-stream.events:
+			if !ok {
+				if err := <-produceErr; err != nil && ctx.Err() == nil {
+					log.F(ctx).Warnf("%s producer fail:%v", format.name, err)
+					_ = format.write(c.Writer, SSEvent{Event: SSEEventError, Data: FromError(err)})
+					c.Writer.Flush()
+				}
+				log.F(ctx).Debugf("%s stream finish", format.name)
+				return
+			}
+			if err := format.write(c.Writer, ev); err != nil {
+				log.F(ctx).Warnf("write %s event fail:%v", format.name, err)
+				return
+			}
+			c.Writer.Flush()
+		case <-heartbeat:
+			if _, err := io.WriteString(c.Writer, format.heartbeat); err != nil {
+				log.F(ctx).Warnf("write %s heartbeat fail:%v", format.name, err)
+				return
+			}
+			c.Writer.Flush()
+		case <-ctx.Done():
+			// producer will notice ctx done and stop, drain events to let it exit.
+			go func() {
+				for range stream.events {
+				}
+			}()
+			log.F(ctx).Debugf("%s stream closed:%v", format.name, ctx.Err())
+			return
+		}
+	}
+}
+
+func writeSSEvent(w io.Writer, ev SSEvent) error {
+	var sb strings.Builder
+	if ev.ID != "" {
+		fmt.Fprintf(&sb, "id: %s\n", ev.ID)
+	}
+	if ev.Event != "" {
+		fmt.Fprintf(&sb, "event: %s\n", ev.Event)
+	}
+	if ev.Retry > 0 {
+		fmt.Fprintf(&sb, "retry: %s\n", strconv.FormatInt(ev.Retry.Milliseconds(), 10))
+	}
+
+	var data string
+	switch d := ev.Data.(type) {
+	case nil:
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&sb, "data: %s\n", line)
+	}
+	sb.WriteString("\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeJSONLine(w io.Writer, ev SSEvent) error {
+	data := ev.Data
+	if cs, ok := ev.Data.(*CallStatus); ok && ev.Event == SSEEventError {
+		data = Response{Status: cs}
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
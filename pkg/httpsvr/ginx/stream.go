@@ -0,0 +1,162 @@
+package ginx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/shutdown"
+)
+
+// DefaultDrainTimeout is the max time to wait streams finish when shutdown.
+const DefaultDrainTimeout = 10 * time.Second
+
+// DefaultStreamTracker tracks streams created by StreamSSE and UpgradeWebSocket
+// when no other tracker is specified or set in gin.Context.
+var DefaultStreamTracker = NewStreamTracker()
+
+const streamTrackerKey = "ginx_stream_tracker"
+
+var _ shutdown.ShutdownCallback = (*StreamTracker)(nil)
+
+// StreamTracker tracks long-lived streaming connections such as SSE and WebSocket.
+// http.Server.Shutdown never interrupts active handlers or hijacked connections, so
+// streams must be notified to finish before server shutdown.
+type StreamTracker struct {
+	lock sync.Mutex
+	// closed when draining starts
+	done chan struct{}
+	// closed when all streams finish after draining starts
+	idle     chan struct{}
+	active   int
+	draining bool
+}
+
+// NewStreamTracker creates a stream tracker.
+func NewStreamTracker() *StreamTracker {
+	return &StreamTracker{done: make(chan struct{})}
+}
+
+// track registers a stream, ok is false if tracker is draining. The returned channel is closed
+// when tracker starts draining, release must be called when stream finish.
+func (t *StreamTracker) track() (draining <-chan struct{}, release func(), ok bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.draining {
+		return nil, nil, false
+	}
+	t.active++
+
+	var once sync.Once
+	return t.done, func() {
+		once.Do(func() {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.active--
+			if t.draining && t.active == 0 {
+				t.finishDrain()
+			}
+		})
+	}, true
+}
+
+// finishDrain notifies Drain all streams finished, lock must be held.
+func (t *StreamTracker) finishDrain() {
+	close(t.idle)
+}
+
+// Reset makes a drained tracker accept new streams again.
+func (t *StreamTracker) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.draining {
+		return
+	}
+	t.draining = false
+	t.done = make(chan struct{})
+}
+
+// Active returns the number of active streams.
+func (t *StreamTracker) Active() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.active
+}
+
+// Drain notifies all streams to close and waits them finish until ctx done.
+// New streams are rejected since draining starts until Reset.
+func (t *StreamTracker) Drain(ctx context.Context) error {
+	t.lock.Lock()
+	if !t.draining {
+		t.draining = true
+		t.idle = make(chan struct{})
+		close(t.done)
+		if t.active == 0 {
+			t.finishDrain()
+		}
+	}
+	idle, active := t.idle, t.active
+	t.lock.Unlock()
+
+	log.Infof("draining %d streams", active)
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		log.Warnf("drain streams timeout, %d streams still active", t.Active())
+		return ctx.Err()
+	}
+}
+
+// OnShutdown implements shutdown.ShutdownCallback, so tracker can be added into graceful shutdown callbacks.
+func (t *StreamTracker) OnShutdown(string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDrainTimeout)
+	defer cancel()
+	return t.Drain(ctx)
+}
+
+// SetStreamTracker sets the tracker of streams created by c, overrides DefaultStreamTracker.
+func SetStreamTracker(c *gin.Context, tracker *StreamTracker) {
+	c.Set(streamTrackerKey, tracker)
+}
+
+// streamTracker returns tracker set by SetStreamTracker, or DefaultStreamTracker.
+func streamTracker(c *gin.Context) *StreamTracker {
+	if v, ok := c.Get(streamTrackerKey); ok {
+		if tracker, ok := v.(*StreamTracker); ok && tracker != nil {
+			return tracker
+		}
+	}
+	return DefaultStreamTracker
+}
+
+// streamContext returns a context canceled when parent done or tracker draining.
+func streamContext(parent context.Context, done <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// requestContext returns request context carrying log fields stored in gin.Context, such as request id.
+func requestContext(c *gin.Context) context.Context {
+	ctx := c.Request.Context()
+	if fields, ok := c.Get(log.FieldKeyCtx{}.String()); ok {
+		if fieldMap, ok := fields.(map[string]interface{}); ok {
+			ctx = log.WithFields(ctx, fieldMap)
+		}
+	}
+	return ctx
+}
@@ -0,0 +1,200 @@
+package ginx_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+)
+
+func waitFor(f func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if f() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestStreamSSE(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	Convey("SSE流", t, func() {
+		tracker := ginx.NewStreamTracker()
+		producerDone := make(chan error, 1)
+
+		engine := gin.New()
+		engine.GET("/events", func(c *gin.Context) {
+			ginx.StreamSSE(c, func(ctx context.Context, stream *ginx.SSEStream) error {
+				if err := stream.Send(ginx.SSEvent{ID: "1", Event: "hello", Data: map[string]string{"resume": stream.LastEventID()}}); err != nil {
+					return err
+				}
+				<-ctx.Done()
+				producerDone <- ctx.Err()
+				return nil
+			}, ginx.WithSSEHeartbeat(20*time.Millisecond), ginx.WithSSETracker(tracker))
+		})
+		srv := httptest.NewServer(engine)
+		defer srv.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events", nil)
+		req.Header.Set(ginx.HeaderLastEventID, "0")
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+
+		reader := bufio.NewReader(resp.Body)
+		var lines []string
+		for !strings.HasPrefix(strings.Join(lines, ""), "id: 1") || !strings.Contains(strings.Join(lines, ""), ": heartbeat") {
+			line, err := reader.ReadString('\n')
+			So(err, ShouldBeNil)
+			lines = append(lines, line)
+		}
+		So(strings.Join(lines, ""), ShouldContainSubstring, "event: hello\ndata: {\"resume\":\"0\"}\n")
+		So(tracker.Active(), ShouldEqual, 1)
+
+		Convey("客户端断开", func() {
+			resp.Body.Close()
+			select {
+			case err := <-producerDone:
+				So(err, ShouldEqual, context.Canceled)
+			case <-time.After(2 * time.Second):
+				So("producer not canceled", ShouldBeEmpty)
+			}
+			So(waitFor(func() bool { return tracker.Active() == 0 }), ShouldBeTrue)
+		})
+
+		Convey("关闭时通知流结束", func() {
+			defer resp.Body.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			So(tracker.Drain(ctx), ShouldBeNil)
+			So(tracker.Active(), ShouldEqual, 0)
+			So(<-producerDone, ShouldEqual, context.Canceled)
+		})
+	})
+}
+
+func TestStreamTracker_Drain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	Convey("等待流结束超时", t, func() {
+		tracker := ginx.NewStreamTracker()
+		release := make(chan struct{})
+
+		engine := gin.New()
+		engine.GET("/ws", func(c *gin.Context) {
+			_ = ginx.UpgradeWebSocket(c, func(ctx context.Context, conn *ginx.WebSocketConn) error {
+				// ignore draining until released
+				<-release
+				return nil
+			}, ginx.WithWebSocketTracker(tracker))
+		})
+		srv := httptest.NewServer(engine)
+		defer srv.Close()
+		wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(waitFor(func() bool { return tracker.Active() == 1 }), ShouldBeTrue)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		So(tracker.Drain(ctx), ShouldResemble, context.DeadlineExceeded)
+		So(tracker.Active(), ShouldEqual, 1)
+
+		// new streams are rejected during draining
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		So(err, ShouldNotBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+
+		// new streams are still rejected after all streams finish
+		close(release)
+		So(waitFor(func() bool { return tracker.Active() == 0 }), ShouldBeTrue)
+		_, resp, err = websocket.DefaultDialer.Dial(wsURL, nil)
+		So(err, ShouldNotBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+
+		// tracker accepts streams again after reset
+		tracker.Reset()
+		conn2, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		So(err, ShouldBeNil)
+		conn2.Close()
+	})
+}
+
+func TestUpgradeWebSocket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	Convey("WebSocket连接", t, func() {
+		tracker := ginx.NewStreamTracker()
+		result := make(chan error, 1)
+
+		engine := gin.New()
+		engine.GET("/echo", func(c *gin.Context) {
+			result <- ginx.UpgradeWebSocket(c, func(ctx context.Context, conn *ginx.WebSocketConn) error {
+				for {
+					mt, data, err := conn.ReadMessage()
+					if err != nil {
+						return err
+					}
+					if err := conn.WriteMessage(mt, data); err != nil {
+						return err
+					}
+				}
+			}, ginx.WithWebSocketTracker(tracker))
+		})
+		engine.GET("/idle", func(c *gin.Context) {
+			result <- ginx.UpgradeWebSocket(c, func(ctx context.Context, conn *ginx.WebSocketConn) error {
+				<-ctx.Done()
+				return nil
+			}, ginx.WithWebSocketTracker(tracker), ginx.WithWebSocketPingInterval(20*time.Millisecond))
+		})
+		srv := httptest.NewServer(engine)
+		defer srv.Close()
+		wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+		Convey("正常关闭", func() {
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/echo", nil)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			So(conn.WriteMessage(websocket.TextMessage, []byte("hi")), ShouldBeNil)
+			_, data, err := conn.ReadMessage()
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "hi")
+
+			So(conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")), ShouldBeNil)
+			So(<-result, ShouldBeNil)
+			So(waitFor(func() bool { return tracker.Active() == 0 }), ShouldBeTrue)
+		})
+
+		Convey("ping失败", func() {
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/idle", nil)
+			So(err, ShouldBeNil)
+			// drop connection without close frame
+			conn.UnderlyingConn().Close()
+
+			select {
+			case err := <-result:
+				So(err, ShouldNotBeNil)
+			case <-time.After(2 * time.Second):
+				So("ping failure not detected", ShouldBeEmpty)
+			}
+			So(waitFor(func() bool { return tracker.Active() == 0 }), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,230 @@
+package ginx
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+const (
+	defaultWebSocketReadLimit    = 1 << 20
+	defaultWebSocketPingInterval = 30 * time.Second
+	defaultWebSocketWriteWait    = 10 * time.Second
+)
+
+// WebSocketOption configures UpgradeWebSocket.
+type WebSocketOption func(*webSocketOptions)
+
+type webSocketOptions struct {
+	readLimit    int64
+	pingInterval time.Duration
+	writeWait    time.Duration
+	checkOrigin  func(r *http.Request) bool
+	tracker      *StreamTracker
+}
+
+// WithWebSocketReadLimit set the max size of message read from peer.
+func WithWebSocketReadLimit(limit int64) WebSocketOption {
+	return func(o *webSocketOptions) {
+		o.readLimit = limit
+	}
+}
+
+// WithWebSocketPingInterval set interval of ping, connection is closed if no pong received in 2 intervals.
+func WithWebSocketPingInterval(interval time.Duration) WebSocketOption {
+	return func(o *webSocketOptions) {
+		o.pingInterval = interval
+	}
+}
+
+// WithWebSocketWriteWait set the timeout of writing a message.
+func WithWebSocketWriteWait(wait time.Duration) WebSocketOption {
+	return func(o *webSocketOptions) {
+		o.writeWait = wait
+	}
+}
+
+// WithWebSocketCheckOrigin set origin checker, same origin is required by default.
+func WithWebSocketCheckOrigin(f func(r *http.Request) bool) WebSocketOption {
+	return func(o *webSocketOptions) {
+		o.checkOrigin = f
+	}
+}
+
+// WithWebSocketTracker set the tracker connection registered to, tracker set by SetStreamTracker or DefaultStreamTracker is used by default.
+func WithWebSocketTracker(tracker *StreamTracker) WebSocketOption {
+	return func(o *webSocketOptions) {
+		o.tracker = tracker
+	}
+}
+
+// WebSocketConn wraps websocket.Conn, writing is safe for concurrent use.
+type WebSocketConn struct {
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+	writeWait time.Duration
+}
+
+// Underlying returns the underlying websocket connection.
+func (w *WebSocketConn) Underlying() *websocket.Conn {
+	return w.conn
+}
+
+// ReadMessage reads a message from peer.
+func (w *WebSocketConn) ReadMessage() (messageType int, p []byte, err error) {
+	return w.conn.ReadMessage()
+}
+
+// ReadJSON reads a json message from peer into v.
+func (w *WebSocketConn) ReadJSON(v interface{}) error {
+	return w.conn.ReadJSON(v)
+}
+
+// WriteMessage writes a message to peer.
+func (w *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.writeWait))
+	return w.conn.WriteMessage(messageType, data)
+}
+
+// WriteJSON writes v to peer as json message.
+func (w *WebSocketConn) WriteJSON(v interface{}) error {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.writeWait))
+	return w.conn.WriteJSON(v)
+}
+
+// close sends close frame to peer and closes connection.
+func (w *WebSocketConn) close(closeCode int, reason string) {
+	_ = w.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(closeCode, reason), time.Now().Add(w.writeWait))
+	_ = w.conn.Close()
+}
+
+// UpgradeWebSocket upgrades request to websocket and runs handler with the connection.
+// handler runs with a context which is canceled when connection broken or server shutdown,
+// context carries log fields of request, such as request id.
+// Connection is kept alive by ping/pong and closed with close frame after handler returns,
+// error of ping is returned if connection is broken. Request is rejected with 503 if server is shutting down.
+func UpgradeWebSocket(
+	c *gin.Context,
+	handler func(ctx context.Context, conn *WebSocketConn) error,
+	opts ...WebSocketOption,
+) error {
+	o := &webSocketOptions{
+		readLimit:    defaultWebSocketReadLimit,
+		pingInterval: defaultWebSocketPingInterval,
+		writeWait:    defaultWebSocketWriteWait,
+		tracker:      streamTracker(c),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	draining, release, ok := o.tracker.track()
+	if !ok {
+		err := errors.Wrap(code.ErrServiceOverloaded, "server is shutting down")
+		WriteResponse(c, err, nil)
+		return err
+	}
+	defer release()
+
+	upgrader := websocket.Upgrader{CheckOrigin: o.checkOrigin}
+	// upgrader has written error response if upgrade fail
+	raw, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.F(c).Warnf("upgrade websocket fail:%v", err)
+		return err
+	}
+	// make sure hijacked connection is closed on every path, closing twice is harmless
+	defer raw.Close()
+
+	ctx, cancel := streamContext(requestContext(c), draining)
+	defer cancel()
+
+	conn := &WebSocketConn{conn: raw, writeWait: o.writeWait}
+	raw.SetReadLimit(o.readLimit)
+	if o.pingInterval > 0 {
+		pongWait := 2 * o.pingInterval
+		_ = raw.SetReadDeadline(time.Now().Add(pongWait))
+		raw.SetPongHandler(func(string) error {
+			return raw.SetReadDeadline(time.Now().Add(pongWait))
+		})
+	}
+
+	log.F(ctx).Debug("websocket connection established")
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	var pingErr error
+	go func() {
+		defer close(exited)
+
+		var ping <-chan time.Time
+		if o.pingInterval > 0 {
+			ticker := time.NewTicker(o.pingInterval)
+			defer ticker.Stop()
+			ping = ticker.C
+		}
+		for {
+			select {
+			case <-ping:
+				if err := raw.WriteControl(websocket.PingMessage, nil, time.Now().Add(o.writeWait)); err != nil {
+					log.F(ctx).Debugf("websocket ping fail:%v", err)
+					pingErr = err
+					// connection is broken, unblock reading of handler
+					_ = raw.Close()
+					cancel()
+					return
+				}
+			case <-ctx.Done():
+				// server shutdown, notify peer going away and unblock reading of handler
+				select {
+				case <-done:
+				default:
+					log.F(ctx).Debug("websocket connection closed by server shutdown")
+					conn.close(websocket.CloseGoingAway, "server shutdown")
+				}
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = handler(ctx, conn)
+	close(done)
+	<-exited
+	// connection has been closed if ctx is done before handler return
+	closed := ctx.Err() != nil
+	cancel()
+
+	if pingErr != nil {
+		log.F(ctx).Warnf("websocket connection broken:%v", pingErr)
+		return pingErr
+	}
+	if closed {
+		log.F(ctx).Debugf("websocket connection closed:%v", err)
+		return nil
+	}
+	if err != nil && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		log.F(ctx).Warnf("websocket handler fail:%v", err)
+		conn.close(websocket.CloseInternalServerErr, "internal server error")
+		return err
+	}
+	conn.close(websocket.CloseNormalClosure, "")
+	log.F(ctx).Debug("websocket connection finish")
+	return nil
+}
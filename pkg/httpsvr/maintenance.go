@@ -0,0 +1,46 @@
+package httpsvr
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
+)
+
+// MaintenancePath is the path of maintenance admin api.
+const MaintenancePath = "/debug/maintenance"
+
+// Maintenance returns maintenance switch, nil if not enabled.
+// It can be passed to grpc server to share maintenance mode.
+func (s *GenericHTTPServer) Maintenance() *maintenance.Switch {
+	return s.maintenance
+}
+
+// installMaintenanceAPI installs admin api to get and change maintenance state.
+// PATCH changes fields present only, such as `{"mode":"readonly","reason":"migrating"}`.
+func (s *GenericHTTPServer) installMaintenanceAPI() {
+	get := func(c *gin.Context) {
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"state":    s.maintenance.State(),
+			"inFlight": s.maintenance.InFlight(),
+		})
+	}
+
+	s.GET(MaintenancePath, s.adminGuard, get)
+	s.PATCH(MaintenancePath, s.adminGuard, func(c *gin.Context) {
+		var update maintenance.StateUpdate
+		if err := ginx.ParseJSON(c, &update); err != nil {
+			ginx.WriteResponse(c, err, nil)
+			return
+		}
+		if _, err := s.maintenance.Update(update); err != nil {
+			ginx.WriteResponse(c, errors.WrapError(code.ErrValidation, err), nil)
+			return
+		}
+		get(c)
+	})
+}
@@ -0,0 +1,76 @@
+package operation
+
+import (
+	"context"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+)
+
+// DefaultPrefix is the path prefix of operation api.
+const DefaultPrefix = "/operations"
+
+// HeaderLocation tells client where to query accepted operation.
+const HeaderLocation = "Location"
+
+// InstallAPI installs operation api under prefix:
+//
+//	GET    <prefix>/:id        query operation
+//	DELETE <prefix>/:id        cancel operation
+//	GET    <prefix>/:id/watch  stream operation changes as server-sent events
+func InstallAPI(router gin.IRouter, prefix string, m *Manager) {
+	g := router.Group(prefix)
+	g.GET("/:id", func(c *gin.Context) {
+		op, err := m.Get(c.Param("id"))
+		ginx.WriteResponse(c, err, op)
+	})
+	g.DELETE("/:id", func(c *gin.Context) {
+		if err := m.Cancel(c.Param("id")); err != nil {
+			ginx.WriteResponse(c, err, nil)
+			return
+		}
+		op, err := m.Get(c.Param("id"))
+		ginx.WriteResponse(c, err, op)
+	})
+	g.GET("/:id/watch", func(c *gin.Context) {
+		ch, err := m.Watch(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			ginx.WriteResponse(c, err, nil)
+			return
+		}
+		ginx.StreamSSE(c, func(ctx context.Context, stream *ginx.SSEStream) error {
+			for {
+				select {
+				case op, ok := <-ch:
+					if !ok {
+						return nil
+					}
+					if err := stream.Send(ginx.SSEvent{Event: string(op.Status), Data: op}); err != nil {
+						return err
+					}
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		})
+	})
+}
+
+// Accept submits fn as an operation and writes `202 Accepted` with the operation,
+// `Location` header refers to the operation api under prefix.
+func Accept(c *gin.Context, m *Manager, prefix, name string, fn Func) {
+	op, err := m.Submit(c.Copy(), name, fn)
+	if err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+
+	c.Header(HeaderLocation, path.Join(prefix, op.ID))
+	c.JSON(http.StatusAccepted, ginx.Response{
+		Status: ginx.FromError(nil),
+		Data:   op,
+	})
+}
@@ -0,0 +1,444 @@
+package operation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/wangweihong/eazycloud/pkg/cache"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/shutdown"
+)
+
+// Status is the execution status of operation.
+type Status string
+
+const (
+	StatusPending   Status = "Pending"
+	StatusRunning   Status = "Running"
+	StatusSucceeded Status = "Succeeded"
+	StatusFailed    Status = "Failed"
+	StatusCanceled  Status = "Canceled"
+)
+
+// Finished returns true if operation will not change anymore.
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+// Operation describes a long-running operation.
+type Operation struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Status is the execution status of operation.
+	Status Status `json:"status"`
+	// Progress is percentage of operation executed, between 0 and 100.
+	Progress int    `json:"progress"`
+	Message  string `json:"message,omitempty"`
+	// Result is the result of succeeded operation.
+	Result interface{} `json:"result,omitempty"`
+	// Error is the error envelope of failed or canceled operation.
+	Error      *ginx.CallStatus `json:"error,omitempty"`
+	CreateTime time.Time        `json:"create_time"`
+	UpdateTime time.Time        `json:"update_time"`
+	FinishTime *time.Time       `json:"finish_time,omitempty"`
+}
+
+// Reporter reports progress of running operation.
+type Reporter interface {
+	// Progress updates progress percentage and message of operation.
+	Progress(percent int, message string)
+}
+
+// Func is the work executed by operation. ctx is canceled when operation canceled or manager shutdown.
+type Func func(ctx context.Context, reporter Reporter) (result interface{}, err error)
+
+// Config is the configuration of Manager, zero fields use values of NewConfig.
+type Config struct {
+	// Workers is the number of operations executed concurrently.
+	Workers int
+	// QueueSize is the max number of pending operations.
+	QueueSize int
+	// TTL is how long finished operation can be queried.
+	TTL time.Duration
+}
+
+// NewConfig returns a Config with default values.
+func NewConfig() *Config {
+	return &Config{
+		Workers:   4,
+		QueueSize: 100,
+		TTL:       time.Hour,
+	}
+}
+
+// task is an operation not finished yet.
+type task struct {
+	op      Operation
+	fn      Func
+	ctx     context.Context
+	cancel  context.CancelFunc
+	changed chan struct{} // closed and renewed every time op changed
+}
+
+// Manager executes operations in a worker pool and keeps their state.
+type Manager struct {
+	lock    sync.RWMutex
+	tasks   map[string]*task // 未结束的操作
+	queue   chan *task
+	store   cache.TTLStore // 已结束的操作, 过期后删除
+	baseCtx context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	// stop janitor purging expired operations
+	stopJanitor func()
+}
+
+var _ shutdown.ShutdownCallback = (*Manager)(nil)
+
+func (c *Config) complete() *Config {
+	defaults := NewConfig()
+	if c == nil {
+		return defaults
+	}
+	completed := *c
+	if completed.Workers <= 0 {
+		completed.Workers = defaults.Workers
+	}
+	if completed.QueueSize <= 0 {
+		completed.QueueSize = defaults.QueueSize
+	}
+	if completed.TTL <= 0 {
+		completed.TTL = defaults.TTL
+	}
+	return &completed
+}
+
+// NewManager creates an operation manager and starts its workers.
+func NewManager(c *Config) *Manager {
+	c = c.complete()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		tasks: make(map[string]*task),
+		queue: make(chan *task, c.QueueSize),
+		store: cache.NewTTLStore(func(obj interface{}) (string, error) {
+			return obj.(*Operation).ID, nil
+		}, c.TTL),
+		baseCtx: ctx,
+		cancel:  cancel,
+	}
+
+	m.stopJanitor = m.store.RunJanitor(c.TTL)
+
+	for i := 0; i < c.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	return m
+}
+
+// Submit queues fn as an operation and returns it immediately.
+// ctx is only used to carry values such as log fields, cancellation of ctx doesn't cancel operation.
+func (m *Manager) Submit(ctx context.Context, name string, fn Func) (*Operation, error) {
+	now := time.Now()
+	t := &task{
+		op: Operation{
+			ID:         uuid.New().String(),
+			Name:       name,
+			Status:     StatusPending,
+			CreateTime: now,
+			UpdateTime: now,
+		},
+		fn:      fn,
+		changed: make(chan struct{}),
+	}
+	t.ctx, t.cancel = context.WithCancel(detach(m.baseCtx, ctx))
+
+	if m.baseCtx.Err() != nil {
+		t.cancel()
+		return nil, errors.Wrap(code.ErrOperationCanceled, "operation manager has stopped")
+	}
+
+	// op is copied under lock, since worker may run it once queued
+	var op Operation
+	m.lock.Lock()
+	select {
+	case m.queue <- t:
+		m.tasks[t.op.ID] = t
+		op = t.op
+		m.lock.Unlock()
+	default:
+		m.lock.Unlock()
+		t.cancel()
+		return nil, errors.WrapF(code.ErrOperationQueueFull, "queue %d operations", cap(m.queue))
+	}
+
+	log.F(ctx).Infof("operation %s(%s) submitted", name, op.ID)
+	return &op, nil
+}
+
+// Get returns the operation by id.
+func (m *Manager) Get(id string) (*Operation, error) {
+	m.lock.RLock()
+	if t, ok := m.tasks[id]; ok {
+		op := t.op
+		m.lock.RUnlock()
+		return &op, nil
+	}
+	m.lock.RUnlock()
+
+	obj, exists, _ := m.store.GetByKey(id)
+	if !exists {
+		return nil, errors.WrapF(code.ErrOperationNotFound, "operation %s not found", id)
+	}
+	op := *obj.(*Operation)
+	return &op, nil
+}
+
+// Cancel cancels the operation by id. Pending operation is canceled immediately,
+// running operation is canceled by its context and finished when Func returns.
+func (m *Manager) Cancel(id string) error {
+	m.lock.Lock()
+	t, ok := m.tasks[id]
+	if !ok {
+		m.lock.Unlock()
+		if _, err := m.Get(id); err != nil {
+			return err
+		}
+		return errors.WrapF(code.ErrOperationFinished, "operation %s has finished", id)
+	}
+	// pending operation is finished before unlocked, so worker never runs it
+	if t.op.Status == StatusPending {
+		m.finishLocked(t, nil, errors.WrapF(code.ErrOperationCanceled, "operation %s canceled", id))
+	}
+	m.lock.Unlock()
+
+	t.cancel()
+	return nil
+}
+
+// Watch returns a channel which receives operation every time it changed.
+// Channel is closed after operation finished or ctx done.
+func (m *Manager) Watch(ctx context.Context, id string) (<-chan Operation, error) {
+	op, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Operation, 1)
+	ch <- *op
+	if op.Status.Finished() {
+		close(ch)
+		return ch, nil
+	}
+
+	go func() {
+		defer close(ch)
+		last := *op
+		for {
+			m.lock.RLock()
+			t, ok := m.tasks[id]
+			var changed chan struct{}
+			if ok {
+				changed = t.changed
+			}
+			m.lock.RUnlock()
+
+			if ok {
+				select {
+				case <-changed:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			op, err := m.Get(id)
+			if err != nil {
+				return
+			}
+			if op.UpdateTime.Equal(last.UpdateTime) {
+				continue
+			}
+			last = *op
+
+			select {
+			case ch <- last:
+			case <-ctx.Done():
+				return
+			}
+			if last.Status.Finished() {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// OnShutdown implements shutdown.ShutdownCallback, cancels all operations and waits workers exit.
+func (m *Manager) OnShutdown(string) error {
+	m.Stop()
+	return nil
+}
+
+// Stop cancels all operations and waits workers exit.
+func (m *Manager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+	m.stopJanitor()
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.baseCtx.Done():
+			m.cancelPending()
+			return
+		case t := <-m.queue:
+			m.run(t)
+		}
+	}
+}
+
+// cancelPending finishes operations still in queue when manager stopped.
+func (m *Manager) cancelPending() {
+	for {
+		select {
+		case t := <-m.queue:
+			m.finish(t, nil, errors.WrapF(code.ErrOperationCanceled, "operation %s canceled by shutdown", t.op.ID))
+		default:
+			return
+		}
+	}
+}
+
+func (m *Manager) run(t *task) {
+	m.lock.Lock()
+	if t.op.Status != StatusPending {
+		// canceled before running
+		m.lock.Unlock()
+		return
+	}
+	m.updateLocked(t, func(op *Operation) {
+		op.Status = StatusRunning
+	})
+	m.lock.Unlock()
+
+	log.F(t.ctx).Infof("operation %s(%s) running", t.op.Name, t.op.ID)
+
+	result, err := m.execute(t)
+	if err == nil && t.ctx.Err() != nil {
+		err = t.ctx.Err()
+	}
+	if t.ctx.Err() != nil {
+		err = errors.WrapError(code.ErrOperationCanceled, err)
+	}
+	m.finish(t, result, err)
+}
+
+// execute runs operation func, panic is treated as error.
+func (m *Manager) execute(t *task) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.WrapF(code.ErrUnknown, "operation panic:%v", r)
+		}
+	}()
+	return t.fn(t.ctx, &reporter{m: m, t: t})
+}
+
+func (m *Manager) finish(t *task, result interface{}, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.finishLocked(t, result, err)
+}
+
+// finishLocked records result of operation, must be called with lock held.
+func (m *Manager) finishLocked(t *task, result interface{}, err error) {
+	if t.op.Status.Finished() {
+		return
+	}
+
+	m.updateLocked(t, func(op *Operation) {
+		now := time.Now()
+		op.FinishTime = &now
+		switch {
+		case err == nil:
+			op.Status = StatusSucceeded
+			op.Progress = 100
+			op.Result = result
+		case errors.IsCode(err, code.ErrOperationCanceled):
+			op.Status = StatusCanceled
+			op.Error = ginx.FromError(err)
+		default:
+			op.Status = StatusFailed
+			op.Error = ginx.FromError(err)
+		}
+	})
+
+	op := t.op
+	_ = m.store.Add(&op)
+	delete(m.tasks, t.op.ID)
+	t.cancel()
+
+	if err != nil {
+		log.F(t.ctx).Warnf("operation %s(%s) %s:%v", op.Name, op.ID, op.Status, err)
+	} else {
+		log.F(t.ctx).Infof("operation %s(%s) %s", op.Name, op.ID, op.Status)
+	}
+}
+
+// updateLocked modifies operation and notifies watchers, must be called with lock held.
+func (m *Manager) updateLocked(t *task, f func(op *Operation)) {
+	f(&t.op)
+	t.op.UpdateTime = time.Now()
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+type reporter struct {
+	m *Manager
+	t *task
+}
+
+func (r *reporter) Progress(percent int, message string) {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+
+	r.m.lock.Lock()
+	defer r.m.lock.Unlock()
+	if r.t.op.Status != StatusRunning {
+		return
+	}
+	r.m.updateLocked(r.t, func(op *Operation) {
+		op.Progress = percent
+		op.Message = message
+	})
+}
+
+// detachedContext is canceled with embedded context, but carries values of another context.
+type detachedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.values.Value(key)
+}
+
+// detach returns a context canceled with parent only, but carries values of values, such as log fields.
+func detach(parent, values context.Context) context.Context {
+	if values == nil {
+		return parent
+	}
+	return detachedContext{Context: parent, values: values}
+}
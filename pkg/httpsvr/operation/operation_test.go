@@ -0,0 +1,168 @@
+package operation_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/operation"
+)
+
+func waitFinished(m *operation.Manager, id string) *operation.Operation {
+	for i := 0; i < 100; i++ {
+		op, err := m.Get(id)
+		So(err, ShouldBeNil)
+		if op.Status.Finished() {
+			return op
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	Convey("异步操作", t, func() {
+		m := operation.NewManager(&operation.Config{Workers: 1, QueueSize: 1, TTL: time.Minute})
+		defer m.Stop()
+
+		Convey("执行成功", func() {
+			op, err := m.Submit(context.Background(), "test", func(ctx context.Context, r operation.Reporter) (interface{}, error) {
+				r.Progress(50, "half")
+				return "done", nil
+			})
+			So(err, ShouldBeNil)
+			So(op.Status, ShouldEqual, operation.StatusPending)
+
+			ch, err := m.Watch(context.Background(), op.ID)
+			So(err, ShouldBeNil)
+			var last operation.Operation
+			for o := range ch {
+				last = o
+			}
+			So(last.Status, ShouldEqual, operation.StatusSucceeded)
+			So(last.Progress, ShouldEqual, 100)
+			So(last.Result, ShouldEqual, "done")
+		})
+
+		Convey("执行失败", func() {
+			op, err := m.Submit(context.Background(), "test", func(ctx context.Context, r operation.Reporter) (interface{}, error) {
+				return nil, errors.Wrap(code.ErrValidation, "invalid")
+			})
+			So(err, ShouldBeNil)
+			op = waitFinished(m, op.ID)
+			So(op.Status, ShouldEqual, operation.StatusFailed)
+			So(op.Error.Code, ShouldEqual, code.ErrValidation)
+		})
+
+		Convey("取消操作", func() {
+			op, err := m.Submit(context.Background(), "test", func(ctx context.Context, r operation.Reporter) (interface{}, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})
+			So(err, ShouldBeNil)
+			So(m.Cancel(op.ID), ShouldBeNil)
+			op = waitFinished(m, op.ID)
+			So(op.Status, ShouldEqual, operation.StatusCanceled)
+			So(op.Error.Code, ShouldEqual, code.ErrOperationCanceled)
+
+			err = m.Cancel(op.ID)
+			So(errors.IsCode(err, code.ErrOperationFinished), ShouldBeTrue)
+			_, err = m.Get("notexist")
+			So(errors.IsCode(err, code.ErrOperationNotFound), ShouldBeTrue)
+		})
+
+		Convey("取消等待中的操作立即结束且不再执行", func() {
+			block := make(chan struct{})
+			defer close(block)
+			started := make(chan struct{})
+			_, err := m.Submit(context.Background(), "running", func(ctx context.Context, r operation.Reporter) (interface{}, error) {
+				close(started)
+				<-block
+				return nil, nil
+			})
+			So(err, ShouldBeNil)
+			<-started
+
+			executed := make(chan struct{}, 1)
+			op, err := m.Submit(context.Background(), "pending", func(ctx context.Context, r operation.Reporter) (interface{}, error) {
+				executed <- struct{}{}
+				return nil, nil
+			})
+			So(err, ShouldBeNil)
+			So(m.Cancel(op.ID), ShouldBeNil)
+			op, err = m.Get(op.ID)
+			So(err, ShouldBeNil)
+			So(op.Status, ShouldEqual, operation.StatusCanceled)
+			So(executed, ShouldBeEmpty)
+		})
+
+		Convey("队列已满", func() {
+			block := make(chan struct{})
+			defer close(block)
+			fn := func(ctx context.Context, r operation.Reporter) (interface{}, error) {
+				<-block
+				return nil, nil
+			}
+			var err error
+			for i := 0; i < 3 && err == nil; i++ {
+				_, err = m.Submit(context.Background(), "test", fn)
+			}
+			So(errors.IsCode(err, code.ErrOperationQueueFull), ShouldBeTrue)
+		})
+	})
+}
+
+func TestManager_DefaultConfig(t *testing.T) {
+	Convey("配置为零值时使用默认值", t, func() {
+		m := operation.NewManager(&operation.Config{})
+		defer m.Stop()
+
+		op, err := m.Submit(context.Background(), "test", func(ctx context.Context, r operation.Reporter) (interface{}, error) {
+			return "done", nil
+		})
+		So(err, ShouldBeNil)
+		op = waitFinished(m, op.ID)
+		So(op, ShouldNotBeNil)
+		So(op.Status, ShouldEqual, operation.StatusSucceeded)
+	})
+}
+
+func TestAccept(t *testing.T) {
+	Convey("接口返回202", t, func() {
+		gin.SetMode(gin.ReleaseMode)
+		m := operation.NewManager(nil)
+		defer m.Stop()
+
+		e := gin.New()
+		operation.InstallAPI(e, operation.DefaultPrefix, m)
+		e.POST("/jobs", func(c *gin.Context) {
+			operation.Accept(c, m, operation.DefaultPrefix, "job", func(ctx context.Context, r operation.Reporter) (interface{}, error) {
+				return nil, nil
+			})
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/jobs", nil)
+		e.ServeHTTP(w, req)
+		So(w.Code, ShouldEqual, http.StatusAccepted)
+		location := w.Header().Get(operation.HeaderLocation)
+		So(location, ShouldStartWith, operation.DefaultPrefix+"/")
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodGet, location, nil)
+		e.ServeHTTP(w, req)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodGet, location+"/watch", nil)
+		e.ServeHTTP(w, req)
+		So(w.Body.String(), ShouldContainSubstring, "event: Succeeded")
+	})
+}
@@ -0,0 +1,216 @@
+package resource
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+)
+
+const (
+	// QueryResourceVersion is the query parameter of resource version used by delete and watch.
+	QueryResourceVersion = "resource_version"
+	// QueryWatch turns list into watch if it is `true`.
+	QueryWatch = "watch"
+)
+
+// ListResult is the data of list response.
+type ListResult struct {
+	// ResourceVersion is the latest resource version of store when listed.
+	ResourceVersion string   `json:"resource_version"`
+	Items           []Object `json:"items"`
+}
+
+// Install mounts CRUD routes of store under `/<resource name>`:
+//
+//	POST   /<name>      create
+//	GET    /<name>      list, query parameters of registered indexes are selector, such as `?tenant=t1`
+//	                    `?watch=true&resource_version=N` streams changes after N, as server-sent events if
+//	                    `Accept: text/event-stream`, otherwise as newline-delimited json.
+//	                    `Last-Event-ID` header takes precedence over `resource_version` when resume
+//	GET    /<name>/:id  get, ETag is resource version, If-None-Match and If-Modified-Since are supported
+//	PUT    /<name>/:id  update
+//	PATCH  /<name>/:id  json merge patch
+//	DELETE /<name>/:id  delete, `?resource_version=` is optional
+//
+// PUT/PATCH/DELETE accept If-Match with the ETag returned by GET, ErrPreconditionFailed is returned
+// if object has been modified.
+func Install(router gin.IRouter, store *Store) {
+	g := router.Group("/" + store.res.Name)
+	g.POST("", store.create)
+	g.GET("", store.list)
+	g.GET("/:id", store.get)
+	g.PUT("/:id", store.update)
+	g.PATCH("/:id", store.patch)
+	g.DELETE("/:id", store.delete)
+}
+
+func (s *Store) create(c *gin.Context) {
+	obj := s.res.New()
+	if err := ginx.ParseJSON(c, obj); err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+	obj, err := s.Create(c, obj)
+	ginx.WriteResponse(c, err, obj)
+}
+
+func (s *Store) list(c *gin.Context) {
+	// only registered indexes are selectors, other query parameters are ignored
+	selector := make(map[string]string)
+	for k := range c.Request.URL.Query() {
+		if _, ok := s.res.Indexers[k]; ok {
+			selector[k] = c.Query(k)
+		}
+	}
+	if c.Query(QueryWatch) == "true" {
+		s.watch(c, selector)
+		return
+	}
+
+	// read version before list, so client watching from it won't miss any change.
+	version := s.ResourceVersion()
+	objs, err := s.List(selector)
+	if err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+	ginx.WriteResponse(c, nil, ListResult{ResourceVersion: version, Items: objs})
+}
+
+func (s *Store) get(c *gin.Context) {
+	obj, err := s.Get(c.Param("id"))
+	if err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+	meta := obj.GetObjectMeta()
+	if ginx.CheckPreconditions(c, ginx.VersionETag(meta.ResourceVersion, false), meta.UpdateTime) {
+		return
+	}
+	ginx.WriteResponse(c, nil, obj)
+}
+
+func (s *Store) update(c *gin.Context) {
+	obj := s.res.New()
+	if err := ginx.ParseJSON(c, obj); err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+	if key, err := s.res.KeyFunc(obj); err != nil || key != c.Param("id") {
+		ginx.WriteResponse(c, errors.WrapF(code.ErrValidation, "key of %s doesn't match `%s`", s.res.Name, c.Param("id")), nil)
+		return
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+	if version != "" {
+		obj.GetObjectMeta().ResourceVersion = version
+	}
+	obj, err = s.Update(c, obj)
+	s.writeObject(c, preconditionError(err, version), obj)
+}
+
+func (s *Store) patch(c *gin.Context) {
+	data, err := ginx.ParseRawData(c)
+	if err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+	obj, err := s.patchWithVersion(c, c.Param("id"), data, version)
+	s.writeObject(c, preconditionError(err, version), obj)
+}
+
+func (s *Store) delete(c *gin.Context) {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+	if version == "" {
+		version = c.Query(QueryResourceVersion)
+	}
+	err = s.Delete(c, c.Param("id"), version)
+	ginx.WriteResponse(c, preconditionError(err, version), nil)
+}
+
+// writeObject writes object with its ETag.
+func (s *Store) writeObject(c *gin.Context, err error, obj Object) {
+	if err == nil {
+		c.Header(ginx.HeaderETag, ginx.VersionETag(obj.GetObjectMeta().ResourceVersion, false))
+	}
+	ginx.WriteResponse(c, err, obj)
+}
+
+// ifMatchVersion returns resource version in If-Match header, `*` is treated as absent
+// since object must exist to be modified.
+func ifMatchVersion(c *gin.Context) (string, error) {
+	im := c.GetHeader(ginx.HeaderIfMatch)
+	if im == "" || im == "*" {
+		return "", nil
+	}
+	if strings.Contains(im, ",") {
+		return "", errors.WrapF(code.ErrValidation, "multiple etags in If-Match `%s` are not supported", im)
+	}
+	version, weak := ginx.ParseETag(im)
+	if weak || version == "" {
+		// If-Match uses strong comparison, weak etag never matches
+		return "", errors.WrapF(code.ErrPreconditionFailed, "If-Match `%s` is not a strong etag", im)
+	}
+	return version, nil
+}
+
+// preconditionError converts conflict caused by If-Match into ErrPreconditionFailed.
+func preconditionError(err error, version string) error {
+	if err != nil && version != "" && errors.IsCode(err, code.ErrResourceConflict) {
+		return errors.WrapError(code.ErrPreconditionFailed, err)
+	}
+	return err
+}
+
+func (s *Store) watch(c *gin.Context, selector map[string]string) {
+	// EventSource of browser resumes with `Last-Event-ID` header when reconnect
+	version := c.GetHeader(ginx.HeaderLastEventID)
+	if version == "" {
+		version = c.Query(QueryResourceVersion)
+	}
+	// ErrResourceVersionTooOld tells client to list again before watch.
+	ch, err := s.Watch(c.Request.Context(), version, selector)
+	if err != nil {
+		ginx.WriteResponse(c, err, nil)
+		return
+	}
+
+	producer := func(ctx context.Context, stream *ginx.SSEStream) error {
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return nil
+				}
+				err := stream.Send(ginx.SSEvent{ID: e.ResourceVersion, Event: string(e.Type), Data: e})
+				if err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+	if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		ginx.StreamSSE(c, producer)
+		return
+	}
+	ginx.StreamJSON(c, producer)
+}
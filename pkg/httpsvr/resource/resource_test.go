@@ -0,0 +1,267 @@
+package resource_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/cache"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/resource"
+	"github.com/wangweihong/eazycloud/pkg/json"
+)
+
+type User struct {
+	resource.ObjectMeta
+	Name   string `json:"name"`
+	Tenant string `json:"tenant"`
+	Age    int    `json:"age"`
+}
+
+// brokenUser can't be copied by json.
+type brokenUser struct {
+	User
+}
+
+func (brokenUser) MarshalJSON() ([]byte, error) {
+	return nil, fmt.Errorf("broken")
+}
+
+func newUserResource() *resource.Resource {
+	return &resource.Resource{
+		Name: "users",
+		New:  func() resource.Object { return &User{} },
+		KeyFunc: func(obj interface{}) (string, error) {
+			return obj.(*User).Name, nil
+		},
+		Indexers: cache.Indexers{
+			"tenant": func(obj interface{}) ([]string, error) {
+				return []string{obj.(*User).Tenant}, nil
+			},
+		},
+		Validate: func(obj resource.Object) error {
+			if obj.(*User).Age < 0 {
+				return errors.Wrap(code.ErrValidation, "age must not be negative")
+			}
+			return nil
+		},
+	}
+}
+
+func TestStore(t *testing.T) {
+	Convey("资源存储", t, func() {
+		store, err := resource.NewStore(newUserResource())
+		So(err, ShouldBeNil)
+		ctx := context.Background()
+
+		obj, err := store.Create(ctx, &User{Name: "u1", Tenant: "t1"})
+		So(err, ShouldBeNil)
+		rv := obj.GetObjectMeta().ResourceVersion
+		So(rv, ShouldNotBeEmpty)
+
+		_, err = store.Create(ctx, &User{Name: "u1"})
+		So(errors.IsCode(err, code.ErrResourceAlreadyExist), ShouldBeTrue)
+		_, err = store.Create(ctx, &User{Name: "u2", Age: -1})
+		So(errors.IsCode(err, code.ErrValidation), ShouldBeTrue)
+
+		Convey("乐观锁", func() {
+			u := obj.(*User)
+			u.Age = 10
+			updated, err := store.Update(ctx, u)
+			So(err, ShouldBeNil)
+			So(updated.GetObjectMeta().ResourceVersion, ShouldNotEqual, rv)
+
+			// 旧版本更新失败
+			_, err = store.Update(ctx, u)
+			So(errors.IsCode(err, code.ErrResourceConflict), ShouldBeTrue)
+			So(errors.IsCode(store.Delete(ctx, "u1", rv), code.ErrResourceConflict), ShouldBeTrue)
+
+			patched, err := store.Patch(ctx, "u1", []byte(`{"age":20}`))
+			So(err, ShouldBeNil)
+			So(patched.(*User).Age, ShouldEqual, 20)
+			So(patched.(*User).Tenant, ShouldEqual, "t1")
+
+			So(store.Delete(ctx, "u1", ""), ShouldBeNil)
+			_, err = store.Get("u1")
+			So(errors.IsCode(err, code.ErrResourceNotFound), ShouldBeTrue)
+		})
+
+		Convey("索引查询", func() {
+			_, err := store.Create(ctx, &User{Name: "u2", Tenant: "t2"})
+			So(err, ShouldBeNil)
+
+			objs, err := store.List(map[string]string{"tenant": "t2"})
+			So(err, ShouldBeNil)
+			So(len(objs), ShouldEqual, 1)
+			So(objs[0].(*User).Name, ShouldEqual, "u2")
+
+			_, err = store.List(map[string]string{"notexist": "t2"})
+			So(errors.IsCode(err, code.ErrValidation), ShouldBeTrue)
+		})
+
+		Convey("对象无法拷贝时返回错误", func() {
+			store, err := resource.NewStore(&resource.Resource{
+				Name: "brokens",
+				New:  func() resource.Object { return &brokenUser{} },
+				KeyFunc: func(obj interface{}) (string, error) {
+					return obj.(*brokenUser).Name, nil
+				},
+			})
+			So(err, ShouldBeNil)
+			_, err = store.Create(ctx, &brokenUser{User{Name: "u1"}})
+			So(errors.IsCode(err, code.ErrEncodingJSON), ShouldBeTrue)
+		})
+	})
+}
+
+func TestInstall(t *testing.T) {
+	Convey("资源路由", t, func() {
+		gin.SetMode(gin.ReleaseMode)
+		store, err := resource.NewStore(newUserResource())
+		So(err, ShouldBeNil)
+		e := gin.New()
+		resource.Install(e, store)
+
+		serve := func(method, path string, body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, req)
+			return w
+		}
+
+		So(serve(http.MethodPost, "/users", `{"name":"u1","tenant":"t1"}`).Code, ShouldEqual, http.StatusOK)
+		So(serve(http.MethodPut, "/users/u2", `{"name":"u1"}`).Code, ShouldEqual, http.StatusBadRequest)
+		So(serve(http.MethodPut, "/users/u1", `{"name":"u1","resource_version":"100"}`).Code, ShouldEqual, http.StatusConflict)
+		So(serve(http.MethodPatch, "/users/u1", `{"age":3}`).Code, ShouldEqual, http.StatusOK)
+
+		w := serve(http.MethodGet, "/users?tenant=t1", "")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		var resp struct {
+			Data struct {
+				Items []User `json:"items"`
+			} `json:"data"`
+		}
+		So(json.Unmarshal(w.Body.Bytes(), &resp), ShouldBeNil)
+		So(len(resp.Data.Items), ShouldEqual, 1)
+		So(resp.Data.Items[0].Age, ShouldEqual, 3)
+
+		// 非索引的查询参数被忽略
+		w = serve(http.MethodGet, "/users?tenant=t1&page=1", "")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(json.Unmarshal(w.Body.Bytes(), &resp), ShouldBeNil)
+		So(len(resp.Data.Items), ShouldEqual, 1)
+
+		So(serve(http.MethodDelete, "/users/u1", "").Code, ShouldEqual, http.StatusOK)
+		So(serve(http.MethodGet, "/users/u1", "").Code, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestWatch(t *testing.T) {
+	Convey("监听资源变化", t, func() {
+		res := newUserResource()
+		res.HistorySize = 2
+		store, err := resource.NewStore(res)
+		So(err, ShouldBeNil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, err = store.Create(ctx, &User{Name: "u1", Tenant: "t1"})
+		So(err, ShouldBeNil)
+		rv := store.ResourceVersion()
+
+		Convey("从版本恢复监听", func() {
+			_, err = store.Create(ctx, &User{Name: "u2", Tenant: "t2"})
+			So(err, ShouldBeNil)
+			So(store.Delete(ctx, "u1", ""), ShouldBeNil)
+
+			ch, err := store.Watch(ctx, rv, map[string]string{"tenant": "t1"})
+			So(err, ShouldBeNil)
+			e := <-ch
+			So(e.Type, ShouldEqual, cache.Deleted)
+			So(e.ResourceVersion, ShouldEqual, store.ResourceVersion())
+			So(e.Object.(*User).Name, ShouldEqual, "u1")
+		})
+
+		Convey("版本过旧", func() {
+			for _, name := range []string{"u2", "u3", "u4"} {
+				_, err = store.Create(ctx, &User{Name: name})
+				So(err, ShouldBeNil)
+			}
+			_, err := store.Watch(ctx, rv, nil)
+			So(errors.IsCode(err, code.ErrResourceVersionTooOld), ShouldBeTrue)
+		})
+
+		Convey("HTTP流式监听", func() {
+			gin.SetMode(gin.ReleaseMode)
+			e := gin.New()
+			resource.Install(e, store)
+			srv := httptest.NewServer(e)
+			defer srv.Close()
+
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/users?watch=true&resource_version="+rv, nil)
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			So(resp.Header.Get("Content-Type"), ShouldEqual, "application/x-ndjson")
+
+			_, err = store.Patch(ctx, "u1", []byte(`{"age":5}`))
+			So(err, ShouldBeNil)
+
+			var event struct {
+				Type   string `json:"type"`
+				Object User   `json:"object"`
+			}
+			line, err := bufio.NewReader(resp.Body).ReadBytes('\n')
+			So(err, ShouldBeNil)
+			So(json.Unmarshal(line, &event), ShouldBeNil)
+			So(event.Type, ShouldEqual, string(cache.Modified))
+			So(event.Object.Age, ShouldEqual, 5)
+
+			for _, name := range []string{"u2", "u3", "u4"} {
+				_, err = store.Create(ctx, &User{Name: name})
+				So(err, ShouldBeNil)
+			}
+			w := httptest.NewRecorder()
+			req, _ = http.NewRequest(http.MethodGet, "/users?watch=true&resource_version="+rv, nil)
+			e.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusGone)
+		})
+
+		Convey("SSE通过Last-Event-ID恢复监听", func() {
+			gin.SetMode(gin.ReleaseMode)
+			e := gin.New()
+			resource.Install(e, store)
+			srv := httptest.NewServer(e)
+			defer srv.Close()
+
+			// query parameter is too old, header takes precedence
+			for _, name := range []string{"u2", "u3", "u4"} {
+				_, err = store.Create(ctx, &User{Name: name})
+				So(err, ShouldBeNil)
+			}
+			latest := store.ResourceVersion()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/users?watch=true&resource_version="+rv, nil)
+			req.Header.Set("Accept", "text/event-stream")
+			req.Header.Set("Last-Event-ID", latest)
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+
+			_, err = store.Patch(ctx, "u1", []byte(`{"age":6}`))
+			So(err, ShouldBeNil)
+			line, err := bufio.NewReader(resp.Body).ReadString('\n')
+			So(err, ShouldBeNil)
+			So(line, ShouldEqual, "id: "+store.ResourceVersion()+"\n")
+		})
+	})
+}
@@ -0,0 +1,388 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wangweihong/eazycloud/pkg/cache"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/json"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/sets"
+)
+
+// ObjectMeta is the metadata maintained by Store, embed it into resource type.
+type ObjectMeta struct {
+	// ResourceVersion changes every time object changed, used for optimistic concurrency.
+	ResourceVersion string    `json:"resource_version,omitempty"`
+	CreateTime      time.Time `json:"create_time"`
+	UpdateTime      time.Time `json:"update_time"`
+}
+
+// GetObjectMeta implements Object.
+func (m *ObjectMeta) GetObjectMeta() *ObjectMeta {
+	return m
+}
+
+// Object is the resource type managed by Store, it must be a pointer to struct embedded ObjectMeta.
+type Object interface {
+	GetObjectMeta() *ObjectMeta
+}
+
+// Hooks are called around object changes. Error returned by Before* hooks aborts the change.
+// BeforeUpdate and BeforeDelete are called with store locked, they must not call Store.
+type Hooks struct {
+	BeforeCreate func(ctx context.Context, obj Object) error
+	AfterCreate  func(ctx context.Context, obj Object)
+	BeforeUpdate func(ctx context.Context, old, obj Object) error
+	AfterUpdate  func(ctx context.Context, obj Object)
+	BeforeDelete func(ctx context.Context, obj Object) error
+	AfterDelete  func(ctx context.Context, obj Object)
+}
+
+// Resource describes a resource type.
+type Resource struct {
+	// Name is the plural name of resource, used as route path such as `users`.
+	Name string
+	// New returns an empty object of resource type.
+	New func() Object
+	// KeyFunc computes the unique key of object, which is the `:id` in route.
+	KeyFunc cache.KeyFunc
+	// Indexers are able to be used in list query, such as `?tenant=t1`.
+	Indexers cache.Indexers
+	// Validate validates object before created or updated.
+	Validate func(obj Object) error
+	Hooks    Hooks
+	// HistorySize is the number of recent changes kept to resume watch, default is 100.
+	HistorySize int
+}
+
+func (r *Resource) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("resource name is empty")
+	}
+	if r.New == nil || r.KeyFunc == nil {
+		return fmt.Errorf("resource %s must set New and KeyFunc", r.Name)
+	}
+	return nil
+}
+
+// Store keeps objects of resource in an indexer.
+// Objects returned by Store are copies, modifying them doesn't affect Store.
+type Store struct {
+	res     *Resource
+	indexer cache.WatchableIndexer
+	// lock serializes writes to make resource version check and write atomic.
+	lock sync.Mutex
+}
+
+// NewStore creates a store of resource.
+func NewStore(res *Resource) (*Store, error) {
+	if err := res.validate(); err != nil {
+		return nil, err
+	}
+
+	indexers := cache.Indexers{}
+	for name, f := range res.Indexers {
+		indexers[name] = f
+	}
+	return &Store{
+		res: res,
+		indexer: cache.NewWatchableIndexer(res.KeyFunc, indexers, cache.WatchOptions{
+			HistorySize: res.HistorySize,
+			SetResourceVersion: func(obj interface{}, version uint64) {
+				obj.(Object).GetObjectMeta().ResourceVersion = strconv.FormatUint(version, 10)
+			},
+		}),
+	}, nil
+}
+
+// Resource returns the resource definition of store.
+func (s *Store) Resource() *Resource {
+	return s.res
+}
+
+// ResourceVersion returns the latest resource version of store.
+func (s *Store) ResourceVersion() string {
+	return strconv.FormatUint(s.indexer.ResourceVersion(), 10)
+}
+
+// Create adds obj into store.
+func (s *Store) Create(ctx context.Context, obj Object) (Object, error) {
+	if err := s.validateObject(obj); err != nil {
+		return nil, err
+	}
+	key, err := s.res.KeyFunc(obj)
+	if err != nil || key == "" {
+		return nil, errors.WrapF(code.ErrValidation, "compute key of %s fail:%v", s.res.Name, err)
+	}
+	if s.res.Hooks.BeforeCreate != nil {
+		if err := s.res.Hooks.BeforeCreate(ctx, obj); err != nil {
+			return nil, errors.UpdateStack(err)
+		}
+	}
+
+	s.lock.Lock()
+	if _, exists, _ := s.indexer.GetByKey(key); exists {
+		s.lock.Unlock()
+		return nil, errors.WrapF(code.ErrResourceAlreadyExist, "%s %s already exists", s.res.Name, key)
+	}
+	now := time.Now()
+	obj, err = s.copy(obj)
+	if err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	meta := obj.GetObjectMeta()
+	meta.CreateTime = now
+	meta.UpdateTime = now
+	_ = s.indexer.Add(obj)
+	s.lock.Unlock()
+
+	log.F(ctx).Infof("%s %s created", s.res.Name, key)
+	s.afterHook(ctx, s.res.Hooks.AfterCreate, obj)
+	return s.copy(obj)
+}
+
+// Get returns object by key.
+func (s *Store) Get(key string) (Object, error) {
+	obj, exists, err := s.indexer.GetByKey(key)
+	if err != nil {
+		return nil, errors.WrapError(code.ErrUnknown, err)
+	}
+	if !exists {
+		return nil, errors.WrapF(code.ErrResourceNotFound, "%s %s not found", s.res.Name, key)
+	}
+	return s.copy(obj.(Object))
+}
+
+// List returns objects sorted by key. Each entry of selector is indexer name and indexed value,
+// objects must match all entries.
+func (s *Store) List(selector map[string]string) ([]Object, error) {
+	var keys sets.String
+	for name, value := range selector {
+		if _, ok := s.res.Indexers[name]; !ok {
+			return nil, errors.WrapF(code.ErrValidation, "%s has no index `%s`", s.res.Name, name)
+		}
+		indexKeys, err := s.indexer.IndexKeys(name, value)
+		if err != nil {
+			return nil, errors.WrapError(code.ErrUnknown, err)
+		}
+		if keys == nil {
+			keys = sets.NewString(indexKeys...)
+		} else {
+			keys = keys.Intersection(sets.NewString(indexKeys...))
+		}
+	}
+	if keys == nil {
+		keys = sets.NewString(s.indexer.ListKeys()...)
+	}
+
+	objs := make([]Object, 0, keys.Len())
+	for _, key := range keys.List() {
+		if obj, exists, _ := s.indexer.GetByKey(key); exists {
+			out, err := s.copy(obj.(Object))
+			if err != nil {
+				return nil, err
+			}
+			objs = append(objs, out)
+		}
+	}
+	return objs, nil
+}
+
+// Update replaces object with obj. If resource version of obj is not empty,
+// it must equal to the current one, otherwise ErrResourceConflict returned.
+func (s *Store) Update(ctx context.Context, obj Object) (Object, error) {
+	if err := s.validateObject(obj); err != nil {
+		return nil, err
+	}
+	key, err := s.res.KeyFunc(obj)
+	if err != nil || key == "" {
+		return nil, errors.WrapF(code.ErrValidation, "compute key of %s fail:%v", s.res.Name, err)
+	}
+
+	s.lock.Lock()
+	old, err := s.checkVersionLocked(key, obj.GetObjectMeta().ResourceVersion)
+	if err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	if s.res.Hooks.BeforeUpdate != nil {
+		if err := s.beforeHook(func(old Object) error { return s.res.Hooks.BeforeUpdate(ctx, old, obj) }, old); err != nil {
+			s.lock.Unlock()
+			return nil, err
+		}
+	}
+	obj, err = s.copy(obj)
+	if err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	meta := obj.GetObjectMeta()
+	meta.CreateTime = old.GetObjectMeta().CreateTime
+	meta.UpdateTime = time.Now()
+	_ = s.indexer.Update(obj)
+	s.lock.Unlock()
+
+	log.F(ctx).Infof("%s %s updated", s.res.Name, key)
+	s.afterHook(ctx, s.res.Hooks.AfterUpdate, obj)
+	return s.copy(obj)
+}
+
+// Patch applies json merge patch(RFC 7386) to object. If patch contains resource version,
+// it must equal to the current one.
+func (s *Store) Patch(ctx context.Context, key string, patch []byte) (Object, error) {
+	return s.patchWithVersion(ctx, key, patch, "")
+}
+
+// patchWithVersion is like Patch, non-empty resourceVersion takes precedence over the one in patch.
+func (s *Store) patchWithVersion(ctx context.Context, key string, patch []byte, resourceVersion string) (Object, error) {
+	var patchMap map[string]interface{}
+	if err := json.Unmarshal(patch, &patchMap); err != nil {
+		return nil, errors.WrapError(code.ErrBind, err)
+	}
+
+	current, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(current)
+	if err != nil {
+		return nil, errors.WrapError(code.ErrEncodingJSON, err)
+	}
+	var currentMap map[string]interface{}
+	if err := json.Unmarshal(data, &currentMap); err != nil {
+		return nil, errors.WrapError(code.ErrDecodingJSON, err)
+	}
+	// resource version in patch takes precedence, otherwise the one read above
+	// ensures object isn't modified between read and update.
+	merged := mergePatch(currentMap, patchMap)
+	data, err = json.Marshal(merged)
+	if err != nil {
+		return nil, errors.WrapError(code.ErrEncodingJSON, err)
+	}
+	obj := s.res.New()
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, errors.WrapError(code.ErrBind, err)
+	}
+
+	if newKey, err := s.res.KeyFunc(obj); err != nil || newKey != key {
+		return nil, errors.WrapF(code.ErrValidation, "key of %s is not allowed to change", s.res.Name)
+	}
+	if resourceVersion != "" {
+		obj.GetObjectMeta().ResourceVersion = resourceVersion
+	}
+	return s.Update(ctx, obj)
+}
+
+// Delete removes object by key. If resourceVersion is not empty, it must equal to the current one.
+func (s *Store) Delete(ctx context.Context, key, resourceVersion string) error {
+	s.lock.Lock()
+	old, err := s.checkVersionLocked(key, resourceVersion)
+	if err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	if s.res.Hooks.BeforeDelete != nil {
+		if err := s.beforeHook(func(old Object) error { return s.res.Hooks.BeforeDelete(ctx, old) }, old); err != nil {
+			s.lock.Unlock()
+			return err
+		}
+	}
+	_ = s.indexer.Delete(old)
+	s.lock.Unlock()
+
+	log.F(ctx).Infof("%s %s deleted", s.res.Name, key)
+	s.afterHook(ctx, s.res.Hooks.AfterDelete, old)
+	return nil
+}
+
+func (s *Store) validateObject(obj Object) error {
+	if s.res.Validate == nil {
+		return nil
+	}
+	if err := s.res.Validate(obj); err != nil {
+		if errors.FromError(err).Code() == code.ErrUnknown {
+			return errors.WrapError(code.ErrValidation, err)
+		}
+		return errors.UpdateStack(err)
+	}
+	return nil
+}
+
+func (s *Store) checkVersionLocked(key, resourceVersion string) (Object, error) {
+	item, exists, _ := s.indexer.GetByKey(key)
+	if !exists {
+		return nil, errors.WrapF(code.ErrResourceNotFound, "%s %s not found", s.res.Name, key)
+	}
+	old := item.(Object)
+	if resourceVersion != "" && resourceVersion != old.GetObjectMeta().ResourceVersion {
+		return nil, errors.WrapF(code.ErrResourceConflict,
+			"%s %s has been modified, resource version %s, current %s",
+			s.res.Name, key, resourceVersion, old.GetObjectMeta().ResourceVersion)
+	}
+	return old, nil
+}
+
+// beforeHook calls hook with a copy of stored object.
+func (s *Store) beforeHook(hook func(old Object) error, old Object) error {
+	old, err := s.copy(old)
+	if err != nil {
+		return err
+	}
+	if err := hook(old); err != nil {
+		return errors.UpdateStack(err)
+	}
+	return nil
+}
+
+// afterHook calls hook with a copy of stored object if hook is set.
+func (s *Store) afterHook(ctx context.Context, hook func(ctx context.Context, obj Object), obj Object) {
+	if hook == nil {
+		return
+	}
+	obj, err := s.copy(obj)
+	if err != nil {
+		log.F(ctx).Errorf("skip hook of %s:%v", s.res.Name, err)
+		return
+	}
+	hook(ctx, obj)
+}
+
+// copy deep copies object by json, objects in indexer must never be modified.
+func (s *Store) copy(obj Object) (Object, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.WrapF(code.ErrEncodingJSON, "marshal %s object fail:%v", s.res.Name, err)
+	}
+	out := s.res.New()
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, errors.WrapF(code.ErrEncodingJSON, "unmarshal %s object fail:%v", s.res.Name, err)
+	}
+	return out, nil
+}
+
+// mergePatch applies json merge patch to target, null in patch deletes the field.
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{})
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(target, k)
+			continue
+		}
+		if pm, ok := v.(map[string]interface{}); ok {
+			tm, _ := target[k].(map[string]interface{})
+			target[k] = mergePatch(tm, pm)
+			continue
+		}
+		target[k] = v
+	}
+	return target
+}
@@ -0,0 +1,96 @@
+package resource
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/wangweihong/eazycloud/pkg/cache"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/sets"
+)
+
+// WatchEvent is a change of resource object.
+type WatchEvent struct {
+	Type            cache.EventType `json:"type"`
+	ResourceVersion string          `json:"resource_version"`
+	Object          Object          `json:"object"`
+}
+
+// Watch returns a channel receiving changes after resourceVersion, which match all entries of selector.
+// Empty resourceVersion means watching from now on. ErrResourceVersionTooOld is returned if changes after
+// resourceVersion have been evicted from history, caller should list again and watch from the returned version.
+// Channel is closed when ctx done or watcher is too slow, caller should watch again from the last version received.
+func (s *Store) Watch(ctx context.Context, resourceVersion string, selector map[string]string) (<-chan WatchEvent, error) {
+	var version uint64
+	if resourceVersion != "" {
+		var err error
+		if version, err = strconv.ParseUint(resourceVersion, 10, 64); err != nil {
+			return nil, errors.WrapF(code.ErrValidation, "invalid resource version `%s`", resourceVersion)
+		}
+	}
+	for name := range selector {
+		if _, ok := s.res.Indexers[name]; !ok {
+			return nil, errors.WrapF(code.ErrValidation, "%s has no index `%s`", s.res.Name, name)
+		}
+	}
+
+	w, err := s.indexer.Watch(version)
+	if err != nil {
+		if err == cache.ErrResourceVersionTooOld {
+			return nil, errors.WrapF(code.ErrResourceVersionTooOld,
+				"resource version %s of %s is too old, current %s", resourceVersion, s.res.Name, s.ResourceVersion())
+		}
+		return nil, errors.WrapError(code.ErrUnknown, err)
+	}
+
+	ch := make(chan WatchEvent)
+	go func() {
+		defer close(ch)
+		defer w.Stop()
+		for {
+			select {
+			case e, ok := <-w.ResultChan():
+				if !ok {
+					log.F(ctx).Warnf("watch %s closed by store", s.res.Name)
+					return
+				}
+				if !s.match(e.Object, selector) {
+					continue
+				}
+				obj, err := s.copy(e.Object.(Object))
+				if err != nil {
+					log.F(ctx).Errorf("watch %s closed:%v", s.res.Name, err)
+					return
+				}
+				event := WatchEvent{
+					Type:            e.Type,
+					ResourceVersion: strconv.FormatUint(e.ResourceVersion, 10),
+					Object:          obj,
+				}
+				// deleted object carries its last version, use the version of deletion instead
+				event.Object.GetObjectMeta().ResourceVersion = event.ResourceVersion
+				select {
+				case ch <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// match returns true if obj matches all entries of selector.
+func (s *Store) match(obj interface{}, selector map[string]string) bool {
+	for name, value := range selector {
+		values, err := s.res.Indexers[name](obj)
+		if err != nil || !sets.NewString(values...).Has(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,228 @@
+package httpsvr
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gosuri/uitable"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// RoutesPath is the path of route introspection api.
+const RoutesPath = "/debug/routes"
+
+// RouteMeta describes route attributes which can not be derived from gin router, such as
+// authentication requirement and deprecation status.
+type RouteMeta struct {
+	// Auth describes authentication requirement of route, such as `jwt`,`basic`.
+	// Empty means route can be accessed anonymously.
+	Auth string `json:"auth,omitempty"`
+	// Deprecated marks route is deprecated and will be removed in the future.
+	Deprecated bool `json:"deprecated,omitempty"`
+	// Sunset is the time after which route will be removed.
+	Sunset *time.Time `json:"sunset,omitempty"`
+	// Link refer to the document of deprecated route.
+	Link string `json:"link,omitempty"`
+	// RejectAfterSunset reject request after sunset.
+	RejectAfterSunset bool `json:"reject_after_sunset,omitempty"`
+}
+
+// RouteInfo represents a route served by GenericHTTPServer.
+type RouteInfo struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Handler     string   `json:"handler"`
+	Middlewares []string `json:"middlewares"`
+	RouteMeta
+}
+
+// routeMetaStore stores route meta keyed by `METHOD path`, and route groups created by server.
+type routeMetaStore struct {
+	lock   sync.RWMutex
+	metas  map[string]RouteMeta
+	groups []*gin.RouterGroup
+}
+
+func newRouteMetaStore() *routeMetaStore {
+	return &routeMetaStore{metas: make(map[string]RouteMeta)}
+}
+
+func routeKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+func (r *routeMetaStore) set(method, path string, meta RouteMeta) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.metas[routeKey(method, path)] = meta
+}
+
+func (r *routeMetaStore) update(method, path string, f func(meta *RouteMeta)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	meta := r.metas[routeKey(method, path)]
+	f(&meta)
+	r.metas[routeKey(method, path)] = meta
+}
+
+func (r *routeMetaStore) get(method, path string) (RouteMeta, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	meta, ok := r.metas[routeKey(method, path)]
+	return meta, ok
+}
+
+func (r *routeMetaStore) addGroup(g *gin.RouterGroup) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.groups = append(r.groups, g)
+}
+
+// group returns the group with the longest base path which path is under, nil if not found.
+func (r *routeMetaStore) group(path string) *gin.RouterGroup {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var found *gin.RouterGroup
+	for _, g := range r.groups {
+		base := strings.TrimSuffix(g.BasePath(), "/")
+		if path != base && !strings.HasPrefix(path, base+"/") {
+			continue
+		}
+		if found == nil || len(g.BasePath()) > len(found.BasePath()) {
+			found = g
+		}
+	}
+	return found
+}
+
+// Group creates a route group like gin.Engine.Group and records it, so that middlewares of routes
+// in group are shown in route table. Routes of sub groups are shown with middlewares of the recorded group.
+func (s *GenericHTTPServer) Group(relativePath string, handlers ...gin.HandlerFunc) *gin.RouterGroup {
+	g := s.Engine.Group(relativePath, handlers...)
+	s.routeMetas.addGroup(g)
+	return g
+}
+
+// SetRouteMeta record meta of route `method path`, route meta will be shown in route table.
+// path must be the full path which route registered with, such as `/v1/users/:id`.
+func (s *GenericHTTPServer) SetRouteMeta(method, path string, meta RouteMeta) {
+	s.routeMetas.set(method, path, meta)
+}
+
+// GetRouteMeta return meta of route `method path`.
+func (s *GenericHTTPServer) GetRouteMeta(method, path string) (RouteMeta, bool) {
+	return s.routeMetas.get(method, path)
+}
+
+// Routes returns all routes served by server, sorted by path and method.
+// Middlewares of route are global middlewares, or middlewares of the group created by Group which route is under.
+// Middlewares passed along with route handler are not shown.
+func (s *GenericHTTPServer) Routes() []RouteInfo {
+	routes := s.Engine.Routes()
+	infos := make([]RouteInfo, 0, len(routes))
+	for _, r := range routes {
+		info := RouteInfo{
+			Method:      r.Method,
+			Path:        r.Path,
+			Handler:     shortFuncName(r.Handler),
+			Middlewares: []string{},
+		}
+
+		chain := s.Engine.Handlers
+		if g := s.routeMetas.group(r.Path); g != nil {
+			chain = g.Handlers
+		}
+		for _, h := range chain {
+			info.Middlewares = append(info.Middlewares, funcName(h))
+		}
+
+		if meta, ok := s.routeMetas.get(r.Method, r.Path); ok {
+			info.RouteMeta = meta
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Path == infos[j].Path {
+			return infos[i].Method < infos[j].Method
+		}
+		return infos[i].Path < infos[j].Path
+	})
+	return infos
+}
+
+// PrintRoutes writes route table into w.
+func (s *GenericHTTPServer) PrintRoutes(w io.Writer) {
+	fmt.Fprintf(w, "%v", routeTable(s.Routes()))
+}
+
+func routeTable(routes []RouteInfo) *uitable.Table {
+	table := uitable.New()
+	table.Separator = "  "
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("METHOD", "PATH", "HANDLER", "MIDDLEWARES", "AUTH", "DEPRECATED")
+	for _, r := range routes {
+		deprecated := "-"
+		if r.Deprecated {
+			deprecated = "yes"
+			if r.Sunset != nil {
+				deprecated = fmt.Sprintf("sunset %s", r.Sunset.Format(time.RFC3339))
+			}
+		}
+		auth := r.Auth
+		if auth == "" {
+			auth = "-"
+		}
+		middlewares := strings.Join(r.Middlewares, ",")
+		if middlewares == "" {
+			middlewares = "-"
+		}
+		table.AddRow(r.Method, r.Path, r.Handler, middlewares, auth, deprecated)
+	}
+	return table
+}
+
+// installRoutesAPI install route introspection api, which is protected by admin guard.
+// `?format=table` returns route table in plain text, otherwise in json.
+func (s *GenericHTTPServer) installRoutesAPI() {
+	s.GET(RoutesPath, s.adminGuard, func(c *gin.Context) {
+		if c.Query("format") == "table" {
+			c.String(http.StatusOK, "%v\n", routeTable(s.Routes()))
+			return
+		}
+		c.JSON(http.StatusOK, s.Routes())
+	})
+}
+
+// logRoutes print route table into log when server start.
+func (s *GenericHTTPServer) logRoutes() {
+	var sb strings.Builder
+	s.PrintRoutes(&sb)
+	log.Infof("Route table:\n%s", sb.String())
+}
+
+func funcName(h gin.HandlerFunc) string {
+	return shortFuncName(runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name())
+}
+
+// shortFuncName trim package path of function name,
+// `github.com/wangweihong/eazycloud/pkg/httpsvr/genericmiddleware.RequestID.func1` will be
+// `genericmiddleware.RequestID.func1`.
+func shortFuncName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
@@ -9,17 +9,26 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/wangweihong/eazycloud/pkg/authz"
 	"github.com/wangweihong/eazycloud/pkg/debug"
 
 	"github.com/wangweihong/eazycloud/pkg/httpsvr/profiling"
 
 	"github.com/wangweihong/eazycloud/pkg/httpsvr/genericmiddleware"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/resource"
 
 	ginprometheus "github.com/zsais/go-gin-prometheus"
 
+	"github.com/wangweihong/eazycloud/pkg/faultinject"
 	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
+	"github.com/wangweihong/eazycloud/pkg/sets"
+	"github.com/wangweihong/eazycloud/pkg/skipper"
+	"github.com/wangweihong/eazycloud/pkg/util/netutil"
 	"github.com/wangweihong/eazycloud/pkg/version"
 
 	cryptotls "crypto/tls"
@@ -37,6 +46,12 @@ type GenericHTTPServer struct {
 	// which middleware want to install
 	// 注意中间件顺序的影响
 	middlewares []string
+	// limit of request body, installed before middlewares
+	maxRequestBodySize int64
+	compression        *CompressionInfo
+	// resolve real client ip with headers from trusted proxies
+	trustedProxies *netutil.TrustedProxies
+	proxyProtocol  bool
 
 	// SecureServingInfo holds configuration of the TLS server.
 	SecureServingInfo *SecureServingInfo
@@ -48,10 +63,35 @@ type GenericHTTPServer struct {
 	enableMetrics bool
 	profiling     *FeatureProfilingInfo
 	version       bool
+	// install route introspection api and print route table when server start
+	routes     bool
+	routeMetas *routeMetaStore
+	// guard of admin apis under `/debug/`
+	adminGuard gin.HandlerFunc
+	// api versions served by VersionGroup
+	apiVersions *apiVersioning
+	// call counts of deprecated routes
+	deprecationUsage *deprecationUsage
+
+	// authorizer is created from policy file or shared, nil if authorization is disabled
+	authorizer *authz.Authorizer
+	// ownAuthorizer is true if authorizer is created by server, which stops it when closed
+	ownAuthorizer bool
+	// maintenance switch installed before middlewares, nil if disabled
+	maintenance           *maintenance.Switch
+	stopMaintenanceSignal func()
+	// fault injector installed after middlewares, nil if disabled
+	faultInjector *faultinject.Injector
+	// mirror requests to shadow backend, nil if disabled
+	mirror *genericmiddleware.MirrorConfig
 
 	insecureServer, secureServer *http.Server
+	// certificate of secure server, replaced by ReloadCertificate
+	certificate atomic.Value // *cryptotls.Certificate
 
 	runtimeDebug *debug.RuntimeDebugInfo
+	// streams of this server, drained when closed
+	streamTracker *ginx.StreamTracker
 }
 
 // 安装通用服务的中间件和api
@@ -97,6 +137,27 @@ func (s *GenericHTTPServer) InstallAPIs() {
 			c.JSON(http.StatusOK, version.Get())
 		})
 	}
+
+	// install route introspection api
+	// 不同于gin debug模式下的路由打印, 该接口在release模式下仍然可用
+	if s.routes {
+		s.installRoutesAPI()
+	}
+
+	// install maintenance admin api
+	if s.maintenance != nil {
+		s.installMaintenanceAPI()
+	}
+
+	// install fault injection admin api
+	if s.faultInjector != nil {
+		s.installFaultInjectionAPI()
+	}
+
+	// install authorization decision test api
+	if s.authorizer != nil {
+		s.installAuthzAPI()
+	}
 }
 
 // Setup do some setup work for gin engine.
@@ -109,6 +170,33 @@ func (s *GenericHTTPServer) Setup() {
 
 // InstallMiddlewares install generic middlewares.
 func (s *GenericHTTPServer) InstallMiddlewares() {
+	// streams created by handlers are registered to tracker of this server
+	s.Use(func(c *gin.Context) {
+		ginx.SetStreamTracker(c, s.streamTracker)
+		c.Next()
+	})
+	if s.maintenance != nil {
+		log.Infof("install maintenance, mode:%s", s.maintenance.State().Mode)
+		s.Use(genericmiddleware.Maintenance(s.maintenance))
+	}
+	if s.trustedProxies.Len() > 0 {
+		log.Infof("install real ip resolution, trusted proxies: %v", s.trustedProxies)
+		s.Use(genericmiddleware.RealIP(s.trustedProxies))
+	}
+	if s.maxRequestBodySize > 0 {
+		log.Infof("install request body limit: %d bytes", s.maxRequestBodySize)
+		s.Use(genericmiddleware.DefaultBodyLimit(s.maxRequestBodySize))
+	}
+	if s.compression != nil && s.compression.Enable {
+		log.Infof("install response compression, level:%d, min size:%d",
+			s.compression.Level, s.compression.MinSize)
+		s.Use(genericmiddleware.Compress(genericmiddleware.CompressConfig{
+			Level:        s.compression.Level,
+			MinSize:      s.compression.MinSize,
+			ContentTypes: s.compression.ContentTypes,
+		}))
+	}
+
 	// install custom middlewares
 	for _, m := range s.middlewares {
 		mw, ok := genericmiddleware.MiddlewareList[m]
@@ -117,10 +205,30 @@ func (s *GenericHTTPServer) InstallMiddlewares() {
 
 			continue
 		}
+		if m == genericmiddleware.MWNameCopyBody {
+			// limit copied body with server config
+			mw = genericmiddleware.CopyBodyMiddlewareWithLimit(s.maxRequestBodySize)
+		}
 
 		log.Infof("install middleware: %s", m)
 		s.Use(mw)
 	}
+
+	// deprecated routes are marked after installed, so always install it
+	s.Use(s.DeprecationMiddleware())
+
+	if s.faultInjector != nil {
+		log.Warn("install fault injection, never enable it in production")
+		s.Use(genericmiddleware.FaultInject(s.faultInjector, skipper.AllowPathPrefixSkipper("/debug/")))
+	}
+	if s.mirror != nil {
+		log.Infof("install traffic mirroring to %s, percentage:%v", s.mirror.Client.GetAddr(), s.mirror.Percentage)
+		// mirror reuses body copied by copybody middleware if installed
+		if !sets.NewString(s.middlewares...).Has(genericmiddleware.MWNameCopyBody) {
+			s.Use(genericmiddleware.CopyBodyMiddlewareWithLimit(s.maxRequestBodySize))
+		}
+		s.Use(genericmiddleware.Mirror(*s.mirror, skipper.AllowPathPrefixSkipper("/debug/")))
+	}
 }
 
 func (s *GenericHTTPServer) InstallRuntimeDebug() {
@@ -149,6 +257,10 @@ func (s *GenericHTTPServer) Run() error {
 	// For scalability, use custom HTTP configuration mode here
 	var eg errgroup.Group
 
+	if s.routes {
+		s.logRoutes()
+	}
+
 	// Initializing the server in a goroutine so that
 	// it won't block the graceful shutdown handling below
 	if s.InsecureServingInfo.Required {
@@ -163,7 +275,14 @@ func (s *GenericHTTPServer) Run() error {
 		eg.Go(func() error {
 			log.Infof("Start to listening the incoming requests on http address: %s", s.InsecureServingInfo.Address)
 
-			if err := s.insecureServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ln, err := s.listen(s.insecureServer.Addr)
+			if err != nil {
+				log.Fatal(err.Error())
+
+				return err
+			}
+
+			if err := s.insecureServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				log.Fatal(err.Error())
 
 				return err
@@ -176,19 +295,18 @@ func (s *GenericHTTPServer) Run() error {
 	}
 
 	if s.SecureServingInfo.Required {
-		cert, err := cryptotls.X509KeyPair(
-			[]byte(s.SecureServingInfo.CertKey.Cert),
-			[]byte(s.SecureServingInfo.CertKey.Key),
-		)
-		if err != nil {
-			log.Fatalf("Failed to generate credentials %s", err.Error())
+		// certificate may be reloaded before server run
+		if s.certificate.Load() == nil {
+			if err := s.ReloadCertificate(s.SecureServingInfo.CertKey); err != nil {
+				log.Fatalf("Failed to generate credentials %s", err.Error())
+			}
 		}
 		// For scalability, use custom HTTP configuration mode here
 		s.secureServer = &http.Server{
 			Addr:    s.SecureServingInfo.Address(),
 			Handler: s,
 			TLSConfig: &cryptotls.Config{
-				Certificates: []cryptotls.Certificate{cert},
+				GetCertificate: s.getCertificate,
 			},
 			// ReadTimeout:    10 * time.Second,
 			// WriteTimeout:   10 * time.Second,
@@ -198,7 +316,14 @@ func (s *GenericHTTPServer) Run() error {
 		eg.Go(func() error {
 			log.Infof("Start to listening the incoming requests on https address: %s", s.SecureServingInfo.Address())
 
-			if err := s.secureServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ln, err := s.listen(s.secureServer.Addr)
+			if err != nil {
+				log.Fatal(err.Error())
+
+				return err
+			}
+
+			if err := s.secureServer.ServeTLS(ln, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				log.Fatal(err.Error())
 
 				return err
@@ -235,6 +360,37 @@ func (s *GenericHTTPServer) Run() error {
 	return nil
 }
 
+// listen listens on addr, wraps listener with PROXY protocol support if enabled.
+func (s *GenericHTTPServer) listen(addr string) (net.Listener, error) {
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.proxyProtocol {
+		log.Infof("enable proxy protocol on %s", addr)
+		return netutil.NewProxyProtocolListener(ln, s.trustedProxies, 0), nil
+	}
+	return ln, nil
+}
+
+// InstallResource creates a store of res and mounts its CRUD routes under `<prefix>/<resource name>`.
+func (s *GenericHTTPServer) InstallResource(prefix string, res *resource.Resource) (*resource.Store, error) {
+	store, err := resource.NewStore(res)
+	if err != nil {
+		return nil, err
+	}
+	resource.Install(s.Group(prefix), store)
+	return store, nil
+}
+
+// StreamTracker returns the tracker of streaming connections such as SSE and WebSocket served by the server.
+func (s *GenericHTTPServer) StreamTracker() *ginx.StreamTracker {
+	return s.streamTracker
+}
+
 // Close graceful shutdown the api server.
 func (s *GenericHTTPServer) Close() {
 	// The context is used to inform the server it has 10 seconds to finish
@@ -242,6 +398,11 @@ func (s *GenericHTTPServer) Close() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Shutdown doesn't interrupt streaming connections such as SSE and WebSocket, notify them to finish first.
+	if err := s.streamTracker.Drain(ctx); err != nil {
+		log.Warnf("Drain streams failed: %s", err.Error())
+	}
+
 	if s.SecureServingInfo.Required {
 		if err := s.secureServer.Shutdown(ctx); err != nil {
 			log.Warnf("Shutdown secure server failed: %s", err.Error())
@@ -253,6 +414,14 @@ func (s *GenericHTTPServer) Close() {
 			log.Warnf("Shutdown insecure server failed: %s", err.Error())
 		}
 	}
+
+	if s.ownAuthorizer {
+		s.authorizer.Stop()
+	}
+
+	if s.stopMaintenanceSignal != nil {
+		s.stopMaintenanceSignal()
+	}
 }
 
 // ping pings the http server to make sure the router is working.
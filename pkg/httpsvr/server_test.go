@@ -1,14 +1,41 @@
 package httpsvr_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
 	cryptotls "crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/wangweihong/eazycloud/pkg/authz"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/faultinject"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	signinterceptor "github.com/wangweihong/eazycloud/pkg/httpcli/interceptorcli/signature"
 	"github.com/wangweihong/eazycloud/pkg/httpsvr"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/genericmiddleware"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
+	"github.com/wangweihong/eazycloud/pkg/signature"
 
 	. "github.com/smartystreets/goconvey/convey"
 
@@ -122,3 +149,831 @@ func TestGenericHTTPServer_InstallAPIs(t *testing.T) {
 		})
 	})
 }
+
+func TestGenericHTTPServer_Routes(t *testing.T) {
+	Convey("路由查看", t, func() {
+		conf := httpsvr.NewConfig()
+		conf.EnableMetrics = false
+		conf.Profiling.EnableProfiling = false
+		conf.Routes = true
+		conf.AdminToken = "admin"
+
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+
+		s.GET("/v1/users/:id", func(c *gin.Context) {})
+		s.SetRouteMeta(http.MethodGet, "/v1/users/:id", httpsvr.RouteMeta{Auth: "jwt", Deprecated: true})
+		s.Group("/v2", genericmiddleware.NoCache).GET("/users/:id", func(c *gin.Context) {})
+
+		var routes []httpsvr.RouteInfo
+		{
+			req, _ := http.NewRequest(http.MethodGet, httpsvr.RoutesPath, nil)
+			req.RemoteAddr = "127.0.0.1:50000"
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, 200)
+			So(json.Unmarshal(w.Body.Bytes(), &routes), ShouldBeNil)
+		}
+
+		var found bool
+		for _, r := range routes {
+			if r.Path == "/v1/users/:id" {
+				found = true
+				So(r.Method, ShouldEqual, http.MethodGet)
+				So(r.Auth, ShouldEqual, "jwt")
+				So(r.Deprecated, ShouldBeTrue)
+				So(r.Middlewares, ShouldHaveLength, len(s.Engine.Handlers))
+			}
+			if r.Path == "/v2/users/:id" {
+				So(r.Middlewares, ShouldHaveLength, len(s.Engine.Handlers)+1)
+				So(r.Middlewares[len(s.Engine.Handlers)], ShouldEqual, "genericmiddleware.NoCache")
+			}
+		}
+		So(found, ShouldBeTrue)
+
+		{
+			req, _ := http.NewRequest(http.MethodGet, httpsvr.RoutesPath+"?format=table", nil)
+			req.RemoteAddr = "127.0.0.1:50000"
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, 200)
+			So(w.Body.String(), ShouldContainSubstring, "/v1/users/:id")
+		}
+
+		Convey("远程访问需要管理令牌", func() {
+			req := httptest.NewRequest(http.MethodGet, httpsvr.RoutesPath, nil)
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+
+			req.Header.Set("Authorization", "Bearer admin")
+			w = httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("同主机代理转发的请求仅在代理受信任时视为本地访问", func() {
+			serve := func(s *httpsvr.GenericHTTPServer, forwardedFor string) int {
+				req := httptest.NewRequest(http.MethodGet, httpsvr.RoutesPath, nil)
+				req.RemoteAddr = "127.0.0.1:50000"
+				req.Header.Set("X-Forwarded-For", forwardedFor)
+				w := httptest.NewRecorder()
+				s.Engine.ServeHTTP(w, req)
+				return w.Code
+			}
+			So(serve(s, "1.2.3.4"), ShouldEqual, http.StatusForbidden)
+			So(serve(s, "127.0.0.1"), ShouldEqual, http.StatusForbidden)
+
+			conf.TrustedProxies = []string{"127.0.0.1"}
+			trusted, err := conf.Complete().New()
+			So(err, ShouldBeNil)
+			So(serve(trusted, "1.2.3.4"), ShouldEqual, http.StatusForbidden)
+			So(serve(trusted, "127.0.0.1"), ShouldEqual, http.StatusOK)
+		})
+	})
+}
+
+func TestGenericHTTPServer_VersionGroup(t *testing.T) {
+	Convey("API版本", t, func() {
+		conf := httpsvr.NewConfig()
+		conf.EnableMetrics = false
+		conf.Profiling.EnableProfiling = false
+
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+
+		v1 := s.VersionGroup("/api", "v1")
+		v1.GET("/users", func(c *gin.Context) { c.String(http.StatusOK, "v1") })
+		v2 := s.VersionGroup("/api", "v2")
+		v2.GET("/users", func(c *gin.Context) { c.String(http.StatusOK, "v2") })
+		s.SetDefaultVersion("/api", "v1")
+
+		serve := func(path, version string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, path, nil)
+			if version != "" {
+				req.Header.Set(httpsvr.HeaderAcceptVersion, version)
+			}
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("路径前缀", func() {
+			w := serve("/api/v2/users", "")
+			So(w.Code, ShouldEqual, 200)
+			So(w.Body.String(), ShouldEqual, "v2")
+			So(w.Header().Get(httpsvr.HeaderAPIVersion), ShouldEqual, "v2")
+		})
+
+		Convey("版本头部", func() {
+			w := serve("/api/users", "v2")
+			So(w.Body.String(), ShouldEqual, "v2")
+
+			w = serve("/api/users", "")
+			So(w.Body.String(), ShouldEqual, "v1")
+
+			w = serve("/api/users", "v3")
+			So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("弃用路由", func() {
+			sunset := time.Now().Add(-time.Hour)
+			s.Deprecate(http.MethodGet, "/api/v1/users", httpsvr.Deprecation{
+				Sunset: &sunset,
+				Link:   "/api/v2/users",
+			})
+
+			w := serve("/api/v1/users", "")
+			So(w.Code, ShouldEqual, 200)
+			So(w.Header().Get(httpsvr.HeaderDeprecation), ShouldEqual, "true")
+			So(w.Header().Get(httpsvr.HeaderSunset), ShouldNotBeEmpty)
+			So(w.Header().Get(httpsvr.HeaderLink), ShouldContainSubstring, "/api/v2/users")
+			So(s.DeprecationUsage()["GET /api/v1/users"], ShouldNotBeEmpty)
+
+			s.Deprecate(http.MethodGet, "/api/v1/users", httpsvr.Deprecation{
+				Sunset:            &sunset,
+				RejectAfterSunset: true,
+			})
+			w = serve("/api/v1/users", "")
+			So(w.Code, ShouldEqual, http.StatusGone)
+		})
+
+		Convey("根路径版本分组不改写通用接口", func() {
+			s.VersionGroup("/", "v1").GET("/items", func(c *gin.Context) { c.String(http.StatusOK, "v1 items") })
+			s.SetDefaultVersion("/", "v1")
+			s.GET("/debug/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+			So(serve("/items", "").Body.String(), ShouldEqual, "v1 items")
+			w := serve("/healthz", "")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Header().Get(httpsvr.HeaderAPIVersion), ShouldBeEmpty)
+			So(serve("/debug/ping", "").Body.String(), ShouldEqual, "pong")
+		})
+
+		Convey("版本分组外的弃用路由", func() {
+			s.GET("/legacy", func(c *gin.Context) { c.String(http.StatusOK, "legacy") })
+			s.Deprecate(http.MethodGet, "/legacy", httpsvr.Deprecation{Link: "/api/v2/users"})
+
+			w := serve("/legacy", "")
+			So(w.Code, ShouldEqual, 200)
+			So(w.Header().Get(httpsvr.HeaderDeprecation), ShouldEqual, "true")
+			So(s.DeprecationUsage()["GET /legacy"], ShouldNotBeEmpty)
+		})
+	})
+}
+
+func TestGenericHTTPServer_CompressionAndBodyLimit(t *testing.T) {
+	Convey("响应压缩和请求体限制", t, func() {
+		conf := httpsvr.NewConfig()
+		conf.MaxRequestBodySize = 16
+		conf.Compression.Enable = true
+		conf.Compression.MinSize = 256
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+
+		large := strings.Repeat("eazycloud", 100)
+		s.GET("/large", func(c *gin.Context) { ginx.WriteResponse(c, nil, large) })
+		s.GET("/small", func(c *gin.Context) { ginx.WriteResponse(c, nil, "small") })
+		echo := func(c *gin.Context) {
+			var data map[string]string
+			if err := ginx.ParseJSON(c, &data); err != nil {
+				ginx.WriteResponse(c, err, nil)
+				return
+			}
+			ginx.WriteResponse(c, nil, data)
+		}
+		s.POST("/echo", echo)
+		s.POST("/upload", genericmiddleware.BodyLimit(1024), echo)
+
+		get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			return w
+		}
+		post := func(path, body string, chunked bool) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+			if chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("按Accept-Encoding压缩", func() {
+			w := get("/large", "gzip, br;q=0.5")
+			So(w.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+			r, err := gzip.NewReader(w.Body)
+			So(err, ShouldBeNil)
+			data, err := ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldContainSubstring, large)
+
+			w = get("/large", "br, gzip")
+			So(w.Header().Get("Content-Encoding"), ShouldEqual, "br")
+			data, err = ioutil.ReadAll(brotli.NewReader(w.Body))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldContainSubstring, large)
+
+			So(get("/small", "gzip").Header().Get("Content-Encoding"), ShouldBeEmpty)
+			So(get("/large", "identity").Header().Get("Content-Encoding"), ShouldBeEmpty)
+		})
+
+		Convey("请求体超过限制", func() {
+			body := `{"name":"eazycloud"}`
+			So(post("/echo", body, false).Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(post("/echo", body, true).Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(post("/echo", `{"a":"b"}`, false).Code, ShouldEqual, http.StatusOK)
+			// 路由单独设置的限制覆盖全局限制
+			So(post("/upload", body, true).Code, ShouldEqual, http.StatusOK)
+			So(post("/upload", body, false).Code, ShouldEqual, http.StatusOK)
+			So(post("/upload", strings.Repeat("a", 2048), false).Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		})
+	})
+}
+
+func TestGenericHTTPServer_CopyBodyAndBodyLimit(t *testing.T) {
+	Convey("拷贝请求体和请求体限制", t, func() {
+		echo := func(c *gin.Context) {
+			data, err := ioutil.ReadAll(c.Request.Body)
+			if err != nil {
+				ginx.WriteResponse(c, err, nil)
+				return
+			}
+			ginx.WriteResponse(c, nil, len(data))
+		}
+		post := func(h http.Handler, path string, body []byte, encoding string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+			req.Header.Set("Content-Encoding", encoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("路由限制大于全局限制时仍然生效", func() {
+			conf := httpsvr.NewConfig()
+			conf.MaxRequestBodySize = 1024
+			conf.Middlewares = []string{genericmiddleware.MWNameCopyBody}
+			s, err := conf.Complete().New()
+			So(err, ShouldBeNil)
+			s.POST("/echo", echo)
+			s.POST("/upload", genericmiddleware.BodyLimit(8192), echo)
+
+			body := bytes.Repeat([]byte("a"), 4000)
+			w := post(s.Engine, "/upload", body, "")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldContainSubstring, "4000")
+			So(post(s.Engine, "/echo", body, "").Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(post(s.Engine, "/upload", bytes.Repeat([]byte("a"), 9000), "").Code,
+				ShouldEqual, http.StatusRequestEntityTooLarge)
+
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			_, _ = gw.Write(body)
+			_ = gw.Close()
+			w = post(s.Engine, "/upload", buf.Bytes(), "gzip")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldContainSubstring, "4000")
+		})
+
+		Convey("压缩数据超过限制时拒绝而不是截断", func() {
+			e := gin.New()
+			e.Use(genericmiddleware.CopyBodyMiddlewareWithLimit(1024))
+			e.POST("/echo", echo)
+
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			for i := 0; buf.Len() <= 4096; i++ {
+				_, _ = fmt.Fprintf(gw, "%x", sha256.Sum256([]byte(strconv.Itoa(i))))
+				_ = gw.Flush()
+			}
+			_ = gw.Close()
+			So(post(e, "/echo", buf.Bytes(), "gzip").Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(post(e, "/echo", []byte("not gzip"), "gzip").Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
+
+func TestGenericHTTPServer_StreamTracker(t *testing.T) {
+	Convey("每个服务使用独立的流跟踪器", t, func() {
+		newServer := func() *httpsvr.GenericHTTPServer {
+			conf := httpsvr.NewConfig()
+			conf.EnableMetrics = false
+			conf.Profiling.EnableProfiling = false
+			s, err := conf.Complete().New()
+			So(err, ShouldBeNil)
+			s.GET("/events", func(c *gin.Context) {
+				ginx.StreamSSE(c, func(ctx context.Context, stream *ginx.SSEStream) error {
+					return stream.Send(ginx.SSEvent{Data: "ok"})
+				})
+			})
+			return s
+		}
+		serve := func(s *httpsvr.GenericHTTPServer) int {
+			req, _ := http.NewRequest(http.MethodGet, "/events", nil)
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		s1, s2 := newServer(), newServer()
+		So(s1.StreamTracker(), ShouldNotEqual, s2.StreamTracker())
+		So(s1.StreamTracker().Drain(context.Background()), ShouldBeNil)
+		So(serve(s1), ShouldEqual, http.StatusServiceUnavailable)
+		So(serve(s2), ShouldEqual, http.StatusOK)
+	})
+}
+
+func TestGenericHTTPServer_ClientIP(t *testing.T) {
+	Convey("通过受信任代理解析客户端IP", t, func() {
+		conf := httpsvr.NewConfig()
+		conf.TrustedProxies = []string{"10.0.0.0/8", "fd00::1"}
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+
+		s.GET("/ip", func(c *gin.Context) {
+			fields, _ := c.Get(log.FieldKeyCtx{}.String())
+			c.JSON(http.StatusOK, map[string]interface{}{
+				"ip":     genericmiddleware.ClientIP(c),
+				"gin":    c.ClientIP(),
+				"fields": fields,
+			})
+		})
+
+		get := func(remote string, header map[string]string) map[string]interface{} {
+			req, _ := http.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = remote
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			var data map[string]interface{}
+			So(json.Unmarshal(w.Body.Bytes(), &data), ShouldBeNil)
+			return data
+		}
+
+		Convey("非受信任来源忽略转发头", func() {
+			data := get("1.2.3.4:1234", map[string]string{"X-Forwarded-For": "9.9.9.9", "X-Real-IP": "8.8.8.8"})
+			So(data["ip"], ShouldEqual, "1.2.3.4")
+			So(data["gin"], ShouldEqual, "1.2.3.4")
+		})
+
+		Convey("从右向左跳过受信任代理", func() {
+			data := get("10.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 9.9.9.9, 10.0.0.2"})
+			So(data["ip"], ShouldEqual, "9.9.9.9")
+			So(data["fields"], ShouldResemble, map[string]interface{}{string(log.KeyClientIP): "9.9.9.9"})
+
+			// 全部为受信任代理时取最左侧地址
+			So(get("10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.1.1.1, 10.0.0.2"})["ip"], ShouldEqual, "10.1.1.1")
+		})
+
+		Convey("Forwarded优先于X-Forwarded-For", func() {
+			data := get("[fd00::1]:1234", map[string]string{
+				"Forwarded":       `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"`,
+				"X-Forwarded-For": "9.9.9.9",
+			})
+			So(data["ip"], ShouldEqual, "2001:db8::1")
+
+			// 未知标识之后的地址无法验证
+			data = get("10.0.0.1:1234", map[string]string{"Forwarded": `for=192.0.2.60, for=_hidden, for=10.0.0.3`})
+			So(data["ip"], ShouldEqual, "10.0.0.3")
+		})
+
+		Convey("X-Real-IP", func() {
+			So(get("10.0.0.1:1234", map[string]string{"X-Real-IP": "8.8.8.8"})["ip"], ShouldEqual, "8.8.8.8")
+		})
+	})
+}
+
+func TestGenericHTTPServer_Authorize(t *testing.T) {
+	Convey("RBAC鉴权中间件", t, func() {
+		dir, err := ioutil.TempDir("", "authz")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "policy.yaml")
+		policy := `
+roles:
+- name: viewer
+  rules:
+  - verbs: [get]
+    resources: [widgets]
+bindings:
+- role: viewer
+  subjects: [alice]
+`
+		So(ioutil.WriteFile(file, []byte(policy), 0o600), ShouldBeNil)
+
+		conf := httpsvr.NewConfig()
+		conf.Authorization.PolicyFile = file
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+		defer s.Authorizer().Stop()
+
+		// 模拟认证中间件
+		authn := func(c *gin.Context) {
+			c.Set(string(log.KeyUsername), c.GetHeader("X-User"))
+		}
+		g := s.Group("/v1", authn, s.Authorize())
+		handler := func(c *gin.Context) { ginx.WriteResponse(c, nil, "ok") }
+		g.GET("/widgets/:id", handler)
+		g.DELETE("/widgets/:id", handler)
+
+		do := func(method, path, user string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, nil)
+			req.RemoteAddr = "127.0.0.1:50000"
+			req.Header.Set("X-User", user)
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			return w
+		}
+
+		Convey("拒绝无权限请求", func() {
+			So(do(http.MethodGet, "/v1/widgets/1", "alice").Code, ShouldEqual, http.StatusOK)
+			So(do(http.MethodGet, "/v1/widgets/1", "bob").Code, ShouldEqual, http.StatusForbidden)
+			So(do(http.MethodDelete, "/v1/widgets/1", "alice").Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("dry-run仅记录", func() {
+			s.Authorizer().SetDryRun(true)
+			So(do(http.MethodDelete, "/v1/widgets/1", "alice").Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("测试鉴权结果", func() {
+			w := do(http.MethodGet, httpsvr.AuthzPath+"?subject=alice&verb=get&route=/v1/widgets/:id", "")
+			So(w.Code, ShouldEqual, http.StatusOK)
+			var data struct {
+				Attributes authz.Attributes `json:"attributes"`
+				Decision   authz.Decision   `json:"decision"`
+			}
+			So(json.Unmarshal(w.Body.Bytes(), &data), ShouldBeNil)
+			So(data.Attributes.Resource, ShouldEqual, "widgets")
+			So(data.Decision.Allowed, ShouldBeTrue)
+			So(data.Decision.Role, ShouldEqual, "viewer")
+
+			So(do(http.MethodGet, httpsvr.AuthzPath+"?subject=alice", "").Code, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("远程测试鉴权结果需要管理令牌", func() {
+			req, _ := http.NewRequest(http.MethodGet, httpsvr.AuthzPath+"?subject=alice&verb=get&route=/v1/widgets/:id", nil)
+			req.RemoteAddr = "1.2.3.4:50000"
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("共享鉴权器", func() {
+			conf := httpsvr.NewConfig()
+			conf.Authorization.Authorizer = s.Authorizer()
+			shared, err := conf.Complete().New()
+			So(err, ShouldBeNil)
+			So(shared.Authorizer(), ShouldEqual, s.Authorizer())
+
+			shared.GET("/widgets/:id", authn, shared.Authorize(), handler)
+			req, _ := http.NewRequest(http.MethodGet, "/widgets/1", nil)
+			req.Header.Set("X-User", "bob")
+			w := httptest.NewRecorder()
+			shared.Engine.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+		})
+	})
+}
+
+func TestGenericHTTPServer_Maintenance(t *testing.T) {
+	Convey("维护模式", t, func() {
+		conf := httpsvr.NewConfig()
+		conf.Maintenance.Enable = true
+		conf.Maintenance.RetryAfter = 60
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+
+		handler := func(c *gin.Context) { ginx.WriteResponse(c, nil, "ok") }
+		s.GET("/widgets", handler)
+		s.POST("/widgets", handler)
+
+		do := func(method, path, body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+			req.RemoteAddr = "127.0.0.1:50000"
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			return w
+		}
+
+		So(do(http.MethodPost, "/widgets", "").Code, ShouldEqual, http.StatusOK)
+
+		Convey("通过管理接口切换到只读模式", func() {
+			w := do(http.MethodPatch, httpsvr.MaintenancePath, `{"mode":"readonly","reason":"migrating"}`)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			// 部分更新保留其它字段
+			So(s.Maintenance().State().RetryAfter, ShouldEqual, 60)
+
+			So(do(http.MethodGet, "/widgets", "").Code, ShouldEqual, http.StatusOK)
+			w = do(http.MethodPost, "/widgets", "")
+			So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+			So(w.Header().Get("Retry-After"), ShouldEqual, "60")
+			So(w.Body.String(), ShouldContainSubstring, "migrating")
+
+			// 完全维护模式下健康检查和管理接口仍可访问
+			So(do(http.MethodPatch, httpsvr.MaintenancePath, `{"mode":"full"}`).Code, ShouldEqual, http.StatusOK)
+			So(s.Maintenance().State().Reason, ShouldEqual, "migrating")
+			So(do(http.MethodGet, "/widgets", "").Code, ShouldEqual, http.StatusServiceUnavailable)
+			So(do(http.MethodGet, "/healthz", "").Code, ShouldEqual, http.StatusOK)
+			So(do(http.MethodPatch, httpsvr.MaintenancePath, `{"mode":"off"}`).Code, ShouldEqual, http.StatusOK)
+			So(do(http.MethodPost, "/widgets", "").Code, ShouldEqual, http.StatusOK)
+
+			So(do(http.MethodPatch, httpsvr.MaintenancePath, `{"mode":"unknown"}`).Code, ShouldEqual, http.StatusBadRequest)
+			So(s.Maintenance().State().Mode, ShouldEqual, maintenance.ModeOff)
+		})
+
+		Convey("远程修改维护状态需要管理令牌", func() {
+			req, _ := http.NewRequest(http.MethodPatch, httpsvr.MaintenancePath, bytes.NewBufferString(`{"mode":"full"}`))
+			req.RemoteAddr = "1.2.3.4:50000"
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+			So(s.Maintenance().State().Mode, ShouldEqual, maintenance.ModeOff)
+		})
+
+		Convey("超过并发上限时拒绝", func() {
+			So(s.Maintenance().Set(maintenance.State{MaxInFlight: 1, RetryAfter: 1}), ShouldBeNil)
+			release := make(chan struct{})
+			entered := make(chan struct{})
+			s.GET("/slow", func(c *gin.Context) {
+				close(entered)
+				<-release
+				ginx.WriteResponse(c, nil, "ok")
+			})
+			go do(http.MethodGet, "/slow", "")
+			<-entered
+
+			w := do(http.MethodGet, "/widgets", "")
+			So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+			So(w.Header().Get("Retry-After"), ShouldEqual, "1")
+			close(release)
+		})
+	})
+}
+
+func TestGenericHTTPServer_FaultInjection(t *testing.T) {
+	Convey("故障注入", t, func() {
+		conf := httpsvr.NewConfig()
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+		So(s.FaultInjector() == nil, ShouldEqual, !faultinject.BuildEnabled)
+
+		conf = httpsvr.NewConfig()
+		conf.FaultInjection.Enable = true
+		s, err = conf.Complete().New()
+		So(err, ShouldBeNil)
+		So(s.FaultInjector(), ShouldNotBeNil)
+
+		s.GET("/widgets", func(c *gin.Context) { ginx.WriteResponse(c, nil, "ok") })
+
+		do := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+			req.RemoteAddr = "127.0.0.1:50000"
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			return w
+		}
+
+		So(do(http.MethodGet, "/widgets", "", nil).Code, ShouldEqual, http.StatusOK)
+
+		w := do(http.MethodPut, httpsvr.FaultInjectionPath, fmt.Sprintf(
+			`[{"name":"abort","routes":["/widgets"],"headers":{"X-Fault":"abort"},"abortCode":%d}]`, code.ErrServiceOverloaded), nil)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldContainSubstring, "abort")
+
+		So(do(http.MethodGet, "/widgets", "", nil).Code, ShouldEqual, http.StatusOK)
+		w = do(http.MethodGet, "/widgets", "", map[string]string{"X-Fault": "abort"})
+		So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+		So(w.Body.String(), ShouldContainSubstring, "abort")
+
+		// 请求ID匹配, 延迟后继续处理
+		w = do(http.MethodPut, httpsvr.FaultInjectionPath,
+			`[{"name":"slow","requestIDs":["req-1"],"delay":"20ms"}]`, nil)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		start := time.Now()
+		So(do(http.MethodGet, "/widgets", "", map[string]string{"X-Request-ID": "req-1"}).Code, ShouldEqual, http.StatusOK)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+
+		So(do(http.MethodPut, httpsvr.FaultInjectionPath, `[{"name":"noop"}]`, nil).Code, ShouldEqual, http.StatusBadRequest)
+		So(do(http.MethodDelete, httpsvr.FaultInjectionPath, "", nil).Code, ShouldEqual, http.StatusOK)
+		So(s.FaultInjector().Rules(), ShouldBeEmpty)
+
+		// 远程修改故障规则需要管理令牌
+		req, _ := http.NewRequest(http.MethodPut, httpsvr.FaultInjectionPath, bytes.NewBufferString(`[{"name":"slow","delay":"1s"}]`))
+		req.RemoteAddr = "1.2.3.4:50000"
+		w = httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, req)
+		So(w.Code, ShouldEqual, http.StatusForbidden)
+		So(s.FaultInjector().Rules(), ShouldBeEmpty)
+	})
+}
+
+func TestGenericHTTPServer_Mirror(t *testing.T) {
+	Convey("流量镜像", t, func() {
+		type shadowReq struct {
+			method, uri, body, mirror, encoding string
+		}
+		received := make(chan shadowReq, 10)
+		shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			received <- shadowReq{
+				r.Method, r.RequestURI, string(body),
+				r.Header.Get(genericmiddleware.XMirrorKey), r.Header.Get("Content-Encoding"),
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if r.URL.Path == "/widgets/2" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(fmt.Sprintf(`{"status":{"code":%d}}`, code.ErrPageNotFound)))
+				return
+			}
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"status":{"code":%d}}`, code.ErrSuccess)))
+		}))
+		defer shadow.Close()
+
+		conf := httpsvr.NewConfig()
+		conf.Mirror.Address = shadow.URL
+		conf.Mirror.Percentage = 100
+		s, err := conf.Complete().New()
+		So(err, ShouldBeNil)
+
+		s.POST("/widgets/:id", func(c *gin.Context) {
+			var arg map[string]interface{}
+			if err := ginx.ParseJSON(c, &arg); err != nil {
+				ginx.WriteResponse(c, err, nil)
+				return
+			}
+			ginx.WriteResponse(c, nil, arg)
+		})
+
+		req, _ := http.NewRequest(http.MethodPost, "/widgets/1?q=1", bytes.NewBufferString(`{"name":"a"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, req)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldContainSubstring, `"name":"a"`)
+
+		select {
+		case r := <-received:
+			So(r, ShouldResemble, shadowReq{http.MethodPost, "/widgets/1?q=1", `{"name":"a"}`, "true", ""})
+		case <-time.After(5 * time.Second):
+			So("shadow request not received", ShouldBeEmpty)
+		}
+
+		Convey("复用copybody中间件并镜像解压后的请求体", func() {
+			conf := httpsvr.NewConfig()
+			conf.Middlewares = append(conf.Middlewares, genericmiddleware.MWNameCopyBody)
+			conf.Mirror.Address = shadow.URL
+			conf.Mirror.Percentage = 100
+			s, err := conf.Complete().New()
+			So(err, ShouldBeNil)
+			s.POST("/widgets/:id", func(c *gin.Context) {
+				var arg map[string]interface{}
+				if err := ginx.ParseJSON(c, &arg); err != nil {
+					ginx.WriteResponse(c, err, nil)
+					return
+				}
+				ginx.WriteResponse(c, nil, arg)
+			})
+
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			_, _ = zw.Write([]byte(`{"name":"b"}`))
+			So(zw.Close(), ShouldBeNil)
+			req, _ := http.NewRequest(http.MethodPost, "/widgets/3", &buf)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			s.Engine.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(w.Body.String(), ShouldContainSubstring, `"name":"b"`)
+
+			select {
+			case r := <-received:
+				So(r, ShouldResemble, shadowReq{http.MethodPost, "/widgets/3", `{"name":"b"}`, "true", ""})
+			case <-time.After(5 * time.Second):
+				So("shadow request not received", ShouldBeEmpty)
+			}
+		})
+
+		Convey("记录对比结果", func() {
+			results := make(chan genericmiddleware.MirrorResult, 10)
+			client, err := httpcli.NewClient(shadow.URL)
+			So(err, ShouldBeNil)
+
+			e := gin.New()
+			e.Use(genericmiddleware.CopyBodyMiddleware(), genericmiddleware.Mirror(genericmiddleware.MirrorConfig{
+				Client:     client,
+				Percentage: 100,
+				OnResult:   func(r genericmiddleware.MirrorResult) { results <- r },
+			}))
+			e.GET("/widgets/:id", func(c *gin.Context) { ginx.WriteResponse(c, nil, c.Param("id")) })
+
+			for _, id := range []string{"1", "2"} {
+				req, _ := http.NewRequest(http.MethodGet, "/widgets/"+id, nil)
+				e.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			got := map[string]genericmiddleware.MirrorResult{}
+			for i := 0; i < 2; i++ {
+				select {
+				case r := <-results:
+					got[r.Path] = r
+				case <-time.After(5 * time.Second):
+					So("mirror result not recorded", ShouldBeEmpty)
+				}
+			}
+			So(got["/widgets/1"].Result, ShouldEqual, genericmiddleware.MirrorResultMatch)
+			So(got["/widgets/2"].Result, ShouldEqual, genericmiddleware.MirrorResultStatusMismatch)
+			So(got["/widgets/2"].Route, ShouldEqual, "/widgets/:id")
+			So(got["/widgets/2"].ShadowCode, ShouldEqual, code.ErrPageNotFound)
+		})
+	})
+}
+
+func TestGenericHTTPServer_VerifySignature(t *testing.T) {
+	Convey("请求签名验证", t, func() {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		So(err, ShouldBeNil)
+		verifier := signature.NewRequestVerifier(signature.StaticKeys(map[string]signature.Verifier{
+			"hmac":    signature.NewHMACVerifier([]byte("secret")),
+			"ed25519": signature.NewEd25519Verifier(pub),
+		}), signature.VerifyConfig{RequiredHeaders: []string{"host"}})
+
+		e := gin.New()
+		e.Use(genericmiddleware.VerifySignature(verifier))
+		e.POST("/widgets", func(c *gin.Context) {
+			var arg map[string]interface{}
+			if err := c.ShouldBindJSON(&arg); err != nil {
+				ginx.WriteResponse(c, errors.WrapError(code.ErrBind, err), nil)
+				return
+			}
+			ginx.WriteResponse(c, nil, arg)
+		})
+		srv := httptest.NewServer(e)
+		defer srv.Close()
+
+		for _, interceptor := range []httpcli.Interceptor{
+			signinterceptor.HMACSignatureInterceptor("hmac", []byte("secret")),
+			signinterceptor.Ed25519SignatureInterceptor("ed25519", priv),
+		} {
+			client, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(interceptor))
+			So(err, ShouldBeNil)
+
+			var reply map[string]interface{}
+			resp, err := client.Invoke(context.Background(), http.MethodPost, "/widgets", map[string]string{"name": "a"}, &reply,
+				httpcli.QueryCallOption(map[string]interface{}{"q": "1"}))
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			So(string(resp.Body), ShouldContainSubstring, `"name":"a"`)
+		}
+
+		Convey("签名前可处理请求, 篡改的请求被拒绝", func() {
+			client, err := httpcli.NewClient(srv.URL, httpcli.WithIntercepts(
+				signinterceptor.HMACSignatureInterceptor("hmac", []byte("secret"))))
+			So(err, ShouldBeNil)
+			resp, _ := client.Invoke(context.Background(), http.MethodPost, "/widgets", map[string]string{"name": "a"}, nil,
+				httpcli.ResponseNotParseCallOption(),
+				httpcli.HttpRequestProcessOption(func(req *http.Request) (*http.Request, error) {
+					// processed before signing
+					req.Header.Set("Content-Type", "application/json")
+					return req, nil
+				}))
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/widgets", strings.NewReader(`{"name":"b"}`))
+			req.Header.Set("Content-Type", "application/json")
+			So(signature.Sign(req, signature.NewHMACSigner("hmac", []byte("secret")), nil,
+				signature.BodyDigest([]byte(`{"name":"a"}`))), ShouldBeNil)
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			So(w.Body.String(), ShouldContainSubstring, fmt.Sprintf(`"code":%d`, code.ErrSignatureInvalid))
+		})
+
+		Convey("未签名请求被拒绝", func() {
+			req, _ := http.NewRequest(http.MethodPost, "/widgets", strings.NewReader(`{"name":"a"}`))
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+}
+
+func TestGenericHTTPServer_ReloadCertificate(t *testing.T) {
+	Convey("重新加载证书", t, func() {
+		s, err := httpsvr.NewConfig().Complete().New()
+		So(err, ShouldBeNil)
+
+		So(s.ReloadCertificate(tls.CertData{Cert: certData, Key: "invalid"}), ShouldNotBeNil)
+		So(s.ReloadCertificate(tls.CertData{Cert: certData, Key: keyData}), ShouldBeNil)
+	})
+}
@@ -0,0 +1,174 @@
+package httpsvr
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpsvr/ginx"
+	"github.com/wangweihong/eazycloud/pkg/json"
+	"github.com/wangweihong/eazycloud/pkg/log"
+	"github.com/wangweihong/eazycloud/pkg/sets"
+)
+
+const (
+	// HeaderAcceptVersion is the request header used to negotiate api version.
+	HeaderAcceptVersion = "Accept-Version"
+	// HeaderAPIVersion is the response header which tells the api version actually served.
+	HeaderAPIVersion = "API-Version"
+	// ContextKeyAPIVersion is the key of negotiated api version stored in gin.Context.
+	ContextKeyAPIVersion = "api_version"
+)
+
+// unversionedPaths are generic apis never rewritten by version negotiation, as well as admin apis under `/debug/`.
+var unversionedPaths = sets.NewString("/healthz", "/version", "/metrics")
+
+func unversioned(path string) bool {
+	return unversionedPaths.Has(path) || path == "/debug" || strings.HasPrefix(path, "/debug/")
+}
+
+// apiVersioning records versions served under each base path.
+type apiVersioning struct {
+	lock  sync.RWMutex
+	bases map[string]*versionedBase
+}
+
+type versionedBase struct {
+	versions       sets.String
+	defaultVersion string
+}
+
+func newAPIVersioning() *apiVersioning {
+	return &apiVersioning{bases: make(map[string]*versionedBase)}
+}
+
+func (v *apiVersioning) add(base, version string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	b, ok := v.bases[base]
+	if !ok {
+		b = &versionedBase{versions: sets.NewString()}
+		v.bases[base] = b
+	}
+	b.versions.Insert(version)
+}
+
+func (v *apiVersioning) setDefault(base, version string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if b, ok := v.bases[base]; ok {
+		b.defaultVersion = version
+	}
+}
+
+// negotiate returns the versioned path of request.
+// rewrite is false if request path doesn't under any versioned base, already contains version segment
+// or is a generic api.
+func (v *apiVersioning) negotiate(path, accept string) (versioned string, rewrite bool, err error) {
+	if unversioned(path) {
+		return path, false, nil
+	}
+
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	// match the longest base first
+	bases := make([]string, 0, len(v.bases))
+	for base := range v.bases {
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool { return len(bases[i]) > len(bases[j]) })
+
+	for _, base := range bases {
+		if base != "/" && path != base && !strings.HasPrefix(path, base+"/") {
+			continue
+		}
+
+		rest := strings.TrimPrefix(strings.TrimPrefix(path, base), "/")
+		b := v.bases[base]
+		if b.versions.Has(strings.SplitN(rest, "/", 2)[0]) {
+			return path, false, nil
+		}
+
+		version := accept
+		if version == "" {
+			version = b.defaultVersion
+		}
+		if version == "" {
+			return path, false, nil
+		}
+		if !b.versions.Has(version) {
+			return path, false, errors.WrapF(code.ErrAPIVersionUnsupported,
+				"version `%s` is not supported, supported versions:%v", version, b.versions.List())
+		}
+		return joinPath(base, version, rest), true, nil
+	}
+	return path, false, nil
+}
+
+func joinPath(elems ...string) string {
+	segments := make([]string, 0, len(elems))
+	for _, e := range elems {
+		if e = strings.Trim(e, "/"); e != "" {
+			segments = append(segments, e)
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// VersionGroup creates a route group `<base>/<version>` with version negotiation middleware.
+// Beside path prefix, requests to `<base>/...` without version segment will be routed to the version specified
+// by `Accept-Version` header, or the default version set by SetDefaultVersion if header is missing.
+func (s *GenericHTTPServer) VersionGroup(base, version string, handlers ...gin.HandlerFunc) *gin.RouterGroup {
+	base = joinPath(base)
+	s.apiVersions.add(base, version)
+
+	chain := []gin.HandlerFunc{VersionNegotiation(version)}
+	return s.Group(joinPath(base, version), append(chain, handlers...)...)
+}
+
+// SetDefaultVersion set the version used when request under `base` has no `Accept-Version` header.
+func (s *GenericHTTPServer) SetDefaultVersion(base, version string) {
+	s.apiVersions.setDefault(joinPath(base), version)
+}
+
+// VersionNegotiation is a middleware which records the api version served in context and response header.
+func VersionNegotiation(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ContextKeyAPIVersion, version)
+		c.Header(HeaderAPIVersion, version)
+		c.Next()
+	}
+}
+
+// ServeHTTP rewrites request path by `Accept-Version` header before handled by gin engine.
+func (s *GenericHTTPServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	versioned, rewrite, err := s.apiVersions.negotiate(req.URL.Path, req.Header.Get(HeaderAcceptVersion))
+	if err != nil {
+		log.F(req.Context()).Warnf("negotiate api version fail:%v", err)
+		writeError(w, err)
+		return
+	}
+
+	if rewrite {
+		log.F(req.Context()).Debugf("rewrite request path from %v to %v", req.URL.Path, versioned)
+		req.URL.Path = versioned
+		req.URL.RawPath = ""
+	}
+	s.Engine.ServeHTTP(w, req)
+}
+
+// writeError write error into response with ginx.Response structure, used when gin.Context is unavailable.
+func writeError(w http.ResponseWriter, err error) {
+	data, _ := json.Marshal(ginx.Response{Status: ginx.FromError(err)})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errors.FromError(err).HTTPStatus())
+	_, _ = w.Write(data)
+}
@@ -128,6 +128,7 @@ type zapLogger struct {
 	// deals with our desire to have multiple verbosity levels.
 	zapLogger *zap.Logger
 	infoLogger
+	core *reloadableCore
 }
 
 // handleFields converts a bunch of arbitrary key-value pairs into Zap fields.  It takes
@@ -199,6 +200,25 @@ func New(opts *Options) *zapLogger {
 		opts = NewOptions()
 	}
 
+	l := buildLogger(opts)
+	// core can be replaced by Reload
+	core := newReloadableCore(l.Core())
+	l = l.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core { return core }))
+	logger := &zapLogger{
+		zapLogger: l.Named(opts.Name),
+		infoLogger: infoLogger{
+			log:   l,
+			level: zap.InfoLevel,
+		},
+		core: core,
+	}
+	klog.InitLogger(l)
+	zap.RedirectStdLog(l)
+
+	return logger
+}
+
+func buildLogger(opts *Options) *zap.Logger {
 	var zapLevel zapcore.Level
 	if err := zapLevel.UnmarshalText([]byte(opts.Level)); err != nil {
 		zapLevel = zapcore.InfoLevel
@@ -238,22 +258,11 @@ func New(opts *Options) *zapLogger {
 		ErrorOutputPaths: opts.ErrorOutputPaths,
 	}
 
-	var err error
 	l, err := loggerConfig.Build(zap.AddStacktrace(zapcore.PanicLevel), zap.AddCallerSkip(1))
 	if err != nil {
 		panic(err)
 	}
-	logger := &zapLogger{
-		zapLogger: l.Named(opts.Name),
-		infoLogger: infoLogger{
-			log:   l,
-			level: zap.InfoLevel,
-		},
-	}
-	klog.InitLogger(l)
-	zap.RedirectStdLog(l)
-
-	return logger
+	return l
 }
 
 // SugaredLogger returns global sugared logger.
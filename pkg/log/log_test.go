@@ -3,6 +3,8 @@ package log_test
 import (
 	"context"
 	"errors"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"go.uber.org/zap"
@@ -194,3 +196,34 @@ func Benchmark_ZapTypeObject(b *testing.B) {
 		log.Info("This is object example", log.Object("req", req))
 	}
 }
+
+func Test_Reload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "reload.log")
+	opts := log.NewOptions()
+	opts.OutputPaths = []string{file}
+	log.Init(opts)
+	defer log.Init(log.NewOptions())
+
+	logger := log.WithValues("key", "value")
+	logger.Debug("before reload")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			log.Info("logging while reloading")
+		}
+	}()
+	opts.Level = log.DebugLevel.String()
+	opts.Format = "json"
+	log.Reload(opts)
+	<-done
+
+	logger.Debug("after reload")
+	log.Flush()
+
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "before reload")
+	assert.Contains(t, string(data), `"message":"after reload","key":"value"`)
+}
@@ -0,0 +1,76 @@
+package log
+
+import (
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Reload applies level, format, color and output paths of opts to the global logger in place,
+// it is safe to call while logging. Other options take effect after Init.
+func Reload(opts *Options) {
+	if opts == nil {
+		opts = NewOptions()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	std.core.swap(buildLogger(opts).Core())
+}
+
+// reloadableCore delegates to a core which can be replaced atomically,
+// so that loggers derived before replaced follow the new one.
+type reloadableCore struct {
+	current *atomic.Value
+	fields  []zapcore.Field
+}
+
+// coreHolder keeps type stored in atomic.Value consistent.
+type coreHolder struct {
+	core zapcore.Core
+}
+
+func newReloadableCore(core zapcore.Core) *reloadableCore {
+	c := &reloadableCore{current: &atomic.Value{}}
+	c.swap(core)
+	return c
+}
+
+func (c *reloadableCore) swap(core zapcore.Core) {
+	c.current.Store(coreHolder{core: core})
+}
+
+func (c *reloadableCore) load() zapcore.Core {
+	core := c.current.Load().(coreHolder).core
+	if len(c.fields) > 0 {
+		core = core.With(c.fields)
+	}
+	return core
+}
+
+func (c *reloadableCore) Enabled(lvl zapcore.Level) bool {
+	return c.current.Load().(coreHolder).core.Enabled(lvl)
+}
+
+func (c *reloadableCore) With(fields []zapcore.Field) zapcore.Core {
+	all := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	all = append(all, c.fields...)
+	all = append(all, fields...)
+	return &reloadableCore{current: c.current, fields: all}
+}
+
+func (c *reloadableCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	// sampling of current core decides whether to write
+	return c.load().Check(ent, ce)
+}
+
+func (c *reloadableCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.load().Write(ent, fields)
+}
+
+func (c *reloadableCore) Sync() error {
+	return c.current.Load().(coreHolder).core.Sync()
+}
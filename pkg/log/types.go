@@ -14,6 +14,7 @@ import (
 const (
 	KeyRequestID ContextKey = "requestID"
 	KeyUsername  ContextKey = "username"
+	KeyClientIP  ContextKey = "clientIP"
 )
 
 type ContextKey string
@@ -0,0 +1,207 @@
+package maintenance
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// Mode decides which requests are rejected in maintenance.
+type Mode string
+
+const (
+	// ModeOff serves all requests.
+	ModeOff Mode = "off"
+	// ModeReadOnly rejects write requests, such as migrating data.
+	ModeReadOnly Mode = "readonly"
+	// ModeFull rejects all requests.
+	ModeFull Mode = "full"
+)
+
+// DefaultRetryAfter is the default seconds client should wait before retry.
+const DefaultRetryAfter = 30
+
+// DefaultAllowedRoutes are health, admin and introspection routes of http and grpc server.
+var DefaultAllowedRoutes = []string{
+	"/healthz",
+	"/version",
+	"/metrics",
+	"/debug/*",
+	"/version.VersionService/*",
+	"/grpc.health.v1.Health/*",
+	"/grpc.reflection.v1alpha.ServerReflection/*",
+}
+
+// Modes are supported modes.
+var Modes = []string{string(ModeOff), string(ModeReadOnly), string(ModeFull)}
+
+// State is the runtime state of Switch.
+type State struct {
+	Mode Mode `json:"mode"`
+	// Reason is returned to client in maintenance.
+	Reason string `json:"reason,omitempty"`
+	// RetryAfter is seconds client should wait before retry, set into `Retry-After` header.
+	RetryAfter int `json:"retryAfter"`
+	// MaxInFlight sheds request when in-flight requests reach it, zero means no limit.
+	MaxInFlight int64 `json:"maxInFlight"`
+}
+
+// StateUpdate changes fields of State which are not nil.
+type StateUpdate struct {
+	Mode        *Mode   `json:"mode,omitempty"`
+	Reason      *string `json:"reason,omitempty"`
+	RetryAfter  *int    `json:"retryAfter,omitempty"`
+	MaxInFlight *int64  `json:"maxInFlight,omitempty"`
+}
+
+// apply returns state with fields of update merged.
+func (u StateUpdate) apply(state State) State {
+	if u.Mode != nil {
+		state.Mode = *u.Mode
+	}
+	if u.Reason != nil {
+		state.Reason = *u.Reason
+	}
+	if u.RetryAfter != nil {
+		state.RetryAfter = *u.RetryAfter
+	}
+	if u.MaxInFlight != nil {
+		state.MaxInFlight = *u.MaxInFlight
+	}
+	return state
+}
+
+// Validate checks validation of State.
+func (s State) Validate() error {
+	switch s.Mode {
+	case ModeOff, ModeReadOnly, ModeFull:
+	default:
+		return fmt.Errorf("maintenance mode must be one of %v", Modes)
+	}
+	if s.RetryAfter < 0 {
+		return fmt.Errorf("retry after must not be negative")
+	}
+	if s.MaxInFlight < 0 {
+		return fmt.Errorf("max in-flight must not be negative")
+	}
+	return nil
+}
+
+// Switch rejects or sheds requests according to its state, which can be changed at runtime.
+// It can be shared by http and grpc server.
+type Switch struct {
+	state atomic.Value // State
+	// lock serializes changes of state
+	lock sync.Mutex
+	// allowed routes are always served, such as healthz and admin api
+	allowed  []string
+	inFlight int64
+}
+
+// NewSwitch creates a switch, routes matching allowed are always served and not counted as in-flight.
+// Route pattern ending with `/*` matches all routes with the prefix.
+func NewSwitch(state State, allowed ...string) (*Switch, error) {
+	s := &Switch{allowed: allowed}
+	if err := s.Set(state); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// State returns current state.
+func (s *Switch) State() State {
+	return s.state.Load().(State)
+}
+
+// Set replaces current state.
+func (s *Switch) Set(state State) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.setLocked(state)
+}
+
+// Update merges update into current state, state is untouched if the merged one is invalid.
+func (s *Switch) Update(update StateUpdate) (State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	state := update.apply(s.State())
+	if err := s.setLocked(state); err != nil {
+		return s.State(), err
+	}
+	return s.State(), nil
+}
+
+func (s *Switch) setLocked(state State) error {
+	if state.Mode == "" {
+		state.Mode = ModeOff
+	}
+	if err := state.Validate(); err != nil {
+		return err
+	}
+
+	if old, ok := s.state.Load().(State); !ok || old.Mode != state.Mode {
+		log.Infof("maintenance mode changed to %s, reason:%s", state.Mode, state.Reason)
+	}
+	s.state.Store(state)
+	return nil
+}
+
+// SetMode changes mode and reason only.
+func (s *Switch) SetMode(mode Mode, reason string) error {
+	_, err := s.Update(StateUpdate{Mode: &mode, Reason: &reason})
+	return err
+}
+
+// InFlight returns number of in-flight requests.
+func (s *Switch) InFlight() int64 {
+	return atomic.LoadInt64(&s.inFlight)
+}
+
+// Admit decides whether request of route can be served, read reports whether request doesn't
+// modify anything. done must be called when request finished if admitted.
+// Rejected error is ErrServiceInMaintenance or ErrServiceOverloaded.
+func (s *Switch) Admit(route string, read bool) (done func(), err error) {
+	if s.Allowed(route) {
+		return func() {}, nil
+	}
+
+	state := s.State()
+	switch state.Mode {
+	case ModeFull:
+		return nil, errors.Wrap(code.ErrServiceInMaintenance, s.reason(state, "service is under maintenance"))
+	case ModeReadOnly:
+		if !read {
+			return nil, errors.Wrap(code.ErrServiceInMaintenance, s.reason(state, "service is read-only under maintenance"))
+		}
+	}
+
+	n := atomic.AddInt64(&s.inFlight, 1)
+	if state.MaxInFlight > 0 && n > state.MaxInFlight {
+		atomic.AddInt64(&s.inFlight, -1)
+		return nil, errors.WrapF(code.ErrServiceOverloaded, "in-flight requests exceed %d", state.MaxInFlight)
+	}
+	return func() { atomic.AddInt64(&s.inFlight, -1) }, nil
+}
+
+// Allowed reports whether route is always served.
+func (s *Switch) Allowed(route string) bool {
+	for _, p := range s.allowed {
+		if strings.HasSuffix(p, "/*") && strings.HasPrefix(route, strings.TrimSuffix(p, "*")) || p == route {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Switch) reason(state State, defaultReason string) string {
+	if state.Reason != "" {
+		return state.Reason
+	}
+	return defaultReason
+}
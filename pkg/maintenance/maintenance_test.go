@@ -0,0 +1,71 @@
+package maintenance_test
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/maintenance"
+)
+
+func TestSwitch(t *testing.T) {
+	Convey("维护模式开关", t, func() {
+		sw, err := maintenance.NewSwitch(maintenance.State{}, "/healthz", "/debug/*")
+		So(err, ShouldBeNil)
+		So(sw.State().Mode, ShouldEqual, maintenance.ModeOff)
+
+		Convey("只读模式拒绝写请求", func() {
+			So(sw.SetMode(maintenance.ModeReadOnly, "migrating"), ShouldBeNil)
+			done, err := sw.Admit("/v1/widgets", true)
+			So(err, ShouldBeNil)
+			done()
+			_, err = sw.Admit("/v1/widgets", false)
+			So(errors.IsCode(err, code.ErrServiceInMaintenance), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "migrating")
+		})
+
+		Convey("完全维护模式放行白名单", func() {
+			So(sw.SetMode(maintenance.ModeFull, ""), ShouldBeNil)
+			_, err := sw.Admit("/v1/widgets", true)
+			So(errors.IsCode(err, code.ErrServiceInMaintenance), ShouldBeTrue)
+			_, err = sw.Admit("/healthz", true)
+			So(err, ShouldBeNil)
+			_, err = sw.Admit("/debug/maintenance", false)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("超过并发上限时拒绝", func() {
+			So(sw.Set(maintenance.State{MaxInFlight: 1}), ShouldBeNil)
+			done, err := sw.Admit("/v1/widgets", true)
+			So(err, ShouldBeNil)
+			So(sw.InFlight(), ShouldEqual, 1)
+			_, err = sw.Admit("/v1/widgets", true)
+			So(errors.IsCode(err, code.ErrServiceOverloaded), ShouldBeTrue)
+			done()
+			So(sw.InFlight(), ShouldEqual, 0)
+			done, err = sw.Admit("/v1/widgets", true)
+			So(err, ShouldBeNil)
+			done()
+		})
+
+		Convey("部分更新", func() {
+			So(sw.Set(maintenance.State{Mode: maintenance.ModeReadOnly, Reason: "migrating", RetryAfter: 60}), ShouldBeNil)
+			mode := maintenance.ModeFull
+			state, err := sw.Update(maintenance.StateUpdate{Mode: &mode})
+			So(err, ShouldBeNil)
+			So(state, ShouldResemble, maintenance.State{Mode: maintenance.ModeFull, Reason: "migrating", RetryAfter: 60})
+
+			retryAfter := -1
+			_, err = sw.Update(maintenance.StateUpdate{RetryAfter: &retryAfter})
+			So(err, ShouldNotBeNil)
+			So(sw.State().RetryAfter, ShouldEqual, 60)
+		})
+
+		Convey("非法状态", func() {
+			So(sw.Set(maintenance.State{Mode: "unknown"}), ShouldNotBeNil)
+			So(sw.Set(maintenance.State{MaxInFlight: -1}), ShouldNotBeNil)
+		})
+	})
+}
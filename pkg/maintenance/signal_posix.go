@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package maintenance
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// HandleSignals enters maintenance mode on SIGTTOU and leaves on SIGTTIN, the same as haproxy
+// pausing and resuming listeners. Call stop to uninstall handler.
+func (s *Switch) HandleSignals(mode Mode) (stop func()) {
+	ch := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGTTOU, syscall.SIGTTIN)
+
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				next := ModeOff
+				if sig == syscall.SIGTTOU {
+					next = mode
+				}
+				log.Infof("receive %v signal, change maintenance mode to %s", sig, next)
+				if err := s.SetMode(next, ""); err != nil {
+					log.Warnf("change maintenance mode error:%v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package maintenance
+
+import "github.com/wangweihong/eazycloud/pkg/log"
+
+// HandleSignals is not supported on windows.
+func (s *Switch) HandleSignals(mode Mode) (stop func()) {
+	log.Warnf("system don't support maintenance signal")
+	return func() {}
+}
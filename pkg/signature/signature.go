@@ -0,0 +1,247 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers carrying signature of request.
+const (
+	HeaderKeyID         = "X-Signature-Key-Id"
+	HeaderAlgorithm     = "X-Signature-Algorithm"
+	HeaderSignedHeaders = "X-Signature-Headers"
+	HeaderTimestamp     = "X-Signature-Timestamp"
+	HeaderNonce         = "X-Signature-Nonce"
+	HeaderContentSHA256 = "X-Content-Sha256"
+	HeaderSignature     = "X-Signature"
+)
+
+// Supported algorithms.
+const (
+	AlgorithmHMACSHA256 = "HMAC-SHA256"
+	AlgorithmEd25519    = "Ed25519"
+)
+
+// UnsignedPayload is the body digest of request whose body can not be read in advance, such as streaming.
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// DefaultSignedHeaders are headers signed if not specified.
+var DefaultSignedHeaders = []string{"host", "content-type"}
+
+// Signer signs canonical request with a key.
+type Signer interface {
+	KeyID() string
+	Algorithm() string
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier verifies signature made by a key.
+type Verifier interface {
+	Algorithm() string
+	Verify(data, signature []byte) bool
+}
+
+// KeyFunc returns verifier of key id, false if key is unknown.
+type KeyFunc func(keyID string) (Verifier, bool)
+
+// StaticKeys returns KeyFunc of fixed keys.
+func StaticKeys(keys map[string]Verifier) KeyFunc {
+	return func(keyID string) (Verifier, bool) {
+		v, ok := keys[keyID]
+		return v, ok
+	}
+}
+
+type hmacKey struct {
+	keyID  string
+	secret []byte
+}
+
+// NewHMACSigner returns Signer signing with HMAC-SHA256 of secret.
+func NewHMACSigner(keyID string, secret []byte) Signer {
+	return &hmacKey{keyID: keyID, secret: secret}
+}
+
+// NewHMACVerifier returns Verifier of HMAC-SHA256 signature of secret.
+func NewHMACVerifier(secret []byte) Verifier {
+	return &hmacKey{secret: secret}
+}
+
+func (k *hmacKey) KeyID() string     { return k.keyID }
+func (k *hmacKey) Algorithm() string { return AlgorithmHMACSHA256 }
+
+func (k *hmacKey) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (k *hmacKey) Verify(data, signature []byte) bool {
+	expected, _ := k.Sign(data)
+	return hmac.Equal(expected, signature)
+}
+
+type ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewEd25519Signer returns Signer signing with ed25519 private key.
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) Signer {
+	return &ed25519Signer{keyID: keyID, key: key}
+}
+
+func (s *ed25519Signer) KeyID() string     { return s.keyID }
+func (s *ed25519Signer) Algorithm() string { return AlgorithmEd25519 }
+
+func (s *ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, data), nil
+}
+
+type ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+// NewEd25519Verifier returns Verifier of ed25519 signature of public key.
+func NewEd25519Verifier(key ed25519.PublicKey) Verifier {
+	return &ed25519Verifier{key: key}
+}
+
+func (v *ed25519Verifier) Algorithm() string { return AlgorithmEd25519 }
+
+func (v *ed25519Verifier) Verify(data, signature []byte) bool {
+	return len(v.key) == ed25519.PublicKeySize && ed25519.Verify(v.key, data, signature)
+}
+
+// BodyDigest returns hex encoded sha256 of body.
+func BodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewNonce returns a random nonce.
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CanonicalRequest returns the data to be signed, lines of:
+//
+//	METHOD
+//	escaped path
+//	query sorted by key and value
+//	lowercase `name:value` of each signed header, sorted by name
+//	signed header names joined with `;`
+//	body digest
+//	timestamp
+//	nonce
+//
+// Values of repeated header are joined with `,`, and `host` header is host of request.
+func CanonicalRequest(req *http.Request, signedHeaders []string, bodyDigest, timestamp, nonce string) []byte {
+	names := normalizeHeaders(signedHeaders)
+
+	var buf bytes.Buffer
+	buf.WriteString(strings.ToUpper(req.Method))
+	buf.WriteByte('\n')
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	buf.WriteString(path)
+	buf.WriteByte('\n')
+	buf.WriteString(canonicalQuery(req.URL.RawQuery))
+	buf.WriteByte('\n')
+	for _, name := range names {
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(headerValue(req, name))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(strings.Join(names, ";"))
+	buf.WriteByte('\n')
+	buf.WriteString(bodyDigest)
+	buf.WriteByte('\n')
+	buf.WriteString(timestamp)
+	buf.WriteByte('\n')
+	buf.WriteString(nonce)
+	return buf.Bytes()
+}
+
+// Sign sets signature headers of req, bodyDigest is BodyDigest of body or UnsignedPayload.
+// DefaultSignedHeaders are signed if signedHeaders is empty.
+func Sign(req *http.Request, signer Signer, signedHeaders []string, bodyDigest string) error {
+	if len(signedHeaders) == 0 {
+		signedHeaders = DefaultSignedHeaders
+	}
+	nonce, err := NewNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	names := normalizeHeaders(signedHeaders)
+
+	signature, err := signer.Sign(CanonicalRequest(req, names, bodyDigest, timestamp, nonce))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(HeaderKeyID, signer.KeyID())
+	req.Header.Set(HeaderAlgorithm, signer.Algorithm())
+	req.Header.Set(HeaderSignedHeaders, strings.Join(names, ";"))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderContentSHA256, bodyDigest)
+	req.Header.Set(HeaderSignature, hex.EncodeToString(signature))
+	return nil
+}
+
+func normalizeHeaders(headers []string) []string {
+	seen := make(map[string]bool, len(headers))
+	names := make([]string, 0, len(headers))
+	for _, h := range headers {
+		name := strings.ToLower(strings.TrimSpace(h))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func headerValue(req *http.Request, name string) string {
+	if name == "host" {
+		if req.Host != "" {
+			return req.Host
+		}
+		return req.URL.Host
+	}
+	values := req.Header.Values(name)
+	trimmed := make([]string, 0, len(values))
+	for _, v := range values {
+		trimmed = append(trimmed, strings.TrimSpace(v))
+	}
+	return strings.Join(trimmed, ",")
+}
+
+func canonicalQuery(rawQuery string) string {
+	values, _ := url.ParseQuery(rawQuery)
+	for _, v := range values {
+		sort.Strings(v)
+	}
+	// Encode sorts by key
+	return values.Encode()
+}
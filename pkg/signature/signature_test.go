@@ -0,0 +1,101 @@
+package signature_test
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/signature"
+)
+
+func TestSignature(t *testing.T) {
+	Convey("请求签名", t, func() {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		So(err, ShouldBeNil)
+		keys := signature.StaticKeys(map[string]signature.Verifier{
+			"hmac":    signature.NewHMACVerifier([]byte("secret")),
+			"ed25519": signature.NewEd25519Verifier(pub),
+		})
+		signers := []signature.Signer{
+			signature.NewHMACSigner("hmac", []byte("secret")),
+			signature.NewEd25519Signer("ed25519", priv),
+		}
+		body := []byte(`{"name":"a"}`)
+
+		newRequest := func(signer signature.Signer) *http.Request {
+			req, _ := http.NewRequest(http.MethodPost, "http://example.com/v1/items?b=2&a=1&a=0", nil)
+			req.Header.Set("Content-Type", "application/json")
+			So(signature.Sign(req, signer, nil, signature.BodyDigest(body)), ShouldBeNil)
+			return req
+		}
+
+		Convey("查询参数顺序不影响规范请求", func() {
+			r1, _ := http.NewRequest(http.MethodGet, "http://example.com/a?b=2&a=1&a=0", nil)
+			r2, _ := http.NewRequest(http.MethodGet, "http://example.com/a?a=0&a=1&b=2", nil)
+			c1 := signature.CanonicalRequest(r1, []string{"Host"}, "digest", "1", "n")
+			So(string(c1), ShouldEqual, "GET\n/a\na=0&a=1&b=2\nhost:example.com\nhost\ndigest\n1\nn")
+			So(string(signature.CanonicalRequest(r2, []string{"host"}, "digest", "1", "n")), ShouldEqual, string(c1))
+		})
+
+		Convey("验证通过, 重放被拒绝", func() {
+			v := signature.NewRequestVerifier(keys, signature.VerifyConfig{})
+			for _, signer := range signers {
+				req := newRequest(signer)
+				So(v.Verify(req, body), ShouldBeNil)
+				err := v.Verify(req, body)
+				So(errors.IsCode(err, code.ErrSignatureInvalid), ShouldBeTrue)
+				So(err.Error(), ShouldContainSubstring, "replayed")
+			}
+		})
+
+		Convey("篡改请求被拒绝", func() {
+			v := signature.NewRequestVerifier(keys, signature.VerifyConfig{})
+			for _, signer := range signers {
+				req := newRequest(signer)
+				So(errors.IsCode(v.Verify(req, []byte(`{"name":"b"}`)), code.ErrSignatureInvalid), ShouldBeTrue)
+
+				req = newRequest(signer)
+				req.URL.RawQuery = "a=1"
+				So(errors.IsCode(v.Verify(req, body), code.ErrSignatureInvalid), ShouldBeTrue)
+
+				req = newRequest(signer)
+				req.Header.Set("Content-Type", "text/plain")
+				So(errors.IsCode(v.Verify(req, body), code.ErrSignatureInvalid), ShouldBeTrue)
+			}
+		})
+
+		Convey("时间偏差过大被拒绝", func() {
+			v := signature.NewRequestVerifier(keys, signature.VerifyConfig{MaxSkew: time.Minute})
+			req := newRequest(signers[0])
+			req.Header.Set(signature.HeaderTimestamp, strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10))
+			err := v.Verify(req, body)
+			So(errors.IsCode(err, code.ErrSignatureInvalid), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "skew")
+		})
+
+		Convey("未知密钥和未签名请求头", func() {
+			v := signature.NewRequestVerifier(keys, signature.VerifyConfig{RequiredHeaders: []string{"X-Tenant"}})
+			req := newRequest(signers[0])
+			So(strings.Contains(v.Verify(req, body).Error(), "x-tenant must be signed"), ShouldBeTrue)
+
+			req = newRequest(signature.NewHMACSigner("unknown", []byte("secret")))
+			So(errors.IsCode(v.Verify(req, body), code.ErrSignatureInvalid), ShouldBeTrue)
+		})
+
+		Convey("未签名请求体", func() {
+			req, _ := http.NewRequest(http.MethodPut, "http://example.com/upload", nil)
+			So(signature.Sign(req, signers[0], nil, signature.UnsignedPayload), ShouldBeNil)
+			So(errors.IsCode(signature.NewRequestVerifier(keys, signature.VerifyConfig{}).Verify(req, nil),
+				code.ErrSignatureInvalid), ShouldBeTrue)
+			So(signature.NewRequestVerifier(keys, signature.VerifyConfig{AllowUnsignedPayload: true}).Verify(req, nil),
+				ShouldBeNil)
+		})
+	})
+}
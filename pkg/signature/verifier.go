@@ -0,0 +1,139 @@
+package signature
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangweihong/eazycloud/pkg/cache"
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+)
+
+// DefaultMaxSkew is the default max difference between signing time and now.
+const DefaultMaxSkew = 5 * time.Minute
+
+// VerifyConfig is config of RequestVerifier.
+type VerifyConfig struct {
+	// MaxSkew is the max difference between signing time and now, DefaultMaxSkew if not set.
+	MaxSkew time.Duration
+	// AllowUnsignedPayload accepts request whose body is not signed, such as streaming.
+	AllowUnsignedPayload bool
+	// RequiredHeaders must be signed, such as `host`.
+	RequiredHeaders []string
+}
+
+// RequestVerifier verifies signature of request.
+// Nonce of verified request is remembered for twice of MaxSkew to reject replayed request,
+// request signed before that is rejected by clock skew check.
+type RequestVerifier struct {
+	keys   KeyFunc
+	config VerifyConfig
+
+	lock      sync.Mutex
+	nonces    cache.Store
+	lastPurge time.Time
+}
+
+// NewRequestVerifier creates RequestVerifier with keys.
+func NewRequestVerifier(keys KeyFunc, config VerifyConfig) *RequestVerifier {
+	if config.MaxSkew <= 0 {
+		config.MaxSkew = DefaultMaxSkew
+	}
+	config.RequiredHeaders = normalizeHeaders(config.RequiredHeaders)
+	return &RequestVerifier{
+		keys:      keys,
+		config:    config,
+		nonces:    cache.NewTTLStore(func(obj interface{}) (string, error) { return obj.(string), nil }, 2*config.MaxSkew),
+		lastPurge: time.Now(),
+	}
+}
+
+// Verify verifies signature of req with body, returns code.ErrSignatureInvalid error if invalid.
+func (v *RequestVerifier) Verify(req *http.Request, body []byte) error {
+	keyID := req.Header.Get(HeaderKeyID)
+	if keyID == "" || req.Header.Get(HeaderSignature) == "" {
+		return errors.Wrap(code.ErrSignatureInvalid, "request is not signed")
+	}
+	key, ok := v.keys(keyID)
+	if !ok {
+		return errors.WrapF(code.ErrSignatureInvalid, "unknown key %s", keyID)
+	}
+	if algorithm := req.Header.Get(HeaderAlgorithm); algorithm != key.Algorithm() {
+		return errors.WrapF(code.ErrSignatureInvalid, "algorithm %s not match key %s", algorithm, keyID)
+	}
+
+	timestamp := req.Header.Get(HeaderTimestamp)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.WrapF(code.ErrSignatureInvalid, "invalid timestamp %s", timestamp)
+	}
+	if skew := time.Since(time.Unix(sec, 0)); skew > v.config.MaxSkew || skew < -v.config.MaxSkew {
+		return errors.WrapF(code.ErrSignatureInvalid, "timestamp %s exceeds max clock skew %v", timestamp, v.config.MaxSkew)
+	}
+
+	nonce := req.Header.Get(HeaderNonce)
+	if nonce == "" {
+		return errors.Wrap(code.ErrSignatureInvalid, "nonce is missing")
+	}
+
+	signedHeaders := splitHeaders(req.Header.Get(HeaderSignedHeaders))
+	signed := make(map[string]bool, len(signedHeaders))
+	for _, h := range signedHeaders {
+		signed[h] = true
+	}
+	for _, h := range v.config.RequiredHeaders {
+		if !signed[h] {
+			return errors.WrapF(code.ErrSignatureInvalid, "header %s must be signed", h)
+		}
+	}
+
+	digest := BodyDigest(body)
+	if req.Header.Get(HeaderContentSHA256) == UnsignedPayload {
+		if !v.config.AllowUnsignedPayload {
+			return errors.Wrap(code.ErrSignatureInvalid, "unsigned payload is not allowed")
+		}
+		digest = UnsignedPayload
+	}
+
+	signature, err := hex.DecodeString(req.Header.Get(HeaderSignature))
+	if err != nil {
+		return errors.Wrap(code.ErrSignatureInvalid, "signature is not hex encoded")
+	}
+	if !key.Verify(CanonicalRequest(req, signedHeaders, digest, timestamp, nonce), signature) {
+		return errors.Wrap(code.ErrSignatureInvalid, "signature mismatch")
+	}
+
+	// remember nonce only after signature verified, so that forged request can't occupy nonce
+	if v.replayed(keyID + "/" + nonce) {
+		return errors.WrapF(code.ErrSignatureInvalid, "nonce %s is replayed", nonce)
+	}
+	return nil
+}
+
+// replayed returns true if nonce has been seen, otherwise remembers it.
+func (v *RequestVerifier) replayed(nonce string) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	// expired nonces are removed lazily, purge them periodically to limit memory
+	if now := time.Now(); now.Sub(v.lastPurge) > v.config.MaxSkew {
+		_ = v.nonces.ListKeys()
+		v.lastPurge = now
+	}
+	if _, exists, _ := v.nonces.GetByKey(nonce); exists {
+		return true
+	}
+	_ = v.nonces.Add(nonce)
+	return false
+}
+
+func splitHeaders(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return normalizeHeaders(strings.Split(s, ";"))
+}
@@ -0,0 +1,112 @@
+package token
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wangweihong/eazycloud/pkg/code"
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/httpcli"
+	"github.com/wangweihong/eazycloud/pkg/json"
+)
+
+// ClientCredentialsConfig is config of OAuth2 client credentials grant.
+type ClientCredentialsConfig struct {
+	ClientID     string
+	ClientSecret string
+	// TokenURL is the token endpoint of authorization server.
+	TokenURL string
+	Scopes   []string
+	// EndpointParams are additional parameters of token request, such as `audience`.
+	EndpointParams url.Values
+	// AuthInParams sends client id and secret as parameters instead of basic auth.
+	AuthInParams bool
+	// ExpiryDelta is how long before expiry the token is refreshed, DefaultExpiryDelta if not set.
+	ExpiryDelta time.Duration
+	// RefreshTimeout is the timeout of token request, DefaultRefreshTimeout if not set.
+	RefreshTimeout time.Duration
+	// ClientOptions are options of client requesting token endpoint, such as tls.
+	ClientOptions []httpcli.Option
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// ClientCredentialsTokenSource returns TokenSource requesting token with OAuth2 client credentials grant.
+// Token is cached and refreshed before expiry.
+func ClientCredentialsTokenSource(config ClientCredentialsConfig) (*CachedTokenSource, error) {
+	if config.TokenURL == "" || config.ClientID == "" {
+		return nil, errors.Wrap(code.ErrValidation, "token url and client id must be set")
+	}
+	if config.RefreshTimeout <= 0 {
+		config.RefreshTimeout = DefaultRefreshTimeout
+	}
+	// timeout set in ClientOptions takes precedence
+	opts := append([]httpcli.Option{httpcli.WithTimeout(config.RefreshTimeout)}, config.ClientOptions...)
+	client, err := httpcli.NewClient(config.TokenURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	source := TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return requestToken(ctx, client, &config)
+	})
+	cached := NewCachedTokenSource(source, config.ExpiryDelta)
+	cached.RefreshTimeout = config.RefreshTimeout
+	return cached, nil
+}
+
+func requestToken(ctx context.Context, client *httpcli.Client, config *ClientCredentialsConfig) (*Token, error) {
+	params := url.Values{"grant_type": {"client_credentials"}}
+	if len(config.Scopes) > 0 {
+		params.Set("scope", strings.Join(config.Scopes, " "))
+	}
+	for k, v := range config.EndpointParams {
+		params[k] = v
+	}
+
+	opts := []httpcli.CallOption{
+		httpcli.FormCallOption(),
+		httpcli.ResponseNotParseCallOption(),
+		httpcli.OneHeaderCallOption("Accept", "application/json"),
+	}
+	if config.AuthInParams {
+		params.Set("client_id", config.ClientID)
+		params.Set("client_secret", config.ClientSecret)
+	} else {
+		opts = append(opts, httpcli.HttpRequestProcessOption(func(req *http.Request) (*http.Request, error) {
+			req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+			return req, nil
+		}))
+	}
+
+	start := time.Now()
+	rawResp, err := client.Invoke(ctx, http.MethodPost, "", params, nil, opts...)
+	if err != nil {
+		return nil, errors.UpdateStack(err)
+	}
+
+	var resp tokenResponse
+	if err := json.Unmarshal(rawResp.Body, &resp); err != nil && rawResp.StatusCode == http.StatusOK {
+		return nil, errors.WrapError(code.ErrHTTPResponseDataParseError, err)
+	}
+	if rawResp.StatusCode != http.StatusOK || resp.AccessToken == "" {
+		return nil, errors.WrapF(code.ErrHTTPError, "request token fail, status:%d, error:%s %s",
+			rawResp.StatusCode, resp.Error, resp.ErrorDescription)
+	}
+
+	t := &Token{AccessToken: resp.AccessToken, TokenType: resp.TokenType}
+	if resp.ExpiresIn > 0 {
+		// expiry is counted from request sent, in case response is delayed
+		t.Expiry = start.Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
@@ -0,0 +1,127 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// FileTokenSource reads token from file, such as mounted service account token.
+// File is watched, so rotated token is picked up without restart.
+type FileTokenSource struct {
+	path string
+
+	lock  sync.RWMutex
+	token *Token
+
+	watcher *fsnotify.Watcher
+	stop    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+var (
+	_ TokenSource = &FileTokenSource{}
+	_ Invalidator = &FileTokenSource{}
+)
+
+// NewFileTokenSource reads token from file and watches it, FileTokenSource must be closed after use.
+func NewFileTokenSource(path string) (*FileTokenSource, error) {
+	file, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileTokenSource{path: file, stop: make(chan struct{})}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// watch directory of file since file may be replaced by rename, such as kubernetes secret volume
+	if err := s.watcher.Add(filepath.Dir(file)); err != nil {
+		s.watcher.Close()
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.watch()
+	return s, nil
+}
+
+// Token returns token read from file.
+func (s *FileTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.token, nil
+}
+
+// Invalidate reads file again, in case change of file is not notified.
+func (s *FileTokenSource) Invalidate(t *Token) {
+	if err := s.load(); err != nil {
+		log.Warnf("reload token file %s fail:%v", s.path, err)
+	}
+}
+
+// Close stops watching file.
+func (s *FileTokenSource) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	s.wg.Wait()
+}
+
+func (s *FileTokenSource) load() error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	accessToken := strings.TrimSpace(string(data))
+	if accessToken == "" {
+		return fmt.Errorf("token file %s is empty", s.path)
+	}
+
+	s.lock.Lock()
+	s.token = &Token{AccessToken: accessToken}
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *FileTokenSource) watch() {
+	defer s.wg.Done()
+	defer s.watcher.Close()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			name, _ := filepath.Abs(event.Name)
+			// kubernetes updates secret volume by swapping symlink of `..data`
+			if (name == s.path || filepath.Base(name) == "..data") && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				if err := s.load(); err != nil {
+					// keep the old token, file may be written partially
+					log.Warnf("reload token file %s fail:%v", s.path, err)
+					continue
+				}
+				log.Infof("token file %s reloaded", s.path)
+			}
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warnf("watch token file %s error:%v", s.path, err)
+		}
+	}
+}
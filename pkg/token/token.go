@@ -0,0 +1,154 @@
+package token
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/wangweihong/eazycloud/pkg/errors"
+	"github.com/wangweihong/eazycloud/pkg/log"
+)
+
+// DefaultTokenType is the type of token if not set.
+const DefaultTokenType = "Bearer"
+
+// DefaultExpiryDelta is how long before expiry the token is refreshed.
+const DefaultExpiryDelta = 10 * time.Second
+
+// DefaultRefreshTimeout bounds refreshing token of CachedTokenSource.
+const DefaultRefreshTimeout = 30 * time.Second
+
+// Token is an access token.
+type Token struct {
+	AccessToken string
+	// TokenType is the type of token, DefaultTokenType if empty.
+	TokenType string
+	// Expiry is the expiration time of token, zero means never expire.
+	Expiry time.Time
+}
+
+// Type returns type of token.
+func (t *Token) Type() string {
+	if t.TokenType == "" || strings.EqualFold(t.TokenType, DefaultTokenType) {
+		return DefaultTokenType
+	}
+	return t.TokenType
+}
+
+// AuthorizationHeader returns value of `Authorization` header.
+func (t *Token) AuthorizationHeader() string {
+	return t.Type() + " " + t.AccessToken
+}
+
+// Valid returns true if token is not empty and not expired in delta.
+func (t *Token) Valid(delta time.Duration) bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry))
+}
+
+// TokenSource returns token to access protected services.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// Invalidator is implemented by TokenSource which caches token, the token rejected by server is invalidated
+// so that next Token returns a new one.
+type Invalidator interface {
+	Invalidate(t *Token)
+}
+
+// TokenSourceFunc is a function TokenSource.
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// StaticTokenSource returns the fixed token.
+func StaticTokenSource(accessToken string) TokenSource {
+	t := &Token{AccessToken: accessToken}
+	return TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return t, nil
+	})
+}
+
+// CachedTokenSource caches token of source and refreshes it expiryDelta before expiry.
+// Concurrent refreshing shares one call to source.
+type CachedTokenSource struct {
+	// RefreshTimeout bounds refreshing token, DefaultRefreshTimeout if not positive. Set it before use.
+	RefreshTimeout time.Duration
+
+	source      TokenSource
+	expiryDelta time.Duration
+
+	lock  sync.RWMutex
+	token *Token
+	group singleflight.Group
+}
+
+var (
+	_ TokenSource = &CachedTokenSource{}
+	_ Invalidator = &CachedTokenSource{}
+)
+
+// NewCachedTokenSource caches token of source, DefaultExpiryDelta is used if expiryDelta is not positive.
+func NewCachedTokenSource(source TokenSource, expiryDelta time.Duration) *CachedTokenSource {
+	if expiryDelta <= 0 {
+		expiryDelta = DefaultExpiryDelta
+	}
+	return &CachedTokenSource{source: source, expiryDelta: expiryDelta}
+}
+
+// Token returns cached token, or a new one if cached token is about to expire.
+func (s *CachedTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.lock.RLock()
+	t := s.token
+	s.lock.RUnlock()
+	if t.Valid(s.expiryDelta) {
+		return t, nil
+	}
+
+	// refreshing is shared by callers, so it must not be canceled by one of them, but must not hang forever
+	ch := s.group.DoChan("", func() (interface{}, error) {
+		timeout := s.RefreshTimeout
+		if timeout <= 0 {
+			timeout = DefaultRefreshTimeout
+		}
+		refreshCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		t, err := s.source.Token(refreshCtx)
+		if err != nil {
+			log.Errorf("refresh token fail:%v", err)
+			return nil, err
+		}
+		s.lock.Lock()
+		s.token = t
+		s.lock.Unlock()
+		return t, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, errors.UpdateStack(r.Err)
+		}
+		return r.Val.(*Token), nil
+	}
+}
+
+// Invalidate drops cached token if it is t, and invalidates it in source.
+func (s *CachedTokenSource) Invalidate(t *Token) {
+	s.lock.Lock()
+	if s.token != nil && t != nil && s.token.AccessToken == t.AccessToken {
+		s.token = nil
+	}
+	s.lock.Unlock()
+
+	if i, ok := s.source.(Invalidator); ok {
+		i.Invalidate(t)
+	}
+}
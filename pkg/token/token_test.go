@@ -0,0 +1,107 @@
+package token_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/token"
+)
+
+func TestCachedTokenSource(t *testing.T) {
+	Convey("缓存令牌", t, func() {
+		var calls int64
+		source := token.NewCachedTokenSource(token.TokenSourceFunc(func(ctx context.Context) (*token.Token, error) {
+			n := atomic.AddInt64(&calls, 1)
+			time.Sleep(20 * time.Millisecond)
+			return &token.Token{AccessToken: strconv.FormatInt(n, 10), Expiry: time.Now().Add(150 * time.Millisecond)}, nil
+		}), 100*time.Millisecond)
+
+		Convey("并发刷新只请求一次", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _ = source.Token(context.Background())
+				}()
+			}
+			wg.Wait()
+			So(atomic.LoadInt64(&calls), ShouldEqual, 1)
+
+			tok, err := source.Token(context.Background())
+			So(err, ShouldBeNil)
+			So(tok.AccessToken, ShouldEqual, "1")
+			So(tok.AuthorizationHeader(), ShouldEqual, "Bearer 1")
+		})
+
+		Convey("过期前刷新", func() {
+			tok, err := source.Token(context.Background())
+			So(err, ShouldBeNil)
+			So(tok.AccessToken, ShouldEqual, "1")
+			time.Sleep(60 * time.Millisecond)
+			tok, err = source.Token(context.Background())
+			So(err, ShouldBeNil)
+			So(tok.AccessToken, ShouldEqual, "2")
+		})
+
+		Convey("失效后重新获取", func() {
+			tok, _ := source.Token(context.Background())
+			source.Invalidate(&token.Token{AccessToken: "other"})
+			again, _ := source.Token(context.Background())
+			So(again, ShouldEqual, tok)
+
+			source.Invalidate(tok)
+			again, _ = source.Token(context.Background())
+			So(again.AccessToken, ShouldEqual, "2")
+		})
+
+		Convey("刷新超时", func() {
+			hang := token.NewCachedTokenSource(token.TokenSourceFunc(func(ctx context.Context) (*token.Token, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}), 0)
+			hang.RefreshTimeout = 50 * time.Millisecond
+
+			start := time.Now()
+			_, err := hang.Token(context.Background())
+			So(err, ShouldNotBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+	})
+}
+
+func TestFileTokenSource(t *testing.T) {
+	Convey("文件令牌", t, func() {
+		dir, err := ioutil.TempDir("", "token")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "token")
+
+		_, err = token.NewFileTokenSource(file)
+		So(err, ShouldNotBeNil)
+
+		So(ioutil.WriteFile(file, []byte("old\n"), 0o600), ShouldBeNil)
+		source, err := token.NewFileTokenSource(file)
+		So(err, ShouldBeNil)
+		defer source.Close()
+		tok, err := source.Token(context.Background())
+		So(err, ShouldBeNil)
+		So(tok.AccessToken, ShouldEqual, "old")
+
+		So(ioutil.WriteFile(file, []byte("new"), 0o600), ShouldBeNil)
+		for i := 0; i < 20 && tok.AccessToken != "new"; i++ {
+			time.Sleep(50 * time.Millisecond)
+			tok, _ = source.Token(context.Background())
+		}
+		So(tok.AccessToken, ShouldEqual, "new")
+	})
+}
@@ -0,0 +1,164 @@
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+)
+
+// TrustedProxies is a set of networks whose forwarding headers are trusted.
+// A nil TrustedProxies trusts nothing.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// NewTrustedProxies parses proxies in CIDR notation, single IP is also accepted.
+func NewTrustedProxies(proxies []string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy `%s`", p)
+			}
+			bits := net.IPv4len * 8
+			if ip.To4() == nil {
+				bits = net.IPv6len * 8
+			}
+			p = fmt.Sprintf("%s/%d", p, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy `%s`: %w", p, err)
+		}
+		t.nets = append(t.nets, ipNet)
+	}
+	return t, nil
+}
+
+// Len returns number of trusted networks.
+func (t *TrustedProxies) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.nets)
+}
+
+// String returns trusted networks in CIDR notation.
+func (t *TrustedProxies) String() string {
+	if t == nil {
+		return "[]"
+	}
+	cidrs := make([]string, 0, len(t.nets))
+	for _, n := range t.nets {
+		cidrs = append(cidrs, n.String())
+	}
+	return "[" + strings.Join(cidrs, ",") + "]"
+}
+
+// Contains reports whether ip is a trusted proxy.
+func (t *TrustedProxies) Contains(ip net.IP) bool {
+	if t == nil || ip == nil {
+		return false
+	}
+	for _, n := range t.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsAddr reports whether host of addr such as `127.0.0.1:80` is a trusted proxy.
+func (t *TrustedProxies) ContainsAddr(addr net.Addr) bool {
+	if addr == nil {
+		return false
+	}
+	return t.Contains(ParseIP(addr.String()))
+}
+
+// ClientIP resolves the real client ip of r.
+// Forwarding headers are used only when r comes from a trusted proxy, addresses of `Forwarded`
+// or `X-Forwarded-For` are walked from right to left and the first untrusted one is the client,
+// since the left ones can be forged by client. `X-Real-IP` is used when both are absent.
+func (t *TrustedProxies) ClientIP(r *http.Request) string {
+	remote := ParseIP(r.RemoteAddr)
+	if remote == nil {
+		return ""
+	}
+	if !t.Contains(remote) {
+		return remote.String()
+	}
+
+	chain := forwardedFor(r.Header)
+	if len(chain) == 0 {
+		chain = splitHeader(r.Header.Values(HeaderXForwardedFor))
+	}
+	if len(chain) == 0 {
+		if ip := ParseIP(r.Header.Get(HeaderXRealIP)); ip != nil {
+			return ip.String()
+		}
+		return remote.String()
+	}
+
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := ParseIP(chain[i])
+		// unknown or obfuscated identifier, hops beyond it can't be verified
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !t.Contains(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// ParseIP parses ip with optional port, brackets and quotes, such as `"[::1]:80"`.
+func ParseIP(s string) net.IP {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	return net.ParseIP(s)
+}
+
+// forwardedFor returns `for` parameters of RFC 7239 Forwarded header.
+func forwardedFor(h http.Header) []string {
+	var chain []string
+	for _, element := range splitHeader(h.Values(HeaderForwarded)) {
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+				chain = append(chain, kv[1])
+			}
+		}
+	}
+	return chain
+}
+
+func splitHeader(values []string) []string {
+	var items []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,213 @@
+package netutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProxyHeaderTimeout is the default timeout to read PROXY protocol header.
+const DefaultProxyHeaderTimeout = 10 * time.Second
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	proxyV1MaxLength = 107
+	proxyV2HeaderLen = 16
+)
+
+// ProxyProtocolListener accepts connections with optional PROXY protocol v1/v2 header, and replaces
+// RemoteAddr with the source address in the header.
+// Header is parsed only for connections from trusted proxies, others are served as is.
+type ProxyProtocolListener struct {
+	net.Listener
+	trusted *TrustedProxies
+	timeout time.Duration
+}
+
+// NewProxyProtocolListener wraps l with PROXY protocol support.
+func NewProxyProtocolListener(l net.Listener, trusted *TrustedProxies, timeout time.Duration) *ProxyProtocolListener {
+	if timeout <= 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+	return &ProxyProtocolListener{Listener: l, trusted: trusted, timeout: timeout}
+}
+
+// Accept doesn't read header to avoid blocking accept loop, header is read on first use of conn.
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted.ContainsAddr(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn), timeout: l.timeout}, nil
+}
+
+type proxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *proxyConn) readHeader() {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		c.err = err
+		return
+	}
+	defer func() {
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	}()
+
+	first, err := c.reader.Peek(1)
+	if err != nil {
+		c.err = err
+		return
+	}
+	switch first[0] {
+	case proxyV1Prefix[0]:
+		if prefix, err := c.reader.Peek(len(proxyV1Prefix)); err == nil && bytes.Equal(prefix, proxyV1Prefix) {
+			c.remoteAddr, c.localAddr, c.err = readProxyV1(c.reader)
+		}
+	case proxyV2Signature[0]:
+		if sig, err := c.reader.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(sig, proxyV2Signature) {
+			c.remoteAddr, c.localAddr, c.err = readProxyV2(c.reader)
+		}
+	}
+	if c.err != nil {
+		c.err = fmt.Errorf("invalid proxy protocol header: %w", c.err)
+	}
+}
+
+// readProxyV1 reads header like `PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n`.
+func readProxyV1(r *bufio.Reader) (src, dst net.Addr, err error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("v1 header too long")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("malformed v1 header `%s`", strings.TrimSpace(string(line)))
+	}
+	if src, err = parseTCPAddr(fields[2], fields[4]); err != nil {
+		return nil, nil, err
+	}
+	if dst, err = parseTCPAddr(fields[3], fields[5]); err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseTCPAddr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address `%s`", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port `%s`", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readProxyV2 reads binary header, only PROXY command of TCP/UDP over IPv4/IPv6 changes addresses.
+func readProxyV2(r *bufio.Reader) (src, dst net.Addr, err error) {
+	header := make([]byte, proxyV2HeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if version := header[12] >> 4; version != 2 {
+		return nil, nil, fmt.Errorf("unsupported version %d", version)
+	}
+	command := header[12] & 0x0f
+	family := header[13] >> 4
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0: // LOCAL, connection established by proxy itself
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("unsupported command %d", command)
+	}
+
+	var ipLen int
+	switch family {
+	case 0x1:
+		ipLen = net.IPv4len
+	case 0x2:
+		ipLen = net.IPv6len
+	default:
+		// AF_UNSPEC or AF_UNIX, keep original addresses
+		return nil, nil, nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, fmt.Errorf("v2 address block too short")
+	}
+	src = &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	dst = &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+	return src, dst, nil
+}
@@ -0,0 +1,90 @@
+package netutil_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/wangweihong/eazycloud/pkg/util/netutil"
+)
+
+// dial sends header and payload, returns remote address and data seen by server.
+func dial(ln net.Listener, header []byte) (string, string, error) {
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write(append(header, []byte("hello\n")...))
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		return "", "", err
+	}
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	return conn.RemoteAddr().String(), line, err
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	Convey("PROXY协议", t, func() {
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer inner.Close()
+
+		trusted, err := netutil.NewTrustedProxies([]string{"127.0.0.1"})
+		So(err, ShouldBeNil)
+		ln := netutil.NewProxyProtocolListener(inner, trusted, 0)
+
+		Convey("v1", func() {
+			remote, data, err := dial(ln, []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"))
+			So(err, ShouldBeNil)
+			So(remote, ShouldEqual, "192.168.0.1:56324")
+			So(data, ShouldEqual, "hello\n")
+
+			remote, _, err = dial(ln, []byte("PROXY UNKNOWN\r\n"))
+			So(err, ShouldBeNil)
+			So(remote, ShouldStartWith, "127.0.0.1:")
+
+			_, _, err = dial(ln, []byte("PROXY TCP4 bad\r\n"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("v2", func() {
+			header := []byte("\r\n\r\n\x00\r\nQUIT\n")
+			header = append(header, 0x21, 0x21) // version 2 PROXY, TCP over IPv6
+			payload := append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...)
+			payload = append(payload, 0, 0, 0, 0)
+			binary.BigEndian.PutUint16(payload[32:], 4711)
+			binary.BigEndian.PutUint16(payload[34:], 443)
+			header = append(header, 0, byte(len(payload)))
+			header = append(header, payload...)
+
+			remote, data, err := dial(ln, header)
+			So(err, ShouldBeNil)
+			So(remote, ShouldEqual, "[2001:db8::1]:4711")
+			So(data, ShouldEqual, "hello\n")
+		})
+
+		Convey("无PROXY头直接透传", func() {
+			remote, data, err := dial(ln, nil)
+			So(err, ShouldBeNil)
+			So(remote, ShouldStartWith, "127.0.0.1:")
+			So(data, ShouldEqual, "hello\n")
+		})
+
+		Convey("非受信任来源不解析", func() {
+			untrusted, err := netutil.NewTrustedProxies([]string{"10.0.0.0/8"})
+			So(err, ShouldBeNil)
+			ln := netutil.NewProxyProtocolListener(inner, untrusted, 0)
+			_, data, err := dial(ln, []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"))
+			So(err, ShouldBeNil)
+			So(data, ShouldStartWith, "PROXY")
+		})
+	})
+}